@@ -0,0 +1,61 @@
+package argparse
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Action is a subcommand of an operation, named by the operation's first
+// argument. What it does is up to the operation.
+type Action interface {
+	// Usage gives the arguments following the action's name, if any
+	Usage() string
+	// Description tells what the action does
+	Description() string
+}
+
+// Actions are the subcommands of an operation by name.
+type Actions map[string]Action
+
+// Names gives the names of all actions in alphabetical order.
+func (a Actions) Names() []string {
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Arg is the argument naming the action.
+func (a Actions) Arg() Arg {
+	return Arg{
+		Name:        "<action>",
+		Description: "What to do: " + strings.Join(a.Names(), ", "),
+	}
+}
+
+// Help lists the actions with their usage and description, to be shown in
+// the help footer.
+func (a Actions) Help() string {
+	var lines []string
+	for _, name := range a.Names() {
+		act := a[name]
+		lines = append(lines, "    "+strings.TrimSpace(name+" "+act.Usage())+"\n        "+act.Description())
+	}
+	return "Actions\n" + strings.Join(lines, "\n")
+}
+
+// Choose gives the action named by the first of the arguments.
+func (a Actions) Choose(args []string) (Action, error) {
+	if len(args) == 0 {
+		return nil, errors.New("Require an action")
+	}
+	act, ok := a[args[0]]
+	if !ok {
+		return nil, errors.Errorf("No such action: %s", args[0])
+	}
+	return act, nil
+}
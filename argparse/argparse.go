@@ -14,6 +14,8 @@ const (
 	ParamIdentifierPrefix = ":"
 	// TODO: Should it be a public constant here? Other options? Package-private?
 	AllTasks string = ParamIdentifierPrefix + "all"
+	// Marks arguments tagging an entry, as in +billable, where accepted
+	TagShorthandPrefix = "+"
 )
 
 type numTasks int
@@ -22,10 +24,14 @@ const (
 	noTasks      numTasks = 0
 	oneTask      numTasks = 1
 	severalTasks numTasks = 2
+	optionalTask numTasks = 3
+	splitTask    numTasks = 4
 )
 
 type taskHandler interface {
 	handleTasks(cmd *msg.Cmd, args []string) ([]string, error)
+	// Check the tasks of a command received from elsewhere.
+	validateTasks(tasks []string) error
 	description() string
 	numberOfTasks() numTasks
 }
@@ -36,6 +42,13 @@ func (h noTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, error
 	return args, nil
 }
 
+func (h noTaskHandler) validateTasks(tasks []string) error {
+	if len(tasks) > 0 {
+		return errors.Errorf("Takes no task but got %v", tasks)
+	}
+	return nil
+}
+
 func (h noTaskHandler) description() string {
 	return ""
 }
@@ -64,6 +77,15 @@ func (h singleTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, e
 	return args[1:], nil
 }
 
+func (h singleTaskHandler) validateTasks(tasks []string) error {
+	if len(tasks) != 1 {
+		return errors.Errorf("Require single task but got %d", len(tasks))
+	} else if tasks[0] == AllTasks || !validSingleName(tasks[0]) {
+		return errors.Errorf("Invalid task name: %s", tasks[0])
+	}
+	return nil
+}
+
 func (h singleTaskHandler) description() string {
 	return "[task]"
 }
@@ -72,6 +94,78 @@ func (h singleTaskHandler) numberOfTasks() numTasks {
 	return oneTask
 }
 
+// Like singleTaskHandler, except that the task may be omitted.
+type optionalTaskHandler struct{}
+
+func (h optionalTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, error) {
+	if len(args) == 0 || isParamIdentifier(args[0]) {
+		return args, nil
+	}
+	return singleTaskHandler{}.handleTasks(cmd, args)
+}
+
+func (h optionalTaskHandler) validateTasks(tasks []string) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	return singleTaskHandler{}.validateTasks(tasks)
+}
+
+func (h optionalTaskHandler) description() string {
+	return "[task]"
+}
+
+func (h optionalTaskHandler) numberOfTasks() numTasks {
+	return optionalTask
+}
+
+// Like optionalTaskHandler, except that several tasks may be given, each as
+// task:weight, to split time between them.
+type splitTaskHandler struct{}
+
+func (h splitTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, error) {
+	n := 0
+	for n < len(args) && !isParamIdentifier(args[n]) && !IsTagShorthand(args[n]) {
+		n++
+	}
+	if n == 0 {
+		return args, nil
+	} else if n == 1 {
+		return singleTaskHandler{}.handleTasks(cmd, args)
+	}
+	for _, spec := range args[:n] {
+		if alloc, err := msg.ParseAllocation(spec); err != nil {
+			return args, err
+		} else if !validTaskName(alloc.Task) || strings.Contains(alloc.Task, ",") {
+			return args, errors.Errorf("Invalid task name: %s", alloc.Task)
+		}
+	}
+	cmd.TaskNames = args[:n]
+	return args[n:], nil
+}
+
+func (h splitTaskHandler) validateTasks(tasks []string) error {
+	if len(tasks) <= 1 {
+		return optionalTaskHandler{}.validateTasks(tasks)
+	}
+	for _, spec := range tasks {
+		if alloc, err := msg.ParseAllocation(spec); err != nil {
+			return err
+		} else if !validSingleName(alloc.Task) {
+			return errors.Errorf("Invalid task name: %s", alloc.Task)
+		}
+	}
+	return nil
+}
+
+func (h splitTaskHandler) description() string {
+	return "[task]"
+}
+
+func (h splitTaskHandler) numberOfTasks() numTasks {
+	return splitTask
+}
+
 type multiTaskHandler struct{}
 
 func (h multiTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, error) {
@@ -95,6 +189,22 @@ func (h multiTaskHandler) handleTasks(cmd *msg.Cmd, args []string) ([]string, er
 	return args[1:], nil
 }
 
+func (h multiTaskHandler) validateTasks(tasks []string) error {
+	if len(tasks) == 0 {
+		return errors.New("Require one or more tasks but none is given")
+	}
+	for _, task := range tasks {
+		if task == AllTasks {
+			if len(tasks) > 1 {
+				return errors.New("When given, '" + AllTasks + "' must be the only task")
+			}
+		} else if !validSingleName(task) {
+			return errors.Errorf("Invalid task name: %s", task)
+		}
+	}
+	return nil
+}
+
 func (h multiTaskHandler) description() string {
 	return "[task,..]"
 }
@@ -113,12 +223,25 @@ type ArgHandler interface {
 	DescribeParameters() []ParamDescription
 }
 
+// Implemented by argument handlers able to check the arguments of a command
+// received from elsewhere.
+type argValidator interface {
+	validateArgs(cmd msg.Cmd) error
+}
+
 type noArgHandler struct{}
 
 func (h noArgHandler) HandleArgs(cmd *msg.Cmd, args []string) ([]string, error) {
 	return args, nil
 }
 
+func (h noArgHandler) validateArgs(cmd msg.Cmd) error {
+	if len(cmd.Args) > 0 || len(cmd.Flags) > 0 || len(cmd.Opts) > 0 || len(cmd.Quantities) > 0 {
+		return errors.New("Takes no arguments or parameters")
+	}
+	return nil
+}
+
 func (h noArgHandler) TakesParameters() bool {
 	return false
 }
@@ -159,6 +282,10 @@ func (p *Parser) TaskDescription() string {
 		return p.taskHandler.description() + "  A single task name"
 	case severalTasks:
 		return p.taskHandler.description() + "  One or more task names, separated by comma; :all to select all tasks"
+	case splitTask:
+		return p.taskHandler.description() + "  A single task name, may be omitted; several as task:weight to split time between them"
+	case optionalTask:
+		return p.taskHandler.description() + "  A single task name, may be omitted"
 	default:
 		panic("Invalid number of tasks for task handler")
 	}
@@ -170,7 +297,9 @@ func (p *Parser) ParamDescription() []ParamDescription {
 
 func (p *Parser) Describe(what string) Description {
 	paramDescription := ""
-	if p.argHandler.TakesParameters() {
+	if u, ok := p.argHandler.(usageDescriber); ok {
+		paramDescription = u.describeUsage()
+	} else if p.argHandler.TakesParameters() {
 		paramDescription = "[parameters]"
 	}
 	return Description{p.command, p.taskHandler.description(), paramDescription, what}
@@ -186,6 +315,16 @@ func (p *Parser) WithSingleTask() *Parser {
 	return p
 }
 
+func (p *Parser) WithOptionalTask() *Parser {
+	p.taskHandler = new(optionalTaskHandler)
+	return p
+}
+
+func (p *Parser) WithSplitTask() *Parser {
+	p.taskHandler = new(splitTaskHandler)
+	return p
+}
+
 func (p *Parser) WithMultipleTasks() *Parser {
 	p.taskHandler = new(multiTaskHandler)
 	return p
@@ -223,6 +362,23 @@ func (p *Parser) Parse(args []string) (msg.Cmd, error) {
 	}
 }
 
+// Validate checks a command received from elsewhere, e.g. by the server,
+// against what the parser would produce. Commands passing validation can be
+// executed without further checks of their tasks, parameters, and number of
+// arguments.
+func (p *Parser) Validate(cmd msg.Cmd) error {
+	if cmd.Op != p.command {
+		return errors.Errorf("Expected command %s but got %s", p.command, cmd.Op)
+	}
+	if err := p.taskHandler.validateTasks(cmd.TaskNames); err != nil {
+		return err
+	}
+	if v, ok := p.argHandler.(argValidator); ok {
+		return v.validateArgs(cmd)
+	}
+	return nil
+}
+
 // Warn the user about arguments being unevaluated.
 // If args is empty, no warning is issued.
 func WarnUnused(args []string) {
@@ -246,6 +402,23 @@ func GetTaskNames(taskField string) ([]string, error) {
 	return tasks, nil
 }
 
+// GetTagNames splits a comma-separated list of tags, checking each.
+func GetTagNames(tagField string) ([]string, error) {
+	tags := strings.Split(tagField, ",")
+	for _, tag := range tags {
+		if !validTaskName(tag) || tag == "" {
+			return nil, errors.Errorf("Invalid tag: %s", tag)
+		}
+	}
+	return tags, nil
+}
+
+// IsTagShorthand determines whether the argument tags an entry, as in
+// +billable, rather than naming a task.
+func IsTagShorthand(arg string) bool {
+	return strings.HasPrefix(arg, TagShorthandPrefix)
+}
+
 // Whether the given name is valid for a task.
 func validTaskName(name string) bool {
 	if isParamIdentifier(name) {
@@ -256,6 +429,11 @@ func validTaskName(name string) bool {
 	return true
 }
 
+// Whether the given name is valid for a single task, as opposed to a list.
+func validSingleName(name string) bool {
+	return name != "" && validTaskName(name) && !strings.Contains(name, ",")
+}
+
 func stripKeyword(raw string) string {
 	return strings.TrimLeft(raw, ":")
 }
@@ -276,19 +454,56 @@ type Quantifier interface {
 type Param struct {
 	Name        string
 	RequiresArg bool
-	Quantifier  Quantifier
+	Quantifier  Quantifier // Without quantifier, the parameter is a flag or option
 	Description string
+	Values      string // Description of possible values of an option
+}
+
+// Flag describes a parameter which is either given or not.
+func Flag(name string, description string) Param {
+	return Param{Name: name, RequiresArg: false, Description: description}
+}
+
+// Option describes a parameter with a single value, taken as is.
+func Option(name string, values string, description string) Param {
+	return Param{Name: name, RequiresArg: true, Description: description, Values: values}
 }
 
 func (p Param) Describe() ParamDescription {
+	values := p.Values
+	if p.Quantifier != nil {
+		values = p.Quantifier.DescribeUsage()
+	}
 	return ParamDescription{
 		ParamName:        ParamIdentifierPrefix + p.Name,
-		ParamValues:      p.Quantifier.DescribeUsage(),
+		ParamValues:      values,
 		ParamExplanation: p.Description,
 	}
 }
 
+// Arg describes a positional argument.
+type Arg struct {
+	Name        string // How the argument is shown in usage information
+	Description string // What the argument is used for
+	Optional    bool   // Whether the argument may be omitted
+	Many        bool   // Whether the argument takes up all remaining positions
+}
+
+func (a Arg) Describe() ParamDescription {
+	return ParamDescription{
+		ParamName:        "",
+		ParamValues:      a.Name,
+		ParamExplanation: a.Description,
+	}
+}
+
+// Implemented by argument handlers providing their own usage summary.
+type usageDescriber interface {
+	describeUsage() string
+}
+
 type paramHandler struct {
+	args   []Arg
 	params map[string]Param
 }
 
@@ -303,7 +518,7 @@ func (p paramHandler) HandleArgs(cmd *msg.Cmd, args []string) ([]string, error)
 				if param.RequiresArg {
 					if strings.Contains(arg, "=") {
 						// Quantity contained in argument.
-						pArg = strings.Split(arg, "=")[1]
+						pArg = strings.SplitN(arg, "=", 2)[1]
 					} else {
 						// Quantity in next argument.
 						i++
@@ -315,6 +530,10 @@ func (p paramHandler) HandleArgs(cmd *msg.Cmd, args []string) ([]string, error)
 				} else {
 					// If no arg is required, we can pass the empty string.
 				}
+				if param.Quantifier == nil {
+					setFlagOrOption(cmd, param, pArg)
+					continue
+				}
 				// Parse and add to list.
 				q, err := param.Quantifier.Parse(pArg)
 				if err != nil {
@@ -327,11 +546,80 @@ func (p paramHandler) HandleArgs(cmd *msg.Cmd, args []string) ([]string, error)
 		}
 	}
 	cmd.Quantities = quant
-	return unused, nil
+	return p.assignPositional(cmd, unused)
+}
+
+func (p paramHandler) validateArgs(cmd msg.Cmd) error {
+	for name := range cmd.Flags {
+		if param, ok := p.params[name]; !ok || param.RequiresArg || param.Quantifier != nil {
+			return errors.Errorf("Unknown flag: %s", name)
+		}
+	}
+	for name := range cmd.Opts {
+		if param, ok := p.params[name]; !ok || !param.RequiresArg || param.Quantifier != nil {
+			return errors.Errorf("Unknown option: %s", name)
+		}
+	}
+	if len(cmd.Quantities) > 0 {
+		quantified := false
+		for _, param := range p.params {
+			quantified = quantified || param.Quantifier != nil
+		}
+		if !quantified {
+			return errors.New("Takes no quantities")
+		}
+	}
+
+	many := false
+	for i, arg := range p.args {
+		many = many || arg.Many
+		if i >= len(cmd.Args) && !arg.Optional {
+			return errors.New("Missing argument: " + arg.Name)
+		}
+	}
+	if !many && len(cmd.Args) > len(p.args) {
+		return errors.Errorf("Expected at most %d arguments but got %d", len(p.args), len(cmd.Args))
+	}
+	return nil
+}
+
+// Set a flag or option in the command.
+func setFlagOrOption(cmd *msg.Cmd, param Param, value string) {
+	if param.RequiresArg {
+		if cmd.Opts == nil {
+			cmd.Opts = make(map[string]string)
+		}
+		cmd.Opts[param.Name] = value
+	} else {
+		if cmd.Flags == nil {
+			cmd.Flags = make(map[string]bool)
+		}
+		cmd.Flags[param.Name] = true
+	}
+}
+
+// Assign positional arguments in order. Returns those left over.
+func (p paramHandler) assignPositional(cmd *msg.Cmd, args []string) ([]string, error) {
+	for _, arg := range p.args {
+		if len(args) == 0 {
+			if !arg.Optional {
+				return args, errors.New("Missing argument: " + arg.Name)
+			}
+			break
+		}
+		if arg.Many {
+			cmd.Args = append(cmd.Args, args...)
+			args = nil
+		} else {
+			cmd.Args = append(cmd.Args, args[0])
+			args = args[1:]
+		}
+	}
+	return args, nil
 }
 
 func (h paramHandler) TakesParameters() bool {
-	return len(h.params) > 0
+	return len(h.params) > 0 || len(h.args) > 0
 }
 
 func (h paramHandler) DescribeParameters() []ParamDescription {
@@ -345,10 +633,31 @@ func (h paramHandler) DescribeParameters() []ParamDescription {
 		return descriptions[i].ParamName < descriptions[j].ParamName
 	}
 	sort.Slice(descriptions, byName)
-	return descriptions
+	var argDescriptions []ParamDescription
+	for _, arg := range h.args {
+		argDescriptions = append(argDescriptions, arg.Describe())
+	}
+	return append(argDescriptions, descriptions...)
+}
+
+func (h paramHandler) describeUsage() string {
+	var words []string
+	for _, arg := range h.args {
+		words = append(words, arg.Name)
+	}
+	if len(h.params) > 0 {
+		words = append(words, "[parameters]")
+	}
+	return strings.Join(words, " ")
 }
 
 func HandlerForParams(params []Param) ArgHandler {
+	return HandlerForArgsAndParams(nil, params)
+}
+
+// HandlerForArgsAndParams creates a handler for positional arguments,
+// followed by parameters.
+func HandlerForArgsAndParams(args []Arg, params []Param) ArgHandler {
 	pmap := make(map[string]Param)
 	for _, param := range params {
 		if _, ok := pmap[param.Name]; ok {
@@ -357,7 +666,7 @@ func HandlerForParams(params []Param) ArgHandler {
 		pmap[param.Name] = param
 	}
 
-	return paramHandler{params: pmap}
+	return paramHandler{args: args, params: pmap}
 }
 
 func isParamIdentifier(str string) bool {
@@ -367,3 +676,50 @@ func isParamIdentifier(str string) bool {
 func cleanParam(str string) string {
 	return strings.TrimLeft(strings.Split(str, "=")[0], ParamIdentifierPrefix)
 }
+
+// SplitLine splits a command line into arguments the way a shell would,
+// respecting single and double quotes as well as backslash escapes.
+func SplitLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case strings.ContainsRune(" \t\n", r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return args, errors.Errorf("Unterminated quote: %c", quote)
+	} else if escaped {
+		return args, errors.New("Line ends in an escape character")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,173 @@
+package argparse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+func TestSplitLine(t *testing.T) {
+	cases := map[string][]string{
+		"":                            nil,
+		"   ":                         nil,
+		"start foo":                   {"start", "foo"},
+		"  query  foo,bar   :today  ": {"query", "foo,bar", ":today"},
+		`note "stand-up ran long"`:    {"note", "stand-up ran long"},
+		`note 'it''s'`:                {"note", "its"},
+		`note it\'s`:                  {"note", "it's"},
+		`note "say \"hi\""`:           {"note", `say "hi"`},
+		`stop :note="fixed it"`:       {"stop", ":note=fixed it"},
+		`empty ""`:                    {"empty", ""},
+	}
+	for line, expected := range cases {
+		args, err := SplitLine(line)
+		if err != nil {
+			t.Errorf("Failed to split %q: %v", line, err)
+		} else if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Splitting %q gave %q, expected %q", line, args, expected)
+		}
+	}
+}
+
+func TestSplitLineUnterminated(t *testing.T) {
+	for _, line := range []string{`note "open`, "note 'open", `note \`} {
+		if _, err := SplitLine(line); err == nil {
+			t.Errorf("Expected an error splitting %q", line)
+		}
+	}
+}
+
+func TestFlagsOptionsAndArgs(t *testing.T) {
+	args := []Arg{
+		Arg{Name: "<first>"},
+		Arg{Name: "<rest>", Optional: true, Many: true},
+	}
+	params := []Param{
+		Flag("force", "Force it"),
+		Option("note", "TEXT", "A note"),
+	}
+	p := CommandParser("test").WithoutTask().WithArgHandler(HandlerForArgsAndParams(args, params))
+
+	cmd, err := p.Parse([]string{"one", ":force", ":note=a=b", "two", "three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmd.Flags["force"] {
+		t.Error("Flag not set")
+	}
+	if note := cmd.Opts["note"]; note != "a=b" {
+		t.Errorf("Option not set correctly: %q", note)
+	}
+	if expected := []string{"one", "two", "three"}; !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("Positional arguments %q, expected %q", cmd.Args, expected)
+	}
+
+	cmd, err = p.Parse([]string{":note", "separate"})
+	if err == nil {
+		t.Error("Missing argument not detected")
+	}
+	cmd, err = p.Parse([]string{"only"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Flags["force"] || len(cmd.Args) != 1 {
+		t.Errorf("Unexpected result: %v", cmd)
+	}
+}
+
+func TestOptionalTask(t *testing.T) {
+	parser := CommandParser("stop").WithOptionalTask().WithoutParams()
+	if cmd, err := parser.Parse(nil); err != nil {
+		t.Error(err)
+	} else if len(cmd.TaskNames) != 0 {
+		t.Errorf("Expected no task, got %v", cmd.TaskNames)
+	}
+	if cmd, err := parser.Parse([]string{"foo"}); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(cmd.TaskNames, []string{"foo"}) {
+		t.Errorf("Expected task foo, got %v", cmd.TaskNames)
+	}
+	if _, err := parser.Parse([]string{"foo,bar"}); err == nil {
+		t.Error("Expected error for several tasks")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	args := []Arg{Arg{Name: "<what>"}}
+	params := []Param{Flag("force", "Force it"), Option("note", "TEXT", "A note")}
+	parser := CommandParser("test").WithSingleTask().WithArgHandler(HandlerForArgsAndParams(args, params))
+
+	valid := msg.Cmd{Op: "test", TaskNames: []string{"foo"}, Args: []string{"x"}, Flags: map[string]bool{"force": true}}
+	if err := parser.Validate(valid); err != nil {
+		t.Error(err)
+	}
+	invalid := map[string]msg.Cmd{
+		"no task":       msg.Cmd{Op: "test", Args: []string{"x"}},
+		"all tasks":     msg.Cmd{Op: "test", TaskNames: []string{AllTasks}, Args: []string{"x"}},
+		"missing arg":   msg.Cmd{Op: "test", TaskNames: []string{"foo"}},
+		"extra arg":     msg.Cmd{Op: "test", TaskNames: []string{"foo"}, Args: []string{"x", "y"}},
+		"unknown flag":  msg.Cmd{Op: "test", TaskNames: []string{"foo"}, Args: []string{"x"}, Flags: map[string]bool{"bar": true}},
+		"flag as opt":   msg.Cmd{Op: "test", TaskNames: []string{"foo"}, Args: []string{"x"}, Opts: map[string]string{"force": "1"}},
+		"other command": msg.Cmd{Op: "other", TaskNames: []string{"foo"}, Args: []string{"x"}},
+	}
+	for name, cmd := range invalid {
+		if err := parser.Validate(cmd); err == nil {
+			t.Errorf("Expected validation error for %s", name)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	args := []Arg{Arg{Name: "<id>", Description: "The ID"}}
+	params := []Param{
+		Option("note", "TEXT", "A note"),
+		Flag("force", "Force it"),
+	}
+	spec := CommandParser("test").WithSingleTask().
+		WithArgHandler(HandlerForArgsAndParams(args, params)).Spec("Test things")
+	expected := Spec{
+		Command: "test",
+		Summary: "Test things",
+		Tasks:   "single",
+		Args:    []ArgSpec{{Name: "<id>", Description: "The ID"}},
+		Params: []ParamSpec{
+			{Name: ":force", Kind: ParamFlag, Description: "Force it"},
+			{Name: ":note", Kind: ParamOption, Values: "TEXT", Description: "A note"},
+		},
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Got spec %+v, expected %+v", spec, expected)
+	}
+}
+
+type testAction string
+
+func (a testAction) Usage() string {
+	return string(a)
+}
+
+func (a testAction) Description() string {
+	return "Does things"
+}
+
+func TestActions(t *testing.T) {
+	actions := Actions{"list": testAction(""), "add": testAction("<name>")}
+	if names := actions.Names(); !reflect.DeepEqual(names, []string{"add", "list"}) {
+		t.Errorf("Unexpected action names: %v", names)
+	}
+	expected := "Actions\n    add <name>\n        Does things\n    list\n        Does things"
+	if help := actions.Help(); help != expected {
+		t.Errorf("Got help %q, expected %q", help, expected)
+	}
+	if act, err := actions.Choose([]string{"add", "x"}); err != nil {
+		t.Error(err)
+	} else if act != testAction("<name>") {
+		t.Errorf("Chose the wrong action: %v", act)
+	}
+	for _, args := range [][]string{nil, {"remove"}} {
+		if _, err := actions.Choose(args); err == nil {
+			t.Errorf("Expected error choosing an action from %q", args)
+		}
+	}
+}
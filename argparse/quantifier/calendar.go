@@ -0,0 +1,383 @@
+package quantifier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	arg "github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+const (
+	TimeFiscalYear = "fiscal-year"
+	TimePeriod     = "period"
+	// Separates first and last day in the definition of a named period.
+	periodSeparator = ".."
+)
+
+// Calendar holds user settings affecting how periods are determined.
+type Calendar struct {
+	fyMonth  time.Month           // Month in which the fiscal year starts
+	fyDay    int                  // Day of the month on which the fiscal year starts
+	periods  map[string][2]string // Named periods with first and last day
+	workdays [7]bool              // Whether a day of the week is a working day
+	holidays map[string]string    // Names of holidays by date
+	daysOff  map[string]string    // Kinds of days off, e.g. vacation, by date
+	expected [7]time.Duration     // Expected working time by day of the week
+	dayStart time.Duration        // Time of day at which days start, after midnight
+}
+
+// DefaultCalendar has fiscal years coincide with calendar years, working
+// days from Monday through Friday, no holidays, and no named periods.
+func DefaultCalendar() *Calendar {
+	c := Calendar{fyMonth: time.January, fyDay: 1}
+	c.periods = make(map[string][2]string)
+	c.holidays = make(map[string]string)
+	c.daysOff = make(map[string]string)
+	for d := time.Monday; d <= time.Friday; d++ {
+		c.workdays[d] = true
+		c.expected[d] = 8 * time.Hour
+	}
+	return &c
+}
+
+// Configure adjusts the calendar to the given configuration.
+func (c *Calendar) Configure(conf *config.Opts) error {
+	if err := c.SetFiscalYearStart(conf.FiscalYearStart.Value); err != nil {
+		return err
+	}
+	if err := c.SetDayStart(conf.DayStart.Value); err != nil {
+		return err
+	}
+	if err := c.SetWorkingDays(conf.WorkingDays.Value); err != nil {
+		return err
+	}
+	if err := c.SetHolidays(conf.Section(config.SectionHolidays)); err != nil {
+		return err
+	}
+	if err := c.SetExpectedHours(conf.ExpectedHours.Value, conf.Section(config.SectionWeekdayHours)); err != nil {
+		return err
+	}
+	return c.SetPeriods(conf.Section(config.SectionPeriods))
+}
+
+// SetWorkingDays sets the days of the week on which work is expected, given
+// as a comma-separated list of abbreviated names, e.g. mon,tue,wed.
+func (c *Calendar) SetWorkingDays(days string) error {
+	var workdays [7]bool
+	for _, name := range strings.Split(days, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		d, err := parseWeekday(name)
+		if err != nil {
+			return err
+		}
+		workdays[d] = true
+	}
+	c.workdays = workdays
+	return nil
+}
+
+// WeeklyWorkingDays gives the number of working days in a week without
+// holidays or days off.
+func (c *Calendar) WeeklyWorkingDays() int {
+	n := 0
+	for _, working := range c.workdays {
+		if working {
+			n++
+		}
+	}
+	return n
+}
+
+// SetExpectedHours sets the working time expected on each working day, as
+// well as deviations for specific days of the week, given by name. Must be
+// called after the working days are set.
+func (c *Calendar) SetExpectedHours(daily string, byWeekday map[string]string) error {
+	perDay, err := time.ParseDuration(daily)
+	if err != nil {
+		return errors.Errorf("Not a duration of expected working time: %s", daily)
+	}
+	var expected [7]time.Duration
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if c.workdays[d] {
+			expected[d] = perDay
+		}
+	}
+	for name, hours := range byWeekday {
+		d, err := parseWeekday(name)
+		if err != nil {
+			return err
+		}
+		if expected[d], err = time.ParseDuration(hours); err != nil {
+			return errors.Errorf("Not a duration of expected working time on %s: %s", name, hours)
+		}
+	}
+	c.expected = expected
+	return nil
+}
+
+// ExpectedHours gives the working time expected on the day containing t.
+// Nothing is expected on holidays or days off.
+func (c *Calendar) ExpectedHours(t time.Time) time.Duration {
+	if c.isFree(t) {
+		return 0
+	}
+	return c.expected[t.Weekday()]
+}
+
+// Parse the (possibly abbreviated) name of a day of the week.
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) >= 2 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.HasPrefix(strings.ToLower(d.String()), name) {
+				return d, nil
+			}
+		}
+	}
+	return time.Sunday, errors.Errorf("Not a day of the week: %s", name)
+}
+
+// SetHolidays defines holidays, given as names by date (YYYY-MM-DD).
+// Any prior definitions are discarded.
+func (c *Calendar) SetHolidays(definitions map[string]string) error {
+	holidays := make(map[string]string)
+	for date, name := range definitions {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return errors.Errorf("Holiday %s not given as YYYY-MM-DD: %s", name, date)
+		}
+		holidays[date] = name
+	}
+	c.holidays = holidays
+	return nil
+}
+
+// AddDaysOff marks the given days as off, in addition to prior ones.
+func (c *Calendar) AddDaysOff(days []msg.DayOff) {
+	for _, d := range days {
+		c.daysOff[d.Date] = d.Kind
+	}
+}
+
+// IsWorkingDay determines whether t falls on a working day which is
+// neither a holiday nor a day off.
+func (c *Calendar) IsWorkingDay(t time.Time) bool {
+	if c.isFree(t) {
+		return false
+	}
+	return c.workdays[t.Weekday()]
+}
+
+// Whether t falls on a holiday or a day off.
+func (c *Calendar) isFree(t time.Time) bool {
+	date := isoDate(t)
+	_, holiday := c.holidays[date]
+	_, off := c.daysOff[date]
+	return holiday || off
+}
+
+// Holiday gives the name of the holiday on t, if any.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[isoDate(t)]
+	return name, ok
+}
+
+// DayOff gives the kind of day off on t, if any.
+func (c *Calendar) DayOff(t time.Time) (string, bool) {
+	kind, ok := c.daysOff[isoDate(t)]
+	return kind, ok
+}
+
+// WorkingDays counts the working days within the span.
+func (c *Calendar) WorkingDays(span Span) int {
+	n := 0
+	end := span.End.Add(-c.dayStart)
+	for day := dayStart(span.Start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(day) {
+			n++
+		}
+	}
+	return n
+}
+
+// SetPeriods defines named periods, given as YYYY-MM-DD..YYYY-MM-DD by name.
+// Any prior definitions are discarded.
+func (c *Calendar) SetPeriods(definitions map[string]string) error {
+	periods := make(map[string][2]string)
+	for name, def := range definitions {
+		days := strings.Split(def, periodSeparator)
+		if len(days) != 2 {
+			return errors.Errorf("Period %s not of the form YYYY-MM-DD..YYYY-MM-DD: %s", name, def)
+		}
+		first, last := strings.TrimSpace(days[0]), strings.TrimSpace(days[1])
+		start, end, err := parseDateRange([]string{first, last})
+		if err != nil {
+			return errors.Wrapf(err, "Invalid period %s", name)
+		} else if !start.Before(end) {
+			return errors.Errorf("Period %s ends before it starts: %s", name, def)
+		}
+		periods[name] = [2]string{first, last}
+	}
+	c.periods = periods
+	return nil
+}
+
+// SetDayStart sets the time of day, given as HH:MM, at which days start. For
+// night owls, a day may continue past midnight, e.g. until 04:00.
+func (c *Calendar) SetDayStart(hhmm string) error {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return errors.Errorf("Not a valid start of the day: %s", hhmm)
+	}
+	c.dayStart = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return nil
+}
+
+// Today gives a time on the day containing now, taking into account when
+// days start. Before the start of the day, this is on the previous date.
+func (c *Calendar) Today(now time.Time) time.Time {
+	if now.Before(c.shift(dayStart(now))) {
+		return now.AddDate(0, 0, -1)
+	}
+	return now
+}
+
+// Move a time at midnight to the start of the day.
+func (c *Calendar) shift(midnight time.Time) time.Time {
+	h, m := int(c.dayStart/time.Hour), int(c.dayStart%time.Hour/time.Minute)
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(), h, m, 0, 0, midnight.Location())
+}
+
+// Move a span from midnight to midnight to the start of the day.
+func (c *Calendar) shiftSpan(span Span) Span {
+	span.Start, span.End = c.shift(span.Start), c.shift(span.End)
+	return span
+}
+
+// Period determines the stretch of time described by a quantity, see
+// Period, with days starting as set for the calendar.
+func (c *Calendar) Period(q msg.Quantity) (Span, error) {
+	span, err := Period(q)
+	return c.shiftSpan(span), err
+}
+
+// Breakdown splits a span of the calendar into consecutive spans of the given
+// unit, see Breakdown.
+func (c *Calendar) Breakdown(whole Span, unit string) ([]Span, error) {
+	spans, err := Breakdown(Span{Label: whole.Label, Start: dayStart(whole.Start), End: dayStart(whole.End)}, unit)
+	for i := range spans {
+		spans[i] = c.shiftSpan(spans[i])
+	}
+	return spans, err
+}
+
+// Day gives the span of the day containing t, see Day.
+func (c *Calendar) Day(t time.Time) Span {
+	return c.shiftSpan(Day(c.Today(t)))
+}
+
+// Week gives the span of the week containing t, see Week.
+func (c *Calendar) Week(t time.Time) Span {
+	return c.shiftSpan(Week(c.Today(t)))
+}
+
+// Month gives the span of the month containing t, see Month.
+func (c *Calendar) Month(t time.Time) Span {
+	return c.shiftSpan(Month(c.Today(t)))
+}
+
+// SetFiscalYearStart sets the start of the fiscal year, given as MM-DD.
+func (c *Calendar) SetFiscalYearStart(mmdd string) error {
+	t, err := time.Parse("01-02", mmdd)
+	if err != nil || t.Month() == time.February && t.Day() == 29 {
+		return errors.Errorf("Not a valid start of the fiscal year: %s", mmdd)
+	}
+	c.fyMonth = t.Month()
+	c.fyDay = t.Day()
+	return nil
+}
+
+// Start of the fiscal year named by the calendar year it starts in.
+func (c *Calendar) fiscalYearStart(year int) time.Time {
+	return time.Date(year, c.fyMonth, c.fyDay, 0, 0, 0, 0, time.Local)
+}
+
+// The name of the fiscal year containing t.
+func (c *Calendar) fiscalYearOf(t time.Time) int {
+	if t.Before(c.fiscalYearStart(t.Year())) {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// Quantity describing the fiscal year with the given name.
+func (c *Calendar) fiscalYear(year int) []msg.Quantity {
+	start := c.fiscalYearStart(year)
+	last := c.fiscalYearStart(year+1).AddDate(0, 0, -1)
+	return arg.SingleQuantity(TimeFiscalYear, fmt.Sprint(year), isoDate(start), isoDate(last))
+}
+
+type fiscalYear struct {
+	cal *Calendar
+}
+
+func (f fiscalYear) Parse(str string) ([]msg.Quantity, error) {
+	t, err := time.Parse("2006", str)
+	if err != nil {
+		return nil, errors.Errorf("Not a year: %s", str)
+	}
+	return f.cal.fiscalYear(t.Year()), nil
+}
+
+func (f fiscalYear) DescribeUsage() string {
+	return "YYYY"
+}
+
+type fixedFiscalYearOffset struct {
+	now   time.Time
+	cal   *Calendar
+	years int
+}
+
+func (f fixedFiscalYearOffset) Parse(_ string) ([]msg.Quantity, error) {
+	return f.cal.fiscalYear(f.cal.fiscalYearOf(f.now) + f.years), nil
+}
+
+func (f fixedFiscalYearOffset) DescribeUsage() string {
+	return ""
+}
+
+// SpecificFiscalYear describes a fiscal year by the calendar year it starts in.
+func SpecificFiscalYear(cal *Calendar) arg.Quantifier {
+	return fiscalYear{cal: cal}
+}
+
+func FixedFiscalYearOffset(now time.Time, cal *Calendar, years int) arg.Quantifier {
+	return fixedFiscalYearOffset{now: now, cal: cal, years: years}
+}
+
+type namedPeriod struct {
+	cal *Calendar
+}
+
+func (n namedPeriod) Parse(str string) ([]msg.Quantity, error) {
+	period, ok := n.cal.periods[str]
+	if !ok {
+		return nil, errors.Errorf("Unknown period: %s", str)
+	}
+	return arg.SingleQuantity(TimePeriod, str, period[0], period[1]), nil
+}
+
+func (n namedPeriod) DescribeUsage() string {
+	return "NAME"
+}
+
+// NamedPeriod describes a user-defined period by its name.
+func NamedPeriod(cal *Calendar) arg.Quantifier {
+	return namedPeriod{cal: cal}
+}
@@ -0,0 +1,194 @@
+package quantifier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// Units for breaking down a period into smaller spans.
+const (
+	ByDay     = "day"
+	ByWeek    = "week"
+	ByMonth   = "month"
+	ByQuarter = "quarter"
+	ByYear    = "year"
+)
+
+// BreakdownUnits describes the units by which a period can be broken down.
+const BreakdownUnits = ByDay + "|" + ByWeek + "|" + ByMonth + "|" + ByQuarter + "|" + ByYear
+
+// Span is a labelled stretch of time, including the start but not the end.
+type Span struct {
+	Label msg.Quantity
+	Start time.Time
+	End   time.Time
+}
+
+// Period determines the stretch of time described by a quantity.
+func Period(q msg.Quantity) (Span, error) {
+	if len(q.Elems) == 0 {
+		return Span{}, errors.Errorf("Incomplete time quantity: %v", q)
+	}
+	var start, end time.Time
+	var err error
+	switch q.Type {
+	case TimeDay:
+		start, err = parseLocal("2006-01-02", q.Elems[0])
+		end = start.AddDate(0, 0, 1)
+	case TimeWeek:
+		if len(q.Elems) > 1 {
+			// Part of a week, followed by first and last day.
+			start, end, err = parseDateRange(q.Elems[1:])
+		} else {
+			start, end, err = parseWeek(q.Elems[0])
+		}
+	case TimeMonth:
+		start, err = parseLocal("2006-01", q.Elems[0])
+		end = start.AddDate(0, 1, 0)
+	case TimeQuarter:
+		start, end, err = parseQuarter(q.Elems[0])
+	case TimeYear:
+		start, err = parseLocal("2006", q.Elems[0])
+		end = start.AddDate(1, 0, 0)
+	case TimeBetween:
+		start, end, err = parseDateRange(q.Elems)
+	case TimeFiscalYear, TimePeriod:
+		// Named period, followed by first and last day.
+		start, end, err = parseDateRange(q.Elems[1:])
+	default:
+		return Span{}, errors.Errorf("Not a time quantity: %v", q)
+	}
+	if err != nil {
+		return Span{}, errors.Wrapf(err, "Invalid time quantity: %v", q)
+	}
+	return Span{Label: q, Start: start, End: end}, nil
+}
+
+// Breakdown splits a span into consecutive spans of the given unit. Spans at
+// the edges are cut to fit into the original one.
+func Breakdown(whole Span, unit string) ([]Span, error) {
+	var spans []Span
+	start := whole.Start
+	for start.Before(whole.End) {
+		var next time.Time
+		var label msg.Quantity
+		switch unit {
+		case ByDay:
+			next = start.AddDate(0, 0, 1)
+			label = msg.Quantity{Type: TimeDay, Elems: []string{isoDate(start)}}
+		case ByWeek:
+			next = weekStart(start).AddDate(0, 0, 7)
+			label = msg.Quantity{Type: TimeWeek, Elems: []string{isoWeek(start)}}
+		case ByMonth:
+			next = monthStart(start).AddDate(0, 1, 0)
+			label = msg.Quantity{Type: TimeMonth, Elems: []string{isoMonth(start)}}
+		case ByQuarter:
+			next = quarterStart(start).AddDate(0, 3, 0)
+			label = msg.Quantity{Type: TimeQuarter, Elems: []string{isoQuarter(start)}}
+		case ByYear:
+			next = time.Date(start.Year()+1, time.January, 1, 0, 0, 0, 0, start.Location())
+			label = msg.Quantity{Type: TimeYear, Elems: []string{isoYear(start)}}
+		default:
+			return nil, errors.Errorf("Cannot break down by %s, use one of %s", unit, BreakdownUnits)
+		}
+		if next.After(whole.End) {
+			next = whole.End
+		}
+		if label.Type == TimeWeek && (!start.Equal(weekStart(start)) || !next.Equal(weekStart(start).AddDate(0, 0, 7))) {
+			// Weeks cut to the period are labelled with their days.
+			label.Elems = append(label.Elems, isoDate(start), isoDate(next.AddDate(0, 0, -1)))
+		}
+		spans = append(spans, Span{Label: label, Start: start, End: next})
+		start = next
+	}
+	return spans, nil
+}
+
+// Parse the first and last day of a period, returning its start and end.
+func parseDateRange(elems []string) (time.Time, time.Time, error) {
+	if len(elems) < 2 {
+		return time.Time{}, time.Time{}, errors.New("Require first and last day of the period")
+	}
+	start, err := parseLocal("2006-01-02", elems[0])
+	if err != nil {
+		return start, start, err
+	}
+	last, err := parseLocal("2006-01-02", elems[1])
+	// The last day is included in the period.
+	return start, last.AddDate(0, 0, 1), err
+}
+
+// Parse a date in the local time zone.
+func parseLocal(layout string, str string) (time.Time, error) {
+	return time.ParseInLocation(layout, str, time.Local)
+}
+
+// Parse a quarter given as yyyy-Qn, returning its start and end.
+func parseQuarter(str string) (time.Time, time.Time, error) {
+	var year, q int
+	if n, err := fmt.Sscanf(str, "%4d-Q%1d", &year, &q); err != nil || n != 2 || q < 1 || q > 4 ||
+		len(str) != len("YYYY-QN") {
+		return time.Time{}, time.Time{}, errors.Errorf("Not a quarter: %s", str)
+	}
+	start := time.Date(year, time.Month(3*(q-1)+1), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 3, 0), nil
+}
+
+// Parse an ISO week given as yyyy-Www, returning its start and end. Weeks
+// start on Monday, the first one of a year being the one containing January 4.
+func parseWeek(str string) (time.Time, time.Time, error) {
+	var year, week int
+	if n, err := fmt.Sscanf(strings.ToUpper(str), "%4d-W%2d", &year, &week); err != nil || n != 2 ||
+		len(str) != len("YYYY-WNN") {
+		return time.Time{}, time.Time{}, errors.Errorf("Not a week: %s", str)
+	}
+	start := weekStart(time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local)).AddDate(0, 0, 7*(week-1))
+	if y, w := start.ISOWeek(); week < 1 || y != year || w != week {
+		return time.Time{}, time.Time{}, errors.Errorf("No such week: %s", str)
+	}
+	return start, start.AddDate(0, 0, 7), nil
+}
+
+// Day gives the span of the day containing t.
+func Day(t time.Time) Span {
+	start := dayStart(t)
+	return Span{Start: start, End: start.AddDate(0, 0, 1)}
+}
+
+// Week gives the span of the week, starting on Monday, containing t.
+func Week(t time.Time) Span {
+	start := weekStart(t)
+	return Span{Start: start, End: start.AddDate(0, 0, 7)}
+}
+
+// Month gives the span of the calendar month containing t.
+func Month(t time.Time) Span {
+	start := monthStart(t)
+	return Span{Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+// Midnight on the Monday of the week containing t.
+func weekStart(t time.Time) time.Time {
+	daysSinceLastMonday := (int(t.Weekday()) + 6) % 7
+	return dayStart(t).AddDate(0, 0, -daysSinceLastMonday)
+}
+
+// Midnight at the start of the day containing t.
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Midnight on the first of the month containing t.
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Midnight on the first day of the quarter containing t.
+func quarterStart(t time.Time) time.Time {
+	month := time.Month(3*((int(t.Month())-1)/3) + 1)
+	return time.Date(t.Year(), month, 1, 0, 0, 0, 0, t.Location())
+}
@@ -12,7 +12,9 @@ import (
 
 const (
 	TimeDay     = "date"
+	TimeWeek    = "week"
 	TimeMonth   = "month"
+	TimeQuarter = "quarter"
 	TimeYear    = "year"
 	TimeBetween = "between"
 )
@@ -77,29 +79,51 @@ type date struct{}
 
 func (dq date) Parse(str string) ([]msg.Quantity, error) {
 	_, err := time.Parse("2006-01-02", str)
-	return arg.SingleQuantity("day", str), err
+	return arg.SingleQuantity(TimeDay, str), err
 }
 
 func (dq date) DescribeUsage() string {
 	return "YYYY-MM-DD"
 }
 
+type week struct{}
+
+func (wq week) Parse(str string) ([]msg.Quantity, error) {
+	start, _, err := parseWeek(str)
+	return arg.SingleQuantity(TimeWeek, isoWeek(start)), err
+}
+
+func (wq week) DescribeUsage() string {
+	return "YYYY-Www"
+}
+
 type month struct{}
 
 func (mq month) Parse(str string) ([]msg.Quantity, error) {
 	_, err := time.Parse("2006-01", str)
-	return arg.SingleQuantity("month", str), err
+	return arg.SingleQuantity(TimeMonth, str), err
 }
 
 func (mq month) DescribeUsage() string {
 	return "YYYY-MM"
 }
 
+type quarter struct{}
+
+func (qq quarter) Parse(str string) ([]msg.Quantity, error) {
+	_, _, err := parseQuarter(str)
+	return arg.SingleQuantity(TimeQuarter, str), err
+}
+
+func (qq quarter) DescribeUsage() string {
+	return "YYYY-QN"
+}
+
 type year struct{}
 
 func (yq year) Parse(str string) ([]msg.Quantity, error) {
 	_, err := time.Parse("2006", str)
-	return arg.SingleQuantity("year", str), err
+	return arg.SingleQuantity(TimeYear, str), err
 }
 
 func (yq year) DescribeUsage() string {
@@ -110,10 +134,18 @@ func SpecificDate() arg.Quantifier {
 	return date{}
 }
 
+func SpecificWeek() arg.Quantifier {
+	return week{}
+}
+
 func SpecificMonth() arg.Quantifier {
 	return month{}
 }
 
+func SpecificQuarter() arg.Quantifier {
+	return quarter{}
+}
+
 func SpecificYear() arg.Quantifier {
 	return year{}
 }
@@ -126,7 +158,11 @@ type fixedDateOffset struct {
 }
 
 func (f fixedDateOffset) Parse(_ string) ([]msg.Quantity, error) {
-	return arg.SingleQuantity(f.qType, isoDate(f.now.AddDate(f.years, 0, f.days))), nil
+	then := f.now.AddDate(f.years, 0, f.days)
+	if f.qType == TimeYear {
+		return arg.SingleQuantity(f.qType, isoYear(then)), nil
+	}
+	return arg.SingleQuantity(f.qType, isoDate(then)), nil
 }
 
 func (f fixedDateOffset) DescribeUsage() string {
@@ -139,7 +175,7 @@ type fixedWeekOffset struct {
 }
 
 func (f fixedWeekOffset) Parse(_ string) ([]msg.Quantity, error) {
-	return weeksAgo(f.now, f.weeks), nil
+	return weeksAgo(f.now, -f.weeks), nil
 }
 
 func (f fixedWeekOffset) DescribeUsage() string {
@@ -152,13 +188,27 @@ type fixedMonthOffset struct {
 }
 
 func (f fixedMonthOffset) Parse(_ string) ([]msg.Quantity, error) {
-	return monthsAgo(f.now, f.months), nil
+	return monthsAgo(f.now, -f.months), nil
 }
 
 func (f fixedMonthOffset) DescribeUsage() string {
 	return ""
 }
 
+type fixedQuarterOffset struct {
+	now      time.Time
+	quarters int
+}
+
+func (f fixedQuarterOffset) Parse(_ string) ([]msg.Quantity, error) {
+	start := quarterStart(f.now).AddDate(0, 3*f.quarters, 0)
+	return arg.SingleQuantity(TimeQuarter, isoQuarter(start)), nil
+}
+
+func (f fixedQuarterOffset) DescribeUsage() string {
+	return ""
+}
+
 func FixedDayOffset(now time.Time, days int) arg.Quantifier {
 	return fixedDateOffset{now: now, qType: TimeDay, days: days}
 }
@@ -171,6 +221,10 @@ func FixedMonthOffset(now time.Time, months int) arg.Quantifier {
 	return fixedMonthOffset{now: now, months: months}
 }
 
+func FixedQuarterOffset(now time.Time, quarters int) arg.Quantifier {
+	return fixedQuarterOffset{now: now, quarters: quarters}
+}
+
 func FixedYearOffset(now time.Time, years int) arg.Quantifier {
 	return fixedDateOffset{now: now, qType: TimeYear, years: years}
 }
@@ -197,7 +251,12 @@ type dynWeeksAgo struct {
 
 func (d dynWeeksAgo) Parse(str string) ([]msg.Quantity, error) {
 	weeks, err := strconv.Atoi(str)
-	return weeksAgo(d.now, weeks), err
+	if err != nil {
+		return nil, errors.Errorf("Not a number of weeks: %s", str)
+	} else if weeks < 0 {
+		return nil, errors.Errorf("Cannot look into the future: %d weeks ago", weeks)
+	}
+	return weeksAgo(d.now, weeks), nil
 }
 
 func (d dynWeeksAgo) DescribeUsage() string {
@@ -268,6 +327,7 @@ func DynamicBetween() arg.Quantifier {
 }
 
 // Quantity describing the week (Mon-Sun) a number of weeks before now.
+// Both ends of the resulting period are inclusive.
 func weeksAgo(now time.Time, weeks int) []msg.Quantity {
 	daysSinceLastMonday := (int(now.Weekday()) + 6) % 7
 	// Monday in the target week
@@ -296,11 +356,23 @@ func isoDate(t time.Time) string {
 	return t.Format("2006-01-02")
 }
 
+// Format as the ISO week, yyyy-Www. Around new year, the year may differ from
+// the calendar year.
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
 // Format as yyyy-MM.
 func isoMonth(t time.Time) string {
 	return t.Format("2006-01")
 }
 
+// Format as yyyy-Qn.
+func isoQuarter(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
+
 // Format as yyyy.
 func isoYear(t time.Time) string {
 	return t.Format("2006")
@@ -0,0 +1,285 @@
+package quantifier
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// A Wednesday.
+var now = time.Date(2019, time.May, 15, 13, 30, 0, 0, time.Local)
+
+func between(start, end string) msg.Quantity {
+	return msg.Quantity{Type: TimeBetween, Elems: []string{start, end}}
+}
+
+func weekOf(elems ...string) msg.Quantity {
+	return msg.Quantity{Type: TimeWeek, Elems: elems}
+}
+
+func expectQuantities(t *testing.T, description string, actual []msg.Quantity, expected ...msg.Quantity) {
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("%s: got %v, expected %v", description, actual, expected)
+	}
+}
+
+func TestWeeksAgo(t *testing.T) {
+	q, err := ListOf(DynamicWeekOffset(now)).Parse("1,2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectQuantities(t, "weeks ago", q,
+		between("2019-05-06", "2019-05-12"),
+		between("2019-04-29", "2019-05-05"),
+		between("2019-04-22", "2019-04-28"))
+}
+
+func TestWeeksAgoRejectsInvalid(t *testing.T) {
+	for _, arg := range []string{"", "x", "-1"} {
+		if _, err := DynamicWeekOffset(now).Parse(arg); err == nil {
+			t.Errorf("Expected error for %q weeks ago", arg)
+		}
+	}
+}
+
+func TestFixedWeeks(t *testing.T) {
+	q, _ := FixedWeekOffset(now, 0).Parse("")
+	expectQuantities(t, "this week", q, between("2019-05-13", "2019-05-15"))
+	q, _ = FixedWeekOffset(now, -1).Parse("")
+	expectQuantities(t, "last week", q, between("2019-05-06", "2019-05-12"))
+}
+
+func TestWeekStartsOnMonday(t *testing.T) {
+	sunday := time.Date(2019, time.May, 19, 8, 0, 0, 0, time.Local)
+	q, _ := FixedWeekOffset(sunday, 0).Parse("")
+	expectQuantities(t, "this week on sunday", q, between("2019-05-13", "2019-05-19"))
+	monday := time.Date(2019, time.May, 20, 8, 0, 0, 0, time.Local)
+	q, _ = FixedWeekOffset(monday, -1).Parse("")
+	expectQuantities(t, "last week on monday", q, between("2019-05-13", "2019-05-19"))
+}
+
+func TestCalendarMonth(t *testing.T) {
+	cal := DefaultCalendar()
+	if err := cal.SetDayStart("04:00"); err != nil {
+		t.Fatal(err)
+	}
+	// Still the last day of April until 04:00
+	early := time.Date(2019, time.May, 1, 2, 0, 0, 0, time.Local)
+	month := cal.Month(early)
+	if start := time.Date(2019, time.April, 1, 4, 0, 0, 0, time.Local); !month.Start.Equal(start) {
+		t.Errorf("Expected the month to start at %v, got %v", start, month.Start)
+	}
+	if end := time.Date(2019, time.May, 1, 4, 0, 0, 0, time.Local); !month.End.Equal(end) {
+		t.Errorf("Expected the month to end at %v, got %v", end, month.End)
+	}
+}
+
+func TestFixedMonths(t *testing.T) {
+	q, _ := FixedMonthOffset(now, -1).Parse("")
+	expectQuantities(t, "last month", q, msg.Quantity{Type: TimeMonth, Elems: []string{"2019-04"}})
+}
+
+func TestQuarters(t *testing.T) {
+	q, _ := FixedQuarterOffset(now, 0).Parse("")
+	expectQuantities(t, "this quarter", q, msg.Quantity{Type: TimeQuarter, Elems: []string{"2019-Q2"}})
+	q, _ = FixedQuarterOffset(now, -2).Parse("")
+	expectQuantities(t, "two quarters ago", q, msg.Quantity{Type: TimeQuarter, Elems: []string{"2018-Q4"}})
+
+	for _, invalid := range []string{"2019", "2019-Q5", "2019-Q0", "2019-Q12", "19-Q1"} {
+		if _, err := SpecificQuarter().Parse(invalid); err == nil {
+			t.Errorf("Expected error for quarter %q", invalid)
+		}
+	}
+	span, err := Period(msg.Quantity{Type: TimeQuarter, Elems: []string{"2019-Q4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span.Start.Month() != time.October || span.End.Year() != 2020 || span.End.Month() != time.January {
+		t.Errorf("Wrong period for 2019-Q4: %v - %v", span.Start, span.End)
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	span, _ := Period(between("2019-03-30", "2019-07-02"))
+	spans, err := Breakdown(span, ByQuarter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []msg.Quantity
+	for _, s := range spans {
+		labels = append(labels, s.Label)
+	}
+	expectQuantities(t, "quarters", labels,
+		msg.Quantity{Type: TimeQuarter, Elems: []string{"2019-Q1"}},
+		msg.Quantity{Type: TimeQuarter, Elems: []string{"2019-Q2"}},
+		msg.Quantity{Type: TimeQuarter, Elems: []string{"2019-Q3"}})
+	if !spans[0].Start.Equal(span.Start) || !spans[2].End.Equal(span.End) {
+		t.Error("Breakdown exceeds the original period:", spans)
+	}
+
+	spans, _ = Breakdown(span, ByWeek)
+	if first := spans[0].Label; !reflect.DeepEqual(first, weekOf("2019-W13", "2019-03-30", "2019-03-31")) {
+		t.Error("First week not cut to period:", first)
+	}
+	if second := spans[1].Label; !reflect.DeepEqual(second, weekOf("2019-W14")) {
+		t.Error("Full week not labelled as such:", second)
+	}
+	if last := spans[len(spans)-1].Label; !reflect.DeepEqual(last, weekOf("2019-W27", "2019-07-01", "2019-07-02")) {
+		t.Error("Last week not cut to period:", last)
+	}
+
+	if _, err := Breakdown(span, "fortnight"); err == nil {
+		t.Error("Expected error for unknown unit")
+	}
+}
+
+func TestWeeks(t *testing.T) {
+	for str, monday := range map[string]string{
+		"2019-W20": "2019-05-13",
+		"2020-W53": "2020-12-28", // A long year
+		"2025-W01": "2024-12-30", // Starting in the previous year
+		"2027-w01": "2027-01-04",
+	} {
+		span, err := Period(weekOf(str))
+		if err != nil {
+			t.Error(err)
+		} else if isoDate(span.Start) != monday || span.End.Sub(span.Start) < 6*24*time.Hour {
+			t.Errorf("Week %s starts %s, ends %s; expected to start %s", str, span.Start, span.End, monday)
+		}
+	}
+	for _, str := range []string{"2021-W53", "2019-W00", "2019-20", "2019-W5"} {
+		if _, err := SpecificWeek().Parse(str); err == nil {
+			t.Errorf("Expected error for week %q", str)
+		}
+	}
+}
+
+func TestFixedYears(t *testing.T) {
+	q, _ := FixedYearOffset(now, -1).Parse("")
+	expectQuantities(t, "last year", q, msg.Quantity{Type: TimeYear, Elems: []string{"2018"}})
+}
+
+func TestFiscalYears(t *testing.T) {
+	cal := DefaultCalendar()
+	q, _ := FixedFiscalYearOffset(now, cal, 0).Parse("")
+	expectQuantities(t, "calendar fiscal year", q,
+		msg.Quantity{Type: TimeFiscalYear, Elems: []string{"2019", "2019-01-01", "2019-12-31"}})
+
+	if err := cal.SetFiscalYearStart("04-01"); err != nil {
+		t.Fatal(err)
+	}
+	q, _ = FixedFiscalYearOffset(now, cal, 0).Parse("")
+	expectQuantities(t, "this fiscal year", q,
+		msg.Quantity{Type: TimeFiscalYear, Elems: []string{"2019", "2019-04-01", "2020-03-31"}})
+	q, _ = FixedFiscalYearOffset(now.AddDate(0, -2, 0), cal, -1).Parse("")
+	expectQuantities(t, "last fiscal year in March", q,
+		msg.Quantity{Type: TimeFiscalYear, Elems: []string{"2017", "2017-04-01", "2018-03-31"}})
+	q, _ = SpecificFiscalYear(cal).Parse("2023")
+	expectQuantities(t, "specific fiscal year", q,
+		msg.Quantity{Type: TimeFiscalYear, Elems: []string{"2023", "2023-04-01", "2024-03-31"}})
+
+	span, err := Period(q[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span.End.Year() != 2024 || span.End.Month() != time.April || span.End.Day() != 1 {
+		t.Error("Fiscal year should end before April 1st, not", span.End)
+	}
+
+	for _, invalid := range []string{"4-1", "13-01", "02-29", "April"} {
+		if err := cal.SetFiscalYearStart(invalid); err == nil {
+			t.Errorf("Expected error for fiscal year start %q", invalid)
+		}
+	}
+}
+
+func TestNamedPeriods(t *testing.T) {
+	cal := DefaultCalendar()
+	err := cal.SetPeriods(map[string]string{"sprint42": "2024-05-06..2024-05-17", "spaced": "2024-01-01 .. 2024-01-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := ListOf(NamedPeriod(cal)).Parse("sprint42,spaced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectQuantities(t, "named periods", q,
+		msg.Quantity{Type: TimePeriod, Elems: []string{"sprint42", "2024-05-06", "2024-05-17"}},
+		msg.Quantity{Type: TimePeriod, Elems: []string{"spaced", "2024-01-01", "2024-01-02"}})
+	if _, err := NamedPeriod(cal).Parse("sprint43"); err == nil {
+		t.Error("Expected error for unknown period")
+	}
+
+	for _, invalid := range []string{"2024-05-06", "2024-05-06..", "2024-05-17..2024-05-06", "a..b"} {
+		if err := cal.SetPeriods(map[string]string{"invalid": invalid}); err == nil {
+			t.Errorf("Expected error for period %q", invalid)
+		}
+	}
+}
+
+func TestWorkingDays(t *testing.T) {
+	cal := DefaultCalendar()
+	// Mon, 2019-05-13 through Sun, 2019-05-19
+	span, _ := Period(between("2019-05-13", "2019-05-19"))
+	if n := cal.WorkingDays(span); n != 5 {
+		t.Errorf("Expected 5 working days, got %d", n)
+	}
+
+	if err := cal.SetHolidays(map[string]string{"2019-05-15": "Some holiday"}); err != nil {
+		t.Fatal(err)
+	}
+	if cal.IsWorkingDay(now) {
+		t.Error("Holiday considered a working day")
+	}
+	cal.AddDaysOff([]msg.DayOff{msg.DayOff{Date: "2019-05-14", Kind: msg.OffVacation}})
+	if n := cal.WorkingDays(span); n != 3 {
+		t.Errorf("Expected 3 working days with holiday and day off, got %d", n)
+	}
+	if h := cal.ExpectedHours(now.AddDate(0, 0, -1)); h != 0 {
+		t.Errorf("Expected nothing on a day off, got %v", h)
+	}
+	if err := cal.SetWorkingDays("mon, tue,sat"); err != nil {
+		t.Fatal(err)
+	}
+	if n := cal.WorkingDays(span); n != 2 {
+		t.Errorf("Expected 2 working days, got %d", n)
+	}
+
+	for _, invalid := range []string{"mon,x", "t", "weekday"} {
+		if err := cal.SetWorkingDays(invalid); err == nil {
+			t.Errorf("Expected error for working days %q", invalid)
+		}
+	}
+	if err := cal.SetHolidays(map[string]string{"12/25": "Christmas"}); err == nil {
+		t.Error("Expected error for invalid holiday date")
+	}
+}
+
+func TestExpectedHours(t *testing.T) {
+	cal := DefaultCalendar()
+	friday := now.AddDate(0, 0, 2)
+	if err := cal.SetExpectedHours("7h30m", map[string]string{"fri": "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if h := cal.ExpectedHours(now); h != 7*time.Hour+30*time.Minute {
+		t.Errorf("Expected 7h30m on a working day, got %v", h)
+	}
+	if h := cal.ExpectedHours(friday); h != 5*time.Hour {
+		t.Errorf("Expected 5h on Friday, got %v", h)
+	}
+	if h := cal.ExpectedHours(friday.AddDate(0, 0, 1)); h != 0 {
+		t.Errorf("Expected nothing on Saturday, got %v", h)
+	}
+
+	if err := cal.SetHolidays(map[string]string{"2019-05-15": "Some holiday"}); err != nil {
+		t.Fatal(err)
+	}
+	if h := cal.ExpectedHours(now); h != 0 {
+		t.Errorf("Expected nothing on a holiday, got %v", h)
+	}
+	if err := cal.SetExpectedHours("8h", map[string]string{"x": "5h"}); err == nil {
+		t.Error("Expected error for invalid day of the week")
+	}
+}
@@ -0,0 +1,114 @@
+package argparse
+
+import (
+	"sort"
+	"strings"
+)
+
+// Spec describes the syntax of a command for other programs, e.g. completion
+// generators, in a form suitable for JSON.
+type Spec struct {
+	Command string      `json:"command"`
+	Summary string      `json:"summary"`
+	Tasks   string      `json:"tasks"` // none, single, optional, split or multiple
+	Args    []ArgSpec   `json:"args,omitempty"`
+	Params  []ParamSpec `json:"params,omitempty"`
+}
+
+// ArgSpec describes a positional argument.
+type ArgSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Optional    bool   `json:"optional,omitempty"`
+	Many        bool   `json:"many,omitempty"`
+}
+
+// Kinds of parameters.
+const (
+	ParamFlag       = "flag"       // Given or not, e.g. :force
+	ParamOption     = "option"     // Taking a value as is, e.g. :note=text
+	ParamQuantifier = "quantifier" // Selecting time ranges or the like, e.g. :today
+	ParamKeyword    = "keyword"    // A word without prefix, e.g. a subcommand
+)
+
+// ParamSpec describes a parameter, named as given on the command line.
+type ParamSpec struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Values      string `json:"values,omitempty"`
+	Description string `json:"description"`
+}
+
+// Implemented by argument handlers able to describe their arguments and
+// parameters in detail.
+type specDescriber interface {
+	describeSpec() ([]ArgSpec, []ParamSpec)
+}
+
+// Spec describes the parser's syntax along with what the command does.
+func (p *Parser) Spec(what string) Spec {
+	spec := Spec{Command: p.command, Summary: what, Tasks: p.taskHandler.numberOfTasks().String()}
+	if d, ok := p.argHandler.(specDescriber); ok {
+		spec.Args, spec.Params = d.describeSpec()
+		return spec
+	}
+	// Handlers of their own only give a description for help
+	for _, desc := range p.argHandler.DescribeParameters() {
+		if desc.ParamName == "" {
+			spec.Args = append(spec.Args, ArgSpec{Name: desc.ParamValues, Description: desc.ParamExplanation})
+		} else if strings.HasPrefix(desc.ParamName, ParamIdentifierPrefix) {
+			spec.Params = append(spec.Params, ParamSpec{
+				Name: desc.ParamName, Kind: ParamOption, Values: desc.ParamValues, Description: desc.ParamExplanation})
+		} else {
+			// Values may follow the keyword, e.g. loglevel <level>
+			fields := strings.SplitN(desc.ParamName, " ", 2)
+			values := desc.ParamValues
+			if len(fields) == 2 && values == "" {
+				values = fields[1]
+			}
+			spec.Params = append(spec.Params, ParamSpec{
+				Name: fields[0], Kind: ParamKeyword, Values: values, Description: desc.ParamExplanation})
+		}
+	}
+	return spec
+}
+
+func (n numTasks) String() string {
+	switch n {
+	case noTasks:
+		return "none"
+	case oneTask:
+		return "single"
+	case optionalTask:
+		return "optional"
+	case splitTask:
+		return "split"
+	case severalTasks:
+		return "multiple"
+	default:
+		panic("Invalid number of tasks for task handler")
+	}
+}
+
+func (h paramHandler) describeSpec() ([]ArgSpec, []ParamSpec) {
+	var args []ArgSpec
+	for _, arg := range h.args {
+		args = append(args, ArgSpec{Name: arg.Name, Description: arg.Description, Optional: arg.Optional, Many: arg.Many})
+	}
+	var params []ParamSpec
+	for _, par := range h.params {
+		desc := par.Describe()
+		kind := ParamFlag
+		if par.Quantifier != nil {
+			kind = ParamQuantifier
+		} else if par.RequiresArg {
+			kind = ParamOption
+		}
+		params = append(params, ParamSpec{
+			Name: desc.ParamName, Kind: kind, Values: desc.ParamValues, Description: desc.ParamExplanation})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+	return args, params
+}
@@ -2,12 +2,15 @@
 package client
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -32,6 +35,13 @@ type Operation interface {
 	HelpHeaderAndFooter() (string, string)
 }
 
+// Configurable is implemented by operations which depend on configuration
+// when parsing or executing a command.
+type Configurable interface {
+	// Adjust to the given configuration, prior to parsing.
+	Configure(conf *config.Opts) error
+}
+
 // RegisterOperation makes a client-side operation available.
 // This function is called indirectly from other packages' init() functions.
 func RegisterOperation(name string, operation Operation) {
@@ -45,36 +55,74 @@ func Dispatch(conf *config.Opts, args []string) bool {
 		showUsageAndDie(errors.New("No command given"))
 	}
 
-	if args[0] == "-h" || args[0] == "--help" {
+	if isHelpFlag(args[0]) {
 		printAllOperationsHelp(os.Stderr)
 		return true
 	}
 
+	if _, ok := operations[args[0]]; !ok {
+		showUsageAndDie(errors.Errorf("No such command: %s", args[0]))
+	}
+
+	return newClient(conf).Execute(args)
+}
+
+// Execute the command described by args, the first of which is the command
+// name. Returns true if the operation succeeded, false otherwise.
+func (c *Client) Execute(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+
 	command := args[0]
 	op, ok := operations[command]
 	if !ok {
-		showUsageAndDie(errors.Errorf("No such command: %s", command))
+		c.PrintError(errors.Errorf("No such command: %s", command))
+		return false
+	}
+
+	if len(args) > 1 && isHelpFlag(args[1]) {
+		if err := c.PrintSingleOperationHelp(command); err != nil {
+			c.PrintError(err)
+			return false
+		}
+		return true
+	}
+
+	if cop, ok := op.(Configurable); ok {
+		if err := cop.Configure(c.conf); err != nil {
+			c.PrintError(err)
+			return false
+		}
 	}
 
-	cl := newClient(conf)
 	if cmd, err := op.Parser().Parse(args[1:]); err != nil {
-		cl.PrintError(err)
-		cl.PrintShortDescription(op.DescribeShort())
+		c.PrintError(err)
+		c.PrintShortDescription(op.DescribeShort())
 		return false
-	} else if err := op.ClientExec(cl, cmd); err != nil {
-		cl.PrintError(err)
+	} else if err := op.ClientExec(c, cmd); err != nil {
+		c.PrintError(err)
+		c.upgradeServer()
 		return false
-	} else {
-		return true
 	}
+	c.upgradeServer()
+	return true
 }
 
 // Client is a type bundling everything required for client-side operation.
 type Client struct {
-	conf   *config.Opts
-	conn   net.Conn
-	msgout io.Writer
-	err    error
+	conf    *config.Opts
+	conn    net.Conn
+	dec     *json.Decoder
+	in      io.Reader
+	session bool
+	kind    string          // The kind of client, recorded with changed entries
+	ctx     context.Context // Limits requests, see SetContext
+	msgout  io.Writer
+	warned  bool   // Whether the user was warned about the server's release
+	upgrade bool   // Whether to restart the server after the command, see checkRelease
+	lastOp  string // The operation last sent to the server
+	err     error
 }
 
 // Read from the client's connection.
@@ -85,11 +133,28 @@ func (cl *Client) Read(p []byte) (n int, err error) {
 	if cl.conn == nil {
 		panic("cannot read: connection not yet established")
 	}
-	return cl.conn.Read(p)
+	if cl.in == nil {
+		// Data buffered while decoding a response must not get lost.
+		cl.in = io.MultiReader(cl.dec.Buffered(), cl.conn)
+	}
+	return cl.in.Read(p)
 }
 
 func newClient(conf *config.Opts) *Client {
-	return &Client{conf: conf, msgout: os.Stderr}
+	return &Client{conf: conf, kind: msg.OriginCLI, ctx: context.Background(), msgout: os.Stderr}
+}
+
+// SetKind sets the kind of client, e.g. msg.OriginAgent, recorded with the
+// entries created or modified by its commands.
+func (c *Client) SetKind(kind string) {
+	c.kind = kind
+}
+
+// SetContext makes requests subject to the context. Once it is done, waiting
+// for a response ends, the connection is closed and the server stops working
+// on the request. Requests are limited by the configured timeout as well.
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
 }
 
 // Failed returns whether the client has encountered an error.
@@ -105,6 +170,9 @@ func (c *Client) Connected() bool {
 // Close the client's underlying connection.
 func (c *Client) Close() error {
 	err := c.conn.Close()
+	c.conn = nil
+	c.dec = nil
+	c.in = nil
 	if !c.Failed() {
 		// NOTE: c.err can still be nil afterwards
 		c.err = err
@@ -112,6 +180,28 @@ func (c *Client) Close() error {
 	return err
 }
 
+// StartSession makes the client keep its connection open between commands.
+func (c *Client) StartSession() {
+	c.session = true
+}
+
+// Reset clears any error the client may have encountered. If an error
+// occurred, the connection is dropped to be re-established on demand.
+func (c *Client) Reset() {
+	if c.Failed() && c.Connected() {
+		c.conn.Close()
+		c.conn = nil
+		c.dec = nil
+		c.in = nil
+	}
+	c.err = nil
+}
+
+// Config gives the configuration the client operates with.
+func (c *Client) Config() *config.Opts {
+	return c.conf
+}
+
 // Error returns the first error the client may have encountered, or nil.
 func (c *Client) Error() error {
 	return c.err
@@ -121,23 +211,60 @@ func (c *Client) Error() error {
 // This will establish a connection, send the command, receive a response, and
 // print it.
 func (c *Client) SendReceivePrint(cmd msg.Cmd) {
+	resp := c.SendReceive(cmd)
+	c.PrintResponse(resp)
+}
+
+// SendReceive sends the command to the server and returns its response,
+// giving up when the client's context is done or the timeout expires.
+func (c *Client) SendReceive(cmd msg.Cmd) msg.Response {
+	ctx, cancel := c.ctx, context.CancelFunc(func() {})
+	if timeout := c.conf.Timeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
 	c.EstablishConnection()
+	if !c.Failed() {
+		if deadline, ok := ctx.Deadline(); ok {
+			// For the server to stop in time as well
+			cmd.Timeout = time.Until(deadline).Milliseconds()
+		}
+		// Closing the connection ends waiting and tells the server
+		conn, done := c.conn, make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+	}
 	c.SendToServer(cmd)
 	resp := c.ReceiveFromServer()
-	c.PrintResponse(resp)
+	if err := ctx.Err(); err != nil && c.Failed() {
+		c.err = errors.Wrap(err, "gave up waiting for a response")
+		resp.SetError(c.err)
+	}
+	return resp
 }
 
 // EstablishConnection ensures the server is up and the client is connected.
+// An already established connection is reused.
 func (c *Client) EstablishConnection() {
-	if c.Failed() {
+	if c.Failed() || c.Connected() {
 		return
 	}
-	c.EnsureServerIsRunning()
-	socket := c.conf.Socket.Value
-	if conn, err := net.Dial(c.conf.Protocol.Value, socket); err != nil {
-		c.err = errors.Wrap(err, "failed to connect to socket "+socket)
+	if c.EnsureServerIsRunning(); c.Failed() {
+		return
+	}
+	if conn, err := server.Connect(c.conf); err != nil && c.conf.RemoteServer() {
+		c.err = errors.Wrap(err, "failed to connect to server at "+c.conf.ServerAddr.Value)
+	} else if err != nil {
+		c.err = errors.Wrap(err, "failed to connect to socket "+c.conf.Socket.Value)
 	} else {
 		c.conn = conn
+		c.dec = json.NewDecoder(conn)
 	}
 }
 
@@ -148,6 +275,14 @@ func (c *Client) SendToServer(cmd msg.Cmd) {
 	}
 	if !c.Connected() {
 		c.err = errors.New("cannot send to server: not connected")
+		return
+	}
+	cmd.KeepAlive = c.session
+	cmd.Version = msg.ProtocolVersion
+	c.lastOp = cmd.Op
+	if cmd.Origin == "" {
+		host, _ := os.Hostname()
+		cmd.Origin = msg.MakeOrigin(c.kind, host)
 	}
 	enc := json.NewEncoder(c.conn)
 	c.err = errors.Wrap(enc.Encode(cmd), "failed to send command to server")
@@ -162,14 +297,91 @@ func (c *Client) ReceiveFromServer() msg.Response {
 	}
 	if !c.Connected() {
 		c.err = errors.New("cannot receive from server: not connected")
+		resp.SetError(c.err)
+		return resp
+	}
+	c.err = errors.Wrap(c.dec.Decode(&resp), "failed to decode response")
+	if !c.Failed() {
+		c.checkRelease(resp)
 	}
-	dec := json.NewDecoder(c.conn)
-	c.err = errors.Wrap(dec.Decode(&resp), "failed to decode response")
 	return resp
 }
 
+// Warn once if the server answering differs from this client by more than a
+// patch release, e.g. a server left running after an upgrade. If configured,
+// an older local server is restarted once the command is done instead.
+func (c *Client) checkRelease(resp msg.Response) {
+	if c.warned || (resp.Server == "" && resp.Failed()) || msg.CompatibleReleases(resp.Server, msg.Release) {
+		return
+	}
+	c.warned = true
+	older := resp.Server == "" || msg.OlderRelease(resp.Server, msg.Release)
+	// Not while shutting down or restarting the server anyway
+	if older && c.conf.UpgradeServer() && !c.conf.RemoteServer() && c.lastOp != "shutdown" {
+		c.upgrade = true
+		return
+	}
+	server := resp.Server
+	if server == "" {
+		server = "an older release"
+	}
+	advice := "restart it with `tilo server restart`"
+	if c.conf.RemoteServer() {
+		advice = "consider upgrading"
+	}
+	fmt.Fprintf(os.Stderr, "Warning: the server runs %s, this client %s; %s\n", server, msg.Release, advice)
+}
+
+// Restart the server if found to be older than this client, see checkRelease.
+func (c *Client) upgradeServer() {
+	if !c.upgrade {
+		return
+	}
+	c.upgrade = false
+	c.err = nil
+	fmt.Fprintln(os.Stderr, "Restarting the server to upgrade it to", msg.Release)
+	if err := c.RestartServer(os.Stderr); err != nil {
+		c.PrintError(errors.Wrap(err, "Failed to upgrade the server"))
+	}
+}
+
+// RestartServer shuts down a running server, handing over active tasks, and
+// starts a new one. The response to the shutdown request is printed to out.
+// Remote servers are left alone, as they cannot be started from here.
+func (c *Client) RestartServer(out io.Writer) error {
+	if c.conf.RemoteServer() {
+		return errors.Errorf("the server at %s is remote, servers are only restarted locally",
+			c.conf.ServerAddr.Value)
+	}
+	if c.ServerIsRunning() {
+		if c.Connected() {
+			// The server closes connections after answering
+			c.Close()
+		}
+		cmd := msg.Cmd{Op: "shutdown", Flags: map[string]bool{"handover": true}}
+		resp := c.SendReceive(cmd)
+		if c.Failed() {
+			return errors.Wrapf(c.Error(), "Failed to initiate server shutdown")
+		} else if err := resp.Err(); err != nil {
+			return err
+		}
+		// The new server is connected to once started
+		c.Close()
+		c.PrintResponseTo(out, resp)
+		c.AwaitServerShutdown()
+	}
+	c.EnsureServerIsRunning()
+	return c.Error()
+}
+
 // PrintResponse print a server response for the user to read.
 func (c *Client) PrintResponse(resp msg.Response) {
+	c.PrintResponseTo(os.Stdout, resp)
+}
+
+// PrintResponseTo prints a server response for the user to read to the
+// given writer.
+func (c *Client) PrintResponseTo(out io.Writer, resp msg.Response) {
 	if c.Failed() {
 		return
 	}
@@ -177,8 +389,12 @@ func (c *Client) PrintResponse(resp msg.Response) {
 	// Response type might be rewritten.
 	if resp.Failed() {
 		c.err = resp.Err()
+	} else if format := c.conf.Output.Value; format != config.OUTPUT_TABLE {
+		c.PrintWarnings(resp)
+		c.err = writeStructured(out, format, resp)
 	} else {
-		w := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', 0)
+		c.PrintWarnings(resp)
+		w := tabwriter.NewWriter(out, 0, 4, 1, ' ', 0)
 		for _, line := range resp.Body {
 			noTab := true
 			for _, word := range line {
@@ -195,6 +411,13 @@ func (c *Client) PrintResponse(resp msg.Response) {
 	}
 }
 
+// PrintWarnings prints the warnings contained in a server response, if any.
+func (c *Client) PrintWarnings(resp msg.Response) {
+	for _, warning := range resp.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+}
+
 // EnsureServerIsRunning will do nothing if the server is up, else it will start it.
 func (c *Client) EnsureServerIsRunning() {
 	// Query server status.
@@ -203,41 +426,90 @@ func (c *Client) EnsureServerIsRunning() {
 		return
 	} else if running {
 		return
+	} else if c.conf.RemoteServer() {
+		c.err = errors.Errorf("no server listening at %s, servers are only started locally",
+			c.conf.ServerAddr.Value)
+		return
 	}
 
 	// Start server if it isn't running.
-	if pid, err := server.StartInBackground(c.conf); err != nil {
+	proc, err := server.StartInBackground(c.conf)
+	if err != nil {
 		c.err = errors.Wrap(err, "Could not start server")
 		return
-	} else {
-		fmt.Printf("Server started in background process: PID %d\n", pid)
 	}
+	// Not on standard output, which may be redirected to a file
+	fmt.Fprintf(os.Stderr, "Server started in background process: PID %d\n", proc.Pid)
+
+	// Wait for the server to accept connections, unless it exits before
+	exited := make(chan error, 1)
+	go func() {
+		state, err := proc.Wait()
+		if err == nil {
+			err = errors.New(state.String())
+		}
+		exited <- err
+	}()
+	timeout := time.After(c.conf.ServerStartTimeout())
+	for {
+		if up, _ := server.IsRunning(c.conf); up {
+			return
+		}
+		select {
+		case err := <-exited:
+			c.err = errors.Errorf("server exited on start, %v%s", err, logExcerpt(c.conf))
+			return
+		case <-timeout:
+			c.err = errors.Errorf("timeout exceeded trying to bring up server, see %s", server.BackgroundLog(c.conf))
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// The last lines of the background log, prefixed for inclusion in an error
+// message; empty if there are none.
+func logExcerpt(conf *config.Opts) string {
+	lines := server.LastLogLines(conf, 5)
+	if len(lines) == 0 {
+		return ""
+	}
+	return ":\n    " + strings.Join(lines, "\n    ")
+}
 
-	// Wait for server to become available
-	notifyChan := make(chan struct{})
-	go func(ch chan<- struct{}) {
-		for {
-			up, _ := server.IsRunning(c.conf)
-			if up {
-				ch <- struct{}{}
-				return
-			}
-			time.Sleep(20 * time.Millisecond)
+// PrintFailedStart prints the last lines logged by the last server started in
+// the background, unless it shut down cleanly. Gives whether it did not.
+func (c *Client) PrintFailedStart() bool {
+	lines := server.FailedStart(c.conf, 10)
+	if len(lines) == 0 {
+		return false
+	}
+	c.PrintMessage("Last server failed to start or crashed, see " + server.BackgroundLog(c.conf) + ":")
+	for _, line := range lines {
+		c.PrintMessage("    " + line)
+	}
+	return true
+}
+
+// AwaitServerShutdown waits for a server in shutdown to stop running.
+func (c *Client) AwaitServerShutdown() {
+	deadline := time.Now().Add(5 * time.Second)
+	for c.ServerIsRunning() {
+		if time.Now().After(deadline) {
+			c.err = errors.New("timeout exceeded waiting for server shutdown")
+			return
 		}
-	}(notifyChan)
-	select {
-	case <-notifyChan:
-		return
-	// TODO: Make timeout configurable
-	case <-time.After(5 * time.Second):
-		close(notifyChan)
-		c.err = errors.New("timeout exceeded trying to bring up server")
+		time.Sleep(20 * time.Millisecond)
 	}
 }
 
 // ServerIsRunning tries to determine whether the server is running.
 func (c *Client) ServerIsRunning() bool {
-	running, _ := server.IsRunning(c.conf)
+	running, err := server.IsRunning(c.conf)
+	if err != nil && !c.Failed() {
+		// E.g. an unusable socket, which the user needs to know about
+		c.err = err
+	}
 	return running
 }
 
@@ -251,6 +523,16 @@ func (c *Client) PrintMessage(message string) {
 	fmt.Fprintln(c.msgout, message)
 }
 
+// Confirm asks a yes-or-no question on the terminal, defaulting to no. The
+// answer is read from in, which is used as is if already buffered, so that
+// further answers can be read from it.
+func Confirm(in io.Reader, question string) bool {
+	fmt.Print(question + " [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // Print a short command description to the user.
 func (c *Client) PrintShortDescription(desc argparse.Description) {
 	fmt.Fprintln(c.msgout, os.Args[0], desc.Cmd, desc.First, desc.Second, desc.What)
@@ -270,6 +552,39 @@ func operationDescriptions() []argparse.Description {
 	return descriptions
 }
 
+// OperationNames gives the names of all available commands in alphabetical order.
+func OperationNames() []string {
+	var names []string
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParamNames gives the parameter names accepted by the given command.
+func ParamNames(cmd string) []string {
+	var names []string
+	if op, ok := operations[cmd]; ok {
+		for _, par := range op.Parser().ParamDescription() {
+			if par.ParamName != "" {
+				names = append(names, par.ParamName)
+			}
+		}
+	}
+	return names
+}
+
+// Specs describes the syntax of all commands, ordered by name.
+func Specs() []argparse.Spec {
+	var specs []argparse.Spec
+	for _, name := range OperationNames() {
+		op := operations[name]
+		specs = append(specs, op.Parser().Spec(op.DescribeShort().What))
+	}
+	return specs
+}
+
 // Whether a command with the given name exists.
 func (c *Client) CommandExists(cmd string) bool {
 	_, ok := operations[cmd]
@@ -278,35 +593,69 @@ func (c *Client) CommandExists(cmd string) bool {
 
 // PrintSingleOperationHelp prints the detailed help for a single command.
 func (c *Client) PrintSingleOperationHelp(cmd string) error {
-	if op, ok := operations[cmd]; ok {
-		header, footer := op.HelpHeaderAndFooter()
-		// Summary
-		sdesc := op.DescribeShort()
-		fmt.Fprintln(c.msgout, "Usage:", os.Args[0], sdesc.Cmd, sdesc.First, sdesc.Second)
-		// Header
-		fmt.Fprintf(c.msgout, "\n%s\n", header)
-		// Describe required task name(s), if any
-		if tdesc := op.Parser().TaskDescription(); tdesc != "" {
-			fmt.Fprintf(c.msgout, "\nRequired task information\n\t%s\n", tdesc)
+	op, ok := operations[cmd]
+	if !ok {
+		return errors.Errorf("No such operation: %s", cmd)
+	}
+	header, footer := op.HelpHeaderAndFooter()
+	// Summary
+	fmt.Fprintln(c.msgout, usageLine(op.DescribeShort()))
+	// Header
+	fmt.Fprintf(c.msgout, "\n%s\n", header)
+	// Describe required task name(s), if any
+	if tdesc := op.Parser().TaskDescription(); tdesc != "" {
+		fmt.Fprintf(c.msgout, "\nRequired task information\n    %s\n", tdesc)
+	}
+	// Argument and parameter description
+	var args, params []argparse.ParamDescription
+	for _, desc := range op.Parser().ParamDescription() {
+		if desc.ParamName == "" {
+			args = append(args, desc)
+		} else {
+			params = append(params, desc)
+		}
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(c.msgout, "\nArguments\n")
+		w := tabwriter.NewWriter(c.msgout, 4, 4, 2, ' ', 0)
+		for _, arg := range args {
+			fmt.Fprintf(w, "    %s\t%s\n", arg.ParamValues, arg.ParamExplanation)
 		}
-		// Parameter description
-		if pdesc := op.Parser().ParamDescription(); len(pdesc) > 0 {
-			fmt.Fprintf(c.msgout, "\nPossible parameters\n")
-			w := tabwriter.NewWriter(c.msgout, 4, 4, 2, ' ', 0)
-			for _, par := range pdesc {
-				fmt.Fprintf(w, "    %s\t%s\t%s\n",
-					par.ParamName, par.ParamValues, par.ParamExplanation)
+		w.Flush()
+	}
+	if len(params) > 0 {
+		fmt.Fprintf(c.msgout, "\nPossible parameters\n")
+		w := tabwriter.NewWriter(c.msgout, 4, 4, 2, ' ', 0)
+		takesValues := false
+		for _, par := range params {
+			if par.ParamValues != "" {
+				takesValues = true
 			}
-			w.Flush()
+			fmt.Fprintf(w, "    %s\t%s\t%s\n",
+				par.ParamName, par.ParamValues, par.ParamExplanation)
 		}
-		// Footer
-		if footer != "" {
-			fmt.Fprintf(c.msgout, "\n%s\n", footer)
+		w.Flush()
+		if takesValues {
+			fmt.Fprintf(c.msgout, "\nValues can be given as %[1]sparam=value or %[1]sparam value\n",
+				argparse.ParamIdentifierPrefix)
 		}
-		return nil
-	} else {
-		return errors.Errorf("No such operation: %s", cmd)
 	}
+	// Footer
+	if footer != "" {
+		fmt.Fprintf(c.msgout, "\n%s\n", footer)
+	}
+	return nil
+}
+
+// Compose the usage line for a command, omitting empty argument classes.
+func usageLine(desc argparse.Description) string {
+	words := []string{"Usage:", os.Args[0], desc.Cmd}
+	for _, class := range []string{desc.First, desc.Second} {
+		if class != "" {
+			words = append(words, class)
+		}
+	}
+	return strings.Join(words, " ")
 }
 
 // PrintAllOperationsHelp prints a command usage overview for the user.
@@ -337,6 +686,11 @@ func printError(err error, w io.Writer) {
 	fmt.Fprintln(w, err.Error())
 }
 
+// Whether the argument is a request for help.
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == config.CLI_HELP
+}
+
 // Print the error, the usage message, then exit with error status.
 func showUsageAndDie(err error) {
 	printError(err, os.Stderr)
@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fgahr/tilo/client"
+	_ "github.com/fgahr/tilo/command/shutdown"
+	_ "github.com/fgahr/tilo/command/srvcmd"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/server"
+	_ "github.com/fgahr/tilo/server/backend/sqlite3"
+)
+
+// The test binary doubles as the server started in the background, as it
+// is started in place of the tilo executable.
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == "server" && os.Args[2] == "run" {
+		conf, args, err := config.GetConfig(os.Args[1:], os.Environ())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else if !client.Dispatch(conf, args) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Configure the client to run with its own files in the directory.
+func testConfig(t *testing.T, dir string) *config.Opts {
+	t.Setenv(config.ENV_VAR_PREFIX+"CONF_FILE", filepath.Join(dir, "config"))
+	t.Setenv(config.ENV_VAR_PREFIX+"SOCKET", filepath.Join(dir, "run", "server"))
+	t.Setenv(config.ENV_VAR_PREFIX+"START_TIMEOUT", "10s")
+	if os.Getenv(config.ENV_VAR_PREFIX+"DB_FILE") == "" {
+		t.Setenv(config.ENV_VAR_PREFIX+"DB_FILE", filepath.Join(dir, "tilo.db"))
+	}
+	conf, _, err := config.GetConfig(nil, os.Environ())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestColdStart(t *testing.T) {
+	conf := testConfig(t, t.TempDir())
+	if running, err := server.IsRunning(conf); err != nil || running {
+		t.Fatalf("Server running before start: %v", err)
+	}
+	if !client.Dispatch(conf, []string{"server", "start"}) {
+		t.Fatal("Failed to start server")
+	}
+	if running, err := server.IsRunning(conf); err != nil || !running {
+		t.Fatalf("Server not running after start: %v", err)
+	}
+
+	if !client.Dispatch(conf, []string{"server", "stop"}) {
+		t.Fatal("Failed to stop server")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for running, _ := server.IsRunning(conf); running; running, _ = server.IsRunning(conf) {
+		if time.Now().After(deadline) {
+			t.Fatal("Server still running after stop")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	dir := t.TempDir()
+	// The database cannot be created, making the server exit at once
+	t.Setenv(config.ENV_VAR_PREFIX+"DB_FILE", filepath.Join(dir, "missing", "tilo.db"))
+	conf := testConfig(t, dir)
+	start := time.Now()
+	if client.Dispatch(conf, []string{"server", "start"}) {
+		t.Fatal("Started server without a database")
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("Waited %s for a server which had exited", waited)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// The columns of structured output, in order. Durations are given in seconds
+// and times in RFC 3339 format.
+var recordColumns = []string{"id", "task", "period", "start", "end", "duration", "note"}
+
+// A single result in structured output. Fields without a value for the kind
+// of result, e.g. the end of an active task, are null in JSON and empty in
+// CSV.
+type record struct {
+	ID       *int64  `json:"id"`
+	Task     string  `json:"task"`
+	Period   *string `json:"period"`
+	Start    string  `json:"start"`
+	End      *string `json:"end"`
+	Duration int64   `json:"duration"`
+	Note     *string `json:"note"`
+}
+
+func (r record) columns() []string {
+	orEmpty := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	id := ""
+	if r.ID != nil {
+		id = strconv.FormatInt(*r.ID, 10)
+	}
+	return []string{id, r.Task, orEmpty(r.Period), r.Start, orEmpty(r.End),
+		strconv.FormatInt(r.Duration, 10), orEmpty(r.Note)}
+}
+
+func timeField(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// The results contained in a response, if it has any in structured form or
+// nothing else to show.
+func records(resp msg.Response, now time.Time) ([]record, bool) {
+	var recs []record
+	for _, e := range resp.Entries {
+		id, end, note := e.ID, timeField(e.Ended), e.Note
+		recs = append(recs, record{ID: &id, Task: e.Task, Start: timeField(e.Started),
+			End: &end, Duration: int64(e.Ended.Sub(e.Started).Seconds()), Note: &note})
+	}
+	for _, s := range resp.Summary {
+		period := strings.Join(append([]string{s.Details.Type}, s.Details.Elems...), " ")
+		end := timeField(s.End)
+		recs = append(recs, record{Task: s.Task, Period: &period, Start: timeField(s.Start),
+			End: &end, Duration: int64(s.Total.Seconds())})
+	}
+	for _, task := range resp.Tasks {
+		note := task.Note
+		rec := record{Task: task.Name, Start: timeField(task.Started), Note: &note}
+		if task.HasEnded {
+			end := timeField(task.Ended)
+			rec.End = &end
+			rec.Duration = int64(task.Ended.Sub(task.Started).Seconds())
+		} else {
+			rec.Duration = int64(now.Sub(task.Started).Seconds())
+		}
+		recs = append(recs, rec)
+	}
+	return recs, resp.Structured || len(resp.Body) == 0
+}
+
+// Print a response in the configured machine-readable format. Responses
+// without structured results are printed line by line.
+func writeStructured(out io.Writer, format string, resp msg.Response) error {
+	recs, structured := records(resp, time.Now())
+	switch format {
+	case config.OUTPUT_JSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if !structured {
+			return enc.Encode(resp.Body)
+		} else if recs == nil {
+			recs = []record{}
+		}
+		return enc.Encode(recs)
+	case config.OUTPUT_CSV:
+		w := csv.NewWriter(out)
+		if !structured {
+			w.WriteAll(resp.Body)
+			return w.Error()
+		}
+		w.Write(recordColumns)
+		for _, rec := range recs {
+			w.Write(rec.columns())
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return errors.Errorf("Unknown output format: %s (expected %s, %s or %s)",
+			format, config.OUTPUT_TABLE, config.OUTPUT_JSON, config.OUTPUT_CSV)
+	}
+}
@@ -0,0 +1,62 @@
+// Package clipboard puts text into the system clipboard.
+package clipboard
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A program reading text to copy from its standard input.
+type program struct {
+	name string
+	args []string
+}
+
+// Clipboard programs in order of preference. Those not installed are skipped.
+var programs = []program{
+	{"wl-copy", nil},
+	{"xclip", []string{"-selection", "clipboard"}},
+	{"xsel", []string{"--clipboard", "--input"}},
+	{"pbcopy", nil},
+	{"clip.exe", nil},
+}
+
+// Copy puts the text into the clipboard, using the first clipboard program
+// available. Failing that, e.g. on a remote machine, the terminal is asked
+// to do it via an OSC 52 escape sequence, which not all terminals support.
+// Gives the means used.
+func Copy(text string) (string, error) {
+	for _, p := range programs {
+		if _, err := exec.LookPath(p.name); err != nil {
+			continue
+		}
+		// Programs may be present without a display to connect to
+		if err := run(p, text); err == nil {
+			return p.name, nil
+		}
+	}
+	return "terminal (OSC 52)", osc52(text)
+}
+
+func run(p program, text string) error {
+	cmd := exec.Command(p.name, p.args...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// Write the OSC 52 sequence setting the clipboard to the controlling
+// terminal.
+func osc52(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "No clipboard program found and no terminal to use instead")
+	}
+	defer tty.Close()
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
@@ -1,6 +1,8 @@
 package abort
 
 import (
+	"time"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
@@ -9,6 +11,11 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	paramKeep      = "keep"
+	paramKeepUntil = "keep-until"
+)
+
 type operation struct {
 	// No state required
 }
@@ -18,7 +25,11 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+	return argparse.CommandParser(op.Command()).WithOptionalTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Option(paramKeep, "<duration>", "Save the first part of the session, e.g. 30m"),
+			argparse.Option(paramKeepUntil, "<HH:MM>", "Save the session up to the given time of day"),
+		}))
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -27,27 +38,128 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Abort the currently active task without logging the time"
-	footer := "Use the `stop` command to log the time of a task"
+	footer := "Use the `stop` command to log the time of a task\n\n" +
+		"If parallel tasks are allowed (allow_parallel), all active tasks are aborted\n" +
+		"unless a task is given\n\n" +
+		"With :keep or :keep-until, the session is truncated instead and the part\n" +
+		"before the cut is saved as if the task had been stopped then\n\n" +
+		"Examples\n" +
+		"    tilo abort :keep=30m          # Only the first half hour was spent on it\n" +
+		"    tilo abort :keep-until=14:00  # Forgot to stop at two o'clock"
 	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
 	cl.SendReceivePrint(cmd)
 	return errors.Wrap(cl.Error(), "Failed to stop the current task")
 }
 
+func (op operation) Validate(cmd msg.Cmd) error {
+	_, err := cutAt(cmd, time.Now())
+	return err
+}
+
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
-	task, stopped := srv.StopCurrentTask()
-	if stopped {
+	cut, _ := cutAt(req.Cmd, time.Now())
+	if err := cut.check(srv.ActiveTasks(), req.Cmd.TaskNames); err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	stopped := srv.StopTasks(req.Cmd.TaskNames)
+	for _, task := range stopped {
+		if kept, ok := truncate(task, cut); ok {
+			if err := srv.SaveTask(kept); err != nil {
+				resp.SetError(err)
+			}
+			task = kept
+		}
 		resp.AddStoppedTask(task)
-	} else {
+	}
+	if len(stopped) == 0 {
 		resp.SetError(errors.New("No active task"))
 	}
 	return srv.Answer(req, resp)
 }
 
+// Where to cut off an aborted session: a duration after its start or a
+// time of day. Without either, nothing is kept.
+type cut struct {
+	keep  time.Duration
+	until time.Time
+}
+
+func cutAt(cmd msg.Cmd, now time.Time) (cut, error) {
+	keep, hasKeep := cmd.Opts[paramKeep]
+	until, hasUntil := cmd.Opts[paramKeepUntil]
+	var c cut
+	if hasKeep && hasUntil {
+		return c, errors.Errorf("Use either :%s or :%s", paramKeep, paramKeepUntil)
+	} else if hasKeep {
+		d, err := time.ParseDuration(keep)
+		if err != nil || d <= 0 {
+			return c, errors.Errorf("Not a positive duration: %s", keep)
+		}
+		c.keep = d
+	} else if hasUntil {
+		clock, err := time.Parse("15:04", until)
+		if err != nil {
+			return c, errors.Errorf("Not a time (HH:MM): %s", until)
+		}
+		c.until = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if c.until.After(now) {
+			return c, errors.Errorf("%s is still to come", until)
+		}
+	}
+	return c, nil
+}
+
+// Make sure that something is kept of each active task with the given names,
+// or of all of them if no names are given.
+func (c cut) check(active []msg.Task, taskNames []string) error {
+	if c.keep == 0 && c.until.IsZero() {
+		return nil
+	}
+	for _, task := range active {
+		if len(taskNames) > 0 && !contains(taskNames, task.Name) {
+			continue
+		}
+		task.Stop()
+		if _, ok := truncate(task, c); !ok {
+			return errors.Errorf("Task %s started after %s", task.Name, c.until.Format("15:04"))
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The part of a stopped task before the cut, if there is any.
+func truncate(task msg.Task, c cut) (msg.Task, bool) {
+	end := c.until
+	if c.keep > 0 {
+		end = task.Started.Add(c.keep)
+	}
+	if end.IsZero() || !end.After(task.Started) {
+		return task, false
+	}
+	if end.Before(task.Ended) {
+		task.Ended = end
+	}
+	return task, true
+}
+
 func init() {
 	command.RegisterOperation(operation{})
 }
@@ -0,0 +1,138 @@
+package amend
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramStart = "start"
+	paramEnd   = "end"
+	paramTask  = "task"
+	paramNote  = "note"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "amend"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := []argparse.Param{
+		argparse.Option(paramStart, "<time>", "Move the start, e.g. -10m, +5m or 09:15"),
+		argparse.Option(paramEnd, "<time>", "Move the end, e.g. -10m, +5m or 17:30"),
+		argparse.Option(paramTask, "<task>", "Assign the entry to another task"),
+		argparse.Option(paramNote, "<text>", "Replace the entry's note"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Correct the most recently completed entry")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Change the start, end, task or note of the most recently completed entry"
+	footer := "Times are either moved by a duration or set to a time of day (HH:MM) on the\n" +
+		"day they fall on. Use the `last` command to see which entry is affected\n\n" +
+		"Examples\n" +
+		"    tilo amend :end=-10m        # Actually stopped ten minutes ago\n" +
+		"    tilo amend :start=09:15 :task=review\n" +
+		"    tilo amend :note=\"release prep\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to amend the last entry")
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if len(cmd.Opts) == 0 {
+		return errors.New("Nothing to amend")
+	}
+	if name, ok := cmd.Opts[paramTask]; ok {
+		if names, err := argparse.GetTaskNames(name); err != nil {
+			return err
+		} else if len(names) != 1 || names[0] == argparse.AllTasks {
+			return errors.Errorf("Invalid task name: %s", name)
+		}
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if before, err := srv.Backend.LastEntry(); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to fetch the last entry"))
+	} else if before.ID == 0 {
+		resp.SetError(errors.New("No completed entries"))
+	} else if after, err := amended(before, req.Cmd, time.Now()); err != nil {
+		resp.SetError(err)
+	} else if err := srv.Backend.UpdateEntry(after); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddAmendedEntry(before, after)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The entry with the changes requested by the command applied, checking that
+// it still makes sense.
+func amended(e msg.Entry, cmd msg.Cmd, now time.Time) (msg.Entry, error) {
+	var err error
+	if value, ok := cmd.Opts[paramStart]; ok {
+		if e.Started, err = adjust(e.Started, value); err != nil {
+			return e, err
+		}
+	}
+	if value, ok := cmd.Opts[paramEnd]; ok {
+		if e.Ended, err = adjust(e.Ended, value); err != nil {
+			return e, err
+		}
+	}
+	if name, ok := cmd.Opts[paramTask]; ok {
+		e.Task = name
+	}
+	if note, ok := cmd.Opts[paramNote]; ok {
+		e.Note = strings.TrimSpace(note)
+	}
+	e.Modified = cmd.Origin
+	if !e.Ended.After(e.Started) {
+		return e, errors.New("The entry would end before it starts")
+	} else if e.Ended.After(now) {
+		return e, errors.New("The entry would end in the future")
+	}
+	return e, nil
+}
+
+// Move a time by a duration, or set it to a time of day on the same day.
+func adjust(t time.Time, value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return t.Add(d).Truncate(time.Second), nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return t, errors.Errorf("Not a time (HH:MM) or duration: %s", value)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), clock.Hour(), clock.Minute(), 0, 0, t.Location()), nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
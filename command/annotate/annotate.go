@@ -0,0 +1,78 @@
+package annotate
+
+import (
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "annotate"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<text>",
+			Description: "The text to add to the note, quoted or as several words",
+			Many:        true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Add to the note of the current task")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Add text to the note of the currently active task, saved along with the entry"
+	footer := "Repeated annotations are joined, as is a note given on `stop`\n" +
+		"With parallel tasks, this applies to the most recently started one\n\n" +
+		"Examples\n" +
+		"    tilo annotate \"pairing with Alex\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if annotation(cmd) == "" {
+		return errors.New("Empty annotation")
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to annotate the current task")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	task := srv.CurrentTask()
+	if !task.IsRunning() {
+		resp.SetError(errors.New("No active task"))
+	} else if text := annotation(req.Cmd); text == "" {
+		resp.SetError(errors.New("Empty annotation"))
+	} else if err := srv.AddNote(task.Name, text); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddCurrentTask(srv.CurrentTask())
+	}
+	return srv.Answer(req, resp)
+}
+
+// The annotation's text as given in the command.
+func annotation(cmd msg.Cmd) string {
+	return strings.TrimSpace(strings.Join(cmd.Args, " "))
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
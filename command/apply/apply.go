@@ -0,0 +1,103 @@
+package apply
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/template"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Entries are logged via the log command, see there.
+const (
+	opLog     = "log"
+	paramFrom = "from"
+	paramTo   = "to"
+	paramNote = "note"
+	paramTags = "tags"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "apply"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<template>",
+			Description: "The template to log",
+		},
+		argparse.Arg{
+			Name:        "[date]",
+			Description: "The day to log it on, as YYYY-MM-DD; today if omitted",
+			Optional:    true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Log an entry from a template")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Log the entry described by a template on a given day"
+	footer := "Templates are added with `tilo template add`. As with `tilo log`, entries\n" +
+		"overlapping with the new one are pointed out\n\n" +
+		"Examples\n" +
+		"    tilo apply standup\n" +
+		"    tilo apply standup 2023-05-02"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	t, err := template.Find(cl.Config(), cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	day := time.Now()
+	if len(cmd.Args) > 1 {
+		if day, err = time.ParseInLocation("2006-01-02", cmd.Args[1], time.Local); err != nil {
+			return errors.Errorf("Not a date (YYYY-MM-DD): %s", cmd.Args[1])
+		}
+	}
+	task, err := t.On(day)
+	if err != nil {
+		return err
+	}
+	logCmd := msg.Cmd{
+		Op:        opLog,
+		TaskNames: []string{task.Name},
+		Opts: map[string]string{
+			paramFrom: task.Started.Format("2006-01-02T15:04"),
+			paramTo:   t.Duration.String(),
+			paramNote: t.Note,
+			paramTags: t.Tags,
+		},
+	}
+	if t.Tags == "" {
+		delete(logCmd.Opts, paramTags)
+	}
+	cl.SendReceivePrint(logCmd)
+	return errors.Wrapf(cl.Error(), "Failed to apply template '%s'", t.Name)
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
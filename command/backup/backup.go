@@ -0,0 +1,270 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramIncremental = "incremental"
+	// The only action involving the server
+	actionCreate = "create"
+)
+
+// An action on the backups in the configured directory.
+type action struct {
+	description string
+	exec        func(cl *client.Client, cmd msg.Cmd, dir string) error
+}
+
+// Actions on backups take no arguments.
+func (a action) Usage() string {
+	return ""
+}
+
+func (a action) Description() string {
+	return a.description
+}
+
+// Available actions by name.
+var actions = argparse.Actions{
+	actionCreate: action{
+		description: "Write all entries, or only those added since the last backup if incremental",
+		exec:        create,
+	},
+	"verify": action{
+		description: "Check that every backup is intact and continues its predecessor",
+		exec:        verify,
+	},
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "backup"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		actions.Arg(),
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramIncremental, "Only back up entries added since the last backup"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Back up entries")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Back up entries to dated files in the backup directory"
+	footer := actions.Help() + "\n\n" +
+		"The directory is set as backup_dir in the configuration file. An incremental\n" +
+		"backup builds on the latest one, so a full backup followed by incremental ones\n" +
+		"forms a chain. Verification fails if any link of a chain is missing or damaged.\n" +
+		"Changes to entries already backed up are only captured by the next full backup\n\n" +
+		"The [backup] section of the configuration file controls further steps:\n" +
+		"    upload       s3://bucket/prefix or the http(s) URL of a WebDAV collection,\n" +
+		"                 receiving a copy of each new backup\n" +
+		"    s3_access_key, s3_secret_key, s3_region, s3_endpoint\n" +
+		"                 S3 credentials; the endpoint allows for other providers\n" +
+		"    webdav_user, webdav_password\n" +
+		"                 WebDAV credentials\n" +
+		"    keep         The number of full backups to keep, each along with the\n" +
+		"                 incremental ones following it; older ones are removed\n" +
+		"    schedule     When the server makes backups: hourly, nightly or HH:MM\n" +
+		"    incremental  Whether scheduled backups are incremental, default true\n\n" +
+		"Examples\n" +
+		"    tilo backup create\n" +
+		"    tilo backup create :incremental\n" +
+		"    tilo backup verify\n\n" +
+		"    [backup]\n" +
+		"    upload = https://dav.example.com/tilo\n" +
+		"    schedule = nightly\n" +
+		"    keep = 4"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	chosen, err := actions.Choose(cmd.Args)
+	if err != nil {
+		return err
+	}
+	act := chosen.(action)
+	return act.exec(cl, cmd, cl.Config().BackupDir.Value)
+}
+
+func create(cl *client.Client, cmd msg.Cmd, dir string) error {
+	fetch := func(after int64) ([]msg.Entry, error) {
+		cmd.Body = [][]string{{strconv.FormatInt(after, 10)}}
+		resp := cl.SendReceive(cmd)
+		if cl.Failed() {
+			return nil, cl.Error()
+		}
+		return resp.Entries, resp.Err()
+	}
+	d, err := createDump(dir, cmd.Flags[paramIncremental], fetch)
+	if err != nil {
+		return errors.Wrap(err, "Failed to back up entries")
+	} else if d == nil {
+		cl.PrintMessage("No entries added since the last backup")
+		return nil
+	}
+	cl.PrintMessage(fmt.Sprintf("Backed up %d entries to %s", len(d.entries), filepath.Join(dir, d.name)))
+	report, err := finish(cl.Config().Section(config.SectionBackup), dir, *d)
+	for _, line := range report {
+		cl.PrintMessage(line)
+	}
+	return err
+}
+
+// Entries with IDs greater than the given one, from wherever they are
+// available.
+type source func(after int64) ([]msg.Entry, error)
+
+// Create a backup in the directory. An incremental backup builds on the
+// latest one, if any, and is not created if there are no new entries; the
+// result is nil then.
+func createDump(dir string, incremental bool, fetch source) (*dump, error) {
+	names, err := dumpNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	d := dump{header: header{Kind: kindFull, Created: now}}
+	if incremental && len(names) > 0 {
+		previous, err := readDump(filepath.Join(dir, names[len(names)-1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to build on %s", previous.name)
+		}
+		d.header.Kind = kindIncremental
+		d.header.Previous = previous.name
+		d.header.After = previous.header.Last
+	}
+	d.name = dumpName(now, d.header.Kind)
+
+	if d.entries, err = fetch(d.header.After); err != nil {
+		return nil, err
+	} else if d.header.Kind == kindIncremental && len(d.entries) == 0 {
+		return nil, nil
+	}
+	d.header.Entries = len(d.entries)
+	d.header.Last = d.header.After
+	if len(d.entries) > 0 {
+		d.header.Last = d.entries[len(d.entries)-1].ID
+	}
+	if err := writeDump(dir, d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Upload a new backup and remove old ones, as configured in the backup
+// section. Gives a line for each step taken.
+func finish(section map[string]string, dir string, d dump) ([]string, error) {
+	var report []string
+	remote, err := targetFrom(section)
+	if err != nil {
+		return report, err
+	}
+	if remote != nil {
+		data, err := ioutil.ReadFile(filepath.Join(dir, d.name))
+		if err != nil {
+			return report, err
+		}
+		if err := remote.put(d.name, data); err != nil {
+			return report, errors.Wrap(err, "Upload failed")
+		}
+		report = append(report, "Uploaded to "+remote.String())
+	}
+
+	keep, err := retention(section)
+	if err != nil || keep == 0 {
+		return report, err
+	}
+	removed, err := prune(dir, keep)
+	for _, name := range removed {
+		report = append(report, "Removed old backup "+name)
+		if remote != nil {
+			if err := remote.remove(name); err != nil {
+				return report, errors.Wrapf(err, "Unable to remove %s from %s", name, remote)
+			}
+		}
+	}
+	return report, err
+}
+
+func verify(cl *client.Client, cmd msg.Cmd, dir string) error {
+	names, err := dumpNames(dir)
+	if err != nil {
+		return err
+	} else if len(names) == 0 {
+		return errors.Errorf("No backups in %s", dir)
+	}
+	var previous *dump
+	broken := 0
+	for _, name := range names {
+		d, err := readDump(filepath.Join(dir, name))
+		if err == nil {
+			err = checkLink(d, previous)
+		}
+		if err != nil {
+			cl.PrintMessage(fmt.Sprintf("%s  BROKEN: %v", name, err))
+			broken++
+			previous = nil
+			continue
+		}
+		cl.PrintMessage(d.String())
+		previous = &d
+	}
+	if broken > 0 {
+		return errors.Errorf("%d of %d backups broken", broken, len(names))
+	}
+	cl.PrintMessage(fmt.Sprintf("All %d backups complete, up to ID %d", len(names), previous.header.Last))
+	return nil
+}
+
+// Only creating backups involves the server, giving the entries after the
+// ID in the body.
+func (op operation) Validate(cmd msg.Cmd) error {
+	if cmd.Args[0] != actionCreate {
+		return errors.New("Not a valid server action: " + cmd.Args[0])
+	} else if len(cmd.Body) != 1 || len(cmd.Body[0]) != 1 {
+		return errors.New("Expected the ID to start after")
+	} else if _, err := strconv.ParseInt(cmd.Body[0][0], 10, 64); err != nil {
+		return errors.Errorf("Invalid ID: %s", cmd.Body[0][0])
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	after, _ := strconv.ParseInt(req.Cmd.Body[0][0], 10, 64)
+	if entries, err := srv.Backend.EntriesAfter(after); err != nil {
+		resp.SetError(errors.Wrap(err, "Error in database query"))
+	} else {
+		resp.AddRawEntries(entries)
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
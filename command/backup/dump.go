@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// Kinds of dumps.
+const (
+	kindFull        = "full"
+	kindIncremental = "incremental"
+)
+
+const (
+	filePrefix = "tilo-"
+	fileSuffix = ".jsonl"
+)
+
+// The first line of a dump file, describing its contents.
+type header struct {
+	Kind     string    `json:"kind"`
+	Created  time.Time `json:"created"`
+	Previous string    `json:"previous,omitempty"` // The dump an incremental one builds on
+	After    int64     `json:"after"`              // Entries with greater IDs are contained
+	Last     int64     `json:"last"`               // The greatest ID covered
+	Entries  int       `json:"entries"`
+}
+
+// A dump file, consisting of a header followed by one entry per line.
+type dump struct {
+	name    string
+	header  header
+	entries []msg.Entry
+}
+
+// The name of a dump created at the given time. Names sort by creation time.
+func dumpName(created time.Time, kind string) string {
+	return filePrefix + created.Format("20060102-150405") + "-" + kind + fileSuffix
+}
+
+// Write a dump to the directory. Existing files are never overwritten.
+func writeDump(dir string, d dump) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "Unable to create backup directory")
+	}
+	path := filepath.Join(dir, d.name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create backup file")
+	}
+	out := bufio.NewWriter(file)
+	enc := json.NewEncoder(out)
+	err = enc.Encode(d.header)
+	for i := 0; err == nil && i < len(d.entries); i++ {
+		err = enc.Encode(d.entries[i])
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return errors.Wrapf(err, "Failed to write %s", path)
+	}
+	return nil
+}
+
+// Read a dump file, checking that it holds as many entries as announced.
+func readDump(path string) (dump, error) {
+	d := dump{name: filepath.Base(path)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return d, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if err := json.Unmarshal([]byte(lines[0]), &d.header); err != nil {
+		return d, errors.Wrap(err, "Malformed header")
+	}
+	for i, line := range lines[1:] {
+		var e msg.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return d, errors.Wrapf(err, "Malformed entry in line %d", i+2)
+		}
+		d.entries = append(d.entries, e)
+	}
+	if len(d.entries) != d.header.Entries {
+		return d, errors.Errorf("Expected %d entries but found %d", d.header.Entries, len(d.entries))
+	}
+	return d, nil
+}
+
+// Names of all dump files in the directory, oldest first.
+func dumpNames(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Unable to read backup directory")
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), filePrefix) && strings.HasSuffix(f.Name(), fileSuffix) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Check the dump against its predecessor, if any. A full dump starts a new
+// chain, an incremental one needs to continue where the previous one ended.
+func checkLink(d dump, previous *dump) error {
+	h := d.header
+	switch h.Kind {
+	case kindFull:
+		if h.After != 0 {
+			return errors.Errorf("Full backup starts after ID %d", h.After)
+		}
+	case kindIncremental:
+		if previous == nil {
+			return errors.New("Incremental backup without a preceding one")
+		} else if h.Previous != previous.name {
+			return errors.Errorf("Builds on %s but follows %s", h.Previous, previous.name)
+		} else if h.After != previous.header.Last {
+			return errors.Errorf("Starts after ID %d but the previous backup ends at %d",
+				h.After, previous.header.Last)
+		}
+	default:
+		return errors.Errorf("Unknown kind of backup: %s", h.Kind)
+	}
+	last := h.After
+	for _, e := range d.entries {
+		if e.ID <= last || e.ID > h.Last {
+			return errors.Errorf("Entry with ID %d out of order or range", e.ID)
+		}
+		last = e.ID
+	}
+	return nil
+}
+
+// A short description of the dump.
+func (d dump) String() string {
+	return fmt.Sprintf("%s  %d entries, IDs %d to %d", d.name, d.header.Entries, d.header.After+1, d.header.Last)
+}
+
+// Remove all but the latest full backups and the incremental ones building on
+// them, keeping the given number of chains. Gives the names of the removed
+// files.
+func prune(dir string, keep int) ([]string, error) {
+	names, err := dumpNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	chains := 0
+	cut := 0
+	for i := len(names) - 1; i >= 0; i-- {
+		if strings.HasSuffix(names[i], "-"+kindFull+fileSuffix) {
+			if chains++; chains == keep {
+				cut = i
+				break
+			}
+		}
+	}
+	var removed []string
+	for _, name := range names[:cut] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return removed, errors.Wrap(err, "Unable to remove old backup")
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// ReadChain gives all entries backed up as of the given dump file, i.e. those
+// of the full backup it builds on and of the incremental ones up to it. For a
+// directory, the latest backup in it is used.
+func ReadChain(path string) ([]msg.Entry, error) {
+	dir, name := filepath.Split(path)
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		dir, name = path, ""
+	}
+	names, err := dumpNames(dir)
+	if err != nil {
+		return nil, err
+	} else if len(names) == 0 {
+		return nil, errors.Errorf("No backups in %s", dir)
+	}
+	end := len(names) - 1
+	if name != "" {
+		if end = sort.SearchStrings(names, name); end == len(names) || names[end] != name {
+			return nil, errors.Errorf("Not a backup file: %s", path)
+		}
+	}
+	start := end
+	for start > 0 && !strings.HasSuffix(names[start], "-"+kindFull+fileSuffix) {
+		start--
+	}
+
+	var entries []msg.Entry
+	var previous *dump
+	for _, name := range names[start : end+1] {
+		d, err := readDump(filepath.Join(dir, name))
+		if err == nil {
+			err = checkLink(d, previous)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Broken backup %s", name)
+		}
+		entries = append(entries, d.entries...)
+		previous = &d
+	}
+	return entries, nil
+}
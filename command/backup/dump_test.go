@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// A dump of entries with the given IDs, covering those up to last.
+func testDump(name string, kind string, previous string, after int64, last int64, ids ...int64) dump {
+	d := dump{name: name, header: header{Kind: kind, Previous: previous, After: after, Last: last, Entries: len(ids)}}
+	for _, id := range ids {
+		started := time.Unix(1700000000+id*3600, 0)
+		d.entries = append(d.entries, msg.Entry{ID: id, Task: "task", Started: started, Ended: started.Add(time.Hour)})
+	}
+	return d
+}
+
+func entryIDs(entries []msg.Entry) []int64 {
+	var ids []int64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestCheckLink(t *testing.T) {
+	full := testDump("tilo-20240101-000000-full.jsonl", kindFull, "", 0, 5, 1, 3, 5)
+	cases := []struct {
+		desc     string
+		d        dump
+		previous *dump
+		valid    bool
+	}{
+		{"full", full, nil, true},
+		{"full after another", full, &full, true},
+		{"empty full", testDump("a", kindFull, "", 0, 0), nil, true},
+		{"full starting late", testDump("a", kindFull, "", 2, 5, 3, 5), nil, false},
+		{"incremental", testDump("b", kindIncremental, full.name, 5, 8, 6, 8), &full, true},
+		{"empty incremental", testDump("b", kindIncremental, full.name, 5, 5), &full, true},
+		{"incremental alone", testDump("b", kindIncremental, full.name, 5, 8, 6, 8), nil, false},
+		{"incremental on another", testDump("b", kindIncremental, "other", 5, 8, 6, 8), &full, false},
+		{"incremental with gap", testDump("b", kindIncremental, full.name, 6, 8, 7, 8), &full, false},
+		{"incremental with overlap", testDump("b", kindIncremental, full.name, 4, 8, 5, 8), &full, false},
+		{"entry covered before", testDump("b", kindIncremental, full.name, 5, 8, 4, 8), &full, false},
+		{"entry beyond last", testDump("b", kindIncremental, full.name, 5, 8, 6, 9), &full, false},
+		{"entries out of order", testDump("b", kindIncremental, full.name, 5, 8, 8, 6), &full, false},
+		{"unknown kind", testDump("b", "partial", "", 0, 5, 1), nil, false},
+	}
+	for _, c := range cases {
+		if err := checkLink(c.d, c.previous); c.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("%s: expected an error", c.desc)
+		}
+	}
+}
+
+// Write the dumps to the directory, failing the test on error.
+func writeDumps(t *testing.T, dir string, dumps ...dump) {
+	for _, d := range dumps {
+		if err := writeDump(dir, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"tilo-20240101-000000-full.jsonl",
+		"tilo-20240102-000000-incremental.jsonl",
+		"tilo-20240108-000000-full.jsonl",
+		"tilo-20240109-000000-incremental.jsonl",
+		"tilo-20240110-000000-incremental.jsonl",
+		"tilo-20240115-000000-full.jsonl",
+		"tilo-20240116-000000-incremental.jsonl",
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not a backup, left alone
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := prune(dir, 5); err != nil || len(removed) != 0 {
+		t.Errorf("Expected nothing to be removed with fewer chains than kept, got %v, %v", removed, err)
+	}
+	removed, err := prune(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, names[:2]) {
+		t.Errorf("Expected %v to be removed, got %v", names[:2], removed)
+	}
+	left, err := dumpNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(left, names[2:]) {
+		t.Errorf("Expected %v to be left, got %v", names[2:], left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("Expected other files to be kept: %v", err)
+	}
+}
+
+func TestReadChain(t *testing.T) {
+	dir := t.TempDir()
+	first := testDump("tilo-20240101-000000-full.jsonl", kindFull, "", 0, 3, 1, 2, 3)
+	firstInc := testDump("tilo-20240102-000000-incremental.jsonl", kindIncremental, first.name, 3, 4, 4)
+	second := testDump("tilo-20240108-000000-full.jsonl", kindFull, "", 0, 6, 1, 2, 4, 6)
+	secondInc := testDump("tilo-20240109-000000-incremental.jsonl", kindIncremental, second.name, 6, 6)
+	lastInc := testDump("tilo-20240110-000000-incremental.jsonl", kindIncremental, secondInc.name, 6, 9, 7, 9)
+	writeDumps(t, dir, first, firstInc, second, secondInc, lastInc)
+
+	cases := []struct {
+		path string
+		ids  []int64
+	}{
+		{dir, []int64{1, 2, 4, 6, 7, 9}},
+		{filepath.Join(dir, lastInc.name), []int64{1, 2, 4, 6, 7, 9}},
+		{filepath.Join(dir, secondInc.name), []int64{1, 2, 4, 6}},
+		{filepath.Join(dir, second.name), []int64{1, 2, 4, 6}},
+		{filepath.Join(dir, firstInc.name), []int64{1, 2, 3, 4}},
+		{filepath.Join(dir, first.name), []int64{1, 2, 3}},
+	}
+	for _, c := range cases {
+		entries, err := ReadChain(c.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.path, err)
+		} else if ids := entryIDs(entries); !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: expected entries %v, got %v", c.path, c.ids, ids)
+		}
+	}
+
+	if _, err := ReadChain(filepath.Join(dir, "tilo-20240103-000000-full.jsonl")); err == nil {
+		t.Error("Expected an error for a missing backup file")
+	}
+	if _, err := ReadChain(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory without backups")
+	}
+}
+
+func TestReadChainBroken(t *testing.T) {
+	dir := t.TempDir()
+	full := testDump("tilo-20240101-000000-full.jsonl", kindFull, "", 0, 3, 1, 2, 3)
+	// Entry 4 would be missing, as the increment starts too late
+	inc := testDump("tilo-20240102-000000-incremental.jsonl", kindIncremental, full.name, 4, 5, 5)
+	writeDumps(t, dir, full, inc)
+	if _, err := ReadChain(dir); err == nil {
+		t.Error("Expected an error for a broken chain")
+	}
+	if entries, err := ReadChain(filepath.Join(dir, full.name)); err != nil || len(entries) != 3 {
+		t.Errorf("Expected the full backup alone to be intact, got %d entries, %v", len(entries), err)
+	}
+
+	// Fewer entries than announced
+	short := testDump("tilo-20240103-000000-full.jsonl", kindFull, "", 0, 2, 1, 2)
+	short.header.Entries = 3
+	writeDumps(t, dir, short)
+	if _, err := ReadChain(dir); err == nil {
+		t.Error("Expected an error for a truncated backup")
+	}
+}
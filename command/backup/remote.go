@@ -0,0 +1,224 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Keys in the backup section of the configuration file concerning uploads.
+const (
+	keyUpload         = "upload"
+	keyS3Endpoint     = "s3_endpoint"
+	keyS3Region       = "s3_region"
+	keyS3AccessKey    = "s3_access_key"
+	keyS3SecretKey    = "s3_secret_key"
+	keyWebDAVUser     = "webdav_user"
+	keyWebDAVPassword = "webdav_password"
+)
+
+const defaultS3Region = "us-east-1"
+
+// A target receives copies of backup files.
+type target interface {
+	// Store a file under the given name, replacing any prior version
+	put(name string, data []byte) error
+	// Remove the file with the given name; removing a missing file is fine
+	remove(name string) error
+	// Where the files go
+	String() string
+}
+
+// The target configured in the backup section, nil if there is none. An
+// s3:// URL names a bucket and optional prefix, http(s):// a WebDAV
+// collection.
+func targetFrom(section map[string]string) (target, error) {
+	location := section[keyUpload]
+	if location == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid upload target: %s", location)
+	}
+	switch u.Scheme {
+	case "s3":
+		t := s3Target{
+			bucket:    u.Host,
+			prefix:    strings.Trim(u.Path, "/"),
+			endpoint:  strings.TrimRight(section[keyS3Endpoint], "/"),
+			region:    section[keyS3Region],
+			accessKey: section[keyS3AccessKey],
+			secretKey: section[keyS3SecretKey],
+		}
+		if t.region == "" {
+			t.region = defaultS3Region
+		}
+		if t.endpoint == "" {
+			t.endpoint = "https://s3." + t.region + ".amazonaws.com"
+		}
+		if t.bucket == "" || t.accessKey == "" || t.secretKey == "" {
+			return nil, errors.Errorf("S3 upload requires a bucket, %s and %s", keyS3AccessKey, keyS3SecretKey)
+		}
+		return t, nil
+	case "http", "https":
+		return webdavTarget{
+			base:     strings.TrimRight(location, "/"),
+			user:     section[keyWebDAVUser],
+			password: section[keyWebDAVPassword],
+		}, nil
+	default:
+		return nil, errors.Errorf("Unsupported upload target: %s", location)
+	}
+}
+
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// Perform a request, failing unless the response has one of the given codes.
+func do(req *http.Request, accepted ...int) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, code := range accepted {
+		if resp.StatusCode == code {
+			io.Copy(ioutil.Discard, resp.Body)
+			return nil
+		}
+	}
+	detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return errors.Errorf("%s %s: %s %s", req.Method, req.URL, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// A WebDAV collection, which needs to exist already.
+type webdavTarget struct {
+	base     string
+	user     string
+	password string
+}
+
+func (t webdavTarget) request(method string, name string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, t.base+"/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if t.user != "" {
+		req.SetBasicAuth(t.user, t.password)
+	}
+	return req, nil
+}
+
+func (t webdavTarget) put(name string, data []byte) error {
+	req, err := t.request(http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+	return do(req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+func (t webdavTarget) remove(name string) error {
+	req, err := t.request(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	return do(req, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+func (t webdavTarget) String() string {
+	return t.base
+}
+
+// A bucket of an S3-compatible storage, addressed path-style so that other
+// providers work as well.
+type s3Target struct {
+	bucket    string
+	prefix    string
+	endpoint  string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+// Create a request signed with AWS signature version 4.
+func (t s3Target) request(method string, name string, body []byte) (*http.Request, error) {
+	key := name
+	if t.prefix != "" {
+		key = t.prefix + "/" + name
+	}
+	req, err := http.NewRequest(method, t.endpoint+"/"+t.bucket+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", stamp)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		method,
+		req.URL.EscapedPath(),
+		"", // No query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + stamp,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + t.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	signingKey := []byte("AWS4" + t.secretKey)
+	for _, part := range []string{day, t.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func (t s3Target) put(name string, data []byte) error {
+	req, err := t.request(http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+	return do(req, http.StatusOK)
+}
+
+func (t s3Target) remove(name string) error {
+	req, err := t.request(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	return do(req, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+func (t s3Target) String() string {
+	return strings.TrimRight("s3://"+t.bucket+"/"+t.prefix, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
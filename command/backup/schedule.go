@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Keys in the backup section of the configuration file concerning scheduled
+// backups and retention.
+const (
+	keySchedule    = "schedule"
+	keyIncremental = "incremental"
+	keyKeep        = "keep"
+)
+
+// The number of backup chains to keep, 0 for all of them.
+func retention(section map[string]string) (int, error) {
+	value, ok := section[keyKeep]
+	if !ok {
+		return 0, nil
+	}
+	keep, err := strconv.Atoi(value)
+	if err != nil || keep < 1 {
+		return 0, errors.Errorf("Invalid number of backups to keep: %s", value)
+	}
+	return keep, nil
+}
+
+// Backups made by the server as scheduled.
+type job struct {
+	// No state required
+}
+
+func (j job) Next(conf *config.Opts, after time.Time) time.Time {
+	// Errors are reported when running the job
+	next, err := server.NextScheduled(conf.Section(config.SectionBackup)[keySchedule], after)
+	if err != nil {
+		return after.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// Only fetching the entries requires the server to be locked. The backup is
+// written, uploaded and pruned without holding back requests.
+func (j job) Run(srv *server.Server) error {
+	srv.Lock()
+	section := srv.Config().Section(config.SectionBackup)
+	dir := srv.Config().BackupDir.Value
+	srv.Unlock()
+	if _, err := server.NextScheduled(section[keySchedule], time.Now()); err != nil {
+		return errors.Wrap(err, "Invalid backup configuration")
+	}
+	incremental := true
+	if value, ok := section[keyIncremental]; ok {
+		var err error
+		if incremental, err = strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			return errors.Errorf("Invalid value for %s: %s", keyIncremental, value)
+		}
+	}
+	fetch := func(after int64) ([]msg.Entry, error) {
+		srv.Lock()
+		defer srv.Unlock()
+		return srv.Backend.EntriesAfter(after)
+	}
+	d, err := createDump(dir, incremental, fetch)
+	if err != nil || d == nil {
+		return err
+	}
+	_, err = finish(section, dir, *d)
+	return err
+}
+
+func init() {
+	server.RegisterJob("backup", job{})
+}
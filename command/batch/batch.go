@@ -0,0 +1,119 @@
+package batch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	fromStdin     = "-"
+	flagKeepGoing = "keep-going"
+	commentPrefix = "#"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "batch"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<file>",
+			Description: "File to read commands from; - to read from standard input",
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(flagKeepGoing, "Continue with the next command when one fails"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Execute commands read from a file")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Execute one command per line, as if given on the command line, over a single connection"
+	footer := "Empty lines and lines starting with # are skipped\n" +
+		"By default, execution stops at the first failing command\n\n" +
+		"Examples\n" +
+		"    tilo batch - < backfill.txt           # Read commands from standard input\n" +
+		"    tilo batch backfill.txt :keep-going   # Execute all commands, even if some fail"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	in := io.Reader(os.Stdin)
+	if file := cmd.Args[0]; file != fromStdin {
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "Unable to read commands")
+		}
+		defer f.Close()
+		in = f
+	}
+	return runBatch(cl, in, cmd.Flags[flagKeepGoing])
+}
+
+// Execute all commands from the input, reusing the client's connection.
+func runBatch(cl *client.Client, in io.Reader, keepGoing bool) error {
+	cl.StartSession()
+	failed, total := 0, 0
+	scanner := bufio.NewScanner(in)
+	for lnum := 1; scanner.Scan(); lnum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+		total++
+		ok := false
+		if args, err := argparse.SplitLine(line); err != nil {
+			cl.PrintError(err)
+		} else if args[0] == (operation{}).Command() || args[0] == "shell" {
+			cl.PrintError(errors.Errorf("Not allowed in batch mode: %s", args[0]))
+		} else {
+			ok = cl.Execute(args)
+		}
+		cl.Reset()
+		if !ok {
+			failed++
+			if !keepGoing {
+				return errors.Errorf("Stopped at line %d: %s", lnum, line)
+			}
+			cl.PrintMessage(fmt.Sprintf("Line %d failed, continuing: %s", lnum, line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "Failed to read commands")
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d commands failed", failed, total)
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
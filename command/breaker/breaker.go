@@ -0,0 +1,100 @@
+// Package breaker provides the break command, logging breaks on a task of
+// their own so that they can be checked against rules, see the breaks report.
+package breaker
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// As accepted by the log command, which saves past breaks.
+const (
+	paramFrom = "from"
+	paramTo   = "to"
+	paramNote = "note"
+	paramTags = "tags"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "break"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Option(paramFrom, "<time>", "When a past break started"),
+			argparse.Option(paramTo, "<time>", "When it ended, or how long it lasted"),
+			argparse.Option(paramNote, "<text>", "Attach a note to a past break"),
+		}))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Take a break, or log one after the fact")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Pause the active tasks and log a break until they are resumed"
+	footer := "Breaks are logged on the " + msg.BreakTask + " task, tagged " + msg.BreakTag + ". Use `resume` to end the\n" +
+		"break and continue the paused tasks, or start another task to end both.\n" +
+		"With :from and :to, a past break is logged instead, as with the `log` command\n\n" +
+		"Entries on other tasks count as breaks as well when tagged " + msg.BreakTag + ".\n" +
+		"Use `tilo report breaks` to check them against the rules in [" + config.SectionBreakRules + "]\n\n" +
+		"Examples\n" +
+		"    tilo break                        # Off to lunch\n" +
+		"    tilo resume                       # Back again\n" +
+		"    tilo break :from=12:15 :to=45m    # Forgot to log lunch"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	_, from := cmd.Opts[paramFrom]
+	_, to := cmd.Opts[paramTo]
+	if !from && !to {
+		cl.SendReceivePrint(cmd)
+		return errors.Wrap(cl.Error(), "Failed to take a break")
+	} else if !from || !to {
+		return errors.New("Require both :from and :to for a past break")
+	}
+	cmd.Op = "log"
+	cmd.TaskNames = []string{msg.BreakTask}
+	cmd.Opts[paramTags] = msg.BreakTag
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to log the break")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if srv.IsActive(msg.BreakTask) {
+		resp.SetError(errors.New("Already on a break"))
+		return srv.Answer(req, resp)
+	}
+	for _, task := range srv.Break() {
+		// Too short to keep, but resumed all the same
+		if srv.TooShort(task) {
+			resp.AddDiscardedTask(task)
+		} else if err := srv.SaveTask(task); err != nil {
+			resp.SetError(err)
+		}
+	}
+	if paused := srv.Paused(); len(paused) > 0 {
+		resp.AddPausedTasks(paused, time.Now())
+	}
+	resp.AddCurrentTask(srv.CurrentTask())
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
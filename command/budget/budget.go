@@ -0,0 +1,197 @@
+// Package budget provides the budget command, managing the time to be logged
+// on tasks per week or month.
+package budget
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	actionSet    = "set"
+	actionList   = "list"
+	actionRemove = "remove"
+)
+
+// Separates a budget's limit from its period, as in 20h/week.
+const periodSeparator = "/"
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "budget"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<action>",
+			Description: "What to do: " + actionSet + ", " + actionList + " or " + actionRemove,
+		},
+		argparse.Arg{
+			Name:        "[task]",
+			Description: "The task or project the budget applies to",
+			Optional:    true,
+		},
+		argparse.Arg{
+			Name:        "[budget..]",
+			Description: "max or min, followed by the time per week or month, e.g. 20h/week",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Manage weekly or monthly time budgets")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Set the time to be logged on a task per week or month, at most or at least"
+	footer := "A budget for a project, e.g. client-a, covers all of its tasks, e.g. client-a/backend\n" +
+		"Setting a budget again replaces the one of the same kind and period\n" +
+		"Removing without kind or period removes all of the task's budgets\n\n" +
+		"When a task stops, budgets covering it are checked, warning when a maximum is\n" +
+		"exceeded or nearly reached, or when a minimum falls behind, i.e. less of it is\n" +
+		"logged than the share of working days already passed in the period.\n" +
+		"Use `tilo query <task> :budget` to see the time remaining for some tasks\n\n" +
+		"Examples\n" +
+		"    tilo budget set client-a max 20h/week\n" +
+		"    tilo budget set learning min 5h/week\n" +
+		"    tilo budget set side-project max 7h30m/month\n" +
+		"    tilo budget list\n" +
+		"    tilo budget remove client-a max week\n" +
+		"    tilo budget remove learning"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := check(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to manage budgets")
+}
+
+// Check the arguments for the action.
+func check(cmd msg.Cmd) error {
+	switch cmd.Args[0] {
+	case actionSet:
+		_, err := budgetFrom(cmd.Args[1:])
+		return err
+	case actionList:
+		if len(cmd.Args) > 1 {
+			return errors.New("Takes no further arguments")
+		}
+		return nil
+	case actionRemove:
+		_, _, err := removalFrom(cmd.Args[1:])
+		return err
+	default:
+		return errors.Errorf("No such action: %s", cmd.Args[0])
+	}
+}
+
+// The budget described by the arguments, e.g. client-a max 20h/week.
+func budgetFrom(args []string) (msg.Budget, error) {
+	if len(args) != 3 {
+		return msg.Budget{}, errors.New("Require the task, max or min, and the time per period as in 20h/week")
+	}
+	b := msg.Budget{Task: args[0], Kind: args[1]}
+	if b.Kind != msg.BudgetMax && b.Kind != msg.BudgetMin {
+		return b, errors.Errorf("Kind of budget must be %s or %s, got '%s'", msg.BudgetMax, msg.BudgetMin, b.Kind)
+	}
+	parts := strings.SplitN(args[2], periodSeparator, 2)
+	if len(parts) != 2 || !isPeriod(parts[1]) {
+		return b, errors.Errorf("Not a time per %s or %s, as in 20h/week: %s", msg.BudgetWeek, msg.BudgetMonth, args[2])
+	}
+	limit, err := time.ParseDuration(parts[0])
+	if err != nil || limit < time.Minute {
+		return b, errors.Errorf("Not a duration of at least a minute, as in 20h or 7h30m: %s", parts[0])
+	}
+	b.Limit, b.Period = limit, parts[1]
+	return b, nil
+}
+
+// The task, kind and period of the budgets to remove, kind and period being
+// empty unless given.
+func removalFrom(args []string) (string, [2]string, error) {
+	var kindAndPeriod [2]string
+	if len(args) == 0 || len(args) > 3 {
+		return "", kindAndPeriod, errors.New("Require the task, optionally followed by kind and period")
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case (arg == msg.BudgetMax || arg == msg.BudgetMin) && kindAndPeriod[0] == "":
+			kindAndPeriod[0] = arg
+		case isPeriod(arg) && kindAndPeriod[1] == "":
+			kindAndPeriod[1] = arg
+		default:
+			return "", kindAndPeriod, errors.Errorf("Not a kind or period of budget: %s", arg)
+		}
+	}
+	return args[0], kindAndPeriod, nil
+}
+
+func isPeriod(period string) bool {
+	return period == msg.BudgetWeek || period == msg.BudgetMonth
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if err := check(req.Cmd); err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	args := req.Cmd.Args
+	switch args[0] {
+	case actionSet:
+		b, _ := budgetFrom(args[1:])
+		if err := srv.Backend.SaveBudget(b); err != nil {
+			resp.SetError(err)
+			break
+		}
+		resp.AddSavedBudget(b)
+		statuses, err := srv.BudgetStatus([]string{b.Task}, time.Now())
+		if err != nil {
+			resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+		}
+		resp.AddBudgetWarnings(statuses)
+	case actionList:
+		statuses, err := srv.BudgetStatus(nil, time.Now())
+		if err != nil {
+			resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+		} else if len(statuses) == 0 {
+			resp.SetError(errors.New("No budgets set"))
+		} else {
+			resp.AddBudgetStatus(statuses)
+		}
+	case actionRemove:
+		task, kindAndPeriod, _ := removalFrom(args[1:])
+		removed, err := srv.Backend.RemoveBudgets(task, kindAndPeriod[0], kindAndPeriod[1])
+		if err != nil {
+			resp.SetError(err)
+		} else if removed == 0 {
+			resp.SetError(errors.Errorf("No such budget for %s", task))
+		} else {
+			resp.AddRemovedBudgets(task, removed)
+		}
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -3,6 +3,7 @@ package command
 
 import (
 	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/msg"
 	"github.com/fgahr/tilo/server"
 )
 
@@ -24,5 +25,21 @@ func RegisterOperation(op Operation) {
 	}
 	opNames[op.Command()] = true
 	client.RegisterOperation(op.Command(), op)
-	server.RegisterOperation(op.Command(), op)
+	server.RegisterOperation(op.Command(), validated{op})
+}
+
+// An operation validating commands received by the server against its
+// parser, followed by its own validation, if any.
+type validated struct {
+	Operation
+}
+
+func (v validated) Validate(cmd msg.Cmd) error {
+	if err := v.Parser().Validate(cmd); err != nil {
+		return err
+	}
+	if own, ok := v.Operation.(server.Validator); ok {
+		return own.Validate(cmd)
+	}
+	return nil
 }
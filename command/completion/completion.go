@@ -0,0 +1,97 @@
+// Package completion provides the completion command, writing shell
+// completion scripts generated from the registered commands.
+package completion
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Lists the names of known tasks for the scripts, rather than a shell.
+const actionTasks = "tasks"
+
+// Task names are fetched via the tasks command, see there.
+const opTasks = "tasks"
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "completion"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<shell>",
+			Description: "The shell to write the script for: " + strings.Join(shellNames(), ", "),
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Write a shell completion script")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Write a script completing commands, parameters and task names in the given shell"
+	footer := "The script covers the commands of this version, so it is best loaded anew\n" +
+		"at shell startup. Task names are asked from the server, if running, via\n" +
+		"`tilo completion " + actionTasks + "`, leaving out archived tasks\n\n" +
+		"Examples\n" +
+		"    source <(tilo completion bash)    # In ~/.bashrc\n" +
+		"    source <(tilo completion zsh)     # In ~/.zshrc, after compinit\n" +
+		"    tilo completion fish > ~/.config/fish/completions/tilo.fish"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if cmd.Args[0] == actionTasks {
+		return printTasks(cl)
+	}
+	generate, ok := generators[cmd.Args[0]]
+	if !ok {
+		return errors.Errorf("No completion for %s, only for %s", cmd.Args[0], strings.Join(shellNames(), ", "))
+	}
+	fmt.Print(generate(client.Specs()))
+	return nil
+}
+
+// Print the names of known tasks, one per line. Completion does not start a
+// server, so there are none unless one is running.
+func printTasks(cl *client.Client) error {
+	if !cl.Config().RemoteServer() && !cl.ServerIsRunning() {
+		return nil
+	}
+	resp := cl.SendReceive(msg.Cmd{Op: opTasks})
+	if cl.Failed() || resp.Failed() {
+		return errors.New("Failed to determine task names")
+	}
+	for _, line := range resp.Body {
+		if len(line) > 0 {
+			fmt.Println(line[0])
+		}
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,209 @@
+package completion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+)
+
+// What a command completes besides task names, gathered from its spec.
+type words struct {
+	command  string
+	params   []string // Parameter names, ending in = where a value follows
+	keywords []string // Words without prefix, e.g. start for the server
+	tasks    bool     // Whether task names are completed
+}
+
+func wordsFor(spec argparse.Spec) words {
+	w := words{command: spec.Command, tasks: spec.Tasks != "none"}
+	for _, par := range spec.Params {
+		if par.Kind == argparse.ParamKeyword {
+			w.keywords = append(w.keywords, par.Name)
+		} else {
+			w.params = append(w.params, completed(par))
+		}
+	}
+	if spec.Tasks == "multiple" {
+		w.params = append(w.params, argparse.AllTasks)
+	}
+	sort.Strings(w.params)
+	return w
+}
+
+// The parameter as completed, followed by = if it takes a value.
+func completed(par argparse.ParamSpec) string {
+	if par.Kind == argparse.ParamKeyword || par.Kind == argparse.ParamFlag || par.Values == "" {
+		return par.Name
+	}
+	return par.Name + "="
+}
+
+// Scripts by the shell they are written for.
+var generators = map[string]func(specs []argparse.Spec) string{
+	"bash": bash,
+	"zsh":  zsh,
+	"fish": fish,
+}
+
+// Names of the shells scripts can be written for, in alphabetical order.
+func shellNames() []string {
+	var names []string
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bash(specs []argparse.Spec) string {
+	var b strings.Builder
+	b.WriteString("# bash completion for tilo, generated by `tilo completion bash`\n" +
+		"# Load it with: source <(tilo completion bash)\n\n")
+	var commands, withTasks []string
+	b.WriteString("_tilo_words() {\n    case \"$1\" in\n")
+	for _, spec := range specs {
+		w := wordsFor(spec)
+		commands = append(commands, w.command)
+		if w.tasks {
+			withTasks = append(withTasks, w.command)
+		}
+		fmt.Fprintf(&b, "    %s) echo '%s' ;;\n", w.command, strings.Join(append(w.params, w.keywords...), " "))
+	}
+	b.WriteString("    esac\n}\n\n")
+	fmt.Fprintf(&b, `_tilo() {
+    local line=${COMP_LINE:0:COMP_POINT}
+    local cur=${line##*[[:space:]]}
+    local -a args=($line)
+    local candidates
+    if [[ ${#args[@]} -le 1 || ( ${#args[@]} -eq 2 && -n $cur ) ]]; then
+        candidates='%s'
+    else
+        candidates=$(_tilo_words "${args[1]}")
+        case "${args[1]}" in
+        %s)
+            if [[ $cur != :* ]]; then
+                # Only the last of several comma-separated tasks is completed
+                local head=${cur%%"${cur##*,}"} task
+                for task in $(tilo completion tasks 2>/dev/null); do
+                    candidates+=" $head$task"
+                done
+            fi
+            ;;
+        esac
+    fi
+    COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+    # Bash splits words at : and =, replacing only the part after them
+    local prefix=${cur%%"${cur##*[:=]}"}
+    if [[ -n $prefix && $COMP_WORDBREAKS == *:* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+    fi
+    if [[ ${#COMPREPLY[@]} -eq 1 && $cur$COMPREPLY == *= ]]; then
+        compopt -o nospace
+    fi
+}
+
+complete -F _tilo tilo
+`, strings.Join(commands, " "), strings.Join(withTasks, "|"))
+	return b.String()
+}
+
+func zsh(specs []argparse.Spec) string {
+	var b strings.Builder
+	b.WriteString("#compdef tilo\n" +
+		"# zsh completion for tilo, generated by `tilo completion zsh`\n" +
+		"# Load it with: source <(tilo completion zsh)\n\n" +
+		"_tilo() {\n" +
+		"    local -a commands params keywords\n" +
+		"    local tasks=0\n" +
+		"    if (( CURRENT == 2 )); then\n" +
+		"        commands=(\n")
+	for _, spec := range specs {
+		// Colons separate the command from its summary
+		fmt.Fprintf(&b, "            %s\n", zshQuote(spec.Command+":"+strings.Replace(spec.Summary, ":", `\:`, -1)))
+	}
+	b.WriteString("        )\n" +
+		"        _describe command commands\n" +
+		"        return\n" +
+		"    fi\n" +
+		"    case $words[2] in\n")
+	for _, spec := range specs {
+		w := wordsFor(spec)
+		tasks := 0
+		if w.tasks {
+			tasks = 1
+		}
+		fmt.Fprintf(&b, "    %s) params=(%s); keywords=(%s); tasks=%d ;;\n",
+			w.command, strings.Join(w.params, " "), strings.Join(w.keywords, " "), tasks)
+	}
+	b.WriteString(`    esac
+    if [[ $PREFIX == :* ]]; then
+        local p
+        for p in $params; do
+            if [[ $p == *= ]]; then
+                compadd -S '' -- $p
+            else
+                compadd -- $p
+            fi
+        done
+        return
+    fi
+    compadd -a keywords
+    if (( tasks )); then
+        # Only the last of several comma-separated tasks is completed
+        compset -P '*,'
+        compadd -- ${(f)"$(tilo completion tasks 2>/dev/null)"}
+    fi
+}
+
+compdef _tilo tilo
+`)
+	return b.String()
+}
+
+// Quote a word for zsh, within single quotes.
+func zshQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+func fish(specs []argparse.Spec) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for tilo, generated by `tilo completion fish`\n" +
+		"# Load it with: tilo completion fish | source\n\n" +
+		"# Only the last of several comma-separated tasks is completed\n" +
+		"function __tilo_tasks\n" +
+		"    set -l head (string match -r '.*,' -- (commandline -ct))\n" +
+		"    for task in (tilo completion tasks 2>/dev/null)\n" +
+		"        echo $head$task\n" +
+		"    end\n" +
+		"end\n\n" +
+		"complete -c tilo -f\n")
+	var withTasks []string
+	for _, spec := range specs {
+		fmt.Fprintf(&b, "complete -c tilo -n __fish_use_subcommand -a %s -d %s\n",
+			spec.Command, fishQuote(spec.Summary))
+	}
+	for _, spec := range specs {
+		w := wordsFor(spec)
+		if w.tasks {
+			withTasks = append(withTasks, w.command)
+		}
+		condition := fishQuote("__fish_seen_subcommand_from " + w.command)
+		for _, par := range spec.Params {
+			fmt.Fprintf(&b, "complete -c tilo -n %s -a %s -d %s\n",
+				condition, fishQuote(completed(par)), fishQuote(par.Description))
+		}
+		if spec.Tasks == "multiple" {
+			fmt.Fprintf(&b, "complete -c tilo -n %s -a %s -d %s\n", condition, argparse.AllTasks, fishQuote("All tasks"))
+		}
+	}
+	fmt.Fprintf(&b, "complete -c tilo -n %s -a '(__tilo_tasks)'\n",
+		fishQuote("__fish_seen_subcommand_from "+strings.Join(withTasks, " ")))
+	return b.String()
+}
+
+// Quote a word for fish, within single quotes.
+func fishQuote(word string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(word) + "'"
+}
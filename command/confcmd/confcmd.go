@@ -0,0 +1,156 @@
+// Package confcmd provides the config command, showing and changing the
+// configuration file.
+package confcmd
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	actionShow = "show"
+	actionSet  = "set"
+)
+
+// Show secrets rather than hiding them.
+const paramSecrets = "secrets"
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "config"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<action>",
+			Description: "What to do: " + actionShow + " or " + actionSet,
+		},
+		argparse.Arg{
+			Name:        "[setting]",
+			Description: "The setting to change, as named in the configuration file",
+			Optional:    true,
+		},
+		argparse.Arg{
+			Name:        "[value]",
+			Description: "Its new value; without, the setting is removed from the file",
+			Optional:    true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramSecrets, "Show tokens and passwords instead of hiding them"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Show or change the configuration")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Show each setting with its value and where it comes from, or change one in the configuration file"
+	footer := "Settings are taken from the command line (e.g. --log-level=debug), then the\n" +
+		"environment (e.g. __TILO_LOG_LEVEL=debug), then the configuration file, by\n" +
+		"default ~/.config/tilo/config, with the first found taking precedence.\n" +
+		"Changes to the file apply to a running server after `tilo server reload`; some,\n" +
+		"e.g. the socket or backend, only after `tilo server restart`.\n" +
+		"Sections of the file, e.g. [holidays], are edited by hand or by their commands\n\n" +
+		"Examples\n" +
+		"    tilo config show\n" +
+		"    tilo config set day_start 04:00\n" +
+		"    tilo config set output json\n" +
+		"    tilo config set day_start          # Back to the default"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	conf := cl.Config()
+	switch cmd.Args[0] {
+	case actionShow:
+		if len(cmd.Args) > 1 {
+			return errors.New("Takes no further arguments")
+		}
+		var rows [][]string
+		for _, item := range items(conf) {
+			name := item.InFile
+			if name == "" {
+				name = item.InArgs
+			}
+			value := item.Value
+			if !cmd.Flags[paramSecrets] {
+				value = redact(name, value)
+			}
+			rows = append(rows, []string{name, value, conf.Source(item)})
+		}
+		resp := msg.Response{}
+		resp.AddTable([]string{"Setting", "Value", "Source"}, rows)
+		cl.PrintResponse(resp)
+		return cl.Error()
+	case actionSet:
+		if len(cmd.Args) < 2 || len(cmd.Args) > 3 {
+			return errors.New("Require a setting and its value")
+		}
+		key, value := cmd.Args[1], ""
+		if len(cmd.Args) > 2 {
+			value = cmd.Args[2]
+		}
+		if err := conf.SaveValue(key, value); err != nil {
+			return errors.Wrap(err, "Failed to change the configuration")
+		}
+		if value == "" {
+			cl.PrintMessage("Removed " + key + " from " + conf.ConfFile.Value)
+		} else {
+			cl.PrintMessage("Set " + key + " in " + conf.ConfFile.Value)
+		}
+		for _, item := range items(conf) {
+			if item.InFile == key && conf.Source(item) != config.SourceFile && conf.Source(item) != config.SourceDefault {
+				cl.PrintMessage("Note that it is overridden from the " + conf.Source(item))
+			}
+		}
+	default:
+		return errors.Errorf("No such action: %s", cmd.Args[0])
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+// All items of the configuration, including those of the backend in use.
+func items(conf *config.Opts) []*config.Item {
+	return append(conf.AcceptedItems(), config.BackendItems(conf.Backend.Value)...)
+}
+
+// Hide tokens, and passwords in URLs such as db_url.
+func redact(name string, value string) string {
+	if value == "" {
+		return value
+	} else if strings.HasSuffix(name, "token") {
+		return "(hidden)"
+	} else if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
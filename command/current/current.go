@@ -1,6 +1,8 @@
 package current
 
 import (
+	"time"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
@@ -27,7 +29,9 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Determine the currently active task, if any"
-	footer := "Exits with non-zero status if no task is active"
+	footer := "Exits with non-zero status if no task is active or paused\n" +
+		"If parallel tasks are allowed (allow_parallel), all active tasks are shown\n" +
+		"Paused tasks are shown with the time logged before the pause and its length"
 	return header, footer
 }
 
@@ -39,8 +43,10 @@ func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
-	if srv.CurrentTask.IsRunning() {
-		resp.AddCurrentTask(srv.CurrentTask)
+	if active := srv.ActiveTasks(); len(active) > 0 {
+		resp.AddActiveTasks(active)
+	} else if paused := srv.Paused(); len(paused) > 0 {
+		resp.AddPausedTasks(paused, time.Now())
 	} else {
 		resp.SetError(errors.New("No active task"))
 	}
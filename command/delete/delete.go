@@ -0,0 +1,71 @@
+package delete
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "delete"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<entry-id>",
+			Description: "The ID of the entry, as listed by `query :entries`",
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Delete a saved entry")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Remove a single saved entry along with its tags"
+	footer := "There is no undo. Use `show` to review the entry first, or `backup` to be safe\n\n" +
+		"Examples\n" +
+		"    tilo query foo :today :entries   # Find the ID\n" +
+		"    tilo show 42\n" +
+		"    tilo delete 42"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := msg.ParseEntryIDs(cmd.Args); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to delete entry")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	ids, err := msg.ParseEntryIDs(req.Cmd.Args)
+	if err != nil {
+		resp.SetError(err)
+	} else if entry, err := srv.Backend.Entry(ids[0]); err != nil {
+		resp.SetError(err)
+	} else if err := srv.Backend.DeleteEntry(ids[0]); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddDeletedEntry(entry)
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,236 @@
+package doctor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const paramMerge = "merge"
+
+// A check looks for problems in the database, fixing them if requested.
+// Checks of the client's environment run without a server.
+type check struct {
+	description string
+	exec        func(srv *server.Server, cmd msg.Cmd, resp *msg.Response) error
+	local       func(cl *client.Client) error
+}
+
+// Available checks by name.
+var checks = map[string]check{
+	"duplicates": check{
+		description: "Find entries of the same task with overlapping times, e.g. from double imports;\n" +
+			"        with :" + paramMerge + ", each group is merged into its oldest entry",
+		exec: duplicates,
+	},
+	"startup": check{
+		description: "Show why the last server started in the background failed to start or crashed,\n" +
+			"        as far as logged",
+		local: startup,
+	},
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "doctor"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<check>",
+			Description: "What to check: " + strings.Join(checkNames(), ", "),
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramMerge, "Merge the duplicates found instead of only listing them"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Find and fix problems in the database or server")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Check the database for problems, listing them before fixing anything"
+	var lines []string
+	for _, name := range checkNames() {
+		lines = append(lines, "    "+name+"\n        "+checks[name].description)
+	}
+	footer := "Checks\n" + strings.Join(lines, "\n") + "\n\n" +
+		"Merged entries span all entries of their group, keeping all notes and tags\n\n" +
+		"Examples\n" +
+		"    tilo doctor duplicates\n" +
+		"    tilo doctor duplicates :merge\n" +
+		"    tilo doctor startup"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if c, ok := checks[cmd.Args[0]]; ok && c.local != nil {
+		return c.local(cl)
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to check the database")
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if c, ok := checks[cmd.Args[0]]; !ok {
+		return errors.Errorf("No such check: %s", cmd.Args[0])
+	} else if c.exec == nil {
+		return errors.Errorf("Not a server check: %s", cmd.Args[0])
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if err := checks[req.Cmd.Args[0]].exec(srv, req.Cmd, &resp); err != nil {
+		resp.SetError(err)
+	}
+	return srv.Answer(req, resp)
+}
+
+func duplicates(srv *server.Server, cmd msg.Cmd, resp *msg.Response) error {
+	entries, err := srv.Backend.EntriesAfter(0)
+	if err != nil {
+		return errors.Wrap(err, "Error in database query")
+	}
+	groups := overlapping(entries)
+	if cmd.Flags[paramMerge] {
+		for _, group := range groups {
+			into, merged := merge(group)
+			into.Modified = cmd.Origin
+			if err := srv.Backend.MergeEntries(into, merged); err != nil {
+				return err
+			}
+		}
+	}
+	resp.AddDuplicates(groups, cmd.Flags[paramMerge])
+	return nil
+}
+
+// Show the last lines logged by the last background server unless it shut
+// down cleanly. Does not start a server.
+func startup(cl *client.Client) error {
+	if cl.ServerIsRunning() {
+		cl.PrintMessage("Server running, no startup problems")
+		return nil
+	}
+	if !cl.PrintFailedStart() {
+		cl.PrintMessage("No startup problems logged in " + server.BackgroundLog(cl.Config()))
+		return nil
+	}
+	return errors.New("Server failed to start")
+}
+
+// Groups of entries of the same task whose times overlap, or which are equal.
+// Entries in each group are ordered by start time.
+func overlapping(entries []msg.Entry) [][]msg.Entry {
+	byTask := make(map[string][]msg.Entry)
+	var tasks []string
+	for _, e := range entries {
+		if _, ok := byTask[e.Task]; !ok {
+			tasks = append(tasks, e.Task)
+		}
+		byTask[e.Task] = append(byTask[e.Task], e)
+	}
+	sort.Strings(tasks)
+
+	var groups [][]msg.Entry
+	for _, task := range tasks {
+		list := byTask[task]
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Started.Before(list[j].Started)
+		})
+		group := []msg.Entry{list[0]}
+		end := list[0].Ended
+		flush := func() {
+			if len(group) > 1 {
+				groups = append(groups, group)
+			}
+		}
+		for _, e := range list[1:] {
+			prev := group[len(group)-1]
+			if e.Started.Before(end) || (e.Started.Equal(prev.Started) && e.Ended.Equal(prev.Ended)) {
+				group = append(group, e)
+				if e.Ended.After(end) {
+					end = e.Ended
+				}
+				continue
+			}
+			flush()
+			group = []msg.Entry{e}
+			end = e.Ended
+		}
+		flush()
+	}
+	return groups
+}
+
+// Merge a group into its oldest entry, i.e. the one with the smallest ID.
+// The result spans all entries, carrying all their notes and tags. Gives the
+// IDs of the other entries.
+func merge(group []msg.Entry) (msg.Entry, []int64) {
+	into := group[0]
+	for _, e := range group[1:] {
+		if e.ID < into.ID {
+			into = e
+		}
+	}
+	var merged []int64
+	var notes []string
+	seenNotes := make(map[string]bool)
+	seenTags := make(map[string]bool)
+	into.Tags = nil
+	for _, e := range group {
+		if e.ID != into.ID {
+			merged = append(merged, e.ID)
+		}
+		if e.Started.Before(into.Started) {
+			into.Started = e.Started
+		}
+		if e.Ended.After(into.Ended) {
+			into.Ended = e.Ended
+		}
+		if e.Note != "" && !seenNotes[e.Note] {
+			seenNotes[e.Note] = true
+			notes = append(notes, e.Note)
+		}
+		for _, tag := range e.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				into.Tags = append(into.Tags, tag)
+			}
+		}
+	}
+	into.Note = strings.Join(notes, "; ")
+	sort.Strings(into.Tags)
+	return into, merged
+}
+
+// Names of all available checks, in alphabetical order.
+func checkNames() []string {
+	var names []string
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,156 @@
+package edit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramFrom = "from"
+	paramTo   = "to"
+	paramTask = "task"
+	paramNote = "note"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "edit"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<entry-id>",
+			Description: "The ID of the entry, as listed by `query :entries`",
+		},
+	}
+	params := []argparse.Param{
+		argparse.Option(paramFrom, "<time>", "Change the start, e.g. 09:15 or -10m"),
+		argparse.Option(paramTo, "<time>", "Change the end, e.g. 2023-05-02T17:30 or +5m"),
+		argparse.Option(paramTask, "<task>", "Assign the entry to another task"),
+		argparse.Option(paramNote, "<text>", "Replace the entry's note"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Change a saved entry")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Change the times, task or note of any saved entry"
+	footer := "Times are given as YYYY-MM-DDTHH:MM, as HH:MM on the day they fall on, or moved\n" +
+		"by a duration. For the most recent entry, see also the `amend` command\n\n" +
+		"Examples\n" +
+		"    tilo query :all :yesterday :entries   # Find the ID\n" +
+		"    tilo edit 42 :from=09:15 :to=+30m\n" +
+		"    tilo edit 42 :task=review :note=\"release prep\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to edit entry")
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if _, err := msg.ParseEntryIDs(cmd.Args); err != nil {
+		return err
+	} else if len(cmd.Opts) == 0 {
+		return errors.New("Nothing to edit")
+	}
+	if name, ok := cmd.Opts[paramTask]; ok {
+		if names, err := argparse.GetTaskNames(name); err != nil {
+			return err
+		} else if len(names) != 1 || names[0] == argparse.AllTasks {
+			return errors.Errorf("Invalid task name: %s", name)
+		}
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	ids, err := msg.ParseEntryIDs(req.Cmd.Args)
+	if err != nil {
+		resp.SetError(err)
+	} else if before, err := srv.Backend.Entry(ids[0]); err != nil {
+		resp.SetError(err)
+	} else if after, err := edited(before, req.Cmd, time.Now()); err != nil {
+		resp.SetError(err)
+	} else if err := srv.Backend.UpdateEntry(after); err != nil {
+		resp.SetError(err)
+	} else if overlapping, err := srv.Overlapping(after); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddAmendedEntry(before, after)
+		resp.AddOverlaps(overlapping)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The entry with the changes requested by the command applied, checking that
+// it still makes sense.
+func edited(e msg.Entry, cmd msg.Cmd, now time.Time) (msg.Entry, error) {
+	var err error
+	if value, ok := cmd.Opts[paramFrom]; ok {
+		if e.Started, err = adjust(e.Started, value); err != nil {
+			return e, err
+		}
+	}
+	if value, ok := cmd.Opts[paramTo]; ok {
+		if e.Ended, err = adjust(e.Ended, value); err != nil {
+			return e, err
+		}
+	}
+	if name, ok := cmd.Opts[paramTask]; ok {
+		e.Task = name
+	}
+	if note, ok := cmd.Opts[paramNote]; ok {
+		e.Note = strings.TrimSpace(note)
+	}
+	e.Modified = cmd.Origin
+	if !e.Ended.After(e.Started) {
+		return e, errors.New("The entry would end before it starts")
+	} else if e.Ended.After(now) {
+		return e, errors.New("The entry would end in the future")
+	}
+	return e, nil
+}
+
+// Set a time to a date and time, or to a time of day on the same day, or move
+// it by a duration.
+func adjust(t time.Time, value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return t.Add(d).Truncate(time.Second), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if at, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return at, nil
+		}
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return t, errors.Errorf("Not a time (YYYY-MM-DDTHH:MM or HH:MM) or duration: %s", value)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), clock.Hour(), clock.Minute(), 0, 0, t.Location()), nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
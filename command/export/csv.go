@@ -0,0 +1,31 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// Write one line per entry, preceded by a header.
+func writeCSV(w io.Writer, entries []msg.Entry) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "task", "code", "started", "ended", "hours", "note", "tags"})
+	for _, e := range entries {
+		out.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.Task,
+			e.Code,
+			e.Started.Format(time.RFC3339),
+			e.Ended.Format(time.RFC3339),
+			strconv.FormatFloat(e.Ended.Sub(e.Started).Hours(), 'f', 2, 64),
+			e.Note,
+			strings.Join(e.Tags, ","),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,216 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// A writer writes entries to a file in some format.
+type writer func(w io.Writer, entries []msg.Entry) error
+
+// Available formats by name, which is also the file extension.
+var writers = map[string]writer{
+	"csv":  writeCSV,
+	"json": writeJSON,
+	"xlsx": writeXLSX,
+}
+
+const (
+	paramFormat = "format"
+	// Write to standard output instead of a file
+	toStdout = "-"
+)
+
+type operation struct {
+	cal *quantifier.Calendar
+}
+
+func (op operation) Command() string {
+	return "export"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<file>",
+			Description: "The file to write; - for standard output",
+		},
+	}
+	params := append(query.PeriodParams(time.Now(), op.cal),
+		argparse.Option(paramFormat, strings.Join(formatNames(), "|"), "The file format, by default determined by the file extension"))
+	return argparse.CommandParser(op.Command()).WithMultipleTasks().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) Configure(conf *config.Opts) error {
+	return op.cal.Configure(conf)
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Export entries to a file")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Write the entries of the given tasks in the given periods, or of all time, to a file"
+	footer := "Formats\n" +
+		"    csv   One line per entry\n" +
+		"    json  A list of entries with all their details\n" +
+		"    xlsx  A workbook with a sheet of all entries and, for each month, a sheet\n" +
+		"          summarizing the hours per task and day\n\n" +
+		"Entries carry the booking code of their task as mapped in the [codes] section\n" +
+		"of the configuration file, see `tilo help timesheet`\n\n" +
+		"CSV and JSON exports can be imported again with `tilo import tilo`, e.g. to move\n" +
+		"to another backend\n\n" +
+		"Examples\n" +
+		"    tilo export :all :last-month hours.xlsx\n" +
+		"    tilo export foo,bar :this-year - :format=csv\n" +
+		"    tilo export :all :since=2022-01-01 entries.json"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	file := cmd.Args[0]
+	format := cmd.Opts[paramFormat]
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	write, ok := writers[format]
+	if !ok {
+		return errors.Errorf("Unknown format '%s', use :%s=%s", format, paramFormat, strings.Join(formatNames(), "|"))
+	}
+
+	resp := cl.SendReceive(cmd)
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to export entries")
+	} else if err := resp.Err(); err != nil {
+		return errors.Wrap(err, "Failed to export entries")
+	}
+	cl.PrintWarnings(resp)
+
+	if file == toStdout {
+		return write(os.Stdout, resp.Entries)
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create file")
+	}
+	if err := write(out, resp.Entries); err != nil {
+		out.Close()
+		return errors.Wrapf(err, "Failed to write %s", file)
+	}
+	if err := out.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write %s", file)
+	}
+	cl.PrintMessage(fmt.Sprintf("Exported %d entries to %s", len(resp.Entries), file))
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(srv.Config()); err != nil {
+		resp.SetError(errors.Wrap(err, "Invalid calendar configuration"))
+		return srv.Answer(req, resp)
+	}
+	seen := make(map[int64]bool)
+	var entries []msg.Entry
+	if len(req.Cmd.Quantities) == 0 {
+		all, err := allEntries(srv, req.Cmd.TaskNames)
+		if err != nil {
+			resp.SetError(errors.Wrap(err, "Error in database query"))
+			return srv.Answer(req, resp)
+		}
+		entries = all
+	}
+	for _, task := range req.Cmd.TaskNames {
+		for _, quant := range req.Cmd.Quantities {
+			period, err := cal.Period(quant)
+			if err != nil {
+				resp.SetError(err)
+				return srv.Answer(req, resp)
+			}
+			found, err := srv.Backend.EntriesOverlapping(task, period.Start, period.End, 0)
+			if err != nil {
+				resp.SetError(errors.Wrap(err, "Error in database query"))
+				return srv.Answer(req, resp)
+			}
+			// Periods may overlap
+			for _, e := range found {
+				if !seen[e.ID] {
+					seen[e.ID] = true
+					entries = append(entries, e)
+				}
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Started.Before(entries[j].Started)
+	})
+	resp.AddUnmappedTasks(addBookingCodes(srv.Config(), entries))
+	resp.AddRawEntries(entries)
+	return srv.Answer(req, resp)
+}
+
+// All entries of the given tasks, regardless of when they were logged.
+func allEntries(srv *server.Server, taskNames []string) ([]msg.Entry, error) {
+	all, err := srv.Backend.EntriesAfter(0)
+	if err != nil || (len(taskNames) == 1 && taskNames[0] == query.TskAllTasks) {
+		return all, err
+	}
+	var entries []msg.Entry
+	for _, e := range all {
+		for _, task := range taskNames {
+			if e.Task == task {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Set the booking code of each entry with a mapped task. Gives the names of the tasks not mapped
+// to a code, provided any codes are configured at all.
+func addBookingCodes(conf *config.Opts, entries []msg.Entry) []string {
+	var unmapped []string
+	seen := make(map[string]bool)
+	for i, e := range entries {
+		if code, ok := conf.BookingCode(e.Task); ok {
+			entries[i].Code = code
+		} else if !seen[e.Task] && conf.HasBookingCodes() {
+			unmapped = append(unmapped, e.Task)
+		}
+		seen[e.Task] = true
+	}
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// Names of all available formats, in alphabetical order.
+func formatNames() []string {
+	var names []string
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	command.RegisterOperation(operation{quantifier.DefaultCalendar()})
+}
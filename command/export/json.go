@@ -0,0 +1,18 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// Write all entries as a JSON list, as read back by `tilo import tilo`.
+func writeJSON(w io.Writer, entries []msg.Entry) error {
+	if entries == nil {
+		entries = []msg.Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
@@ -0,0 +1,274 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// Cell styles, as indices into cellXfs in the style sheet below.
+const (
+	styleDefault = 0
+	styleHeader  = 1
+	styleTime    = 2
+	styleHours   = 3
+)
+
+// A single cell, either text or a number.
+type cell struct {
+	text    string
+	number  float64
+	numeric bool
+	style   int
+}
+
+func text(s string) cell {
+	return cell{text: s}
+}
+
+func header(s string) cell {
+	return cell{text: s, style: styleHeader}
+}
+
+func timestamp(t time.Time) cell {
+	return cell{number: serial(t), numeric: true, style: styleTime}
+}
+
+func hours(d time.Duration) cell {
+	return cell{number: d.Hours(), numeric: true, style: styleHours}
+}
+
+// A named sheet of rows.
+type sheet struct {
+	name string
+	rows [][]cell
+}
+
+// Write a workbook with a sheet of all entries, followed by a summary sheet
+// for each month with the hours per task and day.
+func writeXLSX(w io.Writer, entries []msg.Entry) error {
+	sheets := []sheet{entrySheet(entries)}
+	sheets = append(sheets, monthSheets(entries)...)
+	return writeWorkbook(w, sheets)
+}
+
+func entrySheet(entries []msg.Entry) sheet {
+	rows := [][]cell{{
+		header("ID"), header("Task"), header("Code"), header("Started"), header("Ended"),
+		header("Hours"), header("Note"), header("Tags"),
+	}}
+	for _, e := range entries {
+		rows = append(rows, []cell{
+			{number: float64(e.ID), numeric: true},
+			text(e.Task),
+			text(e.Code),
+			timestamp(e.Started),
+			timestamp(e.Ended),
+			hours(e.Ended.Sub(e.Started)),
+			text(e.Note),
+			text(strings.Join(e.Tags, ", ")),
+		})
+	}
+	return sheet{name: "Entries", rows: rows}
+}
+
+// Summaries per month, with one row per task and one column per day, plus
+// totals. Entries are attributed to the day they started.
+func monthSheets(entries []msg.Entry) []sheet {
+	type month struct {
+		year int
+		mon  time.Month
+	}
+	byMonth := make(map[month]map[string][]time.Duration)
+	var months []month
+	for _, e := range entries {
+		m := month{e.Started.Year(), e.Started.Month()}
+		if byMonth[m] == nil {
+			byMonth[m] = make(map[string][]time.Duration)
+			months = append(months, m)
+		}
+		if byMonth[m][e.Task] == nil {
+			byMonth[m][e.Task] = make([]time.Duration, 32)
+		}
+		byMonth[m][e.Task][e.Started.Day()] += e.Ended.Sub(e.Started)
+	}
+
+	var sheets []sheet
+	for _, m := range months {
+		days := time.Date(m.year, m.mon+1, 0, 0, 0, 0, 0, time.Local).Day()
+		head := []cell{header("Task")}
+		for day := 1; day <= days; day++ {
+			head = append(head, header(strconv.Itoa(day)))
+		}
+		head = append(head, header("Total"))
+
+		var tasks []string
+		for task := range byMonth[m] {
+			tasks = append(tasks, task)
+		}
+		sort.Strings(tasks)
+		dayTotals := make([]time.Duration, days+1)
+		rows := [][]cell{head}
+		for _, task := range tasks {
+			row := []cell{text(task)}
+			var total time.Duration
+			for day := 1; day <= days; day++ {
+				d := byMonth[m][task][day]
+				row = append(row, hours(d))
+				total += d
+				dayTotals[day] += d
+			}
+			rows = append(rows, append(row, hours(total)))
+		}
+		totals := []cell{header("Total")}
+		var total time.Duration
+		for day := 1; day <= days; day++ {
+			totals = append(totals, hours(dayTotals[day]))
+			total += dayTotals[day]
+		}
+		rows = append(rows, append(totals, hours(total)))
+		sheets = append(sheets, sheet{name: fmt.Sprintf("%d-%02d", m.year, m.mon), rows: rows})
+	}
+	return sheets
+}
+
+// Days since 1899-12-30 as spreadsheets count them, in local time.
+func serial(t time.Time) float64 {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(epoch).Hours() / 24
+}
+
+// The name of a column as used in cell references, e.g. A, Z, AA.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// Write the sheets as an Office Open XML workbook.
+func writeWorkbook(w io.Writer, sheets []sheet) error {
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes(len(sheets))},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(len(sheets))},
+		{"xl/styles.xml", styles},
+	}
+	for i, s := range sheets {
+		files = append(files, struct{ name, content string }{
+			fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(s),
+		})
+	}
+
+	z := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const rootRels = xmlHeader +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const styles = xmlHeader +
+	`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`</styleSheet>`
+
+func contentTypes(n int) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func workbook(sheets []sheet) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func workbookRels(n int) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	// Styles come after all sheets
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, n+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+func worksheet(s sheet) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cl := range row {
+			ref := columnName(c) + strconv.Itoa(r+1)
+			if cl.numeric {
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cl.style,
+					strconv.FormatFloat(cl.number, 'f', -1, 64))
+			} else if cl.text != "" {
+				fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+					ref, cl.style, escape(cl.text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,251 @@
+package githook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramForce = "force"
+	hookName   = "post-checkout"
+	// Identifies hooks installed by this command
+	hookMarker = "# Installed by tilo githook"
+)
+
+// An action operates on the git repository in the working directory.
+type action struct {
+	usage       string
+	description string
+	args        int // Number of arguments required
+	exec        func(cl *client.Client, cmd msg.Cmd) error
+}
+
+func (a action) Usage() string {
+	return a.usage
+}
+
+func (a action) Description() string {
+	return a.description
+}
+
+// Available actions by name.
+var actions = argparse.Actions{
+	"install": action{
+		description: "Install the post-checkout hook in the current repository",
+		exec:        install,
+	},
+	"uninstall": action{
+		description: "Remove the hook from the current repository",
+		exec:        uninstall,
+	},
+	"checkout": action{
+		usage:       "<branch>",
+		description: "Start the task for the branch, as called by the hook",
+		args:        1,
+		exec:        checkout,
+	},
+}
+
+// A rule maps branch names matching a pattern to a task. The task may refer
+// to submatches of the pattern, e.g. $1.
+type rule struct {
+	pattern *regexp.Regexp
+	task    string
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "githook"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		actions.Arg(),
+		argparse.Arg{
+			Name:        "[args..]",
+			Description: "Further arguments, depending on the action",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramForce, "Replace an existing hook not installed by tilo"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Switch tasks along with git branches")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Manage a git hook starting the task for a branch whenever it is checked out"
+	footer := actions.Help() + "\n\n" +
+		"Rules are defined in the [branch_rules] section of the configuration file, each\n" +
+		"mapping a regular expression to a task. The task may refer to parts of the branch\n" +
+		"name matched in parentheses, as $1, $2, etc. If several rules apply, the\n" +
+		"alphabetically first pattern wins; if none does, the current task is kept\n\n" +
+		"Examples\n" +
+		"    [branch_rules]\n" +
+		"    ^(?:feature|fix)/([A-Z]+-[0-9]+) = $1\n" +
+		"    ^main$ = maintenance\n\n" +
+		"    tilo githook install\n" +
+		"    tilo githook checkout feature/ACME-42-login   # Starts task ACME-42"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SetKind(msg.OriginAgent)
+	chosen, err := actions.Choose(cmd.Args)
+	if err != nil {
+		return err
+	}
+	act := chosen.(action)
+	if len(cmd.Args)-1 != act.args {
+		return errors.Errorf("Usage: githook %s", strings.TrimSpace(cmd.Args[0]+" "+act.usage))
+	}
+	return act.exec(cl, cmd)
+}
+
+func install(cl *client.Client, cmd msg.Cmd) error {
+	hook, err := hookPath()
+	if err != nil {
+		return err
+	}
+	if !cmd.Flags[paramForce] && existsForeign(hook) {
+		return errors.Errorf("A %s hook exists already, use :force to replace it", hookName)
+	}
+	tilo, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "Unable to determine the tilo executable")
+	}
+	// Only branch checkouts are of interest, not those of single files.
+	// The hook must never fail the checkout.
+	script := "#!/bin/sh\n" +
+		hookMarker + "\n" +
+		"[ \"$3\" = 1 ] || exit 0\n" +
+		"branch=$(git symbolic-ref --short -q HEAD) || exit 0\n" +
+		fmt.Sprintf("%q githook checkout \"$branch\" || true\n", tilo)
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		return errors.Wrap(err, "Unable to create hooks directory")
+	}
+	if err := ioutil.WriteFile(hook, []byte(script), 0755); err != nil {
+		return errors.Wrap(err, "Unable to install hook")
+	}
+	cl.PrintMessage("Installed " + hook)
+	return nil
+}
+
+func uninstall(cl *client.Client, cmd msg.Cmd) error {
+	hook, err := hookPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(hook); os.IsNotExist(err) {
+		return errors.New("No hook installed")
+	} else if existsForeign(hook) && !cmd.Flags[paramForce] {
+		return errors.Errorf("The %s hook was not installed by tilo, use :force to remove it", hookName)
+	}
+	if err := os.Remove(hook); err != nil {
+		return errors.Wrap(err, "Unable to remove hook")
+	}
+	cl.PrintMessage("Removed " + hook)
+	return nil
+}
+
+func checkout(cl *client.Client, cmd msg.Cmd) error {
+	rules, err := branchRules(cl.Config())
+	if err != nil {
+		return err
+	}
+	task := matchingTask(rules, cmd.Args[1])
+	if task == "" {
+		return nil
+	}
+	if tasks, err := argparse.GetTaskNames(task); err != nil {
+		return err
+	} else if len(tasks) != 1 || tasks[0] == argparse.AllTasks {
+		return errors.Errorf("Branch rule gives an invalid task: %s", task)
+	}
+	if !cl.Execute([]string{"start", task}) {
+		return errors.Errorf("Failed to start task %s", task)
+	}
+	return nil
+}
+
+// The path of the hook in the repository of the working directory.
+func hookPath() (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", errors.New("Not in a git repository")
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), hookName), nil
+}
+
+// Whether a hook exists which was not installed by tilo.
+func existsForeign(hook string) bool {
+	content, err := ioutil.ReadFile(hook)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	return !strings.Contains(string(content), hookMarker)
+}
+
+// The rules from the configuration, in alphabetical order of their patterns.
+func branchRules(conf *config.Opts) ([]rule, error) {
+	section := conf.Section(config.SectionBranchRules)
+	var patterns []string
+	for pattern := range section {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var rules []rule
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid branch rule: %s", pattern)
+		}
+		rules = append(rules, rule{re, section[pattern]})
+	}
+	return rules, nil
+}
+
+// The task for the first rule matching the branch, empty if none does.
+func matchingTask(rules []rule, branch string) string {
+	for _, r := range rules {
+		if match := r.pattern.FindStringSubmatchIndex(branch); match != nil {
+			return string(r.pattern.ExpandString(nil, r.task, branch, match))
+		}
+	}
+	return ""
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
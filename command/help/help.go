@@ -60,14 +60,15 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Describe usage of a command"
-	footer := "You already know how to use this command :-)"
+	footer := "You already know how to use this command :-)\n" +
+		"Alternatively, append -h or --help to any command to see its detailed usage"
 	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
 	if op.ch.specific {
 		if cl.CommandExists(op.ch.command) {
-			cl.PrintSingleOperationHelp(op.ch.command)
+			return cl.PrintSingleOperationHelp(op.ch.command)
 		} else {
 			cl.PrintAllOperationsHelp()
 			return errors.Errorf("\nNo such command: %s", op.ch.command)
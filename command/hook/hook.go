@@ -0,0 +1,228 @@
+package hook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/project"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramDebounce   = "debounce"
+	defaultDebounce = 10 * time.Second
+	// Files in the socket directory tracking the hook's state
+	dirFile  = "hook-dir"
+	taskFile = "hook-task"
+)
+
+// Shell snippets by shell name. The placeholder is replaced by the command
+// to run on changing directories.
+var snippets = map[string]string{
+	"bash": `_tilo_hook() {
+	if [ "$PWD" != "$_TILO_PWD" ]; then
+		_TILO_PWD=$PWD
+		(%s "$PWD" >/dev/null 2>&1 &)
+	fi
+}
+case ";$PROMPT_COMMAND;" in
+	*";_tilo_hook;"*) ;;
+	*) PROMPT_COMMAND="_tilo_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac
+`,
+	"zsh": `_tilo_hook() {
+	(%s "$PWD" >/dev/null 2>&1 &)
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _tilo_hook
+_tilo_hook
+`,
+	"fish": `function _tilo_hook --on-variable PWD
+	%s "$PWD" >/dev/null 2>&1 &
+	disown
+end
+_tilo_hook
+`,
+}
+
+// An action, given its arguments.
+type action struct {
+	usage       string
+	description string
+	exec        func(cl *client.Client, arg string, debounce time.Duration) error
+}
+
+func (a action) Usage() string {
+	return a.usage
+}
+
+func (a action) Description() string {
+	return a.description
+}
+
+// Available actions by name.
+var actions = argparse.Actions{
+	"shell": action{
+		usage:       "<" + strings.Join(shellNames(), "|") + ">",
+		description: "Print the snippet to add to the shell's startup file",
+		exec:        shell,
+	},
+	"cd": action{
+		usage:       "<dir>",
+		description: "Switch to the project task of the directory, as called by the snippet",
+		exec:        changeDir,
+	},
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "hook"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		actions.Arg(),
+		argparse.Arg{
+			Name:        "<arg>",
+			Description: "The shell or directory, depending on the action",
+		},
+	}
+	params := []argparse.Param{
+		argparse.Option(paramDebounce, "<duration>", "Time to stay in a directory before switching tasks, default 10s"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Switch tasks when changing directories")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Integrate with the shell to start a project's task when entering its directory"
+	footer := actions.Help() + "\n\n" +
+		"A project is a directory containing a " + project.FileName + " file, naming its task:\n" +
+		"    task = thesis\n" +
+		"Entering the directory or any below it starts the task. Leaving all project\n" +
+		"directories stops the task started this way. Switching happens only once the\n" +
+		"shell stayed in a directory for the debounce time, so short visits are not logged\n\n" +
+		"Examples\n" +
+		"    eval \"$(tilo hook shell bash)\"   # In ~/.bashrc\n" +
+		"    tilo hook shell fish :debounce=30s | source"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SetKind(msg.OriginAgent)
+	chosen, err := actions.Choose(cmd.Args)
+	if err != nil {
+		return err
+	}
+	act := chosen.(action)
+	debounce := defaultDebounce
+	if value, ok := cmd.Opts[paramDebounce]; ok {
+		var err error
+		if debounce, err = time.ParseDuration(value); err != nil || debounce < 0 {
+			return errors.Errorf("Invalid debounce time: %s", value)
+		}
+	}
+	return act.exec(cl, cmd.Args[1], debounce)
+}
+
+func shell(cl *client.Client, name string, debounce time.Duration) error {
+	snippet, ok := snippets[name]
+	if !ok {
+		return errors.Errorf("Unsupported shell: %s", name)
+	}
+	tilo, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "Unable to determine the tilo executable")
+	}
+	hook := fmt.Sprintf("%q hook cd :debounce=%s", tilo, debounce)
+	fmt.Print(fmt.Sprintf(snippet, hook))
+	return nil
+}
+
+// Switch to the project task of the directory, unless another directory is
+// entered within the debounce time.
+func changeDir(cl *client.Client, dir string, debounce time.Duration) error {
+	stateDir := cl.Config().SocketDir()
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return errors.Wrap(err, "Unable to create state directory")
+	}
+	dirState := filepath.Join(stateDir, dirFile)
+	stamp := fmt.Sprintf("%d %s", time.Now().UnixNano(), dir)
+	if err := ioutil.WriteFile(dirState, []byte(stamp), 0600); err != nil {
+		return errors.Wrap(err, "Unable to save hook state")
+	}
+	time.Sleep(debounce)
+	if current, err := ioutil.ReadFile(dirState); err != nil || string(current) != stamp {
+		// Superseded by a later change of directory
+		return err
+	}
+
+	proj, err := project.Find(dir)
+	if err != nil {
+		return err
+	}
+	taskState := filepath.Join(stateDir, taskFile)
+	previous := ""
+	if content, err := ioutil.ReadFile(taskState); err == nil {
+		previous = string(content)
+	}
+	next := ""
+	if proj != nil {
+		next = proj.Task
+	}
+
+	cl.StartSession()
+	if previous != "" && previous != next {
+		// The task may have been stopped in the meantime; that's fine.
+		cl.SendReceive(msg.Cmd{Op: "stop", TaskNames: []string{previous}})
+		cl.Reset()
+	}
+	if next != "" {
+		// Started from within the directory to pick up the project's tags
+		if err := os.Chdir(dir); err != nil {
+			return err
+		}
+		if !cl.Execute([]string{"start", ":unless-active"}) {
+			return errors.Errorf("Failed to start task %s", next)
+		}
+	}
+	return ioutil.WriteFile(taskState, []byte(next), 0600)
+}
+
+// Names of all supported shells, in alphabetical order.
+func shellNames() []string {
+	var names []string
+	for name := range snippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
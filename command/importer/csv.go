@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Read entries from a file with comma-separated values.
+func readCSV(file *os.File, m mapping) ([][]string, error) {
+	if m[keyStart] == "" {
+		return nil, errors.New("Require a start column")
+	} else if m[keyEnd] == "" && m[keyDuration] == "" {
+		return nil, errors.New("Require an end or duration column")
+	} else if m[keyTask] == "" && m[keyDefaultTask] == "" {
+		return nil, errors.New("Require a task column or default task")
+	}
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if sep := m[keySeparator]; sep == "tab" {
+		r.Comma = '\t'
+	} else if sep != "" {
+		if utf8.RuneCountInString(sep) != 1 {
+			return nil, errors.Errorf("Invalid separator: %s", sep)
+		}
+		r.Comma, _ = utf8.DecodeRuneInString(sep)
+	}
+
+	var header []string
+	if hasHeader, err := strconv.ParseBool(withDefault(m[keyHeader], "true")); err != nil {
+		return nil, errors.Errorf("Invalid value for header: %s", m[keyHeader])
+	} else if hasHeader {
+		if header, err = r.Read(); err != nil {
+			return nil, errors.Wrap(err, "Unable to read header")
+		}
+	}
+	cols, err := resolveColumns(m, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if isBlank(record) {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		entry, err := cols.entry(record, m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Column indices of the parts of an entry, -1 if not present.
+type columns map[string]int
+
+func resolveColumns(m mapping, header []string) (columns, error) {
+	cols := make(columns)
+	for _, key := range []string{keyTask, keyStart, keyEnd, keyDate, keyDuration, keyNote, keyTags, keyID} {
+		cols[key] = -1
+		name := m[key]
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			cols[key] = n - 1
+			continue
+		}
+		for i, col := range header {
+			if strings.EqualFold(strings.TrimSpace(col), name) {
+				cols[key] = i
+			}
+		}
+		if cols[key] < 0 {
+			return nil, errors.Errorf("No such column for %s: %s", key, name)
+		}
+	}
+	return cols, nil
+}
+
+// The value in the given column, empty if not present.
+func (cols columns) value(record []string, key string) string {
+	if i := cols[key]; i >= 0 && i < len(record) {
+		return strings.TrimSpace(record[i])
+	}
+	return ""
+}
+
+// Turn a record into an entry: task, start, end, note, tags and fingerprint.
+func (cols columns) entry(record []string, m mapping) ([]string, error) {
+	task := withDefault(cols.value(record, keyTask), m[keyDefaultTask])
+	if task == "" {
+		return nil, errors.New("No task")
+	}
+
+	layout := withDefault(m[keyLayout], "2006-01-02 15:04")
+	date := cols.value(record, keyDate)
+	if cols[keyDate] >= 0 {
+		layout = withDefault(m[keyDateLayout], "2006-01-02") + " " + withDefault(m[keyLayout], "15:04")
+	}
+	parse := func(key string) (time.Time, error) {
+		value := cols.value(record, key)
+		if cols[keyDate] >= 0 {
+			value = date + " " + value
+		}
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		return t, errors.Wrapf(err, "Invalid %s time", key)
+	}
+
+	start, err := parse(keyStart)
+	if err != nil {
+		return nil, err
+	}
+	var end time.Time
+	if cols[keyEnd] >= 0 {
+		if end, err = parse(keyEnd); err != nil {
+			return nil, err
+		}
+		if cols[keyDate] >= 0 && end.Before(start) {
+			// Past midnight
+			end = end.AddDate(0, 0, 1)
+		}
+	} else {
+		d, err := parseDuration(cols.value(record, keyDuration))
+		if err != nil {
+			return nil, err
+		}
+		end = start.Add(d)
+	}
+
+	return []string{
+		task,
+		strconv.FormatInt(start.Unix(), 10),
+		strconv.FormatInt(end.Unix(), 10),
+		cols.value(record, keyNote),
+		strings.Replace(cols.value(record, keyTags), " ", "", -1),
+		fingerprint(cols.value(record, keyID), record),
+	}, nil
+}
+
+// Parse a duration such as 1h30m, or a number of hours such as 1.5.
+func parseDuration(value string) (time.Duration, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	hours, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, errors.Errorf("Invalid duration: %s", value)
+	}
+	return time.Duration(hours * float64(time.Hour)).Round(time.Second), nil
+}
+
+func withDefault(value string, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,375 @@
+// Package importer provides the import command, reading entries logged
+// elsewhere. It is not named import, which is a reserved word.
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// A reader turns the content of a file into entries, each consisting of
+// task, start and end as Unix time, note, comma-separated tags and a
+// fingerprint. The fingerprint identifies the record the entry stems from, so
+// that it is not imported again; see recordHash.
+type reader func(file *os.File, m mapping) ([][]string, error)
+
+// Available formats by name.
+var readers = map[string]reader{
+	"csv":      readCSV,
+	"notes":    readNotes,
+	"tilo":     readTilo,
+	"wakatime": readWakaTime,
+}
+
+// Formats of activity recorded automatically, rather than logged by hand.
+// Entries of these formats only fill the time not covered by other entries.
+var automatic = map[string]bool{
+	"wakatime": true,
+}
+
+// Formats of entries which may be saved already, other than by an import,
+// and are skipped if so.
+var deduplicated = map[string]bool{
+	"tilo": true,
+}
+
+// Formats written by hand, with entries shown for confirmation before they
+// are imported.
+var previewed = map[string]bool{
+	"notes": true,
+}
+
+const (
+	paramPreset = "preset"
+	paramSave   = "save"
+	paramYes    = "yes"
+)
+
+// Mapping keys as used in presets, with dashes instead of underscores on the
+// command line.
+const (
+	keyTask        = "task"
+	keyDefaultTask = "default_task"
+	keyStart       = "start"
+	keyEnd         = "end"
+	keyDate        = "date"
+	keyDuration    = "duration"
+	keyNote        = "note"
+	keyTags        = "tags"
+	keyID          = "id"
+	keyLayout      = "layout"
+	keyDateLayout  = "date_layout"
+	keySeparator   = "separator"
+	keyHeader      = "header"
+	keyTimeout     = "timeout"
+)
+
+// Descriptions of all mapping keys, in the order shown in help messages.
+var mappingKeys = []struct{ key, values, description string }{
+	{keyTask, "<column>", "Column holding the task name"},
+	{keyDefaultTask, "<task>", "Task for rows without a task column"},
+	{keyStart, "<column>", "Column holding the start time"},
+	{keyEnd, "<column>", "Column holding the end time"},
+	{keyDuration, "<column>", "Column holding the duration, instead of the end time"},
+	{keyDate, "<column>", "Column holding the date, if separate from start and end"},
+	{keyNote, "<column>", "Column holding a note for the entry"},
+	{keyTags, "<column>", "Column holding comma-separated tags for the entry"},
+	{keyID, "<column>", "Column holding an ID for the record, unique within the format"},
+	{keyLayout, "<layout>", "Layout of start and end, default 2006-01-02 15:04 or 15:04 with a date column"},
+	{keyDateLayout, "<layout>", "Layout of the date column, default 2006-01-02"},
+	{keySeparator, "<char>", "Field separator, default ','; use tab for tab-separated files"},
+	{keyHeader, "<bool>", "Whether the first row names the columns, default true"},
+	{keyTimeout, "<duration>", "Longest pause within an entry of recorded activity, default 15m"},
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "import"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<format>",
+			Description: "The file format: " + strings.Join(formatNames(), ", "),
+		},
+		argparse.Arg{
+			Name:        "<file>",
+			Description: "The file to import",
+		},
+	}
+	params := []argparse.Param{
+		argparse.Option(paramPreset, "<name>", "Use the mapping saved under this name"),
+		argparse.Option(paramSave, "<name>", "Save the mapping under this name for later imports"),
+		argparse.Flag(paramYes, "Import notes without showing the entries for confirmation"),
+	}
+	for _, m := range mappingKeys {
+		params = append(params, argparse.Option(argName(m.key), m.values, m.description))
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Import entries logged with other tools")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Import entries from a file, mapping its columns to tasks and times"
+	footer := "Columns are given by the name in the header row or by number, starting at 1\n" +
+		"Layouts use Go's reference time, Mon Jan 2 15:04:05 2006; durations are given as\n" +
+		"e.g. 1h30m or in decimal hours\n\n" +
+		"A mapping can be saved as a preset with :save and reused with :preset; options given\n" +
+		"along with a preset take precedence. Presets are stored in the configuration file,\n" +
+		"in a section named after the preset, e.g. [import.bank-hours]\n\n" +
+		"Each record is imported only once, so files can be imported again after adding to\n" +
+		"them. Records are recognized by their ID if there is an ID column, otherwise by\n" +
+		"their content\n\n" +
+		"WakaTime exports, or other JSON lists of heartbeats with time and project, are\n" +
+		"turned into entries per project, named after it. Heartbeats without a project go\n" +
+		"to the default task. Recorded activity only fills the time not yet covered by\n" +
+		"other entries, so tasks tracked by hand take precedence\n\n" +
+		"Notes kept by hand, in plain text or markdown, are read line by line as e.g.\n" +
+		"09:00-10:30 coding +deep fixed the flaky test, or the same in table cells. The\n" +
+		"first word after the times is the task, words starting with + are tags and the\n" +
+		"rest is the note. The date is taken from a preceding line such as a heading, or\n" +
+		"from the start of the line, as given by :date-layout. Other lines are skipped.\n" +
+		"The entries are shown for confirmation before they are imported\n\n" +
+		"Exports of tilo itself, in CSV or JSON format, are imported as they are, e.g. to\n" +
+		"move to another backend. Entries saved already are skipped\n\n" +
+		"Examples\n" +
+		"    tilo import csv hours.csv :default-task=acme :date=Day :start=From :end=To \\\n" +
+		"        :date-layout=02.01.2006 :separator=';' :save=bank-hours\n" +
+		"    tilo import csv march.csv :preset=bank-hours\n" +
+		"    tilo import wakatime wakatime-export.json :default-task=coding :timeout=10m\n" +
+		"    tilo import tilo entries.json\n" +
+		"    tilo import notes journal.md :date-layout='Mon 02.01.2006'"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SetKind(msg.OriginImport)
+	read, ok := readers[cmd.Args[0]]
+	if !ok {
+		return errors.Errorf("No such format: %s", cmd.Args[0])
+	}
+	conf := cl.Config()
+	m, err := resolveMapping(conf, cmd.Opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(cmd.Args[1])
+	if err != nil {
+		return errors.Wrap(err, "Failed to open file")
+	}
+	defer file.Close()
+	entries, err := read(file, m)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", cmd.Args[1])
+	}
+
+	if name := cmd.Opts[paramSave]; name != "" {
+		if err := conf.SaveSection(config.SectionImportPrefix+name, m); err != nil {
+			return errors.Wrap(err, "Failed to save preset")
+		}
+	}
+	if previewed[cmd.Args[0]] && !cmd.Flags[paramYes] {
+		if len(entries) == 0 {
+			cl.PrintMessage("No entries found")
+			return nil
+		}
+		preview(entries)
+		if !client.Confirm(os.Stdin, fmt.Sprintf("Import %d entries?", len(entries))) {
+			cl.PrintMessage("Nothing imported")
+			return nil
+		}
+	}
+	cmd.Body = entries
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to import entries")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	source := req.Cmd.Args[0]
+	if tasks, fingerprints, err := parseEntries(req.Cmd.Body); err != nil {
+		resp.SetError(err)
+	} else {
+		var imported []msg.Task
+		skipped, covered := 0, 0
+	Tasks:
+		for i, task := range tasks {
+			task.Origin = req.Cmd.Origin
+			parts := []msg.Task{task}
+			if deduplicated[source] {
+				if saved, err := isSaved(srv, task); err != nil {
+					resp.SetError(err)
+					break
+				} else if saved {
+					skipped++
+					continue
+				}
+			}
+			if automatic[source] {
+				if parts, err = untracked(srv, task); err != nil {
+					resp.SetError(err)
+					break
+				} else if len(parts) == 0 {
+					covered++
+					continue
+				}
+			}
+			for p, part := range parts {
+				fp := fingerprints[i]
+				if p > 0 {
+					fp += "+" + strconv.FormatInt(part.Started.Unix(), 10)
+				}
+				if saved, err := srv.Backend.SaveImported(part, source, fp); err != nil {
+					resp.SetError(err)
+					break Tasks
+				} else if saved {
+					imported = append(imported, part)
+				} else {
+					skipped++
+				}
+			}
+		}
+		resp.AddImportedEntries(imported, skipped, covered)
+	}
+	return srv.Answer(req, resp)
+}
+
+// Turn the transferred rows back into tasks along with their fingerprints,
+// checking all of them before any is saved.
+func parseEntries(rows [][]string) ([]msg.Task, []string, error) {
+	var tasks []msg.Task
+	var fingerprints []string
+	for i, row := range rows {
+		if len(row) != 6 || row[5] == "" {
+			return nil, nil, errors.Errorf("Malformed entry %d: %v", i+1, row)
+		}
+		task := msg.Task{Name: row[0], HasEnded: true, Note: row[3]}
+		if names, err := argparse.GetTaskNames(task.Name); err != nil {
+			return nil, nil, err
+		} else if len(names) != 1 || names[0] == argparse.AllTasks {
+			return nil, nil, errors.Errorf("Invalid task name: %s", task.Name)
+		}
+		started, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Malformed entry %d", i+1)
+		}
+		ended, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Malformed entry %d", i+1)
+		}
+		task.Started, task.Ended = time.Unix(started, 0), time.Unix(ended, 0)
+		if !task.Ended.After(task.Started) {
+			return nil, nil, errors.Errorf("Entry %d for %s ends before it starts", i+1, task.Name)
+		}
+		if row[4] != "" {
+			if task.Tags, err = argparse.GetTagNames(row[4]); err != nil {
+				return nil, nil, err
+			}
+		}
+		tasks = append(tasks, task)
+		fingerprints = append(fingerprints, row[5])
+	}
+	return tasks, fingerprints, nil
+}
+
+// Show entries as read from a file, before they are imported.
+func preview(entries [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', 0)
+	fmt.Fprintln(w, "Task\tStarted\tEnded\tDuration\tTags\tNote")
+	for _, e := range entries {
+		started, _ := strconv.ParseInt(e[1], 10, 64)
+		ended, _ := strconv.ParseInt(e[2], 10, 64)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\t%s\n", e[0],
+			time.Unix(started, 0).Format("2006-01-02 15:04"), time.Unix(ended, 0).Format("2006-01-02 15:04"),
+			time.Duration(ended-started)*time.Second, e[4], e[3])
+	}
+	w.Flush()
+}
+
+// A mapping describes where to find the parts of an entry, by key.
+type mapping map[string]string
+
+// The mapping from the named preset, if any, with options given on the
+// command line taking precedence.
+func resolveMapping(conf *config.Opts, opts map[string]string) (mapping, error) {
+	m := make(mapping)
+	if name := opts[paramPreset]; name != "" {
+		preset := conf.Section(config.SectionImportPrefix + name)
+		if len(preset) == 0 {
+			return nil, errors.Errorf("No such preset: %s", name)
+		}
+		for key, value := range preset {
+			m[key] = value
+		}
+	}
+	for _, k := range mappingKeys {
+		if value, ok := opts[argName(k.key)]; ok {
+			m[k.key] = value
+		}
+	}
+	return m, nil
+}
+
+// The name of a mapping key on the command line.
+func argName(key string) string {
+	return strings.Replace(key, "_", "-", -1)
+}
+
+// Names of all available formats, in alphabetical order.
+func formatNames() []string {
+	var names []string
+	for name := range readers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The fingerprint of a record: its ID if it has one, otherwise a hash of its
+// content.
+func fingerprint(id string, record []string) string {
+	if id != "" {
+		return "id:" + id
+	}
+	return recordHash(record)
+}
+
+// A hash of the fields of a record, identifying records without an ID.
+func recordHash(record []string) string {
+	h := sha256.New()
+	for _, field := range record {
+		// Separated so that moving text between fields changes the hash
+		io.WriteString(h, strings.TrimSpace(field)+"\x00")
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/pkg/errors"
+)
+
+// A time range such as 09:00-10:30 or 9.00 to 10.30, or start and end in
+// separate table cells, followed by the rest of the line.
+var notesRange = regexp.MustCompile(`^(\d{1,2}[:.]\d{2})\s*(?:-+|–|to)?\s*(\d{1,2}[:.]\d{2})(?:\s+(.*))?$`)
+
+// Anything looking like a time of day, to find lines not understood.
+var notesTime = regexp.MustCompile(`\b\d{1,2}:\d{2}\b`)
+
+// Table rows separating the header, e.g. |---|:---:|.
+var notesSeparator = regexp.MustCompile(`^[\s|:-]+$`)
+
+// Read entries from time notes kept by hand, in plain text or markdown, one
+// per line as e.g. "09:00-10:30 coding +deep fixed the flaky test" or the
+// same in table cells. Entries are on the date given in a preceding line,
+// e.g. a heading, or at the start of their own line. The first word after
+// the times is the task, words starting with + are tags and the rest is the
+// note. Other lines are skipped.
+func readNotes(file *os.File, m mapping) ([][]string, error) {
+	dateLayout := withDefault(m[keyDateLayout], "2006-01-02")
+	var date time.Time
+	var entries [][]string
+	scanner := bufio.NewScanner(file)
+	for lnum := 1; scanner.Scan(); lnum++ {
+		words := strings.Fields(notesText(scanner.Text()))
+		if len(words) == 0 {
+			continue
+		}
+		if d, rest, ok := notesDate(words, dateLayout); ok {
+			date, words = d, rest
+		}
+		text := strings.Join(words, " ")
+		match := notesRange.FindStringSubmatch(text)
+		if match == nil {
+			if notesTime.MatchString(text) {
+				return nil, errors.Errorf("line %d: Expected a time range such as 09:00-10:30 but got: %s", lnum, text)
+			}
+			continue
+		} else if date.IsZero() {
+			return nil, errors.Errorf("line %d: No date given before: %s", lnum, text)
+		}
+
+		entry, err := notesEntry(date, match, m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lnum)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Wrap(scanner.Err(), "Unable to read notes")
+}
+
+// The text of a line without markdown markup: heading and list markers,
+// emphasis and table pipes. Table separator rows are empty.
+func notesText(line string) string {
+	line = strings.TrimSpace(line)
+	if notesSeparator.MatchString(line) {
+		return ""
+	}
+	line = strings.TrimLeft(line, "#>*- \t")
+	line = strings.Replace(line, "|", " ", -1)
+	line = strings.Replace(line, "**", "", -1)
+	return strings.TrimSpace(line)
+}
+
+// The date at the start of a line, such as a heading, along with the rest.
+func notesDate(words []string, layout string) (time.Time, []string, bool) {
+	n := len(strings.Fields(layout))
+	if n == 0 || len(words) < n {
+		return time.Time{}, words, false
+	}
+	str := strings.TrimRight(strings.Join(words[:n], " "), ":,")
+	d, err := time.ParseInLocation(layout, str, time.Local)
+	if err != nil {
+		return time.Time{}, words, false
+	}
+	return d, words[n:], true
+}
+
+// Turn a matched line into an entry on the given date: task, start, end,
+// note, tags and fingerprint.
+func notesEntry(date time.Time, match []string, m mapping) ([]string, error) {
+	clock := func(str string) (time.Time, error) {
+		t, err := time.Parse("15:04", strings.Replace(str, ".", ":", 1))
+		if err != nil {
+			return t, errors.Errorf("Invalid time: %s", str)
+		}
+		y, mon, d := date.Date()
+		return time.Date(y, mon, d, t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	start, err := clock(match[1])
+	if err != nil {
+		return nil, err
+	}
+	end, err := clock(match[2])
+	if err != nil {
+		return nil, err
+	}
+	if !end.After(start) {
+		// Past midnight
+		end = end.AddDate(0, 0, 1)
+	}
+
+	var task string
+	var tags, note []string
+	for _, word := range strings.Fields(match[3]) {
+		if argparse.IsTagShorthand(word) {
+			tags = append(tags, strings.TrimPrefix(word, argparse.TagShorthandPrefix))
+		} else if task == "" && len(note) == 0 {
+			task = strings.TrimRight(word, ":,")
+		} else {
+			note = append(note, word)
+		}
+	}
+	task = withDefault(task, m[keyDefaultTask])
+	if task == "" {
+		return nil, errors.New("No task")
+	}
+
+	return []string{
+		task,
+		strconv.FormatInt(start.Unix(), 10),
+		strconv.FormatInt(end.Unix(), 10),
+		strings.Join(note, " "),
+		strings.Join(tags, ","),
+		recordHash([]string{date.Format("2006-01-02"), match[0]}),
+	}, nil
+}
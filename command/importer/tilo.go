@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Read entries from an export made by tilo itself, in JSON or CSV format,
+// see `tilo export`. Entries are recognized by task and times, so that the
+// same export can be imported into several backends or again.
+func readTilo(file *os.File, m mapping) ([][]string, error) {
+	in := bufio.NewReader(file)
+	var entries []msg.Entry
+	if first, err := in.Peek(1); err == nil && first[0] == '[' {
+		if err := json.NewDecoder(in).Decode(&entries); err != nil {
+			return nil, errors.Wrap(err, "Malformed export")
+		}
+	} else {
+		var err error
+		if entries, err = readTiloCSV(in); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows [][]string
+	for _, e := range entries {
+		started, ended := strconv.FormatInt(e.Started.Unix(), 10), strconv.FormatInt(e.Ended.Unix(), 10)
+		rows = append(rows, []string{e.Task, started, ended, e.Note, strings.Join(e.Tags, ","),
+			recordHash([]string{e.Task, started, ended})})
+	}
+	return rows, nil
+}
+
+// Read entries from a CSV export, by the columns named in its header.
+func readTiloCSV(in io.Reader) ([]msg.Entry, error) {
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read header")
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, name := range []string{"task", "started", "ended", "note", "tags"} {
+		if _, ok := cols[name]; !ok {
+			return nil, errors.Errorf("Not an export of tilo, missing column %s", name)
+		}
+	}
+
+	var entries []msg.Entry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		e := msg.Entry{Task: record[cols["task"]], Note: record[cols["note"]]}
+		if e.Started, err = time.Parse(time.RFC3339, record[cols["started"]]); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		if e.Ended, err = time.Parse(time.RFC3339, record[cols["ended"]]); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		if tags := record[cols["tags"]]; tags != "" {
+			e.Tags = strings.Split(tags, ",")
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Whether an entry for the task with the same times is saved already, e.g.
+// when importing an export into the backend it was made from.
+func isSaved(srv *server.Server, task msg.Task) (bool, error) {
+	entries, err := srv.Backend.Entries(task.Name, task.Started.Add(-time.Second), task.Ended.Add(time.Second), 0)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.Started.Unix() == task.Started.Unix() && e.Ended.Unix() == task.Ended.Unix() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,175 @@
+package importer
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Heartbeats further apart than this end an entry, unless configured.
+const defaultHeartbeatTimeout = 15 * time.Minute
+
+// A heartbeat, sent by an editor plugin while coding.
+type heartbeat struct {
+	Time    float64 `json:"time"` // Unix time with fractional seconds
+	Project string  `json:"project"`
+}
+
+// The shapes of heartbeat exports: the data dump from the website with a
+// list of days, an API response, or a plain list.
+type heartbeatExport struct {
+	Days []struct {
+		Heartbeats []heartbeat `json:"heartbeats"`
+	} `json:"days"`
+	Data []heartbeat `json:"data"`
+}
+
+// Characters not allowed in task names.
+var invalidTaskChars = regexp.MustCompile(`[^\w-]+`)
+
+// Read entries from a WakaTime export, or any JSON list of heartbeats with
+// time and project. Heartbeats for the same project are joined into one
+// entry as long as they are at most the timeout apart.
+func readWakaTime(file *os.File, m mapping) ([][]string, error) {
+	timeout := defaultHeartbeatTimeout
+	if value := m[keyTimeout]; value != "" {
+		var err error
+		if timeout, err = parseDuration(value); err != nil || timeout <= 0 {
+			return nil, errors.Errorf("Invalid timeout: %s", value)
+		}
+	}
+
+	var beats []heartbeat
+	dec := json.NewDecoder(file)
+	if first, err := dec.Token(); err != nil {
+		return nil, errors.Wrap(err, "Not a JSON file")
+	} else if first == json.Delim('[') {
+		for dec.More() {
+			var b heartbeat
+			if err := dec.Decode(&b); err != nil {
+				return nil, errors.Wrap(err, "Malformed heartbeat")
+			}
+			beats = append(beats, b)
+		}
+	} else {
+		file.Seek(0, 0)
+		var export heartbeatExport
+		if err := json.NewDecoder(file).Decode(&export); err != nil {
+			return nil, errors.Wrap(err, "Malformed export")
+		}
+		for _, day := range export.Days {
+			beats = append(beats, day.Heartbeats...)
+		}
+		beats = append(beats, export.Data...)
+	}
+
+	byTask := make(map[string][]time.Time)
+	for _, b := range beats {
+		if b.Time <= 0 {
+			continue
+		}
+		task := projectTask(b.Project, m[keyDefaultTask])
+		if task == "" {
+			return nil, errors.Errorf("No project for heartbeat at %s, require a default task",
+				heartbeatTime(b).Format("2006-01-02 15:04"))
+		}
+		byTask[task] = append(byTask[task], heartbeatTime(b))
+	}
+
+	var entries [][]string
+	for task, times := range byTask {
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		start, end := times[0], times[0]
+		add := func() {
+			// Single heartbeats or very short runs are no entry of their own
+			if end.Sub(start) >= time.Minute {
+				entries = append(entries, []string{
+					task,
+					strconv.FormatInt(start.Unix(), 10),
+					strconv.FormatInt(end.Unix(), 10),
+					"",
+					"",
+					"run:" + task + "@" + strconv.FormatInt(start.Unix(), 10),
+				})
+			}
+		}
+		for _, t := range times[1:] {
+			if t.Sub(end) > timeout {
+				add()
+				start = t
+			}
+			end = t
+		}
+		add()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i][1] < entries[j][1] })
+	return entries, nil
+}
+
+func heartbeatTime(b heartbeat) time.Time {
+	sec, frac := math.Modf(b.Time)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// The task for a project, turning characters not allowed in task names into
+// dashes; the default task for heartbeats without a project.
+func projectTask(project string, def string) string {
+	task := strings.Trim(invalidTaskChars.ReplaceAllString(strings.TrimSpace(project), "-"), "-")
+	return withDefault(task, def)
+}
+
+// Trim the task to the time not yet covered by other entries or active
+// tasks, so that tracking a task by hand takes precedence over recorded
+// activity. Gives the remaining parts, none if the task is fully covered.
+func untracked(srv *server.Server, task msg.Task) ([]msg.Task, error) {
+	entries, err := srv.Backend.EntriesOverlapping(query.TskAllTasks, task.Started, task.Ended, 0)
+	if err != nil {
+		return nil, err
+	}
+	var covered []msg.Task
+	for _, e := range entries {
+		covered = append(covered, msg.Task{Started: e.Started, Ended: e.Ended})
+	}
+	for _, active := range srv.ActiveTasks() {
+		covered = append(covered, msg.Task{Started: active.Started, Ended: time.Now()})
+	}
+	sort.Slice(covered, func(i, j int) bool { return covered[i].Started.Before(covered[j].Started) })
+
+	var parts []msg.Task
+	rest := task
+	for _, c := range covered {
+		if !c.Ended.After(rest.Started) || !c.Started.Before(rest.Ended) {
+			continue
+		}
+		if c.Started.After(rest.Started) {
+			part := rest
+			part.Ended = c.Started
+			parts = append(parts, part)
+		}
+		rest.Started = c.Ended
+		if !rest.Ended.After(rest.Started) {
+			break
+		}
+	}
+	if rest.Ended.After(rest.Started) {
+		parts = append(parts, rest)
+	}
+
+	var result []msg.Task
+	for _, part := range parts {
+		if part.Ended.Sub(part.Started) >= time.Minute {
+			result = append(result, part)
+		}
+	}
+	return result, nil
+}
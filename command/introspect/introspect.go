@@ -0,0 +1,70 @@
+package introspect
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// The description of all commands, as written by this command.
+type registry struct {
+	ProtocolVersion int             `json:"protocol_version"`
+	ParamPrefix     string          `json:"param_prefix"`
+	AllTasks        string          `json:"all_tasks"`
+	Commands        []argparse.Spec `json:"commands"`
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "introspect"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Describe all commands as JSON, for tooling")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Write the syntax of all commands, their arguments and parameters as JSON"
+	footer := "Meant for programs built around tilo, e.g. completion scripts or GUIs, to stay\n" +
+		"in sync with the installed version. Parameter kinds are flag, option,\n" +
+		"quantifier and keyword; tasks are none, single, optional, split or multiple\n\n" +
+		"Example\n" +
+		"    tilo introspect | jq '.commands[].command'"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(registry{
+		ProtocolVersion: msg.ProtocolVersion,
+		ParamPrefix:     argparse.ParamIdentifierPrefix,
+		AllTasks:        argparse.AllTasks,
+		Commands:        client.Specs(),
+	})
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,55 @@
+package last
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "last"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Show the most recently completed entry")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Show what was last worked on, when it ended, and for how long"
+	footer := "Use the `resume` command to continue with the task\n" +
+		"Exits with non-zero status if no prior task exists"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to determine the last entry")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if entry, err := srv.Backend.LastEntry(); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to fetch the last entry"))
+	} else if entry.ID == 0 {
+		resp.SetError(errors.New("No completed entries"))
+	} else {
+		resp.AddLastEntry(entry)
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -3,6 +3,7 @@ package listen
 import (
 	"io"
 	"os"
+	"time"
 
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
@@ -12,6 +13,10 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	paramTick = "tick"
+)
+
 type operation struct {
 	// No state required
 }
@@ -21,7 +26,11 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+	params := []argparse.Param{
+		argparse.Option(paramTick, "<duration>", "Also notify at this interval while a task is active"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -30,11 +39,38 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Connect to the server and listen for notifications. Print whatever is received"
-	footer := "Use this mode for scripting purposes or as sample output when developing listeners in other languages"
+	footer := "Use this mode for scripting purposes or as sample output when developing listeners in other languages\n" +
+		"Each notification is a JSON object on a line of its own, with the event it is sent\n" +
+		"in response to: status (on connecting and other changes), start, stop, pause,\n" +
+		"tick or shutdown. It holds the current task, empty if idle, the seconds elapsed\n" +
+		"since it started and the paused tasks, if any\n\n" +
+		"Examples\n" +
+		"    tilo listen :tick=1s    # For a status bar showing the elapsed time"
 	return header, footer
 }
 
+func (op operation) Validate(cmd msg.Cmd) error {
+	_, err := tickInterval(cmd)
+	return err
+}
+
+// The interval at which to notify while a task is active, 0 if not requested.
+func tickInterval(cmd msg.Cmd) (time.Duration, error) {
+	value, ok := cmd.Opts[paramTick]
+	if !ok {
+		return 0, nil
+	}
+	tick, err := time.ParseDuration(value)
+	if err != nil || tick < time.Second {
+		return 0, errors.Errorf("Not a duration of at least a second: %s", value)
+	}
+	return tick, nil
+}
+
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
 	cl.EstablishConnection()
 	cl.SendToServer(cmd)
 	resp := cl.ReceiveFromServer()
@@ -51,11 +87,17 @@ func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	// NOTE: Connection has to be kept open!
 	resp := msg.Response{}
-	if listener, err := srv.RegisterListener(req); err != nil {
+	tick, err := tickInterval(req.Cmd)
+	if err != nil {
+		resp.SetError(err)
+		defer req.Close()
+		return srv.Answer(req, resp)
+	}
+	if listener, err := srv.RegisterListener(req, tick); err != nil {
 		resp.SetError(errors.Wrap(err, "Failed to add as listener"))
 	} else {
 		resp.SetListening()
-		defer listener.Notify(server.TaskNotification(srv.CurrentTask))
+		defer listener.Notify(srv.CurrentNotification())
 	}
 	return srv.Answer(req, resp)
 }
@@ -0,0 +1,143 @@
+package log
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramFrom = "from"
+	paramTo   = "to"
+	paramNote = "note"
+	paramTags = "tags"
+)
+
+// Accepted ways of giving a time, the latter two meaning today.
+var timeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "15:04"}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "log"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithSingleTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Option(paramFrom, "<time>", "When the activity started"),
+			argparse.Option(paramTo, "<time>", "When it ended, or how long it lasted"),
+			argparse.Option(paramNote, "<text>", "Attach a note to the entry"),
+			argparse.Option(paramTags, "<tag,..>", "Tag the entry"),
+		}))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Log activity after the fact")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Save a completed entry for activity which was not logged at the time"
+	footer := "Times are given as YYYY-MM-DDTHH:MM, or as HH:MM for today. The end may also be\n" +
+		"given as a duration. Entries overlapping with the new one are pointed out\n\n" +
+		"Examples\n" +
+		"    tilo log review :from=2023-05-02T09:00 :to=2023-05-02T11:30\n" +
+		"    tilo log meeting :from=14:00 :to=45m :note=\"sprint planning\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrapf(cl.Error(), "Failed to log task '%s'", cmd.TaskNames[0])
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if len(cmd.TaskNames) != 1 || cmd.TaskNames[0] == argparse.AllTasks {
+		return errors.New("Require a single task to log")
+	} else if cmd.Opts[paramFrom] == "" || cmd.Opts[paramTo] == "" {
+		return errors.New("Require both :from and :to")
+	}
+	if tags, ok := cmd.Opts[paramTags]; ok {
+		if _, err := argparse.GetTagNames(tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	task, err := logged(req.Cmd, time.Now())
+	if err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	id, err := srv.Backend.SaveEntry(task)
+	if err != nil {
+		resp.SetError(err)
+	} else if entry, err := srv.Backend.Entry(id); err != nil {
+		resp.SetError(err)
+	} else if overlapping, err := srv.Overlapping(entry); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddEntries([]msg.Entry{entry})
+		resp.AddOverlaps(overlapping)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The completed task described by the command, checking that it makes sense.
+func logged(cmd msg.Cmd, now time.Time) (msg.Task, error) {
+	task := msg.Task{Name: cmd.TaskNames[0], HasEnded: true, Origin: cmd.Origin}
+	var err error
+	if task.Started, err = parseTime(cmd.Opts[paramFrom], now); err != nil {
+		return task, err
+	}
+	if d, err := time.ParseDuration(cmd.Opts[paramTo]); err == nil {
+		task.Ended = task.Started.Add(d)
+	} else if task.Ended, err = parseTime(cmd.Opts[paramTo], now); err != nil {
+		return task, err
+	}
+	if !task.Ended.After(task.Started) {
+		return task, errors.New("The entry would end before it starts")
+	} else if task.Ended.After(now) {
+		return task, errors.New("The entry would end in the future")
+	}
+	task.Note = strings.TrimSpace(cmd.Opts[paramNote])
+	if tags, ok := cmd.Opts[paramTags]; ok {
+		if task.Tags, err = argparse.GetTagNames(tags); err != nil {
+			return task, err
+		}
+	}
+	return task, nil
+}
+
+// Parse a time in one of the accepted layouts, in the local time zone.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		} else if layout == "15:04" {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("Not a time (YYYY-MM-DDTHH:MM or HH:MM): %s", value)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,171 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Control packet types of MQTT 3.1.1, shifted into place.
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetDisconnect = 14 << 4
+)
+
+// Flags of the connect packet.
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUserName     = 0x80
+)
+
+// Brokers are given little time, as notifications queue up meanwhile.
+const timeout = 10 * time.Second
+
+const (
+	defaultPort    = "1883"
+	defaultTLSPort = "8883"
+)
+
+// Reasons for a broker to refuse a connection, by return code.
+var refusals = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// A connection to an MQTT broker, speaking just enough of version 3.1.1 to
+// publish messages at most once.
+type broker struct {
+	conn net.Conn
+	addr string
+}
+
+// A message published by the broker on the client's behalf once the
+// connection is lost without disconnecting first.
+type will struct {
+	topic   string
+	message string
+}
+
+// Connect to the broker at the given mqtt:// or mqtts:// URL, which may hold
+// a user name and password. The will is retained.
+func connect(location string, clientID string, keepAlive time.Duration, w will) (*broker, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid broker: %s", location)
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: timeout}
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+		}
+		conn, err = dialer.Dial("tcp", u.Host)
+	case "mqtts", "ssl":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), defaultTLSPort)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, errors.Errorf("Unsupported broker: %s, expected mqtt:// or mqtts://", location)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to %s", u.Host)
+	}
+	b := &broker{conn: conn, addr: u.Host}
+	if err := b.handshake(u.User, clientID, keepAlive, w); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "Failed to connect to %s", b.addr)
+	}
+	return b, nil
+}
+
+// Send the connect packet and await the broker's acknowledgement.
+func (b *broker) handshake(user *url.Userinfo, clientID string, keepAlive time.Duration, w will) error {
+	flags := byte(flagCleanSession | flagWill | flagWillRetain)
+	seconds := uint16(keepAlive / time.Second)
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, 0, byte(seconds>>8), byte(seconds))
+	body = appendString(body, clientID)
+	body = appendString(body, w.topic)
+	body = appendString(body, w.message)
+	if user != nil {
+		flags |= flagUserName
+		body = appendString(body, user.Username())
+		if password, ok := user.Password(); ok {
+			flags |= flagPassword
+			body = appendString(body, password)
+		}
+	}
+	body[7] = flags
+	if err := b.send(packetConnect, body); err != nil {
+		return err
+	}
+	ack := make([]byte, 4)
+	b.conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := io.ReadFull(b.conn, ack); err != nil {
+		return err
+	} else if ack[0] != packetConnack || ack[1] != 2 {
+		return errors.New("Not an MQTT broker")
+	} else if ack[3] != 0 {
+		if reason, ok := refusals[ack[3]]; ok {
+			return errors.Errorf("Refused: %s", reason)
+		}
+		return errors.Errorf("Refused with code %d", ack[3])
+	}
+	return nil
+}
+
+// Publish a message, retained by the broker for later subscribers if so
+// requested.
+func (b *broker) publish(topic string, message string, retain bool) error {
+	kind := byte(packetPublish)
+	if retain {
+		kind |= 1
+	}
+	return b.send(kind, append(appendString(nil, topic), message...))
+}
+
+// Disconnect from the broker, which then discards the will.
+func (b *broker) close() error {
+	b.send(packetDisconnect, nil)
+	return b.conn.Close()
+}
+
+// Send a packet of the given type and flags, with the body following the
+// remaining length.
+func (b *broker) send(kind byte, body []byte) error {
+	packet := []byte{kind}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := b.conn.Write(append(packet, body...))
+	return err
+}
+
+// Append a string, preceded by its length.
+func appendString(buf []byte, s string) []byte {
+	return append(append(buf, byte(len(s)>>8), byte(len(s))), s...)
+}
@@ -0,0 +1,76 @@
+package note
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "note"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<text>",
+			Description: "The text of the note, quoted or as several words",
+			Many:        true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Add a note to the current day")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Add a timestamped note to the current day, independent of any task"
+	footer := "Notes are listed in day-level reports, see `tilo help report`\n\n" +
+		"Examples\n" +
+		"    tilo note \"stand-up ran long\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if noteText(cmd) == "" {
+		return errors.New("Empty note")
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to save note")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	note := msg.Note{Time: time.Now(), Text: noteText(req.Cmd)}
+	if note.Text == "" {
+		resp.SetError(errors.New("Empty note"))
+	} else if err := srv.Backend.SaveNote(note); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddSavedNote(note)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The note's text as given in the command.
+func noteText(cmd msg.Cmd) string {
+	return strings.TrimSpace(strings.Join(cmd.Args, " "))
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,141 @@
+package off
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramRemove = "remove"
+	// Separates first and last day of a range of days off.
+	rangeSeparator = ":"
+	// Upper limit to avoid marking years by accident.
+	maxDays = 366
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "off"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<date>",
+			Description: "The day (YYYY-MM-DD) or range of days (YYYY-MM-DD:YYYY-MM-DD)",
+		},
+		argparse.Arg{
+			Name:        "[kind]",
+			Description: "The kind of absence: " + msg.OffVacation + " or " + msg.OffSick,
+			Optional:    true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramRemove, "Remove the mark from the given days"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Mark whole days as vacation or sick leave")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Mark whole days as off, e.g. for vacation or sick leave"
+	footer := "Days off are not counted as working days and no working time is expected on them\n" +
+		"Marking a day again replaces its previous kind\n\n" +
+		"Examples\n" +
+		"    tilo off 2024-05-02 vacation             # A single day of vacation\n" +
+		"    tilo off 2024-05-06:2024-05-08 sick      # Three sick days\n" +
+		"    tilo off 2024-05-02 :remove              # Undo a mark"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := daysOff(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to mark days off")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	days, err := daysOff(req.Cmd)
+	if err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	remove := req.Cmd.Flags[paramRemove]
+	for _, day := range days {
+		if remove {
+			err = srv.Backend.RemoveDayOff(day.Date)
+		} else {
+			err = srv.Backend.SaveDayOff(day)
+		}
+		if err != nil {
+			resp.SetError(err)
+			return srv.Answer(req, resp)
+		}
+	}
+	resp.AddDaysOff(days, remove)
+	return srv.Answer(req, resp)
+}
+
+// The days off described by the command's arguments.
+func daysOff(cmd msg.Cmd) ([]msg.DayOff, error) {
+	if len(cmd.Args) == 0 {
+		return nil, errors.New("No date given")
+	}
+	kind := ""
+	if len(cmd.Args) > 1 {
+		kind = cmd.Args[1]
+	}
+	if cmd.Flags[paramRemove] {
+		if kind != "" {
+			return nil, errors.New("No kind of absence expected when removing days off")
+		}
+	} else if kind != msg.OffVacation && kind != msg.OffSick {
+		return nil, errors.Errorf("Kind of absence must be %s or %s, got '%s'", msg.OffVacation, msg.OffSick, kind)
+	}
+
+	bounds := strings.SplitN(cmd.Args[0], rangeSeparator, 2)
+	first, err := time.ParseInLocation("2006-01-02", bounds[0], time.Local)
+	if err != nil {
+		return nil, errors.Errorf("Not a date (YYYY-MM-DD): %s", bounds[0])
+	}
+	last := first
+	if len(bounds) == 2 {
+		if last, err = time.ParseInLocation("2006-01-02", bounds[1], time.Local); err != nil {
+			return nil, errors.Errorf("Not a date (YYYY-MM-DD): %s", bounds[1])
+		}
+	}
+	if last.Before(first) {
+		return nil, errors.Errorf("Last day before first: %s", cmd.Args[0])
+	}
+
+	var days []msg.DayOff
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if len(days) == maxDays {
+			return nil, errors.Errorf("Cannot mark more than %d days at once", maxDays)
+		}
+		days = append(days, msg.DayOff{Date: day.Format("2006-01-02"), Kind: kind})
+	}
+	return days, nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,260 @@
+package org
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const actionServe = "serve"
+
+// Sent by the server in place of a task name when shutting down.
+const shutdownTask = "--shutdown"
+
+// Org mode's timestamp format for clock entries, e.g. [2024-05-06 Mon 09:00]
+const orgTimestamp = "[2006-01-02 Mon 15:04]"
+
+// The clock opened for a task, and not yet closed.
+type clock struct {
+	task  string
+	start time.Time
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "org"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<action>",
+			Description: "What to do: " + actionServe,
+		},
+		argparse.Arg{
+			Name:        "<file>",
+			Description: "The org file holding the clock entries",
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Mirror task changes into an org-mode file")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Listen for task changes and mirror them as clock entries into an org-mode file"
+	footer := "Actions\n" +
+		"    serve <file>  Keep clocking in and out until the server shuts down\n\n" +
+		"Each task has a top-level heading of its name, created if missing, under which\n" +
+		"clock entries are kept in a LOGBOOK drawer, the most recent first, as org-mode\n" +
+		"does when clocking in. Starting a task clocks in, stopping it clocks out\n\n" +
+		"Only the current task is mirrored, see `tilo current`. Clocks opened in Emacs\n" +
+		"are left alone. With auto-revert-mode, buffers visiting the file stay in sync\n\n" +
+		"Examples\n" +
+		"    tilo org serve ~/org/clock.org"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if cmd.Args[0] != actionServe {
+		return errors.Errorf("No such action: %s", cmd.Args[0])
+	}
+	file, err := filepath.Abs(cmd.Args[1])
+	if err != nil {
+		return err
+	}
+
+	cl.EstablishConnection()
+	cl.SendToServer(msg.Cmd{Op: "listen"})
+	resp := cl.ReceiveFromServer()
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to establish listener connection")
+	} else if err := resp.Err(); err != nil {
+		return err
+	}
+	cl.PrintMessage("Mirroring task changes into " + file)
+	return serve(cl, file)
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+// Clock in and out on each notification until the server shuts down.
+func serve(notifications io.Reader, file string) error {
+	dec := json.NewDecoder(notifications)
+	var open *clock
+	for {
+		var ntf server.Notification
+		if err := dec.Decode(&ntf); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "Failed to receive notification")
+		}
+		if open != nil && open.task == ntf.Task && open.start.Equal(ntf.Since) {
+			// Nothing changed for the current task, e.g. a new icon
+			continue
+		}
+		if open != nil {
+			end := ntf.Since
+			if ntf.Task == shutdownTask {
+				end = time.Now()
+			}
+			if err := update(file, func(lines []string) []string {
+				return clockOut(lines, *open, end)
+			}); err != nil {
+				return err
+			}
+			open = nil
+		}
+		switch ntf.Task {
+		case shutdownTask:
+			return nil
+		case "":
+			continue
+		}
+		open = &clock{task: ntf.Task, start: ntf.Since}
+		if err := update(file, func(lines []string) []string {
+			return clockIn(lines, *open)
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// Apply a change to the lines of the file, created if it does not exist.
+// The file is replaced at once so that editors never see a partial change.
+func update(file string, change func(lines []string) []string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Unable to read org file")
+	}
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+	lines = change(lines)
+
+	tmp := file + ".tilo-tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err, "Unable to write org file")
+	}
+	return errors.Wrap(os.Rename(tmp, file), "Unable to write org file")
+}
+
+// Open a clock under the task's heading, unless already open, e.g. because
+// mirroring was restarted.
+func clockIn(lines []string, c clock) []string {
+	entry := "CLOCK: " + c.start.Format(orgTimestamp)
+	heading := findHeading(lines, c.task)
+	if heading < 0 {
+		lines = append(lines, "* "+c.task)
+		heading = len(lines) - 1
+	}
+	drawer, found := findLogbook(lines, heading)
+	if found {
+		for i := drawer + 1; i < len(lines) && strings.TrimSpace(lines[i]) != ":END:"; i++ {
+			if strings.TrimSpace(lines[i]) == entry {
+				return lines
+			}
+		}
+		return insert(lines, drawer+1, entry)
+	}
+	return insert(lines, drawer, ":LOGBOOK:", entry, ":END:")
+}
+
+// Close the clock opened for the task, with its duration as org-mode shows it.
+func clockOut(lines []string, c clock, end time.Time) []string {
+	entry := "CLOCK: " + c.start.Format(orgTimestamp)
+	heading := findHeading(lines, c.task)
+	if heading < 0 {
+		return lines
+	}
+	for i := heading + 1; i < len(lines) && !isHeading(lines[i]); i++ {
+		if strings.TrimSpace(lines[i]) == entry {
+			minutes := int(end.Truncate(time.Minute).Sub(c.start.Truncate(time.Minute)).Minutes())
+			lines[i] = fmt.Sprintf("%s--%s => %2d:%02d", entry, end.Format(orgTimestamp), minutes/60, minutes%60)
+			break
+		}
+	}
+	return lines
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^\*+\s`)
+	tagsPattern    = regexp.MustCompile(`\s+:[\w@#%:]+:$`)
+)
+
+func isHeading(line string) bool {
+	return headingPattern.MatchString(line)
+}
+
+// The index of the task's top-level heading, ignoring tags; -1 if missing.
+func findHeading(lines []string, task string) int {
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "* ") {
+			continue
+		}
+		title := tagsPattern.ReplaceAllString(strings.TrimSpace(strings.TrimPrefix(line, "* ")), "")
+		if title == task {
+			return i
+		}
+	}
+	return -1
+}
+
+// The index of the LOGBOOK drawer below the heading if found, otherwise
+// the index at which to insert one: after planning lines and properties.
+func findLogbook(lines []string, heading int) (int, bool) {
+	i := heading + 1
+Lines:
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == ":LOGBOOK:":
+			return i, true
+		case strings.HasPrefix(line, "SCHEDULED:") || strings.HasPrefix(line, "DEADLINE:") ||
+			strings.HasPrefix(line, "CLOSED:"):
+		case line == ":PROPERTIES:":
+			for i < len(lines) && strings.TrimSpace(lines[i]) != ":END:" {
+				i++
+			}
+		default:
+			break Lines
+		}
+	}
+	return i, false
+}
+
+// Insert lines at the index.
+func insert(lines []string, at int, added ...string) []string {
+	result := append([]string{}, lines[:at]...)
+	result = append(result, added...)
+	return append(result, lines[at:]...)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,220 @@
+package overlong
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Accepted for the end of a trimmed task, the former on the day it started.
+const (
+	clockLayout = "15:04"
+	timeLayout  = "2006-01-02T15:04"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "overlong"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name: "<decision>",
+			Description: "What to keep of the task: " + server.OverlongKeep + " it up to the limit, " +
+				server.OverlongTrim + " it or " + server.OverlongDiscard + " it",
+			Optional: true,
+		},
+		argparse.Arg{
+			Name:        "<time>",
+			Description: "When a trimmed task ended, as HH:MM on the day it started or YYYY-MM-DDTHH:MM",
+			Optional:    true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithOptionalTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Decide on tasks stopped for running too long")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "List the tasks stopped for running longer than max_task_duration, or decide what to keep of one"
+	footer := "Stopped tasks are saved up to the limit unless overlong_action is abort.\n" +
+		"Unless decided otherwise, they stay that way. `start` and `stop` ask about\n" +
+		"undecided tasks, too\n\n" +
+		"Examples\n" +
+		"    tilo overlong                    # List the undecided tasks\n" +
+		"    tilo overlong review trim 18:30  # Keep review only until 18:30\n" +
+		"    tilo overlong review discard     # Keep nothing of it"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if len(cmd.TaskNames) == 0 {
+		if len(cmd.Args) > 0 {
+			return errors.New("Require a task to decide on")
+		}
+		cl.SendReceivePrint(cmd)
+		return errors.Wrap(cl.Error(), "Failed to list tasks stopped for running too long")
+	}
+	if len(cmd.Args) == 0 {
+		return errors.New("Require a decision: " + strings.Join(decisions(), ", "))
+	} else if cmd.Args[0] == server.OverlongTrim && len(cmd.Args) < 2 {
+		return errors.New("Require a time to trim the task to")
+	}
+	resp := cl.SendReceive(msg.Cmd{Op: op.Command()})
+	if cl.Failed() {
+		cl.PrintResponse(resp)
+		return errors.Wrap(cl.Error(), "Failed to list tasks stopped for running too long")
+	}
+	cl.Close()
+	for _, o := range resp.Overlong {
+		if o.Task.Name != cmd.TaskNames[0] {
+			continue
+		}
+		var end string
+		if len(cmd.Args) > 1 {
+			t, err := parseEnd(o.Task, cmd.Args[1])
+			if err != nil {
+				return err
+			}
+			end = t.Format(time.RFC3339)
+		}
+		return resolve(cl, o.Task.Name, cmd.Args[0], end)
+	}
+	return errors.Errorf("Task was not stopped for running too long: %s", cmd.TaskNames[0])
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	cmd := req.Cmd
+	if len(cmd.TaskNames) == 0 {
+		resp.AddOverlong(srv.Overlong(), true)
+		return srv.Answer(req, resp)
+	}
+	var end time.Time
+	if len(cmd.Args) > 1 {
+		var err error
+		if end, err = time.Parse(time.RFC3339, cmd.Args[1]); err != nil {
+			resp.SetError(errors.Wrap(err, "Invalid end of trimmed task"))
+			return srv.Answer(req, resp)
+		}
+	} else if len(cmd.Args) == 0 {
+		resp.SetError(errors.New("Require a decision"))
+		return srv.Answer(req, resp)
+	}
+	if err := srv.ResolveOverlong(cmd.TaskNames[0], cmd.Args[0], end); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddOverlong(srv.Overlong(), true)
+	}
+	return srv.Answer(req, resp)
+}
+
+// Ask what to keep of each task in the response stopped for running too
+// long. Those left undecided can be decided on later.
+func Ask(cl *client.Client, resp msg.Response) error {
+	if len(resp.Overlong) == 0 {
+		return nil
+	}
+	// The connection is re-established for each decision
+	if cl.Connected() {
+		cl.Close()
+	}
+	in := bufio.NewReader(os.Stdin)
+	for _, o := range resp.Overlong {
+		task := o.Task
+		fmt.Printf("Task %s was stopped after running since %s\n", task.Name, task.Started.Format("Mon 15:04"))
+		var decision string
+		for decision == "" {
+			fmt.Print("Keep it until " + task.Ended.Format(clockLayout) + ", trim or discard it? [k/t/d, empty to decide later] ")
+			answer, err := in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "" {
+				if err != nil {
+					fmt.Println()
+				}
+				return nil
+			}
+			for _, d := range decisions() {
+				if strings.HasPrefix(d, answer) {
+					decision = d
+				}
+			}
+		}
+		var end string
+		for decision == server.OverlongTrim && end == "" {
+			fmt.Print("Trim to [HH:MM or YYYY-MM-DDTHH:MM] ")
+			answer, err := in.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer == "" && err != nil {
+				fmt.Println()
+				return nil
+			}
+			if t, err := parseEnd(task, answer); err != nil {
+				fmt.Println(err)
+			} else {
+				end = t.Format(time.RFC3339)
+			}
+		}
+		if err := resolve(cl, task.Name, decision, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send a decision on a task to the server.
+func resolve(cl *client.Client, taskName string, decision string, end string) error {
+	args := []string{decision}
+	if end != "" {
+		args = append(args, end)
+	}
+	resp := cl.SendReceive(msg.Cmd{Op: "overlong", TaskNames: []string{taskName}, Args: args})
+	if cl.Connected() {
+		cl.Close()
+	}
+	if resp.Failed() || cl.Failed() {
+		cl.PrintResponse(resp)
+		return errors.Wrapf(cl.Error(), "Failed to %s task '%s'", decision, taskName)
+	}
+	cl.PrintMessage(fmt.Sprintf("Decided to %s task '%s'", decision, taskName))
+	return nil
+}
+
+// The end of a trimmed task given as a time of day on the day it started or
+// as date and time.
+func parseEnd(task msg.Task, str string) (time.Time, error) {
+	if t, err := time.ParseInLocation(clockLayout, str, time.Local); err == nil {
+		y, m, d := task.Started.Date()
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	t, err := time.ParseInLocation(timeLayout, str, time.Local)
+	if err != nil {
+		return t, errors.Errorf("Expected HH:MM or YYYY-MM-DDTHH:MM but got %s", str)
+	}
+	return t, nil
+}
+
+func decisions() []string {
+	return []string{server.OverlongKeep, server.OverlongTrim, server.OverlongDiscard}
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,73 @@
+package pause
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "pause"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Pause the active task, e.g. for a break")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Stop the active task, saving the time so far, and keep it to be resumed"
+	footer := "No time is logged while paused. Use `resume` to continue the task, and `current`\n" +
+		"to see for how long it has been paused. Starting another task ends the pause\n" +
+		"If parallel tasks are allowed (allow_parallel), all active tasks are paused\n\n" +
+		"Examples\n" +
+		"    tilo pause    # Off to lunch\n" +
+		"    tilo resume   # Back again"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to pause")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if len(srv.ActiveTasks()) == 0 {
+		if len(srv.Paused()) > 0 {
+			resp.SetError(errors.New("Already paused"))
+		} else {
+			resp.SetError(errors.New("No active task"))
+		}
+		return srv.Answer(req, resp)
+	}
+	for _, task := range srv.Pause() {
+		// Too short to keep, but resumed all the same
+		if srv.TooShort(task) {
+			resp.AddDiscardedTask(task)
+		} else if err := srv.SaveTask(task); err != nil {
+			resp.SetError(err)
+		}
+	}
+	if !resp.Failed() {
+		resp.AddPausedTasks(srv.Paused(), time.Now())
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,250 @@
+// Package push provides the push command and the job behind it, sending the
+// time logged on each task per day to a time-series database, e.g. for
+// graphs in Grafana.
+package push
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Keys in the metrics section of the configuration file.
+const (
+	keyTarget      = "target"
+	keyInfluxToken = "influx_token"
+	keyPrefix      = "prefix"
+	keySchedule    = "schedule"
+	keyDays        = "days"
+)
+
+const (
+	defaultPrefix = "tilo"
+	// Today and yesterday, whose total may have changed since the last push
+	defaultDays = 2
+)
+
+const (
+	paramDays   = "days"
+	paramDryRun = "dry-run"
+)
+
+// A point is the time logged on a task on one day, starting at day.
+type point struct {
+	task  string
+	day   time.Time
+	total time.Duration
+}
+
+// The number of days to push, as requested or else configured.
+func daysToPush(cmd msg.Cmd, section map[string]string) (int, error) {
+	value, ok := cmd.Opts[paramDays]
+	if !ok {
+		value, ok = section[keyDays]
+	}
+	if !ok {
+		return defaultDays, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, errors.Errorf("Invalid number of days: %s", value)
+	}
+	return days, nil
+}
+
+// The time logged on each task on the given number of days up to the one
+// including now, most recent first. Days start as configured via day_start.
+// Requires the server to be locked.
+func points(srv *server.Server, days int, now time.Time) ([]point, error) {
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(srv.Config()); err != nil {
+		return nil, errors.Wrap(err, "Invalid calendar configuration")
+	}
+	var points []point
+	day := cal.Day(now)
+	for i := 0; i < days; i++ {
+		sum, err := srv.Backend.GetAllTasksBetween(day.Start, day.End, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in database query")
+		}
+		for _, s := range sum {
+			if s.Total > 0 {
+				points = append(points, point{task: s.Task, day: day.Start, total: s.Total})
+			}
+		}
+		day = cal.Day(day.Start.Add(-time.Minute))
+	}
+	return points, nil
+}
+
+// The target configured in the metrics section, which must be given.
+func requireTarget(section map[string]string) (target, error) {
+	t, err := targetFrom(section)
+	if err == nil && t == nil {
+		err = errors.Errorf("No target in the [%s] section of the configuration file", config.SectionMetrics)
+	}
+	return t, err
+}
+
+// Push the points to the target configured in the metrics section. As this
+// waits for the target, the server is best not locked meanwhile.
+func push(section map[string]string, points []point) error {
+	t, err := requireTarget(section)
+	if err != nil || len(points) == 0 {
+		return err
+	}
+	prefix := section[keyPrefix]
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	return errors.Wrapf(t.write(prefix, points), "Failed to push to %s", t)
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "push"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := []argparse.Param{
+		argparse.Option(paramDays, "<n>", "Push the totals of the last n days, including today"),
+		argparse.Flag(paramDryRun, "Only list the totals which would be pushed"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Push daily totals to a time-series database")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Send the time logged on each task per day to InfluxDB or Graphite"
+	footer := "The server pushes on its own if a schedule is set. Each push covers today and\n" +
+		"the days before, replacing the totals pushed for them before.\n\n" +
+		"The [metrics] section of the configuration file controls pushing:\n" +
+		"    target        The http(s) URL of an InfluxDB write endpoint, or\n" +
+		"                  graphite://host:port for Graphite's plaintext protocol\n" +
+		"    influx_token  The API token for InfluxDB, if required\n" +
+		"    prefix        The InfluxDB measurement or Graphite path prefix, default tilo\n" +
+		"    schedule      When the server pushes: hourly, nightly or HH:MM\n" +
+		"    days          The number of days pushed each time, default 2\n\n" +
+		"InfluxDB receives the seconds logged on each day, tagged with the task; Graphite\n" +
+		"receives them as prefix.task, where a project becomes a level of its own\n\n" +
+		"Examples\n" +
+		"    tilo push\n" +
+		"    tilo push :days=90       # Fill in the past\n" +
+		"    tilo push :dry-run\n\n" +
+		"    [metrics]\n" +
+		"    target = http://localhost:8086/api/v2/write?org=home&bucket=tilo\n" +
+		"    influx_token = ...\n" +
+		"    schedule = hourly"
+	return header, footer
+}
+
+// The server gives the totals, which the client pushes so that requests are
+// not held back in the meantime, as with uploaded backups.
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := daysToPush(cmd, nil); err != nil {
+		return err
+	} else if cmd.Flags[paramDryRun] {
+		cl.SendReceivePrint(cmd)
+		return errors.Wrap(cl.Error(), "Failed to determine totals")
+	}
+	section := cl.Config().Section(config.SectionMetrics)
+	if _, err := requireTarget(section); err != nil {
+		return err
+	}
+	resp := cl.SendReceive(cmd)
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to determine totals")
+	} else if err := resp.Err(); err != nil {
+		return errors.Wrap(err, "Failed to determine totals")
+	}
+	var points []point
+	for _, s := range resp.Summary {
+		points = append(points, point{task: s.Task, day: s.Start, total: s.Total})
+	}
+	if err := push(section, points); err != nil {
+		return errors.Wrap(err, "Failed to push totals")
+	}
+	cl.PrintResponse(resp)
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	days, err := daysToPush(req.Cmd, srv.Config().Section(config.SectionMetrics))
+	var totals []point
+	if err == nil {
+		totals, err = points(srv, days, time.Now())
+	}
+	if err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	var rows [][]string
+	for _, p := range totals {
+		rows = append(rows, []string{p.day.Format("2006-01-02"), p.task, fmt.Sprint(p.total)})
+		resp.Summary = append(resp.Summary, msg.Summary{Task: p.task, Start: p.day, Total: p.total})
+	}
+	resp.AddTable([]string{"Day", "Task", "Total"}, rows)
+	return srv.Answer(req, resp)
+}
+
+// Pushes made by the server as scheduled.
+type job struct {
+	// No state required
+}
+
+func (j job) Next(conf *config.Opts, after time.Time) time.Time {
+	section := conf.Section(config.SectionMetrics)
+	if section[keyTarget] == "" {
+		return time.Time{}
+	}
+	// Errors are reported when running the job
+	next, err := server.NextScheduled(section[keySchedule], after)
+	if err != nil {
+		return after.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// Only determining the totals requires the server to be locked, pushing them
+// does not hold back requests.
+func (j job) Run(srv *server.Server) error {
+	srv.Lock()
+	section := srv.Config().Section(config.SectionMetrics)
+	if _, err := server.NextScheduled(section[keySchedule], time.Now()); err != nil {
+		srv.Unlock()
+		return errors.Wrap(err, "Invalid push configuration")
+	}
+	days, err := daysToPush(msg.Cmd{}, section)
+	var totals []point
+	if err == nil {
+		totals, err = points(srv, days, time.Now())
+	}
+	srv.Unlock()
+	if err != nil {
+		return err
+	}
+	return push(section, totals)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+	server.RegisterJob("push", job{})
+}
@@ -0,0 +1,135 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A target is a time-series database receiving daily totals.
+type target interface {
+	// Write the points, replacing those of the same task and day
+	write(prefix string, points []point) error
+	// Where the points go
+	String() string
+}
+
+// The target configured in the metrics section, nil if there is none. An
+// http(s):// URL is an InfluxDB write endpoint, graphite:// the host and
+// port of a Graphite server accepting its plaintext protocol.
+func targetFrom(section map[string]string) (target, error) {
+	location := section[keyTarget]
+	if location == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid push target: %s", location)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return influxTarget{endpoint: location, token: section[keyInfluxToken]}, nil
+	case "graphite":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), defaultGraphitePort)
+		}
+		return graphiteTarget{addr: u.Host}, nil
+	default:
+		return nil, errors.Errorf("Unsupported push target: %s", location)
+	}
+}
+
+// Targets are given little time, as the server waits for them.
+const timeout = 10 * time.Second
+
+const defaultGraphitePort = "2003"
+
+var httpClient = &http.Client{Timeout: timeout}
+
+// An InfluxDB write endpoint taking the line protocol, e.g.
+// http://localhost:8086/api/v2/write?org=me&bucket=tilo, or /write?db=tilo
+// for version 1.
+type influxTarget struct {
+	endpoint string
+	token    string
+}
+
+// Escape commas, spaces and equals signs in a tag value.
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func (t influxTarget) write(prefix string, points []point) error {
+	var body bytes.Buffer
+	for _, p := range points {
+		fmt.Fprintf(&body, "%s,task=%s seconds=%di %d\n", influxEscaper.Replace(prefix),
+			influxEscaper.Replace(p.task), int64(p.total.Seconds()), p.day.UnixNano())
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("POST %s: %s %s", t.endpoint, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (t influxTarget) String() string {
+	return t.endpoint
+}
+
+// A Graphite server, or anything else accepting its plaintext protocol.
+type graphiteTarget struct {
+	addr string
+}
+
+func (t graphiteTarget) write(prefix string, points []point) error {
+	conn, err := net.DialTimeout("tcp", t.addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	var body bytes.Buffer
+	for _, p := range points {
+		fmt.Fprintf(&body, "%s.%s %d %d\n", prefix, graphitePath(p.task), int64(p.total.Seconds()), p.day.Unix())
+	}
+	_, err = conn.Write(body.Bytes())
+	return err
+}
+
+func (t graphiteTarget) String() string {
+	return "graphite://" + t.addr
+}
+
+// The metric path for a task. Projects become a level of their own, other
+// characters Graphite treats specially are replaced.
+func graphitePath(task string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '/':
+			return '.'
+		case r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, task)
+}
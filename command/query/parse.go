@@ -1,9 +1,12 @@
 package query
 
 import (
+	"time"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/argparse/quantifier"
-	"time"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -15,7 +18,9 @@ const (
 	paramEver      = "ever"
 	// Flags and params -- modifiers required
 	paramDay       = "day"
+	paramWeek      = "week"
 	paramMonth     = "month"
+	paramQuarter   = "quarter"
 	paramYear      = "year"
 	paramDaysAgo   = "days-ago"
 	paramWeeksAgo  = "weeks-ago"
@@ -25,14 +30,66 @@ const (
 	paramLastWeek  = "last-week"
 	paramThisMonth = "this-month"
 	paramLastMonth = "last-month"
+	paramThisQuart = "this-quarter"
+	paramLastQuart = "last-quarter"
 	paramThisYear  = "this-year"
 	paramLastYear  = "last-year"
+	paramThisFY    = "this-fy"
+	paramLastFY    = "last-fy"
+	paramFY        = "fy"
 	paramSince     = "since"
 	paramBetween   = "between"
+	paramPeriod    = "period"
+	// Breakdown of results
+	paramBy            = "by"
+	paramPerWorkingDay = "per-working-day"
+	paramPercent       = "percent"
+	// Copy the results to the clipboard
+	paramClip = "clip"
+	// Individual entries instead of totals
+	paramEntries = "entries"
+	// Leave out short entries
+	paramMin = "min"
+	// Only entries from certain clients
+	paramOrigin = "origin"
+	// Only entries of a project or with a tag
+	paramProject = "project"
+	paramTag     = "tag"
+	// Archived tasks, otherwise left out of queries for all tasks
+	paramArchived = "archived"
+	// Time remaining in the current period of budgets
+	paramBudget = "budget"
+	// Totals by project or tag instead of by task
+	paramGroup   = "group"
+	groupProject = "project"
+	groupTag     = "tag"
 )
 
-func newQueryArgHandler(now time.Time) argparse.ArgHandler {
-	params := []argparse.Param{
+func newQueryArgHandler(now time.Time, cal *quantifier.Calendar) argparse.ArgHandler {
+	params := append(PeriodParams(now, cal),
+		// Breakdown
+		argparse.Option(paramBy, quantifier.BreakdownUnits, "Break down each period into smaller ones"),
+		argparse.Flag(paramPerWorkingDay, "Show the average time per working day"),
+		argparse.Flag(paramPercent, "Show each task's share of all time logged in the period"),
+		argparse.Flag(paramEntries, "List individual entries with their IDs instead of totals"),
+		MinParam(),
+		argparse.Option(paramOrigin, "<origin>",
+			"Only entries created or modified by a kind of client, a host, or both as kind@host"),
+		argparse.Option(paramProject, "<project>", "Only entries of tasks in the project, e.g. client-a for client-a/backend"),
+		argparse.Option(paramTag, "<tag>", "Only entries with the tag"),
+		argparse.Option(paramGroup, groupProject+"|"+groupTag, "Give totals by project or by tag instead of by task"),
+		argparse.Flag(paramArchived, "Include archived tasks when querying all tasks"),
+		argparse.Flag(paramBudget, "Show the time remaining for the tasks' budgets in their current period"),
+		argparse.Flag(paramClip, "Copy the results to the clipboard as well"),
+	)
+	return argparse.HandlerForParams(params)
+}
+
+// PeriodParams gives the parameters describing periods of time relative to now.
+// Days start as set for the calendar, so that today may still be yesterday.
+func PeriodParams(now time.Time, cal *quantifier.Calendar) []argparse.Param {
+	now = cal.Today(now)
+	return []argparse.Param{
 		// Fixed day
 		argparse.Param{
 			Name:        paramToday,
@@ -75,6 +132,20 @@ func newQueryArgHandler(now time.Time) argparse.ArgHandler {
 			Description: "Last month's activity",
 		},
 
+		// Fixed quarter
+		argparse.Param{
+			Name:        paramThisQuart,
+			RequiresArg: false,
+			Quantifier:  quantifier.FixedQuarterOffset(now, 0),
+			Description: "This quarter's activity",
+		},
+		argparse.Param{
+			Name:        paramLastQuart,
+			RequiresArg: false,
+			Quantifier:  quantifier.FixedQuarterOffset(now, -1),
+			Description: "Last quarter's activity",
+		},
+
 		// Fixed year
 		argparse.Param{
 			Name:        paramThisYear,
@@ -89,6 +160,26 @@ func newQueryArgHandler(now time.Time) argparse.ArgHandler {
 			Description: "Last year's activity",
 		},
 
+		// Fiscal year
+		argparse.Param{
+			Name:        paramThisFY,
+			RequiresArg: false,
+			Quantifier:  quantifier.FixedFiscalYearOffset(now, cal, 0),
+			Description: "This fiscal year's activity",
+		},
+		argparse.Param{
+			Name:        paramLastFY,
+			RequiresArg: false,
+			Quantifier:  quantifier.FixedFiscalYearOffset(now, cal, -1),
+			Description: "Last fiscal year's activity",
+		},
+		argparse.Param{
+			Name:        paramFY,
+			RequiresArg: true,
+			Quantifier:  quantifier.ListOf(quantifier.SpecificFiscalYear(cal)),
+			Description: "Activity in a given fiscal year",
+		},
+
 		// Dynamic day/week/month/year
 		argparse.Param{
 			Name:        paramDaysAgo,
@@ -115,19 +206,31 @@ func newQueryArgHandler(now time.Time) argparse.ArgHandler {
 			Description: "Activity N years ago",
 		},
 
-		// Specific day/month/year
+		// Specific day/week/month/year
 		argparse.Param{
 			Name:        paramDay,
 			RequiresArg: true,
 			Quantifier:  quantifier.ListOf(quantifier.SpecificDate()),
 			Description: "Activity on a given day",
 		},
+		argparse.Param{
+			Name:        paramWeek,
+			RequiresArg: true,
+			Quantifier:  quantifier.ListOf(quantifier.SpecificWeek()),
+			Description: "Activity in a given ISO week",
+		},
 		argparse.Param{
 			Name:        paramMonth,
 			RequiresArg: true,
 			Quantifier:  quantifier.ListOf(quantifier.SpecificMonth()),
 			Description: "Activity in a given month",
 		},
+		argparse.Param{
+			Name:        paramQuarter,
+			RequiresArg: true,
+			Quantifier:  quantifier.ListOf(quantifier.SpecificQuarter()),
+			Description: "Activity in a given quarter",
+		},
 		argparse.Param{
 			Name:        paramYear,
 			RequiresArg: true,
@@ -148,7 +251,97 @@ func newQueryArgHandler(now time.Time) argparse.ArgHandler {
 			Quantifier:  quantifier.ListOf(quantifier.DynamicBetween()),
 			Description: "Activity between two dates",
 		},
+
+		// User-defined
+		argparse.Param{
+			Name:        paramPeriod,
+			RequiresArg: true,
+			Quantifier:  quantifier.ListOf(quantifier.NamedPeriod(cal)),
+			Description: "Activity in a named period",
+		},
 	}
+}
 
-	return argparse.HandlerForParams(params)
+// MinParam gives the parameter for leaving out entries shorter than a given
+// duration.
+func MinParam() argparse.Param {
+	return argparse.Option(paramMin, "<duration>", "Leave out entries shorter than this, e.g. 1m")
+}
+
+// Restrictions on the entries counted, and how to group them if not by task.
+type entryFilter struct {
+	origin  string // See msg.MatchOrigin
+	project string
+	tag     string
+	group   string          // groupProject, groupTag, or empty
+	hidden  map[string]bool // Tasks left out, e.g. archived ones
+}
+
+// The filter requested by the command.
+func filterFor(cmd msg.Cmd) (entryFilter, error) {
+	f := entryFilter{
+		origin:  cmd.Opts[paramOrigin],
+		project: cmd.Opts[paramProject],
+		tag:     cmd.Opts[paramTag],
+		group:   cmd.Opts[paramGroup],
+	}
+	if _, ok := cmd.Opts[paramGroup]; ok && f.group != groupProject && f.group != groupTag {
+		return f, errors.Errorf("Cannot group by %s, only by %s or %s", f.group, groupProject, groupTag)
+	}
+	return f, nil
+}
+
+// Whether entries need to be looked at individually.
+func (f entryFilter) active() bool {
+	return f.origin != "" || f.project != "" || f.tag != "" || f.group != "" || len(f.hidden) > 0
+}
+
+func (f entryFilter) match(e msg.Entry) bool {
+	if f.hidden[e.Task] {
+		return false
+	} else if f.origin != "" && !e.MatchOrigin(f.origin) {
+		return false
+	} else if f.project != "" && msg.Project(e.Task) != f.project {
+		return false
+	} else if f.tag == "" {
+		return true
+	}
+	for _, tag := range e.Tags {
+		if tag == f.tag {
+			return true
+		}
+	}
+	return false
+}
+
+// The names under which the entry is counted: its task, project, or each of
+// its tags.
+func (f entryFilter) keys(e msg.Entry) []string {
+	switch f.group {
+	case groupProject:
+		if project := msg.Project(e.Task); project != "" {
+			return []string{project}
+		}
+		return []string{"(no project)"}
+	case groupTag:
+		if len(e.Tags) > 0 {
+			return e.Tags
+		}
+		return []string{"(untagged)"}
+	}
+	return []string{e.Task}
+}
+
+// MinDuration gives the minimum duration of entries requested by the
+// command, 0 if there is none.
+func MinDuration(cmd msg.Cmd) (time.Duration, error) {
+	value, ok := cmd.Opts[paramMin]
+	if !ok {
+		return 0, nil
+	}
+	min, err := time.ParseDuration(value)
+	if err != nil || min < 0 {
+		return 0, errors.Errorf("Invalid minimum duration: %s", value)
+	}
+	return min, nil
 }
@@ -1,12 +1,18 @@
 package query
 
 import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/argparse/quantifier"
 	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/clipboard"
 	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
 	"github.com/fgahr/tilo/msg"
 	"github.com/fgahr/tilo/server"
 	"github.com/fgahr/tilo/server/backend"
@@ -14,7 +20,7 @@ import (
 )
 
 type operation struct {
-	// No state required
+	cal *quantifier.Calendar
 }
 
 func (op operation) Command() string {
@@ -22,7 +28,11 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithMultipleTasks().WithArgHandler(newQueryArgHandler(time.Now()))
+	return argparse.CommandParser(op.Command()).WithMultipleTasks().WithArgHandler(newQueryArgHandler(time.Now(), op.cal))
+}
+
+func (op operation) Configure(conf *config.Opts) error {
+	return op.cal.Configure(conf)
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -32,91 +42,300 @@ func (op operation) DescribeShort() argparse.Description {
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Get information about recorded activity"
 	footer := "Where indicated, a list of quantifiers (or pairs thereof) can be given\n" +
-		"Parameters can be freely combined and repeated in a single query\n\n" +
+		"Parameters can be freely combined and repeated in a single query\n" +
+		"Fiscal years are named by the calendar year they start in, see the fiscal_year_start setting\n" +
+		"Named periods are defined in the [periods] section of the configuration file\n" +
+		"Working days are set via working_days, holidays in the [holidays] section\n" +
+		"Days start at midnight unless set otherwise via day_start, e.g. 04:00 for night owls\n" +
+		"Entry IDs, as listed with :entries, remain stable and identify entries in other commands\n" +
+		"Entries reaching beyond a period, e.g. past midnight, count with the part inside it\n" +
+		"Results for several tasks or periods are followed by their total, and with :by= by\n" +
+		"a subtotal for each of the smaller periods; overlapping periods are counted twice\n" +
+		"Entries record the client which created them and the last to modify them, see `tilo show`;\n" +
+		"kinds of clients are cli, tui (tilo shell), agent (e.g. watch, editors) and import\n" +
+		"Tasks named project/task, e.g. client-a/backend, belong to the project before the slash;\n" +
+		"grouped by tag, entries with several tags count for each of them\n" +
+		"Archived tasks, see `tilo help task`, are left out of :all unless :archived is given\n" +
+		"Budgets, see `tilo help budget`, are shown for their current week or month, whatever\n" +
+		"the period queried; with :budget alone, no period is required\n\n" +
 		"Examples\n" +
 		"    tilo query :all :this-week                    # This week's activity across all tasks\n" +
 		"    tilo query foo :between 2019-01-01:2019-06-30 # Logged on task foo in first half of 2019\n" +
-		"    tilo query bar :month=2019-01,2019-02,2019-03 # Activity for bar in three different months"
+		"    tilo query bar :month=2019-01,2019-02,2019-03 # Activity for bar in three different months\n" +
+		"    tilo query :all :this-year :by=quarter        # This year's activity per quarter\n" +
+		"    tilo query :all :week=2024-W19,2024-W20       # Activity in two ISO weeks\n" +
+		"    tilo query foo :today :entries                # Each of today's entries for foo\n" +
+		"    tilo query :all :this-week :min=1m            # Leaving out entries shorter than a minute\n" +
+		"    tilo query :all :today :origin=agent          # Only entries recorded by agents, e.g. watch\n" +
+		"    tilo query foo,bar :last-month :percent       # Share of last month's time for each\n" +
+		"    tilo query :all :last-week :clip              # Ready to paste into a timesheet\n" +
+		"    tilo query :all :period=sprint42              # Activity in a named period, e.g.\n" +
+		"                                                  # sprint42 = 2024-05-06..2024-05-17\n" +
+		"    tilo query :all :this-month :group=project    # This month's activity per project\n" +
+		"    tilo query :all :last-month :tag=billable     # Last month's billable activity\n" +
+		"    tilo query client-a,learning :budget          # Time left for their budgets"
 	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
-	cl.SendReceivePrint(cmd)
-	return errors.Wrap(cl.Error(), "Failed to query the server")
+	if _, err := MinDuration(cmd); err != nil {
+		return err
+	} else if _, err := filterFor(cmd); err != nil {
+		return err
+	}
+	if !cmd.Flags[paramClip] {
+		cl.SendReceivePrint(cmd)
+		return errors.Wrap(cl.Error(), "Failed to query the server")
+	}
+	resp := cl.SendReceive(cmd)
+	var text bytes.Buffer
+	cl.PrintResponseTo(io.MultiWriter(os.Stdout, &text), resp)
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to query the server")
+	}
+	via, err := clipboard.Copy(text.String())
+	if err != nil {
+		return errors.Wrap(err, "Failed to copy to the clipboard")
+	}
+	cl.PrintMessage("Copied to the clipboard via " + via)
+	return nil
 }
 
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
 	backend := srv.Backend
+	breakdown := req.Cmd.Opts[paramBy]
+	infos, err := backend.TaskInfo()
+	if err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to determine task metadata"))
+		return srv.Answer(req, resp)
+	}
+	min, err := MinDuration(req.Cmd)
+	if err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(srv.Config()); err != nil {
+		resp.SetError(errors.Wrap(err, "Invalid calendar configuration"))
+		return srv.Answer(req, resp)
+	}
+	filter, err := filterFor(req.Cmd)
+	if err != nil {
+		resp.SetError(err)
+		return srv.Answer(req, resp)
+	}
+	if len(req.Cmd.TaskNames) == 1 && req.Cmd.TaskNames[0] == argparse.AllTasks && !req.Cmd.Flags[paramArchived] {
+		filter.hidden = archived(infos)
+	}
+	perWorkingDay := req.Cmd.Flags[paramPerWorkingDay]
+	percent := req.Cmd.Flags[paramPercent]
+	var all []msg.Summary
 Outer:
 	for _, task := range req.Cmd.TaskNames {
 		for _, quant := range req.Cmd.Quantities {
-			if sum, err := queryBackend(backend, task, quant); err != nil {
+			var err error
+			if req.Cmd.Flags[paramEntries] {
+				var entries []msg.Entry
+				if entries, err = queryEntries(backend, task, quant, cal, min, filter); err == nil {
+					resp.AddEntries(entries)
+				}
+			} else {
+				var sum []msg.Summary
+				if sum, err = queryBackend(backend, task, quant, breakdown, cal, perWorkingDay, percent, min, filter); err == nil {
+					for i := range sum {
+						sum[i].Description = infos[sum[i].Task].Description
+					}
+					resp.AddQuerySummaries(sum)
+					all = append(all, sum...)
+				}
+			}
+			if err != nil {
 				resp.SetError(errors.Wrap(err, "A query failed"))
 				break Outer
-			} else {
-				resp.AddQuerySummaries(sum)
 			}
 		}
 	}
+	if len(all) > 1 && !resp.Failed() {
+		resp.AddQueryTotals(all, breakdown != "")
+	}
+	if req.Cmd.Flags[paramBudget] && !resp.Failed() {
+		addBudgets(srv, &resp, req.Cmd.TaskNames)
+	}
 	return srv.Answer(req, resp)
 }
 
-func queryBackend(b backend.Backend, task string, param msg.Quantity) ([]msg.Summary, error) {
+// Add the budgets covering the tasks, with the time remaining in their
+// current period, following the other results if any.
+func addBudgets(srv *server.Server, resp *msg.Response, taskNames []string) {
+	if len(taskNames) == 1 && taskNames[0] == argparse.AllTasks {
+		taskNames = nil
+	}
+	statuses, err := srv.BudgetStatus(taskNames, time.Now())
+	if err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+		return
+	} else if len(statuses) == 0 {
+		resp.Warnings = append(resp.Warnings, "No budgets for the queried tasks, see `tilo help budget`")
+		return
+	}
+	if len(resp.Body) > 0 {
+		resp.AddSeparator()
+	}
+	resp.AddBudgetStatus(statuses)
+}
+
+// The names of archived tasks, left out when querying all tasks.
+func archived(infos map[string]msg.TaskInfo) map[string]bool {
+	var names map[string]bool
+	for name, info := range infos {
+		if info.Archived {
+			if names == nil {
+				names = make(map[string]bool)
+			}
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Query the backend for the period described by param in the calendar, broken
+// down into smaller periods if desired. If requested, working days are
+// counted as well, excluding days off, and each task's share of the time
+// logged on all tasks is determined. Entries shorter than min are left out, as
+// are those not matching the filter, which may also group them other than by
+// task.
+func queryBackend(b backend.Backend, task string, param msg.Quantity, breakdown string,
+	cal *quantifier.Calendar, workingDays bool, percent bool, min time.Duration, filter entryFilter) ([]msg.Summary, error) {
 	var sum []msg.Summary
 	if b == nil {
 		return sum, errors.New("No backend present")
 	}
-	var err error
-	// TODO: Some more length checks required. Might be restructured beforehand.
-	switch param.Type {
-	case quantifier.TimeDay:
-		start, err := time.Parse("2006-01-02", param.Elems[0])
-		if err != nil {
-			return nil, errors.Wrap(err, "Unable to construct query")
-		}
-		end := start.AddDate(0, 0, 1)
-		sum, err = b.GetTaskBetween(task, start, end)
-	case quantifier.TimeBetween:
-		if len(param.Elems) < 2 {
-			return nil, errors.Errorf("Invalid query parameter: %v", param)
-		}
-		start, err := time.Parse("2006-01-02", param.Elems[0])
-		if err != nil {
+	period, err := cal.Period(param)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to construct query")
+	}
+	spans := []quantifier.Span{period}
+	if breakdown != "" {
+		if spans, err = cal.Breakdown(period, breakdown); err != nil {
 			return nil, err
 		}
-		end, err := time.Parse("2006-01-02", param.Elems[1])
+	}
+	if workingDays {
+		daysOff, err := b.DaysOff(period.Start, period.End)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrap(err, "Error in database query")
 		}
-		sum, err = b.GetTaskBetween(task, start, end)
-	case quantifier.TimeMonth:
-		start, err := time.Parse("2006-01", param.Elems[0])
-		if err != nil {
-			return nil, errors.Wrap(err, "Unable to construct query")
+		cal.AddDaysOff(daysOff)
+	}
+	for _, span := range spans {
+		var spanSum []msg.Summary
+		if filter.active() {
+			spanSum, err = filteredTotals(b, task, span, min, filter)
+		} else {
+			spanSum, err = b.GetTaskBetween(task, span.Start, span.End, min)
 		}
-		end := start.AddDate(0, 1, 0)
-		sum, err = b.GetTaskBetween(task, start, end)
-	case quantifier.TimeYear:
-		start, err := time.Parse("2006", param.Elems[0])
 		if err != nil {
-			return nil, errors.Wrap(err, "Unable to construct query")
+			return nil, errors.Wrap(err, "Error in database query")
+		}
+		var total time.Duration
+		if percent {
+			if total, err = totalBetween(b, span, min); err != nil {
+				return nil, errors.Wrap(err, "Error in database query")
+			}
+		}
+		// Setting the details allows to give better output.
+		for i := range spanSum {
+			spanSum[i].Details = span.Label
+			if workingDays {
+				spanSum[i].WorkingDays = cal.WorkingDays(span)
+			}
+			if total > 0 {
+				spanSum[i].Percent = 100 * float64(spanSum[i].Total) / float64(total)
+			}
 		}
-		end := start.AddDate(1, 0, 0)
-		sum, err = b.GetTaskBetween(task, start, end)
+		sum = append(sum, spanSum...)
 	}
-	if err != nil {
-		return nil, errors.Wrap(err, "Error in database query")
+	return sum, nil
+}
+
+// The time logged on all tasks within the span.
+func totalBetween(b backend.Backend, span quantifier.Span, min time.Duration) (time.Duration, error) {
+	all, err := b.GetAllTasksBetween(span.Start, span.End, min)
+	var total time.Duration
+	for _, s := range all {
+		total += s.Total
 	}
+	return total, err
+}
 
-	// Setting the details allows to give better output.
-	for i, _ := range sum {
-		sum[i].Details = param
+// The time logged within the span by entries matching the filter, grouped as
+// it demands, counting the part of each entry inside the span, as the backend
+// does for unfiltered totals.
+func filteredTotals(b backend.Backend, task string, span quantifier.Span, min time.Duration,
+	filter entryFilter) ([]msg.Summary, error) {
+	entries, err := b.EntriesOverlapping(task, span.Start, span.End, min)
+	if err != nil {
+		return nil, err
 	}
+	byTask := make(map[string]*msg.Summary)
+	var sum []msg.Summary
+	for _, e := range entries {
+		start, end := e.Started, e.Ended
+		if start.Before(span.Start) {
+			start = span.Start
+		}
+		if end.After(span.End) {
+			end = span.End
+		}
+		if !filter.match(e) || !end.After(start) {
+			continue
+		}
+		for _, key := range filter.keys(e) {
+			s, ok := byTask[key]
+			if !ok {
+				s = &msg.Summary{Task: key, Start: start, End: end}
+				byTask[key] = s
+			}
+			s.Total += end.Sub(start)
+			if end.After(s.End) {
+				s.End = end
+			}
+		}
+	}
+	for _, s := range byTask {
+		sum = append(sum, *s)
+	}
+	sort.Slice(sum, func(i, j int) bool { return sum[i].Task < sum[j].Task })
 	return sum, nil
 }
 
+// Query the backend for the individual entries reaching into the period
+// described by param in the calendar, leaving out those shorter than min and
+// those not matching the filter.
+func queryEntries(b backend.Backend, task string, param msg.Quantity, cal *quantifier.Calendar,
+	min time.Duration, filter entryFilter) ([]msg.Entry, error) {
+	if b == nil {
+		return nil, errors.New("No backend present")
+	}
+	period, err := cal.Period(param)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to construct query")
+	}
+	entries, err := b.EntriesOverlapping(task, period.Start, period.End, min)
+	if err != nil || !filter.active() {
+		return entries, errors.Wrap(err, "Error in database query")
+	}
+	var matching []msg.Entry
+	for _, e := range entries {
+		if filter.match(e) {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
 func init() {
-	command.RegisterOperation(operation{})
+	command.RegisterOperation(operation{quantifier.DefaultCalendar()})
 }
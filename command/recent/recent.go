@@ -41,12 +41,14 @@ func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	resp := msg.Response{}
 
 	fetchNum := 5
-	if srv.CurrentTask.IsRunning() {
-		fetchNum--
-		resp.AddCurrentTask(srv.CurrentTask)
+	if active := srv.ActiveTasks(); len(active) > 0 {
+		fetchNum -= len(active)
+		resp.AddActiveTasks(active)
 	}
 
-	if summary, err := srv.Backend.RecentTasks(fetchNum); err != nil {
+	if fetchNum <= 0 {
+		// Nothing left to fetch.
+	} else if summary, err := srv.Backend.RecentTasks(fetchNum); err != nil {
 		resp.SetError(errors.Wrap(err, "failed to fetch recent task data"))
 	} else {
 		resp.AddQuerySummaries(summary)
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+)
+
+// List the days marked as off, followed by the number of days per kind.
+// Days off not on a working day are listed but not counted.
+func absence(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := srv.Backend.DaysOff(period.Start, period.End)
+		if err != nil {
+			return err
+		}
+
+		var rows [][]string
+		counts := make(map[string]int)
+		for _, day := range days {
+			date, err := time.ParseInLocation("2006-01-02", day.Date, time.Local)
+			if err != nil {
+				return err
+			}
+			// Days off are not added to the calendar, else they would
+			// never be considered working days.
+			counted := cal.IsWorkingDay(date)
+			if counted {
+				counts[day.Kind]++
+			}
+			rows = append(rows, []string{date.Format("Mon 2006-01-02"), day.Kind, fmt.Sprint(counted)})
+		}
+		var kinds []string
+		for kind := range counts {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			rows = append(rows, []string{"Total " + kind, fmt.Sprint(counts[kind])})
+		}
+
+		title := strings.Join(append([]string{"Absence", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Kind", "Working day"}, rows)
+	}
+	return nil
+}
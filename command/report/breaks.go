@@ -0,0 +1,156 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Key in the break_rules section for the shortest break counted, as breaks
+// are often required to last a while to count at all.
+const keyShortestBreak = "shortest"
+
+// A break required once the time worked on a day exceeds some amount.
+type breakRule struct {
+	after    time.Duration
+	required time.Duration
+}
+
+// Break rules and the shortest break counted, as configured.
+type breakRules struct {
+	rules    []breakRule // By time worked, ascending
+	shortest time.Duration
+}
+
+// Read the rules from the section, e.g. 6h = 30m for half an hour of break
+// after six hours of work.
+func breakRulesFrom(section map[string]string) (breakRules, error) {
+	var br breakRules
+	for key, value := range section {
+		required, err := time.ParseDuration(value)
+		if err != nil || required < 0 {
+			return br, errors.Errorf("Not a duration for %s in [%s]: %s", key, config.SectionBreakRules, value)
+		}
+		if key == keyShortestBreak {
+			br.shortest = required
+			continue
+		}
+		after, err := time.ParseDuration(key)
+		if err != nil || after <= 0 {
+			return br, errors.Errorf("Not a time worked in [%s]: %s", config.SectionBreakRules, key)
+		}
+		br.rules = append(br.rules, breakRule{after: after, required: required})
+	}
+	if len(br.rules) == 0 {
+		return br, errors.Errorf("No rules in the [%s] section of the configuration file", config.SectionBreakRules)
+	}
+	sort.Slice(br.rules, func(i, j int) bool { return br.rules[i].after < br.rules[j].after })
+	return br, nil
+}
+
+// The break required for the time worked, according to the strictest rule
+// applying to it.
+func (br breakRules) required(worked time.Duration) time.Duration {
+	var required time.Duration
+	for _, rule := range br.rules {
+		if worked > rule.after && rule.required > required {
+			required = rule.required
+		}
+	}
+	return required
+}
+
+// Check the breaks taken on each day against the rules for the time worked,
+// flagging days with too little of a break. Days without work are skipped.
+func breaks(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	br, err := breakRulesFrom(srv.Config().Section(config.SectionBreakRules))
+	if err != nil {
+		return err
+	}
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+		entries, err := srv.Backend.EntriesOverlapping(argparse.AllTasks, period.Start, period.End, min)
+		if err != nil {
+			return err
+		}
+
+		var rows [][]string
+		var workedTotal, breakTotal time.Duration
+		violations := 0
+		for _, day := range days {
+			if day.Start.After(now) {
+				break
+			}
+			var worked, taken time.Duration
+			// Entries crossing midnight count towards both days
+			for _, e := range entries {
+				d := overlap(e.Started, e.Ended, day.Start, day.End)
+				if d <= 0 {
+					continue
+				} else if !e.IsBreak() {
+					worked += d
+				} else if d >= br.shortest {
+					taken += d
+				}
+			}
+			for _, task := range srv.ActiveTasks() {
+				overlap := activeOverlap(task, day.Start, day.End)
+				if !activeBreak(task) {
+					worked += overlap
+				} else if overlap >= br.shortest {
+					taken += overlap
+				}
+			}
+			if worked == 0 {
+				continue
+			}
+			workedTotal += worked
+			breakTotal += taken
+			required := br.required(worked)
+			state := "ok"
+			if taken < required {
+				state = "short by " + formatHours(required-taken)
+				violations++
+			}
+			rows = append(rows, []string{
+				day.Start.Format("Mon 2006-01-02"),
+				formatHours(worked),
+				formatHours(taken),
+				formatHours(required),
+				state,
+			})
+		}
+		rows = append(rows, []string{"Total", formatHours(workedTotal), formatHours(breakTotal), "",
+			fmt.Sprintf("%d day(s) short", violations)})
+
+		title := strings.Join(append([]string{"Breaks", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Worked", "Breaks", "Required", "State"}, rows)
+	}
+	return nil
+}
+
+// Whether an active task is a break, see msg.Entry.IsBreak.
+func activeBreak(task msg.Task) bool {
+	return msg.Entry{Task: task.Name, Tags: task.Tags}.IsBreak()
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Show tracked time as a share of expected hours for each day, with a
+// subtotal for each week. Days without expectations or activity are skipped,
+// as are days in the future.
+func coverage(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	now := time.Now()
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	if value, ok := cmd.Opts[paramWorkingHours]; ok {
+		if err := setWeeklyHours(cal, value); err != nil {
+			return err
+		}
+	}
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+		if err := addDaysOff(srv, cal, period); err != nil {
+			return err
+		}
+
+		var rows [][]string
+		var weekExpected, weekTracked, expectedTotal, trackedTotal time.Duration
+		week := ""
+		endWeek := func() {
+			if week != "" {
+				rows = append(rows, coverageRow("Week "+week, weekExpected, weekTracked))
+			}
+			weekExpected, weekTracked = 0, 0
+		}
+		for _, day := range days {
+			if day.Start.After(now) {
+				break
+			}
+			tracked, err := trackedBetween(srv, day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			expected := cal.ExpectedHours(day.Start)
+			if expected == 0 && tracked == 0 {
+				continue
+			}
+			if year, w := day.Start.ISOWeek(); fmt.Sprintf("%d-W%02d", year, w) != week {
+				endWeek()
+				week = fmt.Sprintf("%d-W%02d", year, w)
+			}
+			weekExpected += expected
+			weekTracked += tracked
+			expectedTotal += expected
+			trackedTotal += tracked
+			rows = append(rows, coverageRow(day.Start.Format("Mon 2006-01-02"), expected, tracked))
+		}
+		endWeek()
+		rows = append(rows, coverageRow("Total", expectedTotal, trackedTotal))
+
+		title := strings.Join(append([]string{"Coverage", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Expected", "Tracked", "Coverage"}, rows)
+	}
+	return nil
+}
+
+func coverageRow(label string, expected time.Duration, tracked time.Duration) []string {
+	share := "-"
+	if expected > 0 {
+		share = fmt.Sprintf("%.0f%%", 100*float64(tracked)/float64(expected))
+	}
+	return []string{label, formatHours(expected), formatHours(tracked), share}
+}
+
+// Spread the hours expected per week, given as a number of hours or as a
+// duration, evenly across the working days.
+func setWeeklyHours(cal *quantifier.Calendar, value string) error {
+	weekly, err := time.ParseDuration(value)
+	if hours, parseErr := strconv.ParseFloat(value, 64); parseErr == nil {
+		weekly, err = time.Duration(hours*float64(time.Hour)), nil
+	}
+	if err != nil || weekly < 0 {
+		return errors.Errorf("Not a number of working hours: %s", value)
+	}
+	days := cal.WeeklyWorkingDays()
+	if days == 0 {
+		return errors.New("No working days configured")
+	}
+	return cal.SetExpectedHours((weekly / time.Duration(days)).String(), nil)
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// How the time logged on a task each day is billed: rounded up to the next
+// increment, and at least the minimum. Zero values leave the time as is.
+type billing struct {
+	round time.Duration
+	min   time.Duration
+}
+
+// The billing rules requested by the command.
+func billingFor(cmd msg.Cmd) (billing, error) {
+	var b billing
+	for param, d := range map[string]*time.Duration{paramRound: &b.round, paramMinBilled: &b.min} {
+		value, ok := cmd.Opts[param]
+		if !ok {
+			continue
+		}
+		var err error
+		if *d, err = time.ParseDuration(value); err != nil || *d < 0 {
+			return b, errors.Errorf("Invalid duration for %s: %s", param, value)
+		}
+	}
+	return b, nil
+}
+
+// The time billed for the given time logged.
+func (b billing) billed(logged time.Duration) time.Duration {
+	if logged <= 0 {
+		return 0
+	}
+	// Seconds are not billed
+	billed := logged.Round(time.Minute)
+	if b.round > 0 && billed%b.round != 0 {
+		billed += b.round - billed%b.round
+	}
+	if billed < b.min {
+		billed = b.min
+	}
+	return billed
+}
+
+// List the time per task on each day of each period, with the time billed
+// after rounding, subtotals per task and a grand total.
+func invoice(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	b, err := billingFor(cmd)
+	if err != nil {
+		return err
+	}
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	for i, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+		byTask := make(map[string][][]string)
+		loggedTotal := make(map[string]time.Duration)
+		billedTotal := make(map[string]time.Duration)
+		for _, day := range days {
+			sum, err := srv.Backend.GetAllTasksBetween(day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			for _, s := range sum {
+				if s.Total <= 0 {
+					continue
+				}
+				billed := b.billed(s.Total)
+				byTask[s.Task] = append(byTask[s.Task], []string{s.Task, day.Start.Format("Mon 2006-01-02"),
+					formatHours(s.Total), formatHours(billed), decimalHours(billed)})
+				loggedTotal[s.Task] += s.Total
+				billedTotal[s.Task] += billed
+			}
+		}
+
+		var tasks []string
+		for task := range byTask {
+			tasks = append(tasks, task)
+		}
+		sort.Strings(tasks)
+		var rows [][]string
+		var logged, billed time.Duration
+		for _, task := range tasks {
+			rows = append(rows, byTask[task]...)
+			rows = append(rows, []string{task, "Subtotal", formatHours(loggedTotal[task]),
+				formatHours(billedTotal[task]), decimalHours(billedTotal[task])})
+			logged += loggedTotal[task]
+			billed += billedTotal[task]
+		}
+		rows = append(rows, []string{"Total", "", formatHours(logged), formatHours(billed), decimalHours(billed)})
+
+		if i > 0 {
+			resp.AddSeparator()
+		}
+		title := strings.Join(append([]string{"Invoice", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Day", "Logged", "Billed", "Decimal"}, rows)
+	}
+	return nil
+}
+
+// Format a duration as decimal hours, e.g. 1.25 for an hour and a quarter.
+func decimalHours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', 2, 64)
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	"strings"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+)
+
+// List the notes made within each period, along with the days off.
+func journal(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		notes, err := srv.Backend.Notes(period.Start, period.End)
+		if err != nil {
+			return err
+		}
+		if err := addDaysOff(srv, cal, period); err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+
+		var rows [][]string
+		for _, day := range days {
+			if note := dayNote(cal, day.Start); note != "" {
+				rows = append(rows, []string{day.Start.Format("Mon 2006-01-02"), "", note})
+			}
+			for len(notes) > 0 && notes[0].Time.Before(day.End) {
+				rows = append(rows, []string{day.Start.Format("Mon 2006-01-02"), notes[0].Time.Format("15:04"), notes[0].Text})
+				notes = notes[1:]
+			}
+		}
+
+		title := strings.Join(append([]string{"Journal", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Time", "Note"}, rows)
+	}
+	return nil
+}
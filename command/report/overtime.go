@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+)
+
+// Compare tracked and expected working time per day, accumulating the
+// difference. Days without expectations, activity, or notes (including
+// holidays and days off) are skipped, as are days in the future.
+func overtime(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	now := time.Now()
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+		if err := addDaysOff(srv, cal, period); err != nil {
+			return err
+		}
+		notes, err := srv.Backend.Notes(period.Start, period.End)
+		if err != nil {
+			return err
+		}
+
+		var rows [][]string
+		var expectedTotal, trackedTotal, balance time.Duration
+		for _, day := range days {
+			if day.Start.After(now) {
+				break
+			}
+			tracked, err := trackedBetween(srv, day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			expected := cal.ExpectedHours(day.Start)
+			note := dayNote(cal, day.Start)
+			for len(notes) > 0 && notes[0].Time.Before(day.End) {
+				note = joinNotes(note, notes[0].Text)
+				notes = notes[1:]
+			}
+			if expected == 0 && tracked == 0 && note == "" {
+				continue
+			}
+			expectedTotal += expected
+			trackedTotal += tracked
+			balance += tracked - expected
+			rows = append(rows, []string{
+				day.Start.Format("Mon 2006-01-02"),
+				formatHours(expected),
+				formatHours(tracked),
+				formatSigned(tracked - expected),
+				formatSigned(balance),
+				note,
+			})
+		}
+		rows = append(rows, []string{"Total", formatHours(expectedTotal), formatHours(trackedTotal), formatSigned(balance)})
+
+		title := strings.Join(append([]string{"Overtime", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Expected", "Tracked", "Difference", "Balance", "Note"}, rows)
+	}
+	return nil
+}
+
+// Describe why a day is free, if it is.
+func dayNote(cal *quantifier.Calendar, t time.Time) string {
+	if name, ok := cal.Holiday(t); ok {
+		return name
+	}
+	if kind, ok := cal.DayOff(t); ok {
+		return kind
+	}
+	return ""
+}
+
+// Join notes for the same day.
+func joinNotes(note string, other string) string {
+	if note == "" {
+		return other
+	}
+	return note + "; " + other
+}
+
+// Format a duration as hours and minutes, e.g. 7h05m.
+func formatHours(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Format a duration as hours and minutes, always with a sign.
+func formatSigned(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatHours(-d)
+	}
+	return "+" + formatHours(d)
+}
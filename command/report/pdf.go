@@ -0,0 +1,180 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Page layout in points, for A4 paper.
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 50
+	titleSize    = 14
+	maxFontSize  = 9
+	minFontSize  = 5
+	charWidth    = 0.6 // Of a Courier glyph, relative to the font size
+	lineSpacing  = 1.3 // Relative to the font size
+	fontRegular  = "F1"
+	fontBold     = "F2"
+	fontHeadline = "F3"
+)
+
+// A line of text on a page.
+type pdfLine struct {
+	text string
+	bold bool
+}
+
+// Render a report as a PDF document.
+func renderPDF(w io.Writer, body [][]string) error {
+	return writePDF(w, "Activity report, created "+time.Now().Format("2006-01-02"), body)
+}
+
+// Write a PDF document showing the title, followed by the lines of a report
+// as a monospaced table. The first line of each table is set in bold. The
+// font is scaled down for wide reports, to fit the width of the page.
+func writePDF(w io.Writer, title string, body [][]string) error {
+	lines, err := layoutLines(body)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, l := range lines {
+		if n := len([]rune(l.text)); n > width {
+			width = n
+		}
+	}
+	size := float64(maxFontSize)
+	if width > 0 {
+		if fit := (pageWidth - 2*pageMargin) / (charWidth * float64(width)); fit < size {
+			size = fit
+		}
+	}
+	if size < minFontSize {
+		size = minFontSize
+	}
+	leading := size * lineSpacing
+
+	// Split into pages, leaving room for the title on the first one
+	var pages [][]pdfLine
+	room := int((pageHeight - 2*pageMargin - 2*titleSize) / leading)
+	for len(lines) > room {
+		pages = append(pages, lines[:room])
+		lines = lines[room:]
+		room = int((pageHeight - 2*pageMargin) / leading)
+	}
+	pages = append(pages, lines)
+
+	doc := &pdfDocument{}
+	// Objects 1 to 5 are fixed, followed by a page and its contents each
+	doc.add("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	doc.add(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	doc.add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	doc.add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	doc.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		var content bytes.Buffer
+		y := float64(pageHeight - pageMargin)
+		content.WriteString("BT\n")
+		if i == 0 {
+			y -= titleSize
+			fmt.Fprintf(&content, "/%s %d Tf 1 0 0 1 %d %.2f Tm (%s) Tj\n",
+				fontHeadline, titleSize, pageMargin, y, pdfString(title))
+			y -= titleSize
+		}
+		for _, l := range page {
+			y -= leading
+			font := fontRegular
+			if l.bold {
+				font = fontBold
+			}
+			fmt.Fprintf(&content, "/%s %.2f Tf 1 0 0 1 %d %.2f Tm (%s) Tj\n",
+				font, size, pageMargin, y, pdfString(l.text))
+		}
+		content.WriteString("ET\n")
+		doc.add(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, fontHeadline, 7+2*i))
+		doc.add(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+	_, err = w.Write(doc.bytes())
+	return err
+}
+
+// Align the columns of the body as a terminal would show them. The first
+// line and those following an empty one are table headers.
+func layoutLines(body [][]string) ([]pdfLine, error) {
+	var text bytes.Buffer
+	tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	for _, words := range body {
+		fmt.Fprintln(tw, strings.Join(words, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	var lines []pdfLine
+	header := true
+	for _, l := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+		l = strings.TrimRight(l, " ")
+		lines = append(lines, pdfLine{text: l, bold: header && l != ""})
+		header = l == ""
+	}
+	return lines, nil
+}
+
+// A PDF document under construction, as a list of numbered objects.
+type pdfDocument struct {
+	objects []string
+}
+
+// Add an object, numbered in the order of addition starting at 1.
+func (d *pdfDocument) add(object string) {
+	d.objects = append(d.objects, object)
+}
+
+// The complete document, with its cross-reference table.
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	var offsets []int
+	for i, object := range d.objects {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+	return out.Bytes()
+}
+
+// Escape text for use in a PDF string. Characters outside of Latin-1 are
+// replaced, as the standard fonts cannot show them.
+func pdfString(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		case r >= ' ' && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&out, "\\%03o", r)
+		default:
+			out.WriteRune('?')
+		}
+	}
+	return out.String()
+}
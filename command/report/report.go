@@ -0,0 +1,256 @@
+package report
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// A generator adds a report on the requested periods to the response.
+type generator func(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error
+
+// Available reports by name.
+var generators = map[string]generator{
+	"absence":  absence,
+	"breaks":   breaks,
+	"coverage": coverage,
+	"invoice":  invoice,
+	"journal":  journal,
+	"overtime": overtime,
+	"pdf":      summary,
+	"summary":  summary,
+	"svg":      dailyTasks,
+	"tags":     tags,
+}
+
+// A renderer writes a report to a file in some format, rather than it being
+// shown as text.
+type renderer func(w io.Writer, body [][]string) error
+
+// Reports rendered by the client, by name.
+var renderers = map[string]renderer{
+	reportPDF: renderPDF,
+	reportSVG: renderSVG,
+}
+
+const (
+	paramExclusive    = "exclusive"
+	paramWorkingHours = "working-hours"
+	paramOut          = "out"
+	paramRound        = "round"
+	paramMinBilled    = "min-billed"
+	// Reports rendered by the client rather than shown as text
+	reportPDF = "pdf"
+	reportSVG = "svg"
+)
+
+// Names of all available reports, in alphabetical order.
+func reportNames() []string {
+	var names []string
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type operation struct {
+	cal *quantifier.Calendar
+}
+
+func (op operation) Command() string {
+	return "report"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<report>",
+			Description: "The kind of report: " + strings.Join(reportNames(), ", "),
+		},
+	}
+	params := append(query.PeriodParams(time.Now(), op.cal),
+		argparse.Flag(paramExclusive, "In tag reports, count each entry once under all of its tags combined"),
+		argparse.Option(paramWorkingHours, "<hours>", "In coverage reports, the hours expected per week instead of expected_hours"),
+		argparse.Option(paramOut, "<file>", "For PDF and SVG reports, the file to write"),
+		argparse.Option(paramRound, "<duration>", "In invoices, round the time per task and day up to this increment"),
+		argparse.Option(paramMinBilled, "<duration>", "In invoices, bill at least this much per task and day"),
+		query.MinParam())
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) Configure(conf *config.Opts) error {
+	return op.cal.Configure(conf)
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Generate reports on logged activity")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Generate a report on logged activity in the given periods"
+	footer := "Reports\n" +
+		"    absence   Days marked as off, see the `off` command, with totals per kind\n" +
+		"    breaks    Work and breaks per day, flagging days with less of a break than required\n" +
+		"              by the rules in the [break_rules] section for the time worked\n" +
+		"    coverage  Tracked time as a percentage of expected hours per day and week; with\n" +
+		"              :working-hours, the weekly hours are spread across the working days\n" +
+		"    invoice   Time per task on each day with subtotals, rounded up to billing\n" +
+		"              increments with :round and to at least :min-billed per day\n" +
+		"    journal   Notes made on each day, see the `note` command, with holidays and days off\n" +
+		"    overtime  Working time per day compared to expected hours, with cumulative balance\n" +
+		"    pdf       The summary report as a PDF document, written to the file given with :out\n" +
+		"    summary   Time per task, the activity on each day, and the notes made\n" +
+		"    svg       A chart of the time per day, stacked by task, as an SVG image written\n" +
+		"              to standard output or the file given with :out\n" +
+		"    tags      Time per tag, see the `tag` command; entries with several tags count\n" +
+		"              towards each, or once under their combined tags with :exclusive\n\n" +
+		"Expected hours are set via expected_hours for each working day, with deviations\n" +
+		"for specific days of the week in the [weekday_hours] section; none are expected on holidays\n\n" +
+		"Break rules map the time worked on a day to the break required, e.g. 6h = 30m;\n" +
+		"breaks are logged with the `break` command or tagged break, and with shortest\n" +
+		"set, e.g. to 15m, shorter ones do not count\n\n" +
+		"Examples\n" +
+		"    tilo report overtime :this-month          # Flexitime balance for this month\n" +
+		"    tilo report tags :this-month              # Time per tag this month\n" +
+		"    tilo report invoice :last-month :round=15m :min-billed=30m\n" +
+		"    tilo report breaks :last-month            # Records of breaks taken\n" +
+		"    tilo report coverage :this-week :working-hours=40\n" +
+		"    tilo report pdf :month=2024-05 :out=may.pdf # An attachable monthly summary\n" +
+		"    tilo report svg :this-week > week.svg     # A chart to embed in a wiki\n" +
+		"    tilo report tags :this-month :min=1m      # Leaving out accidental entries"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, ok := generators[cmd.Args[0]]; !ok {
+		return errors.Errorf("No such report: %s", cmd.Args[0])
+	} else if len(cmd.Quantities) == 0 {
+		return errors.New("No period given")
+	} else if _, err := query.MinDuration(cmd); err != nil {
+		return err
+	} else if _, err := billingFor(cmd); err != nil {
+		return err
+	} else if render, ok := renderers[cmd.Args[0]]; ok {
+		return writeRendered(cl, cmd, render)
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to generate report")
+}
+
+// Request a report and render it to the file given, or to standard output
+// for text-based formats.
+func writeRendered(cl *client.Client, cmd msg.Cmd, render renderer) error {
+	file := cmd.Opts[paramOut]
+	if file == "" && cmd.Args[0] == reportPDF {
+		return errors.Errorf("No file given, use :%s=<file>", paramOut)
+	}
+	resp := cl.SendReceive(cmd)
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to generate report")
+	} else if err := resp.Err(); err != nil {
+		return errors.Wrap(err, "Failed to generate report")
+	}
+
+	if file == "" {
+		return render(os.Stdout, resp.Body)
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create file")
+	}
+	if err := render(out, resp.Body); err != nil {
+		out.Close()
+		return errors.Wrapf(err, "Failed to write %s", file)
+	}
+	if err := out.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write %s", file)
+	}
+	cl.PrintMessage("Report written to " + file)
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	cal := quantifier.DefaultCalendar()
+	if len(req.Cmd.Args) == 0 {
+		resp.SetError(errors.New("No report requested"))
+	} else if gen, ok := generators[req.Cmd.Args[0]]; !ok {
+		resp.SetError(errors.Errorf("No such report: %s", req.Cmd.Args[0]))
+	} else if err := cal.Configure(srv.Config()); err != nil {
+		resp.SetError(errors.Wrap(err, "Invalid calendar configuration"))
+	} else if _, err := query.MinDuration(req.Cmd); err != nil {
+		resp.SetError(err)
+	} else if err := gen(srv, req.Cmd, cal, &resp); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to generate report"))
+	}
+	return srv.Answer(req, resp)
+}
+
+// Mark the days off within the span in the calendar.
+func addDaysOff(srv *server.Server, cal *quantifier.Calendar, span quantifier.Span) error {
+	days, err := srv.Backend.DaysOff(span.Start, span.End)
+	if err != nil {
+		return errors.Wrap(err, "Failed to determine days off")
+	}
+	cal.AddDaysOff(days)
+	return nil
+}
+
+// Total time logged across all tasks between start and end, including the
+// active tasks. With parallel tasks, the total may exceed the time elapsed.
+// Entries shorter than min are left out.
+func trackedBetween(srv *server.Server, start time.Time, end time.Time, min time.Duration) (time.Duration, error) {
+	sum, err := srv.Backend.GetAllTasksBetween(start, end, min)
+	if err != nil {
+		return 0, err
+	}
+	var total time.Duration
+	for _, s := range sum {
+		total += s.Total
+	}
+	for _, task := range srv.ActiveTasks() {
+		total += activeOverlap(task, start, end)
+	}
+	return total, nil
+}
+
+// The time an active task has been running between start and end.
+func activeOverlap(task msg.Task, start time.Time, end time.Time) time.Duration {
+	if !task.IsRunning() {
+		return 0
+	}
+	return overlap(task.Started, time.Now(), start, end)
+}
+
+// The time between from and until that lies between start and end.
+func overlap(from time.Time, until time.Time, start time.Time, end time.Time) time.Duration {
+	if from.Before(start) {
+		from = start
+	}
+	if until.After(end) {
+		until = end
+	}
+	if until.Before(from) {
+		return 0
+	}
+	return until.Sub(from)
+}
+
+func init() {
+	command.RegisterOperation(operation{quantifier.DefaultCalendar()})
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+)
+
+// Summarize each period with the total per task, the activity on each day,
+// and the notes made.
+func summary(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	for i, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		if err := addDaysOff(srv, cal, period); err != nil {
+			return err
+		}
+		if i > 0 {
+			resp.AddSeparator()
+		}
+
+		sum, err := srv.Backend.GetAllTasksBetween(period.Start, period.End, min)
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		var total time.Duration
+		for _, s := range sum {
+			// Leave out tasks with less than a minute to show
+			if s.Total.Round(time.Minute) > 0 {
+				rows = append(rows, []string{s.Task, formatHours(s.Total)})
+			}
+			total += s.Total
+		}
+		rows = append(rows, []string{"Total", formatHours(total)})
+		title := strings.Join(append([]string{"Summary", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Hours"}, rows)
+
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+		rows = nil
+		for _, day := range days {
+			sum, err := srv.Backend.GetAllTasksBetween(day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			var tasks []string
+			var daily time.Duration
+			for _, s := range sum {
+				if s.Total.Round(time.Minute) > 0 {
+					tasks = append(tasks, s.Task+" "+formatHours(s.Total))
+				}
+				daily += s.Total
+			}
+			if note := dayNote(cal, day.Start); note != "" {
+				tasks = append(tasks, "("+note+")")
+			}
+			if len(tasks) > 0 {
+				rows = append(rows, []string{day.Start.Format("Mon 2006-01-02"), formatHours(daily), strings.Join(tasks, ", ")})
+			}
+		}
+		resp.AddSeparator()
+		resp.AddTable([]string{"Day", "Hours", "Tasks"}, rows)
+
+		notes, err := srv.Backend.Notes(period.Start, period.End)
+		if err != nil {
+			return err
+		}
+		if len(notes) > 0 {
+			rows = nil
+			for _, note := range notes {
+				rows = append(rows, []string{note.Time.Format("Mon 2006-01-02"), note.Time.Format("15:04"), note.Text})
+			}
+			resp.AddSeparator()
+			resp.AddTable([]string{"Notes", "Time", "Note"}, rows)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Chart layout in pixels.
+const (
+	chartWidth  = 640
+	chartHeight = 240 // Of the bars' area
+	chartLeft   = 50  // Room for the hour labels
+	chartTop    = 40  // Room for the title
+	chartBottom = 30  // Room for the day labels
+	legendLine  = 20
+	barGap      = 0.25 // Relative to the space for each day
+)
+
+// Colors of the tasks, in order of their totals. Repeated for many tasks.
+var chartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// Provide the minutes logged on each day and task within each period, for
+// the client to draw as a chart. Tasks come in order of their totals.
+func dailyTasks(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	for i, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+
+		perDay := make([]map[string]time.Duration, len(days))
+		totals := make(map[string]time.Duration)
+		for d, day := range days {
+			perDay[d] = make(map[string]time.Duration)
+			sum, err := srv.Backend.GetAllTasksBetween(day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			for _, s := range sum {
+				perDay[d][s.Task] += s.Total
+			}
+			for _, task := range srv.ActiveTasks() {
+				perDay[d][task.Name] += activeOverlap(task, day.Start, day.End)
+			}
+			for task, total := range perDay[d] {
+				totals[task] += total
+			}
+		}
+		var tasks []string
+		for task, total := range totals {
+			if total >= time.Minute {
+				tasks = append(tasks, task)
+			}
+		}
+		sort.Slice(tasks, func(i, j int) bool {
+			if totals[tasks[i]] != totals[tasks[j]] {
+				return totals[tasks[i]] > totals[tasks[j]]
+			}
+			return tasks[i] < tasks[j]
+		})
+
+		var rows [][]string
+		for d, day := range days {
+			row := []string{day.Start.Format("Mon 01-02")}
+			for _, task := range tasks {
+				row = append(row, strconv.Itoa(int(perDay[d][task].Minutes())))
+			}
+			rows = append(rows, row)
+		}
+		if i > 0 {
+			resp.AddSeparator()
+		}
+		title := strings.Join(append([]string{"Activity", quant.Type}, quant.Elems...), " ")
+		resp.AddTable(append([]string{title}, tasks...), rows)
+	}
+	return nil
+}
+
+// A chart of the minutes per day and task, as provided by dailyTasks.
+type chart struct {
+	title   string
+	tasks   []string
+	days    []string
+	minutes [][]int // By day, then task
+}
+
+// Render the charts provided by dailyTasks as an SVG image.
+func renderSVG(w io.Writer, body [][]string) error {
+	charts, err := readCharts(body)
+	if err != nil {
+		return err
+	}
+	return writeSVG(w, charts)
+}
+
+// Read the charts from the tables in a response body.
+func readCharts(body [][]string) ([]chart, error) {
+	var charts []chart
+	var current *chart
+	for _, line := range body {
+		if len(line) == 0 || (len(line) == 1 && line[0] == "") {
+			current = nil
+			continue
+		} else if current == nil {
+			charts = append(charts, chart{title: line[0], tasks: line[1:]})
+			current = &charts[len(charts)-1]
+			continue
+		}
+		var minutes []int
+		for _, cell := range line[1:] {
+			m, err := strconv.Atoi(cell)
+			if err != nil {
+				return nil, errors.Errorf("Not a number of minutes: %s", cell)
+			}
+			minutes = append(minutes, m)
+		}
+		current.days = append(current.days, line[0])
+		current.minutes = append(current.minutes, minutes)
+	}
+	return charts, nil
+}
+
+// Write an SVG image showing a stacked bar chart for each of the charts, one
+// below the other, each followed by a legend with the tasks' totals.
+func writeSVG(w io.Writer, charts []chart) error {
+	var out strings.Builder
+	y := 0
+	for _, c := range charts {
+		y = c.draw(&out, y)
+	}
+	_, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" "+
+		"font-family=\"sans-serif\" font-size=\"12\">\n"+
+		"<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n%s</svg>\n",
+		chartWidth, y, out.String())
+	return err
+}
+
+// Draw the chart with its top at y, giving the y coordinate below it.
+func (c chart) draw(out *strings.Builder, y int) int {
+	maxDaily := 0
+	totals := make([]int, len(c.tasks))
+	for _, day := range c.minutes {
+		daily := 0
+		for t, m := range day {
+			daily += m
+			totals[t] += m
+		}
+		if daily > maxDaily {
+			maxDaily = daily
+		}
+	}
+	// Full hours at the top, with a grid line for each or every few
+	hours := int(math.Ceil(float64(maxDaily) / 60))
+	if hours == 0 {
+		hours = 1
+	}
+	step := 1
+	for hours/step > 8 {
+		step *= 2
+	}
+	hours = (hours + step - 1) / step * step
+	scale := float64(chartHeight) / float64(hours*60)
+	base := y + chartTop + chartHeight
+	right := chartWidth - 10
+
+	fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\" font-size=\"15\" font-weight=\"bold\">%s</text>\n",
+		chartLeft, y+chartTop/2+5, xmlEscape(c.title))
+	for h := 0; h <= hours; h += step {
+		lineY := float64(base) - float64(h*60)*scale
+		fmt.Fprintf(out, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"#ddd\"/>\n",
+			chartLeft, lineY, right, lineY)
+		fmt.Fprintf(out, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\" fill=\"#555\">%dh</text>\n",
+			chartLeft-6, lineY+4, h)
+	}
+
+	slot := float64(right - chartLeft)
+	if len(c.days) > 0 {
+		slot /= float64(len(c.days))
+	}
+	width := slot * (1 - barGap)
+	for d, day := range c.days {
+		x := float64(chartLeft) + float64(d)*slot + (slot-width)/2
+		top := float64(base)
+		for t, m := range c.minutes[d] {
+			if m == 0 {
+				continue
+			}
+			height := float64(m) * scale
+			top -= height
+			fmt.Fprintf(out, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\">"+
+				"<title>%s: %s</title></rect>\n",
+				x, top, width, height, chartColors[t%len(chartColors)],
+				xmlEscape(c.tasks[t]), formatHours(time.Duration(m)*time.Minute))
+		}
+		fmt.Fprintf(out, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\" fill=\"#555\">%s</text>\n",
+			x+width/2, base+chartBottom/2+5, xmlEscape(day))
+	}
+
+	y = base + chartBottom
+	for t, task := range c.tasks {
+		y += legendLine
+		fmt.Fprintf(out, "<rect x=\"%d\" y=\"%d\" width=\"12\" height=\"12\" fill=\"%s\"/>\n",
+			chartLeft, y-11, chartColors[t%len(chartColors)])
+		fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">%s %s</text>\n",
+			chartLeft+18, y, xmlEscape(task), formatHours(time.Duration(totals[t])*time.Minute))
+	}
+	return y + legendLine
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;").Replace(s)
+}
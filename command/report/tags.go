@@ -0,0 +1,76 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+)
+
+// Label for entries without any tags.
+const untagged = "(untagged)"
+
+// Sum up the time logged per tag. An entry with several tags counts towards
+// each of them unless exclusive, in which case it is counted once under the
+// combination of its tags so that the totals add up to the time logged.
+func tags(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	exclusive := cmd.Flags[paramExclusive]
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		totals, err := srv.Backend.TagTotals(period.Start, period.End, exclusive, min)
+		if err != nil {
+			return err
+		}
+		for _, task := range srv.ActiveTasks() {
+			if overlap := activeOverlap(task, period.Start, period.End); overlap > 0 {
+				totals = addActiveTags(totals, task.Tags, overlap, exclusive)
+			}
+		}
+
+		var rows [][]string
+		for _, t := range totals {
+			tag := t.Tag
+			if tag == "" {
+				tag = untagged
+			}
+			rows = append(rows, []string{tag, strconv.Itoa(t.Entries), formatHours(t.Total)})
+		}
+
+		title := strings.Join(append([]string{"Tags", quant.Type}, quant.Elems...), " ")
+		resp.AddTable([]string{title, "Entries", "Hours"}, rows)
+	}
+	return nil
+}
+
+// Count an active task's time towards its tags, keeping the order by tag.
+func addActiveTags(totals []msg.TagSummary, tags []string, overlap time.Duration, exclusive bool) []msg.TagSummary {
+	keys := tags
+	if len(tags) == 0 {
+		keys = []string{""}
+	} else if exclusive {
+		sorted := append([]string{}, tags...)
+		sort.Strings(sorted)
+		keys = []string{strings.Join(sorted, "+")}
+	}
+	for _, key := range keys {
+		i := sort.Search(len(totals), func(i int) bool { return totals[i].Tag >= key })
+		if i == len(totals) || totals[i].Tag != key {
+			totals = append(totals[:i], append([]msg.TagSummary{{Tag: key}}, totals[i:]...)...)
+		}
+		totals[i].Entries++
+		totals[i].Total += overlap
+	}
+	return totals
+}
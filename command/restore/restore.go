@@ -0,0 +1,268 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/backup"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramMerge = "merge"
+	timeFormat = "2006-01-02 15:04"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "restore"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<backup>",
+			Description: "A backup file or a directory holding backups, to use the latest",
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramMerge, "Add missing entries instead of replacing all entries"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Restore entries from a backup")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Replace all entries by those in a backup, or add those missing"
+	footer := "An incremental backup is restored along with the backups it builds on.\n" +
+		"The changes are listed before being applied, which requires confirmation:\n" +
+		"    + An entry to be added\n" +
+		"    - An entry to be removed\n" +
+		"    ~ An entry with a different note or tags in the backup\n" +
+		"Entries are compared by task and time. When merging, nothing is removed or\n" +
+		"changed\n\n" +
+		"Examples\n" +
+		"    tilo restore ~/.config/tilo/backups\n" +
+		"    tilo restore backups/tilo-20200131-030000-incremental.jsonl :merge"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	restored, err := backup.ReadChain(cmd.Args[0])
+	if err != nil {
+		return errors.Wrap(err, "Unable to read backup")
+	} else if len(restored) == 0 {
+		return errors.New("The backup holds no entries")
+	}
+
+	// Without a body, the server gives the current entries
+	resp := cl.SendReceive(cmd)
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to fetch current entries")
+	} else if err := resp.Err(); err != nil {
+		return errors.Wrap(err, "Failed to fetch current entries")
+	}
+	merge := cmd.Flags[paramMerge]
+	d := compare(resp.Entries, restored)
+	for _, line := range d.lines(merge) {
+		fmt.Println(line)
+	}
+	if len(d.added) == 0 && (merge || len(d.removed)+len(d.changed) == 0) {
+		cl.PrintMessage("Nothing to restore")
+		return nil
+	}
+	// The connection is re-established once confirmed
+	cl.Close()
+	if !client.Confirm(os.Stdin, "Apply these changes?") {
+		cl.PrintMessage("Nothing restored")
+		return nil
+	}
+
+	if merge {
+		cmd.Body = rows(d.added)
+	} else {
+		cmd.Body = rows(restored)
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to restore entries")
+}
+
+// Differences between the current entries and those from a backup.
+type diff struct {
+	added   []msg.Entry // Only in the backup
+	removed []msg.Entry // Only among the current entries
+	changed []msg.Entry // Differing in note or tags, as in the backup
+}
+
+// Entries are identified by task and time, since IDs of the same entry may
+// differ, e.g. when it was added again after data loss.
+func key(e msg.Entry) string {
+	return fmt.Sprintf("%s %d %d", e.Task, e.Started.Unix(), e.Ended.Unix())
+}
+
+func details(e msg.Entry) string {
+	return e.Note + "\n" + strings.Join(e.Tags, ",")
+}
+
+func compare(current []msg.Entry, restored []msg.Entry) diff {
+	var d diff
+	// Current entries not matched yet, by key. Keys need not be unique.
+	pending := make(map[string][]msg.Entry)
+	for _, e := range current {
+		pending[key(e)] = append(pending[key(e)], e)
+	}
+	matched := make(map[int64]bool)
+	match := func(e msg.Entry, sameDetails bool) bool {
+		for _, cur := range pending[key(e)] {
+			if !matched[cur.ID] && (!sameDetails || details(cur) == details(e)) {
+				matched[cur.ID] = true
+				return true
+			}
+		}
+		return false
+	}
+
+	var differing []msg.Entry
+	for _, e := range restored {
+		if !match(e, true) {
+			differing = append(differing, e)
+		}
+	}
+	for _, e := range differing {
+		if match(e, false) {
+			d.changed = append(d.changed, e)
+		} else {
+			d.added = append(d.added, e)
+		}
+	}
+	for _, e := range current {
+		if !matched[e.ID] {
+			d.removed = append(d.removed, e)
+		}
+	}
+	return d
+}
+
+// The changes as listed for the user, followed by a summary.
+func (d diff) lines(merge bool) []string {
+	var lines []string
+	entryLine := func(mark string, e msg.Entry) string {
+		return fmt.Sprintf("%s %s  %s - %s", mark, e.Task,
+			e.Started.Format(timeFormat), e.Ended.Format(timeFormat))
+	}
+	for _, e := range d.added {
+		lines = append(lines, entryLine("+", e))
+	}
+	if merge {
+		return append(lines, fmt.Sprintf("%d entries to add", len(d.added)))
+	}
+	for _, e := range d.removed {
+		lines = append(lines, entryLine("-", e))
+	}
+	for _, e := range d.changed {
+		lines = append(lines, entryLine("~", e))
+	}
+	return append(lines, fmt.Sprintf("%d entries to add, %d to remove, %d to change",
+		len(d.added), len(d.removed), len(d.changed)))
+}
+
+// Entries as transferred to the server: ID, task, start and end as Unix
+// time, split group, note and comma-separated tags.
+func rows(entries []msg.Entry) [][]string {
+	var rows [][]string
+	for _, e := range entries {
+		rows = append(rows, []string{
+			strconv.FormatInt(e.ID, 10),
+			e.Task,
+			strconv.FormatInt(e.Started.Unix(), 10),
+			strconv.FormatInt(e.Ended.Unix(), 10),
+			strconv.FormatInt(e.SplitGroup, 10),
+			e.Note,
+			strings.Join(e.Tags, ","),
+		})
+	}
+	return rows
+}
+
+// Turn the transferred rows back into entries, checking all of them.
+func parseRows(rows [][]string) ([]msg.Entry, error) {
+	var entries []msg.Entry
+	for i, row := range rows {
+		if len(row) != 7 {
+			return nil, errors.Errorf("Malformed entry %d: %v", i+1, row)
+		}
+		e := msg.Entry{Task: row[1], Note: row[5]}
+		var numbers [4]int64
+		for j, col := range []int{0, 2, 3, 4} {
+			n, err := strconv.ParseInt(row[col], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Malformed entry %d", i+1)
+			}
+			numbers[j] = n
+		}
+		e.ID, e.SplitGroup = numbers[0], numbers[3]
+		e.Started, e.Ended = time.Unix(numbers[1], 0), time.Unix(numbers[2], 0)
+		if names, err := argparse.GetTaskNames(e.Task); err != nil {
+			return nil, err
+		} else if len(names) != 1 || names[0] == argparse.AllTasks {
+			return nil, errors.Errorf("Invalid task name: %s", e.Task)
+		}
+		if e.Ended.Before(e.Started) {
+			return nil, errors.Errorf("Entry %d for %s ends before it starts", e.ID, e.Task)
+		}
+		if row[6] != "" {
+			var err error
+			if e.Tags, err = argparse.GetTagNames(row[6]); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	_, err := parseRows(cmd.Body)
+	return err
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if len(req.Cmd.Body) == 0 {
+		if entries, err := srv.Backend.EntriesAfter(0); err != nil {
+			resp.SetError(errors.Wrap(err, "Error in database query"))
+		} else {
+			resp.AddRawEntries(entries)
+		}
+		return srv.Answer(req, resp)
+	}
+
+	entries, _ := parseRows(req.Cmd.Body)
+	merge := req.Cmd.Flags[paramMerge]
+	if err := srv.Backend.RestoreEntries(entries, !merge); err != nil {
+		resp.SetError(err)
+	} else {
+		resp.AddRestoredEntries(len(entries), merge)
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/pkg/errors"
 )
 
+// How many recent entries are searched for a task to resume, past breaks.
+const recentEntries = 10
+
 type operation struct {
 	// No state required
 }
@@ -22,12 +25,13 @@ func (op operation) Parser() *argparse.Parser {
 }
 
 func (op operation) DescribeShort() argparse.Description {
-	return op.Parser().Describe("Resume the last active task")
+	return op.Parser().Describe("Resume the paused or last active task")
 }
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
-	header := "Resume the last active task"
-	footer := "Exits with non-zero status if a task is currently active or if no prior task exists"
+	header := "Resume the tasks stopped by `pause`, or else the last active task"
+	footer := "An ongoing break, see `break`, ends as work resumes\n" +
+		"Exits with non-zero status if a task is currently active or if no prior task exists"
 	return header, footer
 }
 
@@ -39,22 +43,46 @@ func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
-	if srv.CurrentTask.IsRunning() {
+	// The break ends as work resumes
+	for _, task := range srv.StopTasks([]string{msg.BreakTask}) {
+		if saved, err := srv.SaveOrDiscard(task); err != nil {
+			resp.SetError(err)
+			return srv.Answer(req, resp)
+		} else if saved {
+			resp.AddStoppedTask(task)
+		} else {
+			resp.AddDiscardedTask(task)
+		}
+	}
+	if paused := srv.Paused(); len(paused) > 0 {
+		resp.AddActiveTasks(srv.Unpause())
+	} else if len(srv.ActiveTasks()) > 0 && !srv.ParallelTasks() {
 		resp.SetError(errors.New("a task is already active"))
 	} else {
-		if summary, err := srv.Backend.RecentTasks(1); err != nil {
+		if summary, err := srv.Backend.RecentTasks(recentEntries); err != nil {
 			resp.SetError(errors.Wrap(err, "failed to determine latest task"))
-		} else if len(summary) == 0 {
+		} else if tName := lastWorkedOn(summary); tName == "" {
 			resp.SetError(errors.New("no recent activity to continue"))
+		} else if srv.IsActive(tName) {
+			resp.SetError(errors.Errorf("last task %s is already active", tName))
 		} else {
-			tName := summary[0].Task
 			srv.SetActiveTask(tName)
-			resp.AddCurrentTask(srv.CurrentTask)
+			resp.AddCurrentTask(srv.CurrentTask())
 		}
 	}
 	return srv.Answer(req, resp)
 }
 
+// The most recent task in the summary other than a break, empty if none.
+func lastWorkedOn(summary []msg.Summary) string {
+	for _, s := range summary {
+		if s.Task != msg.BreakTask {
+			return s.Task
+		}
+	}
+	return ""
+}
+
 func init() {
 	command.RegisterOperation(operation{})
 }
@@ -0,0 +1,242 @@
+package review
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	actionAccept  = "accept"
+	actionDiscard = "discard"
+)
+
+const paramList = "list"
+
+// Entries are edited via the edit command, see there.
+const (
+	opEdit    = "edit"
+	paramFrom = "from"
+	paramTo   = "to"
+	paramTask = "task"
+	paramNote = "note"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "review"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "[action]",
+			Description: "What to do with the given entries: " + actionAccept + " or " + actionDiscard,
+			Optional:    true,
+		},
+		argparse.Arg{
+			Name:        "[entry-id..]",
+			Description: "The IDs of the entries, as listed",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramList, "Only list the entries to review"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Review imported and automatically logged entries")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Go through the entries imported or logged by the server which nobody has looked at yet"
+	footer := "Without an action, each entry is shown in turn to accept, edit or discard it.\n" +
+		"Entries are reviewed once accepted or edited, here or with `tilo edit`. Discarded\n" +
+		"imports are not imported again\n\n" +
+		"Examples\n" +
+		"    tilo review                 # Go through the entries one by one\n" +
+		"    tilo review :list\n" +
+		"    tilo review accept 12 13\n" +
+		"    tilo review discard 14"
+	return header, footer
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if len(cmd.Args) == 0 {
+		return nil
+	} else if cmd.Args[0] != actionAccept && cmd.Args[0] != actionDiscard {
+		return errors.Errorf("No such action: %s", cmd.Args[0])
+	} else if len(cmd.Args) == 1 {
+		return errors.New("Require the IDs of the entries to " + cmd.Args[0])
+	}
+	_, err := msg.ParseEntryIDs(cmd.Args[1:])
+	return err
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if err := op.Validate(cmd); err != nil {
+		return err
+	}
+	resp := cl.SendReceive(cmd)
+	if len(cmd.Args) > 0 || cmd.Flags[paramList] || resp.Failed() || len(resp.Entries) == 0 {
+		cl.PrintResponse(resp)
+		return errors.Wrap(cl.Error(), "Failed to review entries")
+	}
+	if cl.Failed() {
+		return errors.Wrap(cl.Error(), "Failed to find entries to review")
+	}
+	// The connection is re-established for each decision
+	cl.Close()
+	return walk(cl, resp.Entries)
+}
+
+// Go through the entries on the terminal, deciding on one after another.
+func walk(cl *client.Client, entries []msg.Entry) error {
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question string) (string, bool) {
+		fmt.Print(question)
+		answer, err := in.ReadString('\n')
+		if answer == "" && err != nil {
+			fmt.Println()
+			return "", false
+		}
+		return strings.TrimSpace(answer), true
+	}
+	for i, e := range entries {
+		fmt.Printf("(%d/%d) %s %s - %s (%v) %s\n", i+1, len(entries), e.Task, e.Started.Format("Mon 2006-01-02 15:04"),
+			e.Ended.Format("15:04"), e.Ended.Sub(e.Started), e.Note)
+		answer, ok := ask("[a]ccept, [e]dit, [d]iscard, [s]kip or [q]uit? ")
+		if !ok {
+			return nil
+		}
+		id := strconv.FormatInt(e.ID, 10)
+		var cmd msg.Cmd
+		switch strings.ToLower(answer) {
+		case "a", actionAccept:
+			cmd = msg.Cmd{Op: "review", Args: []string{actionAccept, id}}
+		case "d", actionDiscard:
+			cmd = msg.Cmd{Op: "review", Args: []string{actionDiscard, id}}
+		case "e", "edit":
+			opts := make(map[string]string)
+			for _, field := range []struct{ param, label, current string }{
+				{paramTask, "Task", e.Task},
+				{paramFrom, "From", e.Started.Format("15:04")},
+				{paramTo, "To", e.Ended.Format("15:04")},
+				{paramNote, "Note", e.Note},
+			} {
+				value, ok := ask(fmt.Sprintf("%s [%s]: ", field.label, field.current))
+				if !ok {
+					return nil
+				} else if value != "" && value != field.current {
+					opts[field.param] = value
+				}
+			}
+			if len(opts) == 0 {
+				cmd = msg.Cmd{Op: "review", Args: []string{actionAccept, id}}
+			} else {
+				cmd = msg.Cmd{Op: opEdit, Args: []string{id}, Opts: opts}
+			}
+		case "q", "quit":
+			return nil
+		default:
+			continue
+		}
+		cl.SendReceivePrint(cmd)
+		if cl.Connected() {
+			cl.Close()
+		}
+		if cl.Failed() {
+			return errors.Wrap(cl.Error(), "Failed to review entry")
+		}
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if err := op.Validate(req.Cmd); err != nil {
+		resp.SetError(err)
+	} else if len(req.Cmd.Args) == 0 {
+		if entries, err := unreviewed(srv); err != nil {
+			resp.SetError(err)
+		} else {
+			resp.AddEntries(entries)
+		}
+	} else if err := decide(srv, req.Cmd, &resp); err != nil {
+		resp.SetError(err)
+	}
+	return srv.Answer(req, resp)
+}
+
+// All entries awaiting review, oldest first.
+func unreviewed(srv *server.Server) ([]msg.Entry, error) {
+	all, err := srv.Backend.EntriesAfter(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in database query")
+	}
+	var entries []msg.Entry
+	for _, e := range all {
+		if e.Unreviewed() {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Started.Before(entries[j].Started)
+	})
+	return entries, nil
+}
+
+// Accept or discard the entries given by the command, all of which must
+// await review.
+func decide(srv *server.Server, cmd msg.Cmd, resp *msg.Response) error {
+	ids, _ := msg.ParseEntryIDs(cmd.Args[1:])
+	var entries []msg.Entry
+	for _, id := range ids {
+		e, err := srv.Backend.Entry(id)
+		if err != nil {
+			return err
+		} else if !e.Unreviewed() {
+			return errors.Errorf("Entry %d does not await review", id)
+		}
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		if cmd.Args[0] == actionDiscard {
+			if err := srv.Backend.DiscardEntry(e.ID); err != nil {
+				return err
+			}
+			resp.AddDeletedEntry(e)
+			continue
+		}
+		e.Modified = cmd.Origin
+		if err := srv.Backend.UpdateEntry(e); err != nil {
+			return err
+		}
+	}
+	if cmd.Args[0] == actionAccept {
+		resp.AddEntries(entries)
+	}
+	return nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
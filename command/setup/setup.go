@@ -0,0 +1,171 @@
+package setup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramForce = "force"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "init"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := []argparse.Param{
+		argparse.Flag(paramForce, "Replace an existing configuration file without asking"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Set up tilo interactively")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Create the configuration file by answering a few questions, then start the server"
+	footer := "Asks for the backend and where it keeps its data, the working days and the\n" +
+		"working time expected on each. Pressing enter keeps the value shown in\n" +
+		"brackets. Starting the server initializes the database.\n" +
+		"An existing configuration file is replaced, after confirmation. Further\n" +
+		"settings can be added to it later, see `tilo help`"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	conf := cl.Config()
+	file := conf.ConfFile.Value
+	// A single reader for all answers, as it may read ahead
+	in := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(file); err == nil && !cmd.Flags[paramForce] {
+		if !client.Confirm(in, fmt.Sprintf("Replace the configuration in %s?", file)) {
+			cl.PrintMessage("Configuration left unchanged")
+			return nil
+		}
+	}
+
+	items, err := ask(in, conf)
+	if err != nil {
+		return err
+	}
+	if err := conf.WriteFile(items); err != nil {
+		return err
+	}
+	cl.PrintMessage("Configuration written to " + file)
+
+	if conf.RemoteServer() {
+		cl.PrintMessage("Using the server at " + conf.ServerAddr.Value + ", not starting one")
+		return nil
+	} else if cl.ServerIsRunning() {
+		cl.PrintMessage("A server is already running, apply the configuration with `tilo server restart`")
+		return nil
+	}
+	cl.EnsureServerIsRunning()
+	return errors.Wrap(cl.Error(), "Failed to start the server")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+// Ask for the items to put in the configuration file, offering the current
+// values as defaults.
+func ask(in *bufio.Reader, conf *config.Opts) ([]*config.Item, error) {
+	names := config.BackendNames()
+	backend, err := prompt(in, "Backend ("+strings.Join(names, ", ")+")", conf.Backend.Value,
+		func(answer string) error {
+			if config.BackendItems(answer) == nil {
+				return errors.Errorf("No such backend: %s", answer)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	items := []*config.Item{item(&conf.Backend, backend)}
+
+	for _, bi := range config.BackendItems(backend) {
+		value, err := prompt(in, bi.InFile, bi.Value, nil)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item(bi, value))
+	}
+
+	days, err := prompt(in, "Working days", conf.WorkingDays.Value, func(answer string) error {
+		return quantifier.DefaultCalendar().SetWorkingDays(answer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	hours, err := prompt(in, "Expected working time per day", conf.ExpectedHours.Value, func(answer string) error {
+		if _, err := time.ParseDuration(answer); err != nil {
+			return errors.Errorf("Not a duration: %s", answer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(items, item(&conf.WorkingDays, days), item(&conf.ExpectedHours, hours)), nil
+}
+
+// A copy of the item with the given value.
+func item(orig *config.Item, value string) *config.Item {
+	copied := *orig
+	copied.Value = value
+	return &copied
+}
+
+// Ask for a value on the terminal until a valid one is given. An empty answer
+// gives the default.
+func prompt(in *bufio.Reader, question string, def string, validate func(string) error) (string, error) {
+	for {
+		fmt.Printf("%s [%s]: ", question, def)
+		answer, err := in.ReadString('\n')
+		if err == io.EOF && answer == "" {
+			fmt.Println()
+			return "", errors.New("Setup aborted, configuration left unchanged")
+		} else if err != nil && err != io.EOF {
+			return "", errors.Wrap(err, "Unable to read answer")
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			answer = def
+		}
+		if validate == nil {
+			return answer, nil
+		} else if err := validate(answer); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
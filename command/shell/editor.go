@@ -0,0 +1,251 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Key codes relevant to line editing.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyReturn    = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// A completer determines candidates for the word ending at pos. It returns
+// the position at which the completed word starts and all candidates.
+type completer func(line []rune, pos int) (int, []string)
+
+// A minimal line editor with history and completion.
+type editor struct {
+	file     *os.File
+	in       *bufio.Reader
+	out      io.Writer
+	prompt   string
+	complete completer
+	history  []string
+	buf      []rune
+	pos      int
+}
+
+func newEditor(in *os.File, out io.Writer, prompt string, complete completer) *editor {
+	return &editor{file: in, in: bufio.NewReader(in), out: out, prompt: prompt, complete: complete}
+}
+
+// Add a line to the in-memory history, skipping immediate repetitions.
+func (ed *editor) addHistory(line string) {
+	if n := len(ed.history); n > 0 && ed.history[n-1] == line {
+		return
+	}
+	ed.history = append(ed.history, line)
+}
+
+// Read a line of input. If the input is not a terminal, it is read as is.
+func (ed *editor) readLine() (string, error) {
+	term, err := rawTerminal(int(ed.file.Fd()))
+	if err != nil {
+		return ed.readPlainLine()
+	}
+	defer term.restore()
+
+	ed.buf = nil
+	ed.pos = 0
+	histIdx := len(ed.history)
+	// The line being edited before browsing through history.
+	var pending []rune
+	ed.redraw()
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyReturn, keyLineFeed:
+			fmt.Fprint(ed.out, "\r\n")
+			return string(ed.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(ed.out, "^C\r\n")
+			ed.buf = nil
+			ed.pos = 0
+		case keyCtrlD:
+			if len(ed.buf) == 0 {
+				return "", io.EOF
+			}
+			ed.deleteAt(ed.pos)
+		case keyCtrlA:
+			ed.pos = 0
+		case keyCtrlE:
+			ed.pos = len(ed.buf)
+		case keyCtrlB:
+			ed.moveBy(-1)
+		case keyCtrlF:
+			ed.moveBy(1)
+		case keyCtrlK:
+			ed.buf = ed.buf[:ed.pos]
+		case keyCtrlU:
+			ed.buf = ed.buf[ed.pos:]
+			ed.pos = 0
+		case keyBackspace, keyDelete:
+			if ed.pos > 0 {
+				ed.pos--
+				ed.deleteAt(ed.pos)
+			}
+		case keyTab:
+			ed.completeWord()
+		case keyCtrlP, keyCtrlN:
+			histIdx, pending = ed.browseHistory(histIdx, pending, r == keyCtrlN)
+		case keyEscape:
+			switch ed.readEscapeSequence() {
+			case "[A":
+				histIdx, pending = ed.browseHistory(histIdx, pending, false)
+			case "[B":
+				histIdx, pending = ed.browseHistory(histIdx, pending, true)
+			case "[C":
+				ed.moveBy(1)
+			case "[D":
+				ed.moveBy(-1)
+			case "[H", "OH", "[1~":
+				ed.pos = 0
+			case "[F", "OF", "[4~":
+				ed.pos = len(ed.buf)
+			case "[3~":
+				ed.deleteAt(ed.pos)
+			}
+		default:
+			if r >= ' ' {
+				ed.insert([]rune{r})
+			}
+		}
+		ed.redraw()
+	}
+}
+
+// Fallback for non-interactive input.
+func (ed *editor) readPlainLine() (string, error) {
+	fmt.Fprint(ed.out, ed.prompt)
+	line, err := ed.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Read the remainder of an escape sequence, e.g. "[A" for the up arrow.
+func (ed *editor) readEscapeSequence() string {
+	var seq []rune
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, r)
+		// A sequence ends on a letter or tilde, apart from the introducer.
+		if len(seq) > 1 && (r == '~' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')) {
+			return string(seq)
+		}
+		if len(seq) == 1 && r != '[' && r != 'O' {
+			return string(seq)
+		}
+	}
+}
+
+// Step through history. Returns the new history index and the pending line.
+func (ed *editor) browseHistory(idx int, pending []rune, forward bool) (int, []rune) {
+	if idx == len(ed.history) {
+		pending = ed.buf
+	}
+	if forward && idx < len(ed.history) {
+		idx++
+	} else if !forward && idx > 0 {
+		idx--
+	} else {
+		return idx, pending
+	}
+	if idx == len(ed.history) {
+		ed.buf = pending
+	} else {
+		ed.buf = []rune(ed.history[idx])
+	}
+	ed.pos = len(ed.buf)
+	return idx, pending
+}
+
+// Complete the word under the cursor as far as possible. If several
+// candidates remain, show them.
+func (ed *editor) completeWord() {
+	if ed.complete == nil {
+		return
+	}
+	start, candidates := ed.complete(ed.buf, ed.pos)
+	if len(candidates) == 0 {
+		return
+	}
+	word := string(ed.buf[start:ed.pos])
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "=") {
+		completion += " "
+	}
+	if len(completion) > len(word) {
+		ed.insert([]rune(completion[len(word):]))
+	} else if len(candidates) > 1 {
+		fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (ed *editor) insert(runes []rune) {
+	buf := make([]rune, 0, len(ed.buf)+len(runes))
+	buf = append(buf, ed.buf[:ed.pos]...)
+	buf = append(buf, runes...)
+	ed.buf = append(buf, ed.buf[ed.pos:]...)
+	ed.pos += len(runes)
+}
+
+func (ed *editor) deleteAt(pos int) {
+	if pos < len(ed.buf) {
+		ed.buf = append(ed.buf[:pos], ed.buf[pos+1:]...)
+	}
+}
+
+func (ed *editor) moveBy(n int) {
+	if pos := ed.pos + n; pos >= 0 && pos <= len(ed.buf) {
+		ed.pos = pos
+	}
+}
+
+// Redraw the current line and position the cursor.
+func (ed *editor) redraw() {
+	fmt.Fprintf(ed.out, "\r%s%s\x1b[K", ed.prompt, string(ed.buf))
+	if back := len(ed.buf) - ed.pos; back > 0 {
+		fmt.Fprintf(ed.out, "\x1b[%dD", back)
+	}
+}
+
+// The longest common prefix of all given strings.
+func commonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,186 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	prompt       = "tilo> "
+	historyFile  = "history"
+	maxHistory   = 1000
+	cmdExit      = "exit"
+	cmdQuit      = "quit"
+	tasksCommand = "tasks"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "shell"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Enter commands interactively")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Start an interactive prompt, reusing a single server connection for all commands"
+	footer := "Commands are entered as on the command line, without the program name\n" +
+		"Use the arrow keys to navigate history, Tab to complete commands, parameters, and task names\n" +
+		"Leave with `exit`, `quit`, or Ctrl-D"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SetKind(msg.OriginTUI)
+	sh := shell{cl: cl, histFile: filepath.Join(cl.Config().ConfigDir(), historyFile)}
+	return sh.run(os.Stdin, os.Stdout)
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+type shell struct {
+	cl       *client.Client
+	histFile string
+}
+
+// Read and execute commands until the user leaves the shell.
+func (sh *shell) run(in *os.File, out io.Writer) error {
+	sh.cl.StartSession()
+	ed := newEditor(in, out, prompt, sh.complete)
+	ed.history = loadHistory(sh.histFile)
+	for {
+		line, err := ed.readLine()
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "Failed to read input")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		ed.addHistory(line)
+		sh.saveHistory(line)
+
+		args, err := argparse.SplitLine(line)
+		if err != nil {
+			sh.cl.PrintError(err)
+			continue
+		}
+		switch args[0] {
+		case cmdExit, cmdQuit:
+			return nil
+		case operation{}.Command():
+			sh.cl.PrintMessage("Already running a shell")
+			continue
+		}
+		sh.cl.Execute(args)
+		sh.cl.Reset()
+	}
+}
+
+// Determine completion candidates for the word ending at pos.
+// Returns the index at which the word starts and all candidates.
+func (sh *shell) complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' && line[start-1] != '\t' {
+		start--
+	}
+	word := string(line[start:pos])
+	fields := strings.Fields(string(line[:start]))
+
+	var choices []string
+	switch {
+	case len(fields) == 0:
+		choices = append(client.OperationNames(), cmdExit, cmdQuit)
+	case strings.HasPrefix(word, argparse.ParamIdentifierPrefix):
+		choices = append(client.ParamNames(fields[0]), argparse.AllTasks)
+	default:
+		// Only complete the last of several comma-separated tasks.
+		if comma := strings.LastIndex(word, ","); comma >= 0 {
+			start += len([]rune(word[:comma+1]))
+			word = word[comma+1:]
+		}
+		choices = sh.taskNames()
+	}
+
+	var candidates []string
+	for _, choice := range choices {
+		if strings.HasPrefix(choice, word) {
+			candidates = append(candidates, choice)
+		}
+	}
+	return start, candidates
+}
+
+// Fetch all known task names from the server.
+func (sh *shell) taskNames() []string {
+	defer sh.cl.Reset()
+	resp := sh.cl.SendReceive(msg.Cmd{Op: tasksCommand})
+	if sh.cl.Failed() || resp.Failed() {
+		return nil
+	}
+	var names []string
+	for _, line := range resp.Body {
+		if len(line) > 0 {
+			names = append(names, line[0])
+		}
+	}
+	return names
+}
+
+// Append a line to the history file. Failure is not worth bothering the user.
+func (sh *shell) saveHistory(line string) {
+	f, err := os.OpenFile(sh.histFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// Load the most recent lines from the history file, if it exists.
+func loadHistory(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return history
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
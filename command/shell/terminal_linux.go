@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// A terminal in raw mode, able to restore its previous state.
+type terminal struct {
+	fd    int
+	saved syscall.Termios
+}
+
+// Put the terminal into raw mode for character-wise input.
+// Fails if the file descriptor does not refer to a terminal.
+func rawTerminal(fd int) (*terminal, error) {
+	t := terminal{fd: fd}
+	if err := ioctl(fd, syscall.TCGETS, &t.saved); err != nil {
+		return nil, err
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Restore the terminal to its state prior to entering raw mode.
+func (t *terminal) restore() error {
+	return ioctl(t.fd, syscall.TCSETS, &t.saved)
+}
+
+func ioctl(fd int, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
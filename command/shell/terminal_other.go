@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package shell
+
+import "github.com/pkg/errors"
+
+// Raw terminal mode is only supported on Linux. Elsewhere, input is read
+// line by line without editing capabilities.
+type terminal struct{}
+
+func rawTerminal(fd int) (*terminal, error) {
+	return nil, errors.New("Raw terminal mode not supported on this platform")
+}
+
+func (t *terminal) restore() error {
+	return nil
+}
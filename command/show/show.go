@@ -0,0 +1,78 @@
+package show
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "show"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<entry-id>",
+			Description: "The ID of the entry, as listed by `query :entries`",
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Show all details of a single entry")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Show everything known about a single saved entry"
+	footer := "Useful for review before changing or deleting an entry\n" +
+		"Entries resulting from split time list the entries they are linked to.\n" +
+		"Edits are listed with when, by which client and what was changed\n\n" +
+		"Examples\n" +
+		"    tilo query foo :today :entries   # Find the ID\n" +
+		"    tilo show 42"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := msg.ParseEntryIDs(cmd.Args); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to show entry")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	var linked []msg.Entry
+	var history []msg.Edit
+	ids, err := msg.ParseEntryIDs(req.Cmd.Args)
+	if err != nil {
+		resp.SetError(err)
+	} else if entry, err := srv.Backend.Entry(ids[0]); err != nil {
+		resp.SetError(err)
+	} else if history, err = srv.Backend.EntryHistory(ids[0]); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to determine the entry's history"))
+	} else if entry.SplitGroup == 0 {
+		resp.AddEntryDetails(entry, nil, history)
+	} else if linked, err = srv.Backend.SplitEntries(entry.SplitGroup); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to determine linked entries"))
+	} else {
+		resp.AddEntryDetails(entry, linked, history)
+	}
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
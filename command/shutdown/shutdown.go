@@ -1,6 +1,11 @@
 package shutdown
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
@@ -9,6 +14,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	paramForce    = "force"
+	paramAbort    = "abort"
+	paramWhenIdle = "when-idle"
+	paramHandover = "handover"
+)
+
 type operation struct {
 	// No state required
 }
@@ -18,7 +30,13 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Flag(paramForce, "Stop and save active tasks, dropping paused ones"),
+			argparse.Flag(paramAbort, "Discard active tasks, dropping paused ones"),
+			argparse.Flag(paramWhenIdle, "Wait until no task is active or paused and no other client is connected"),
+			argparse.Flag(paramHandover, "Leave active tasks for the next server to resume"),
+		}))
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -27,33 +45,124 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Request server shutdown"
-	return header, ""
+	footer := "While tasks are active, you are asked whether to stop and save or discard them,\n" +
+		"unless decided with :force or :abort. Without an answer, the server keeps running.\n" +
+		"Paused tasks are asked about as well, as they could no longer be resumed\n\n" +
+		"With :when-idle, the server keeps running until no task is active or paused and no\n" +
+		"other client is connected, e.g. an interactive shell; listeners are not waited for\n\n" +
+		"With :handover, active tasks keep running once the next server starts, as done\n" +
+		"by `tilo server restart`\n\n" +
+		"Examples\n" +
+		"    tilo shutdown :force       # Stop and save active tasks, as `tilo stop` would\n" +
+		"    tilo shutdown :abort       # Discard active tasks, as `tilo abort` would\n" +
+		"    tilo shutdown :when-idle   # E.g. before a system upgrade"
+	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
-	if cl.ServerIsRunning() {
-		cl.SendReceivePrint(cmd)
-	} else {
+	if !cl.ServerIsRunning() {
 		cl.PrintMessage("Server appears to be down. Nothing to do")
+		return nil
+	}
+	resp := cl.SendReceive(cmd)
+	if !cl.Failed() && resp.Code == msg.ErrActiveTasks {
+		// The connection is re-established once decided
+		cl.Close()
+		cl.PrintMessage(resp.Error)
+		decision := ask("Stop and save, or abort them?")
+		if decision == "" {
+			return errors.New("Server shutdown cancelled")
+		}
+		if cmd.Flags == nil {
+			cmd.Flags = make(map[string]bool)
+		}
+		cmd.Flags[decision] = true
+		resp = cl.SendReceive(cmd)
 	}
+	cl.PrintResponse(resp)
 	return errors.Wrapf(cl.Error(), "Failed to initiate server shutdown")
 }
 
+// Ask on the terminal whether to save or abort active tasks, giving the
+// corresponding flag, empty to cancel.
+func ask(question string) string {
+	fmt.Print(question + " [s]ave/[a]bort/[C]ancel ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s", "save":
+		return paramForce
+	case "a", "abort":
+		return paramAbort
+	}
+	return ""
+}
+
+func (op operation) Validate(cmd msg.Cmd) error {
+	if cmd.Flags[paramForce] && cmd.Flags[paramAbort] {
+		return errors.New("Cannot both save and abort active tasks")
+	} else if cmd.Flags[paramWhenIdle] && (cmd.Flags[paramForce] || cmd.Flags[paramAbort]) {
+		return errors.New("Tasks are not stopped when waiting until idle")
+	} else if cmd.Flags[paramHandover] && (cmd.Flags[paramForce] || cmd.Flags[paramAbort] || cmd.Flags[paramWhenIdle]) {
+		return errors.New("Tasks are not stopped when handed over")
+	}
+	return nil
+}
+
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
-	defer srv.InitiateShutdown()
 	defer req.Close()
 	resp := msg.Response{}
-	task, stopped := srv.StopCurrentTask()
-	if stopped {
-		if err := srv.SaveTask(task); err != nil {
+	force, abort := req.Cmd.Flags[paramForce], req.Cmd.Flags[paramAbort]
+	if req.Cmd.Flags[paramHandover] {
+		defer srv.HandOver()
+		resp.AddHandoverMessage(srv.ActiveTasks())
+		return srv.Answer(req, resp)
+	}
+	if req.Cmd.Flags[paramWhenIdle] {
+		clients := srv.ShutdownWhenIdle()
+		resp.AddDeferredShutdown(srv.ActiveTasks(), srv.Paused(), clients)
+		return srv.Answer(req, resp)
+	}
+	active, paused := srv.ActiveTasks(), srv.Paused()
+	if (len(active) > 0 || len(paused) > 0) && !force && !abort {
+		var held []string
+		if len(active) > 0 {
+			held = append(held, "Active: "+labels(active))
+		}
+		if len(paused) > 0 {
+			held = append(held, "Paused: "+labels(paused))
+		}
+		resp.Reject(msg.ErrActiveTasks, errors.Errorf("%s; use :%s to stop and save or :%s to discard",
+			strings.Join(held, "; "), paramForce, paramAbort))
+		return srv.Answer(req, resp)
+	}
+	defer srv.InitiateShutdown()
+	for _, task := range srv.StopAllTasks() {
+		if abort {
+			resp.AddAbortedTask(task)
+		} else if saved, err := srv.SaveOrDiscard(task); err != nil {
 			resp.SetError(err)
+		} else if !saved {
+			resp.AddDiscardedTask(task)
+		} else {
+			resp.AddStoppedTask(task)
 		}
-		resp.AddStoppedTask(task)
+	}
+	if dropped := srv.DropPaused(); len(dropped) > 0 {
+		resp.AddDroppedPause(dropped)
 	}
 	resp.AddShutdownMessage()
 	return srv.Answer(req, resp)
 }
 
+// The labels of the tasks, comma-separated.
+func labels(tasks []msg.Task) string {
+	var labels []string
+	for _, task := range tasks {
+		labels = append(labels, task.Label())
+	}
+	return strings.Join(labels, ", ")
+}
+
 func init() {
 	command.RegisterOperation(operation{})
 }
@@ -0,0 +1,95 @@
+package snooze
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramOff = "off"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "snooze"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "[duration]",
+			Description: "How long to snooze, e.g. 2h or 45m",
+			Optional:    true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramOff, "End snoozing early"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Silence reminders for a while")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Silence reminders, e.g. about no active task or long-running tasks, for a while"
+	footer := "The snooze period is kept by the server and sent to all listeners as snoozed_until,\n" +
+		"allowing all notifiers to respect it. Without arguments, the current state is shown\n\n" +
+		"Examples\n" +
+		"    tilo snooze 2h     # Long lunch\n" +
+		"    tilo snooze :off   # Back early"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := snoozeDuration(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to snooze reminders")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if d, err := snoozeDuration(req.Cmd); err != nil {
+		resp.SetError(err)
+	} else if req.Cmd.Flags[paramOff] {
+		srv.Unsnooze()
+	} else if d > 0 {
+		srv.Snooze(time.Now().Add(d).Truncate(time.Second))
+	}
+	if !resp.Failed() {
+		resp.AddSnooze(srv.SnoozedUntil())
+	}
+	return srv.Answer(req, resp)
+}
+
+// The duration given in the command, zero if none is given.
+func snoozeDuration(cmd msg.Cmd) (time.Duration, error) {
+	if len(cmd.Args) == 0 {
+		return 0, nil
+	} else if cmd.Flags[paramOff] {
+		return 0, errors.New("No duration expected when ending a snooze")
+	}
+	d, err := time.ParseDuration(cmd.Args[0])
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("Not a positive duration: %s", cmd.Args[0])
+	}
+	return d, nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -1,25 +1,32 @@
 package srvcmd
 
 import (
+	"os"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
 	"github.com/fgahr/tilo/msg"
 	"github.com/fgahr/tilo/server"
 	"github.com/pkg/errors"
 )
 
 const (
-	RUN   = "run"
-	START = "start"
-	STOP  = "stop"
+	RUN      = "run"
+	START    = "start"
+	STOP     = "stop"
+	RESTART  = "restart"
+	RELOAD   = "reload"
+	LOGLEVEL = "loglevel"
+	STATUS   = "status"
 )
 
 type cmdHandler struct {
 	command string
 }
 
-func (h *cmdHandler) HandleArgs(_ *msg.Cmd, args []string) ([]string, error) {
+func (h *cmdHandler) HandleArgs(cmd *msg.Cmd, args []string) ([]string, error) {
 	if len(args) == 0 {
 		return args, errors.New("Require a command but none was given")
 	}
@@ -28,6 +35,15 @@ func (h *cmdHandler) HandleArgs(_ *msg.Cmd, args []string) ([]string, error) {
 	} else {
 		return args, errors.New("Not a known server command: " + args[0])
 	}
+	if h.command == LOGLEVEL {
+		if len(args) < 2 {
+			return args, errors.New("Require a log level but none was given")
+		} else if !config.IsLogLevel(args[1]) {
+			return args, errors.New("Not a log level: " + args[1])
+		}
+		cmd.Args = []string{LOGLEVEL, args[1]}
+		return args[2:], nil
+	}
 	return args[1:], nil
 }
 
@@ -45,6 +61,22 @@ func (h *cmdHandler) DescribeParameters() []argparse.ParamDescription {
 			ParamName:        "stop",
 			ParamExplanation: "Stop a running server",
 		},
+		argparse.ParamDescription{
+			ParamName:        "status",
+			ParamExplanation: "Tell whether a server is running, or why the last one stopped",
+		},
+		argparse.ParamDescription{
+			ParamName:        "restart",
+			ParamExplanation: "Replace a running server with a new one, keeping active tasks",
+		},
+		argparse.ParamDescription{
+			ParamName:        "reload",
+			ParamExplanation: "Make a running server re-read its configuration file",
+		},
+		argparse.ParamDescription{
+			ParamName:        "loglevel <level>",
+			ParamExplanation: "Change the log level of a running server until reloaded",
+		},
 		argparse.ParamDescription{
 			ParamName:        "run",
 			ParamExplanation: "Start a server in the foreground, printing log messages",
@@ -60,6 +92,14 @@ func isKnownCommand(str string) bool {
 		return true
 	case STOP:
 		return true
+	case RESTART:
+		return true
+	case RELOAD:
+		return true
+	case LOGLEVEL:
+		return true
+	case STATUS:
+		return true
 	default:
 		return false
 	}
@@ -80,14 +120,25 @@ func (op operation) Parser() *argparse.Parser {
 func (op operation) DescribeShort() argparse.Description {
 	return argparse.Description{
 		Cmd:   op.Command(),
-		First: "[start|stop|run]",
+		First: "[start|stop|status|restart|reload|loglevel|run]",
 		What:  "Start or stop a server process or run in the foreground",
 	}
 }
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Start or stop a server process"
-	footer := "Several other commands may spawn a server process if it is not yet running"
+	footer := "Several other commands may spawn a server process if it is not yet running\n\n" +
+		"Servers started in the background log to server.log in the configuration\n" +
+		"directory, keeping the logs of the last few servers as server.log.1 and so on.\n" +
+		"If the last one failed to start or crashed, the status shows why\n\n" +
+		"A restart hands active tasks over to the new server, which resumes them as if\n" +
+		"nothing happened, e.g. after upgrading tilo\n\n" +
+		"A reload, also done on SIGHUP, applies changes to the configuration file without\n" +
+		"interrupting active tasks. Changes to the socket, backend or HTTP address only\n" +
+		"take effect on restart\n\n" +
+		"Log levels are off, warn, info, debug and trace\n\n" +
+		"Examples\n" +
+		"    tilo server loglevel debug   # Diagnose an issue, then set it back"
 	return header, footer
 }
 
@@ -97,6 +148,14 @@ func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
 		cl.EnsureServerIsRunning()
 	case STOP:
 		op.requestShutdown(cl, cmd)
+	case STATUS:
+		return op.status(cl)
+	case RESTART:
+		return cl.RestartServer(os.Stdout)
+	case RELOAD:
+		return op.reload(cl, cmd)
+	case LOGLEVEL:
+		return op.setLogLevel(cl, cmd)
 	case RUN:
 		cl.RunServer()
 	}
@@ -116,9 +175,64 @@ func (op operation) requestShutdown(cl *client.Client, cmd msg.Cmd) error {
 	return errors.Wrapf(cl.Error(), "Failed to initiate server shutdown")
 }
 
+// Tell whether a server is running, along with the last lines it logged if
+// the last one started in the background stopped without shutting down.
+func (op operation) status(cl *client.Client) error {
+	if cl.ServerIsRunning() {
+		if conf := cl.Config(); conf.RemoteServer() {
+			cl.PrintMessage("Server running: " + conf.ServerAddr.Value)
+		} else {
+			cl.PrintMessage("Server running: " + conf.Socket.Value)
+		}
+		return nil
+	} else if cl.Failed() {
+		return cl.Error()
+	}
+	cl.PrintFailedStart()
+	return errors.New("Server not running")
+}
+
+// Make a running server reload its configuration.
+func (op operation) reload(cl *client.Client, cmd msg.Cmd) error {
+	if !cl.ServerIsRunning() {
+		cl.PrintMessage("Server appears to be down. Nothing to do")
+		return nil
+	}
+	cmd.Args = []string{RELOAD}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to reload server configuration")
+}
+
+// Change the log level of a running server.
+func (op operation) setLogLevel(cl *client.Client, cmd msg.Cmd) error {
+	if !cl.ServerIsRunning() {
+		cl.PrintMessage("Server appears to be down. Nothing to do")
+		return nil
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to change server log level")
+}
+
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
+	if len(req.Cmd.Args) == 1 && req.Cmd.Args[0] == RELOAD {
+		if applied, left, err := srv.ReloadConfig(); err != nil {
+			resp.SetError(err)
+		} else {
+			resp.AddReloadedConfig(applied, left)
+		}
+		return srv.Answer(req, resp)
+	}
+	if len(req.Cmd.Args) == 2 && req.Cmd.Args[0] == LOGLEVEL {
+		if !config.IsLogLevel(req.Cmd.Args[1]) {
+			resp.SetError(errors.New("Not a log level: " + req.Cmd.Args[1]))
+		} else {
+			previous := srv.SetLogLevel(req.Cmd.Args[1])
+			resp.AddLogLevel(req.Cmd.Args[1], previous)
+		}
+		return srv.Answer(req, resp)
+	}
 	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
 	return srv.Answer(req, resp)
 }
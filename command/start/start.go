@@ -1,14 +1,26 @@
 package start
 
 import (
+	"os"
+	"strings"
+
 	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/overlong"
 	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/project"
 	"github.com/fgahr/tilo/server"
 	"github.com/pkg/errors"
 )
 
+const (
+	paramNote = "note"
+	paramTags = "tags"
+	// Keep an active task running instead of saving and restarting it
+	paramUnlessActive = "unless-active"
+)
+
 type operation struct {
 	// No state required
 }
@@ -18,7 +30,20 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithSingleTask().WithoutParams()
+	tags := []argparse.Arg{
+		argparse.Arg{
+			Name:        argparse.TagShorthandPrefix + "<tag>..",
+			Description: "Tag the new entry, as with :tags",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithSplitTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(tags, []argparse.Param{
+			argparse.Option(paramNote, "<text>", "Attach a note to the new entry"),
+			argparse.Option(paramTags, "<tag,..>", "Tag the new entry"),
+			argparse.Flag(paramUnlessActive, "Do nothing if the task is already active"),
+		}))
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -27,30 +52,169 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Set the currently active task, i.e. start logging time. If a task is active, save it first"
-	footer := "To avoid saving the previous task, use the `abort` command first\n\n" +
+	footer := "To avoid saving the previous task, use the `abort` command first\n" +
+		"If parallel tasks are allowed (allow_parallel), other active tasks keep running\n" +
+		"With rollover set to a time of day (HH:MM), e.g. 00:00, active tasks are saved\n" +
+		"and continued at that time, so that overnight sessions give one entry per day\n\n" +
 		"This command can also be used from time to time to avoid losing activity accidentally\n" +
-		"In this case the `current` command will only show elapsed time since the last 'save'"
+		"In this case the `current` command will only show elapsed time since the last 'save'\n\n" +
+		"Time can be split between several tasks by giving each as task:weight\n" +
+		"When stopped, the elapsed time is saved as consecutive entries, one per task,\n" +
+		"with lengths in proportion to the weights\n\n" +
+		"Examples\n" +
+		"    tilo start meeting:50 admin:50   # Split time evenly between meeting and admin\n" +
+		"    tilo start thesis :note=chapter3 # Attach a note to the entry\n" +
+		"    tilo start acme :tags=billable   # Tag the entry, see `tilo tag`\n" +
+		"    tilo start client-a/backend +billable :note=\"sprint 12\"\n" +
+		"                                     # Task of project client-a, see `tilo query`\n\n" +
+		"Without a task, the one named in the nearest " + project.FileName + " file is started, in the\n" +
+		"working directory or above. Besides the task, the file may list tags; any other\n" +
+		"key is metadata, added as a key:value tag:\n" +
+		"    task = thesis\n" +
+		"    tags = writing,university\n" +
+		"    client = tu-berlin"
 	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
-	cl.SendReceivePrint(cmd)
+	if err := shorthandTags(&cmd); err != nil {
+		return err
+	}
+	if len(cmd.TaskNames) == 0 {
+		if err := useProject(&cmd); err != nil {
+			return err
+		}
+	}
+	if tags, ok := cmd.Opts[paramTags]; ok {
+		if _, err := argparse.GetTagNames(tags); err != nil {
+			return err
+		}
+	}
+	resp := cl.SendReceive(cmd)
+	if err := overlong.Ask(cl, resp); err != nil {
+		return err
+	}
+	cl.PrintResponse(resp)
 	return errors.Wrapf(cl.Error(), "Failed to start task '%s'", cmd.TaskNames[0])
 }
 
+// Add the tags given as +tag to those given via :tags.
+func shorthandTags(cmd *msg.Cmd) error {
+	var tags []string
+	for _, arg := range cmd.Args {
+		if !argparse.IsTagShorthand(arg) {
+			return errors.Errorf("Expected a tag as %s<tag> but got %s", argparse.TagShorthandPrefix, arg)
+		}
+		tags = append(tags, strings.TrimPrefix(arg, argparse.TagShorthandPrefix))
+	}
+	cmd.Args = nil
+	if len(tags) == 0 {
+		return nil
+	}
+	if given := cmd.Opts[paramTags]; given != "" {
+		tags = append([]string{given}, tags...)
+	}
+	if cmd.Opts == nil {
+		cmd.Opts = make(map[string]string)
+	}
+	cmd.Opts[paramTags] = strings.Join(tags, ",")
+	return nil
+}
+
+// Start the task of the project in the working directory, adding its tags to
+// those given.
+func useProject(cmd *msg.Cmd) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	proj, err := project.Find(dir)
+	if err != nil {
+		return err
+	} else if proj == nil {
+		return errors.Errorf("No task given and no %s file found", project.FileName)
+	}
+	cmd.TaskNames = []string{proj.Task}
+	if tags := proj.AllTags(); len(tags) > 0 {
+		if given := cmd.Opts[paramTags]; given != "" {
+			tags = append(tags, given)
+		}
+		if cmd.Opts == nil {
+			cmd.Opts = make(map[string]string)
+		}
+		cmd.Opts[paramTags] = strings.Join(tags, ",")
+	}
+	return nil
+}
+
+// The client fills in the project's task if none is given, so the server
+// requires one.
+func (op operation) Validate(cmd msg.Cmd) error {
+	if len(cmd.TaskNames) == 0 {
+		return errors.New("No task given")
+	}
+	return nil
+}
+
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
+	var split []msg.Allocation
 	taskName := req.Cmd.TaskNames[0]
-	task, stopped := srv.StopCurrentTask()
-	if stopped {
-		if err := srv.SaveTask(task); err != nil {
+	if len(req.Cmd.TaskNames) > 1 {
+		for _, spec := range req.Cmd.TaskNames {
+			alloc, err := msg.ParseAllocation(spec)
+			if err != nil {
+				resp.SetError(err)
+				return srv.Answer(req, resp)
+			}
+			split = append(split, alloc)
+		}
+		taskName = msg.FreshSplitTask(split).Name
+	}
+	if req.Cmd.Flags[paramUnlessActive] && srv.IsActive(taskName) {
+		resp.AddActiveTasks(srv.ActiveTasks())
+		return srv.Answer(req, resp)
+	}
+	var stopped []msg.Task
+	if srv.ParallelTasks() {
+		stopped = srv.StopTasks([]string{taskName})
+	} else {
+		stopped = srv.StopAllTasks()
+	}
+	var kept []msg.Task
+	for _, task := range stopped {
+		if saved, err := srv.SaveOrDiscard(task); err != nil {
 			resp.SetError(err)
+		} else if !saved {
+			resp.AddDiscardedTask(task)
+			continue
 		}
 		resp.AddStoppedTask(task)
+		kept = append(kept, task)
+	}
+	if err := srv.WarnAboutBudgets(&resp, kept); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+	}
+	if split != nil {
+		srv.SetActiveSplitTask(split)
+	} else {
+		srv.SetActiveTask(taskName)
+	}
+	if note := req.Cmd.Opts[paramNote]; note != "" {
+		if err := srv.AddNote(taskName, note); err != nil {
+			resp.SetError(err)
+		}
+	}
+	if tagField, ok := req.Cmd.Opts[paramTags]; ok {
+		if tags, err := argparse.GetTagNames(tagField); err != nil {
+			resp.SetError(err)
+		} else if err := srv.SetTags(taskName, tags); err != nil {
+			resp.SetError(err)
+		}
 	}
-	srv.SetActiveTask(taskName)
-	resp.AddCurrentTask(srv.CurrentTask)
+	resp.AddCurrentTask(srv.CurrentTask())
+	resp.AddOverlong(srv.Overlong(), false)
 	return srv.Answer(req, resp)
 }
 
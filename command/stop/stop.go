@@ -1,14 +1,27 @@
 package stop
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
 	"github.com/fgahr/tilo/client"
 	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/overlong"
 	"github.com/fgahr/tilo/msg"
 	"github.com/fgahr/tilo/server"
 	"github.com/pkg/errors"
 )
 
+const (
+	paramNote    = "note"
+	paramKeep    = "keep"
+	paramDiscard = "discard"
+)
+
 type operation struct {
 	// No state required
 }
@@ -18,7 +31,12 @@ func (op operation) Command() string {
 }
 
 func (op operation) Parser() *argparse.Parser {
-	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+	return argparse.CommandParser(op.Command()).WithOptionalTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Option(paramNote, "<text>", "Attach a note to the stopped entry"),
+			argparse.Flag(paramKeep, "Save the task even if it ran for less than discard_under"),
+			argparse.Flag(paramDiscard, "Discard the task without asking if it ran for less than discard_under"),
+		}))
 }
 
 func (op operation) DescribeShort() argparse.Description {
@@ -27,30 +45,145 @@ func (op operation) DescribeShort() argparse.Description {
 
 func (op operation) HelpHeaderAndFooter() (string, string) {
 	header := "Stop the currently active task, logging the activity"
-	footer := "To stop a task without logging, use the `abort` command"
+	footer := "To stop a task without logging, use the `abort` command\n" +
+		"The task's totals for today and this week are shown along with the stopped session,\n" +
+		"followed by warnings about its budgets if exceeded or at risk, see `tilo help budget`\n\n" +
+		"If parallel tasks are allowed (allow_parallel), all active tasks are stopped\n" +
+		"unless a task is given\n\n" +
+		"Tasks which ran for less than discard_under, e.g. 30s, are not saved. Unless\n" +
+		"discard_short is set to silently, you are asked before they are discarded.\n" +
+		"Tasks stopped by starting another one are only discarded silently\n\n" +
+		"Examples\n" +
+		"    tilo stop :note=\"fixed flaky test\"   # Attach a note to the saved entry\n" +
+		"    tilo stop :keep                       # Save the task however short"
 	return header, footer
 }
 
 func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
-	cl.SendReceivePrint(cmd)
+	resp := cl.SendReceive(cmd)
+	if !cl.Failed() && resp.Code == msg.ErrShortTask {
+		// The connection is re-established once decided
+		cl.Close()
+		cl.PrintMessage(resp.Error)
+		decision := paramKeep
+		if client.Confirm(os.Stdin, "Discard?") {
+			decision = paramDiscard
+		}
+		if cmd.Flags == nil {
+			cmd.Flags = make(map[string]bool)
+		}
+		cmd.Flags[decision] = true
+		resp = cl.SendReceive(cmd)
+	}
+	// Tasks stopped for running too long may be why none is active
+	if err := overlong.Ask(cl, resp); err != nil {
+		return err
+	}
+	cl.PrintResponse(resp)
 	return errors.Wrap(cl.Error(), "Failed to stop the current task")
 }
 
+func (op operation) Validate(cmd msg.Cmd) error {
+	if cmd.Flags[paramKeep] && cmd.Flags[paramDiscard] {
+		return errors.New("Cannot both keep and discard the task")
+	}
+	return nil
+}
+
 func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
 	defer req.Close()
 	resp := msg.Response{}
-	task, stopped := srv.StopCurrentTask()
-	if stopped {
+	keep, discard := req.Cmd.Flags[paramKeep], req.Cmd.Flags[paramDiscard]
+	if !keep && !discard && !srv.Config().DiscardSilently() {
+		if short := shortTasks(srv, req.Cmd.TaskNames); len(short) > 0 {
+			resp.Reject(msg.ErrShortTask, errors.Errorf("Ran for less than %v: %s",
+				srv.Config().DiscardThreshold(), strings.Join(short, ", ")))
+			return srv.Answer(req, resp)
+		}
+	}
+	stopped := srv.StopTasks(req.Cmd.TaskNames)
+	var saved []msg.Task
+	for _, task := range stopped {
+		task.AddNote(req.Cmd.Opts[paramNote])
+		if !keep && srv.TooShort(task) {
+			resp.AddDiscardedTask(task)
+			continue
+		}
 		if err := srv.SaveTask(task); err != nil {
 			resp.SetError(err)
 		}
 		resp.AddStoppedTask(task)
-	} else {
+		if err := addRunningTotals(srv, &resp, task); err != nil {
+			resp.SetError(errors.Wrap(err, "Failed to determine totals"))
+		}
+		saved = append(saved, task)
+	}
+	if len(stopped) == 0 {
 		resp.SetError(errors.New("No active task"))
 	}
+	if err := srv.WarnAboutBudgets(&resp, saved); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+	}
+	resp.AddOverlong(srv.Overlong(), false)
 	return srv.Answer(req, resp)
 }
 
+// Labels of the active tasks with the given names, or all active tasks if no
+// names are given, which would be too short to save if stopped now.
+func shortTasks(srv *server.Server, taskNames []string) []string {
+	var short []string
+	for _, task := range srv.ActiveTasks() {
+		if len(taskNames) > 0 && !contains(taskNames, task.Name) {
+			continue
+		}
+		task.Stop()
+		if srv.TooShort(task) {
+			short = append(short, fmt.Sprintf("%s (%v)", task.Label(), task.Ended.Sub(task.Started)))
+		}
+	}
+	return short
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Add today's and this week's totals for a stopped task to the response. For
+// split tasks, totals are given for each task sharing the time.
+func addRunningTotals(srv *server.Server, resp *msg.Response, task msg.Task) error {
+	now := time.Now()
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(srv.Config()); err != nil {
+		return err
+	}
+	for _, part := range task.Allocate() {
+		today, err := totalBetween(srv, part.Name, cal.Day(now))
+		if err != nil {
+			return err
+		}
+		week, err := totalBetween(srv, part.Name, cal.Week(now))
+		if err != nil {
+			return err
+		}
+		resp.AddRunningTotals(part.Name, part.Ended.Sub(part.Started), today, week)
+	}
+	return nil
+}
+
+// The total time logged on a task within the span.
+func totalBetween(srv *server.Server, taskName string, span quantifier.Span) (time.Duration, error) {
+	sum, err := srv.Backend.GetTaskBetween(taskName, span.Start, span.End, 0)
+	if err != nil || len(sum) == 0 {
+		return 0, err
+	}
+	return sum[0].Total, nil
+}
+
 func init() {
 	command.RegisterOperation(operation{})
 }
@@ -0,0 +1,81 @@
+package switcher
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramNote = "note"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "switch"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithSingleTask().
+		WithArgHandler(argparse.HandlerForParams([]argparse.Param{
+			argparse.Option(paramNote, "<text>", "Attach a note to the stopped entry"),
+		}))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Stop the current task and start another one")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Stop and save the current task, starting another one at the same moment"
+	footer := "Unlike `stop` followed by `start`, no time is lost in between: the new task\n" +
+		"starts exactly when the old one ends, and it runs while the old one is saved\n\n" +
+		"If parallel tasks are allowed (allow_parallel), only the most recently started\n" +
+		"task is stopped\n\n" +
+		"Examples\n" +
+		"    tilo switch review :note=\"finished the parser\""
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SendReceivePrint(cmd)
+	return errors.Wrapf(cl.Error(), "Failed to switch to task '%s'", cmd.TaskNames[0])
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	taskName := req.Cmd.TaskNames[0]
+	if srv.IsActive(taskName) {
+		resp.SetError(errors.Errorf("Task is already active: %s", taskName))
+		return srv.Answer(req, resp)
+	}
+	stopped := srv.Switch(taskName)
+	var kept []msg.Task
+	for _, task := range stopped {
+		task.AddNote(req.Cmd.Opts[paramNote])
+		if saved, err := srv.SaveOrDiscard(task); err != nil {
+			resp.SetError(err)
+		} else if !saved {
+			resp.AddDiscardedTask(task)
+			continue
+		}
+		resp.AddStoppedTask(task)
+		kept = append(kept, task)
+	}
+	if err := srv.WarnAboutBudgets(&resp, kept); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to evaluate budgets"))
+	}
+	resp.AddStartedTask(srv.CurrentTask())
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,173 @@
+package tag
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// An action manages the tags of all saved entries.
+type action struct {
+	usage       string // Arguments following the action
+	description string
+	tags        int // Number of tag arguments required
+	exec        func(srv *server.Server, tags []string, resp *msg.Response) error
+}
+
+func (a action) Usage() string {
+	return a.usage
+}
+
+func (a action) Description() string {
+	return a.description
+}
+
+// Available actions by name.
+var actions = argparse.Actions{
+	"list": action{
+		description: "List all tags with the number of entries and time they cover",
+		tags:        0,
+		exec:        list,
+	},
+	"rename": action{
+		usage:       "<tag> <new-name>",
+		description: "Rename a tag on all entries; the new name must not be in use",
+		tags:        2,
+		exec:        rename,
+	},
+	"merge": action{
+		usage:       "<tag> <into>",
+		description: "Replace a tag with another, existing one on all entries",
+		tags:        2,
+		exec:        merge,
+	},
+	"delete": action{
+		usage:       "<tag>",
+		description: "Remove a tag from all entries; the entries themselves are kept",
+		tags:        1,
+		exec:        remove,
+	},
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "tag"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		actions.Arg(),
+		argparse.Arg{
+			Name:        "[tags..]",
+			Description: "The tags to operate on, depending on the action",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, nil))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Manage tags of saved entries")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "List, rename, merge or delete the tags attached to saved entries"
+	footer := actions.Help() + "\n\n" +
+		"Tags are attached when starting a task, using :tags\n" +
+		"Changes apply to all entries at once, so that past queries stay consistent\n\n" +
+		"Examples\n" +
+		"    tilo start acme :tags=billable,meeting\n" +
+		"    tilo tag rename billabel billable\n" +
+		"    tilo tag merge meetings meeting"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := checkedAction(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrapf(cl.Error(), "Failed to %s tags", cmd.Args[0])
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if act, err := checkedAction(req.Cmd); err != nil {
+		resp.SetError(err)
+	} else if err := act.exec(srv, req.Cmd.Args[1:], &resp); err != nil {
+		resp.SetError(err)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The action requested by the command, after checking its arguments.
+func checkedAction(cmd msg.Cmd) (action, error) {
+	chosen, err := actions.Choose(cmd.Args)
+	if err != nil {
+		return action{}, err
+	}
+	act := chosen.(action)
+	tags := cmd.Args[1:]
+	if len(tags) != act.tags {
+		return act, errors.Errorf("Usage: tag %s %s", cmd.Args[0], act.usage)
+	}
+	for _, tag := range tags {
+		if parsed, err := argparse.GetTagNames(tag); err != nil {
+			return act, err
+		} else if len(parsed) != 1 {
+			return act, errors.Errorf("Require a single tag, got %s", tag)
+		}
+	}
+	return act, nil
+}
+
+func list(srv *server.Server, tags []string, resp *msg.Response) error {
+	summaries, err := srv.Backend.TagSummaries()
+	if err != nil {
+		return errors.Wrap(err, "Failed to retrieve tags")
+	}
+	resp.AddTagSummaries(summaries)
+	return nil
+}
+
+func rename(srv *server.Server, tags []string, resp *msg.Response) error {
+	return renameTag(srv, tags[0], tags[1], false, resp)
+}
+
+func merge(srv *server.Server, tags []string, resp *msg.Response) error {
+	if tags[0] == tags[1] {
+		return errors.Errorf("Cannot merge %s into itself", tags[0])
+	}
+	return renameTag(srv, tags[0], tags[1], true, resp)
+}
+
+func renameTag(srv *server.Server, from string, into string, merge bool, resp *msg.Response) error {
+	n, err := srv.Backend.RenameTag(from, into, merge)
+	if err != nil {
+		return err
+	}
+	resp.AddRenamedTag(from, into, n)
+	return nil
+}
+
+func remove(srv *server.Server, tags []string, resp *msg.Response) error {
+	n, err := srv.Backend.DeleteTag(tags[0])
+	if err != nil {
+		return err
+	}
+	resp.AddDeletedTag(tags[0], n)
+	return nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,331 @@
+package task
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// An action manages a single task, given as the first of its arguments.
+// Actions taking several tasks get them comma-separated in its place.
+type action struct {
+	usage       string // Arguments following the task
+	description string
+	check       func(args []string) error
+	confirm     bool // Whether the action requires confirmation, being irreversible
+	multiple    bool // Whether the action takes several tasks
+	exec        func(srv *server.Server, task string, args []string, resp *msg.Response) error
+}
+
+func (a action) Usage() string {
+	return strings.TrimSpace("<task> " + a.usage)
+}
+
+func (a action) Description() string {
+	return a.description
+}
+
+// Available actions by name.
+var actions = argparse.Actions{
+	"archive": action{
+		description: "Hide the task from `tilo tasks`, queries for all tasks, and completion",
+		check:       noArgs,
+		exec:        archive(true),
+	},
+	"describe": action{
+		usage:       "[text]",
+		description: "Describe the task; without text, the description is removed",
+		check:       func(args []string) error { return nil },
+		exec:        describe,
+	},
+	"icon": action{
+		usage:       "[icon]",
+		description: "Set a short icon or emoji shown before the task's name; without icon, it is removed",
+		check: func(args []string) error {
+			if len(args) > 1 || (len(args) == 1 && utf8.RuneCountInString(args[0]) > maxIconLength) {
+				return errors.Errorf("An icon consists of at most %d characters", maxIconLength)
+			}
+			return nil
+		},
+		exec: setIcon,
+	},
+	"merge": action{
+		usage:       "into <target>",
+		description: "Move all entries of the tasks, comma-separated, to the target, which may exist",
+		check: func(args []string) error {
+			if len(args) != 2 || args[0] != "into" {
+				return errors.New("Require the target as in `merge a,b into c`")
+			}
+			_, err := singleTask(args[1])
+			return err
+		},
+		multiple: true,
+		exec:     merge,
+	},
+	"purge": action{
+		description: "Delete the task along with all its entries, their notes and tags, its metadata and budgets",
+		check:       noArgs,
+		confirm:     true,
+		exec:        purge,
+	},
+	"rename": action{
+		usage:       "<new-name>",
+		description: "Move all entries of the task to a new one, along with its metadata and budgets",
+		check: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("Require the new name of the task")
+			}
+			_, err := singleTask(args[0])
+			return err
+		},
+		exec: rename,
+	},
+	"unarchive": action{
+		description: "Show an archived task again",
+		check:       noArgs,
+		exec:        archive(false),
+	},
+}
+
+const paramYes = "yes"
+
+// Icons are meant to be short, but emoji may consist of several code points.
+const maxIconLength = 8
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "task"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		actions.Arg(),
+		argparse.Arg{
+			Name:        "<task>",
+			Description: "The task to manage, several comma-separated ones to merge",
+		},
+		argparse.Arg{
+			Name:        "[args..]",
+			Description: "Further arguments, depending on the action",
+			Optional:    true,
+			Many:        true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramYes, "Confirm an irreversible action"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Manage task metadata")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Manage metadata of a single task"
+	footer := actions.Help() + "\n\n" +
+		"Descriptions are shown by `tilo tasks` and in query results\n" +
+		"Icons are shown before the name of active tasks and sent to listeners\n" +
+		"Purging cannot be undone and requires :yes; backups are not affected\n" +
+		"Renaming or merging leaves out the target's metadata if it has any; tasks\n" +
+		"currently active or paused cannot be renamed, merged or archived\n" +
+		"Archived tasks are shown again with :archived, e.g. `tilo query :all :archived`\n\n" +
+		"Examples\n" +
+		"    tilo task describe coding \"Backend work for ACME\"\n" +
+		"    tilo task icon coding 💻\n" +
+		"    tilo task rename acme acme-support\n" +
+		"    tilo task merge review,meetings into overhead\n" +
+		"    tilo task archive acme-support\n" +
+		"    tilo task purge acme-support :yes"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if _, err := checkedAction(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrapf(cl.Error(), "Failed to %s task", cmd.Args[0])
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if act, err := checkedAction(req.Cmd); err != nil {
+		resp.SetError(err)
+	} else if err := act.exec(srv, req.Cmd.Args[1], req.Cmd.Args[2:], &resp); err != nil {
+		resp.SetError(err)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The action requested by the command, after checking its arguments.
+func checkedAction(cmd msg.Cmd) (action, error) {
+	if len(cmd.Args) < 2 {
+		return action{}, errors.New("Require an action and a task")
+	}
+	chosen, err := actions.Choose(cmd.Args)
+	if err != nil {
+		return action{}, err
+	}
+	act := chosen.(action)
+	if act.multiple {
+		if tasks, err := argparse.GetTaskNames(cmd.Args[1]); err != nil {
+			return act, err
+		} else if tasks[0] == argparse.AllTasks {
+			return act, errors.Errorf("Require task names, got %s", cmd.Args[1])
+		}
+	} else if _, err := singleTask(cmd.Args[1]); err != nil {
+		return act, err
+	}
+	if act.confirm && !cmd.Flags[paramYes] {
+		return act, errors.Errorf("Cannot be undone, confirm with :%s", paramYes)
+	}
+	return act, act.check(cmd.Args[2:])
+}
+
+// The single task named by the argument.
+func singleTask(arg string) (string, error) {
+	if tasks, err := argparse.GetTaskNames(arg); err != nil {
+		return "", err
+	} else if len(tasks) != 1 || tasks[0] == argparse.AllTasks || tasks[0] == "" {
+		return "", errors.Errorf("Require a single task name, got %s", arg)
+	}
+	return arg, nil
+}
+
+func describe(srv *server.Server, task string, args []string, resp *msg.Response) error {
+	info, err := taskInfo(srv, task)
+	if err != nil {
+		return err
+	}
+	info.Description = strings.TrimSpace(strings.Join(args, " "))
+	if err := srv.Backend.SaveTaskInfo(info); err != nil {
+		return err
+	}
+	resp.AddTaskInfo(info)
+	return nil
+}
+
+func setIcon(srv *server.Server, task string, args []string, resp *msg.Response) error {
+	info, err := taskInfo(srv, task)
+	if err != nil {
+		return err
+	}
+	info.Icon = strings.Join(args, "")
+	if err := srv.Backend.SaveTaskInfo(info); err != nil {
+		return err
+	}
+	srv.SetIcon(task, info.Icon)
+	resp.AddTaskInfo(info)
+	return nil
+}
+
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return errors.New("Takes no further arguments")
+	}
+	return nil
+}
+
+func purge(srv *server.Server, task string, args []string, resp *msg.Response) error {
+	entries, err := srv.Backend.PurgeTask(task)
+	if err != nil {
+		return err
+	}
+	srv.ForgetTask(task)
+	resp.AddPurgedTask(task, entries)
+	return nil
+}
+
+func rename(srv *server.Server, task string, args []string, resp *msg.Response) error {
+	return moveEntries(srv, []string{task}, args[0], false, resp)
+}
+
+func merge(srv *server.Server, field string, args []string, resp *msg.Response) error {
+	tasks, _ := argparse.GetTaskNames(field)
+	return moveEntries(srv, tasks, args[1], true, resp)
+}
+
+// Move all entries of the tasks to the target. Tasks held by the server are
+// left alone, as their entries would be saved under the old name.
+func moveEntries(srv *server.Server, tasks []string, into string, merge bool, resp *msg.Response) error {
+	for _, task := range append(tasks, into) {
+		if srv.InUse(task) {
+			return errors.Errorf("Task %s is in use, stop it first", task)
+		}
+	}
+	known, err := srv.Backend.TaskNames()
+	if err != nil {
+		return errors.Wrap(err, "Failed to determine task names")
+	}
+	for _, task := range tasks {
+		if task == into {
+			return errors.Errorf("Cannot move task %s into itself", task)
+		} else if !contains(known, task) {
+			return errors.Errorf("No such task: %s", task)
+		}
+	}
+	for _, task := range tasks {
+		entries, err := srv.Backend.RenameTask(task, into, merge)
+		if err != nil {
+			return err
+		}
+		srv.ForgetTask(task)
+		resp.AddRenamedTask(task, into, entries)
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive the task or show it again.
+func archive(archived bool) func(*server.Server, string, []string, *msg.Response) error {
+	return func(srv *server.Server, task string, args []string, resp *msg.Response) error {
+		if archived && srv.InUse(task) {
+			return errors.Errorf("Task %s is in use, stop it first", task)
+		}
+		info, err := taskInfo(srv, task)
+		if err != nil {
+			return err
+		}
+		info.Archived = archived
+		if err := srv.Backend.SaveTaskInfo(info); err != nil {
+			return err
+		}
+		resp.AddTaskInfo(info)
+		return nil
+	}
+}
+
+// The current metadata of the task.
+func taskInfo(srv *server.Server, task string) (msg.TaskInfo, error) {
+	infos, err := srv.Backend.TaskInfo()
+	if err != nil {
+		return msg.TaskInfo{}, errors.Wrap(err, "Failed to determine task metadata")
+	}
+	info := infos[task]
+	info.Name = task
+	return info, nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const paramArchived = "archived"
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "tasks"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := []argparse.Param{
+		argparse.Flag(paramArchived, "Include archived tasks"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("List all known tasks")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "List the names of all tasks with logged activity"
+	footer := "Active tasks are included even if they have never been saved\n" +
+		"Tasks are followed by their icon and description, see `tilo help task`\n" +
+		"Archived tasks are left out unless asked for, or active"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to list tasks")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	if names, err := srv.Backend.TaskNames(); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to determine task names"))
+	} else if infos, err := srv.Backend.TaskInfo(); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to determine task metadata"))
+	} else {
+		if !req.Cmd.Flags[paramArchived] {
+			names = unarchived(names, infos)
+		}
+		resp.AddTaskNames(withActiveTasks(names, srv.ActiveTasks()), infos)
+	}
+	return srv.Answer(req, resp)
+}
+
+// The names of tasks which are not archived.
+func unarchived(names []string, infos map[string]msg.TaskInfo) []string {
+	var shown []string
+	for _, name := range names {
+		if !infos[name].Archived {
+			shown = append(shown, name)
+		}
+	}
+	return shown
+}
+
+// Add the active tasks to the names unless they're already present. For
+// split tasks, the tasks sharing the time are added.
+func withActiveTasks(names []string, active []msg.Task) []string {
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+	for _, task := range active {
+		taskNames := []string{task.Name}
+		if len(task.Split) > 0 {
+			taskNames = nil
+			for _, alloc := range task.Split {
+				taskNames = append(taskNames, alloc.Task)
+			}
+		}
+		for _, name := range taskNames {
+			if !known[name] {
+				known[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
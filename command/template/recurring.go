@@ -0,0 +1,120 @@
+package template
+
+import (
+	"os"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Repetitions with special names, all others being days of the week.
+const (
+	repeatDaily       = "daily"
+	repeatWorkingDays = "working-days" // As configured via working_days
+)
+
+// The days of the week given by a repetition, nil for working days or if
+// the template does not repeat.
+func repeatDays(repeat string) (*quantifier.Calendar, error) {
+	switch repeat {
+	case "", repeatWorkingDays:
+		return nil, nil
+	case repeatDaily:
+		repeat = "mon,tue,wed,thu,fri,sat,sun"
+	}
+	days := quantifier.DefaultCalendar()
+	return days, days.SetWorkingDays(repeat)
+}
+
+// Whether the server logs the template's entry on the given day, which
+// never happens on holidays and days off.
+func (t Template) repeatsOn(day time.Time, cal *quantifier.Calendar) bool {
+	if t.Repeat == "" {
+		return false
+	} else if t.Repeat == repeatWorkingDays {
+		return cal.IsWorkingDay(day)
+	}
+	if _, holiday := cal.Holiday(day); holiday {
+		return false
+	} else if _, off := cal.DayOff(day); off {
+		return false
+	}
+	days, err := repeatDays(t.Repeat)
+	return err == nil && days.IsWorkingDay(day)
+}
+
+// The templates which repeat, leaving out broken ones.
+func recurringTemplates(conf *config.Opts) []Template {
+	var templates []Template
+	for _, name := range conf.SectionNames(config.SectionTemplatePrefix) {
+		if t, err := Find(conf, name); err == nil && t.Repeat != "" {
+			templates = append(templates, t)
+		}
+	}
+	return templates
+}
+
+// Entries logged by the server from repeating templates, each once its time
+// is over. Days on which the server does not run at that time are left out.
+type recurring struct {
+	// No state required
+}
+
+func (r recurring) Next(conf *config.Opts, after time.Time) time.Time {
+	var next time.Time
+	for _, t := range recurringTemplates(conf) {
+		for _, day := range []time.Time{after, after.AddDate(0, 0, 1)} {
+			task, err := t.On(day)
+			if err != nil || !task.Ended.After(after) {
+				continue
+			}
+			if next.IsZero() || task.Ended.Before(next) {
+				next = task.Ended
+			}
+			break
+		}
+	}
+	return next
+}
+
+func (r recurring) Run(srv *server.Server) error {
+	srv.Lock()
+	defer srv.Unlock()
+	conf := srv.Config()
+	now := time.Now()
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(conf); err != nil {
+		return errors.Wrap(err, "Invalid calendar configuration")
+	}
+	day := cal.Day(now)
+	days, err := srv.Backend.DaysOff(day.Start, day.End)
+	if err != nil {
+		return errors.Wrap(err, "Failed to determine days off")
+	}
+	cal.AddDaysOff(days)
+	host, _ := os.Hostname()
+
+	for _, t := range recurringTemplates(conf) {
+		task, err := t.On(now)
+		if err != nil {
+			return err
+		} else if task.Ended.After(now) || !t.repeatsOn(now, cal) {
+			continue
+		}
+		task.Origin = msg.MakeOrigin(msg.OriginServer, host)
+		task.AddNote("logged automatically from template " + t.Name)
+		fingerprint := t.Name + "@" + now.Format("2006-01-02")
+		if _, err := srv.Backend.SaveImported(task, msg.SourceTemplate, fingerprint); err != nil {
+			return errors.Wrapf(err, "Failed to log template %s", t.Name)
+		}
+	}
+	return nil
+}
+
+func init() {
+	server.RegisterJob("recurring", recurring{})
+}
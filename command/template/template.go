@@ -0,0 +1,216 @@
+// Package template provides the template command, managing templates for
+// entries logged the same way again and again, see the apply command.
+package template
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+// Keys of a template, as parameters and in its section of the configuration
+// file.
+const (
+	paramTask     = "task"
+	paramDuration = "duration"
+	paramAt       = "at"
+	paramNote     = "note"
+	paramTags     = "tags"
+	paramRepeat   = "repeat"
+)
+
+const (
+	actionAdd  = "add"
+	actionList = "list"
+)
+
+// The layout of a template's start time.
+const atLayout = "15:04"
+
+// A Template describes a fixed block of time, logged on any day.
+type Template struct {
+	Name     string
+	Task     string
+	At       string // Time of day, as HH:MM
+	Duration time.Duration
+	Note     string
+	Tags     string
+	Repeat   string // When the server logs the entry on its own, if at all
+}
+
+// On gives the entry described by the template on the given day.
+func (t Template) On(day time.Time) (msg.Task, error) {
+	at, err := time.Parse(atLayout, t.At)
+	if err != nil {
+		return msg.Task{}, errors.Errorf("Invalid time in template %s: %s", t.Name, t.At)
+	}
+	y, m, d := day.Date()
+	task := msg.Task{Name: t.Task, HasEnded: true, Note: t.Note}
+	task.Started = time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, time.Local)
+	task.Ended = task.Started.Add(t.Duration)
+	if t.Tags != "" {
+		if task.Tags, err = argparse.GetTagNames(t.Tags); err != nil {
+			return task, err
+		}
+	}
+	return task, nil
+}
+
+// Find the template with the given name in the configuration.
+func Find(conf *config.Opts, name string) (Template, error) {
+	section := conf.Section(config.SectionTemplatePrefix + name)
+	if len(section) == 0 {
+		return Template{}, errors.Errorf("No such template: %s", name)
+	}
+	return parse(name, section)
+}
+
+// Read a template from its keys, checking that it describes an entry.
+func parse(name string, keys map[string]string) (Template, error) {
+	t := Template{Name: name, Task: keys[paramTask], At: keys[paramAt], Note: keys[paramNote], Tags: keys[paramTags],
+		Repeat: keys[paramRepeat]}
+	if names, err := argparse.GetTaskNames(t.Task); err != nil {
+		return t, err
+	} else if len(names) != 1 || names[0] == argparse.AllTasks {
+		return t, errors.Errorf("Require a single task for template %s", name)
+	}
+	if _, err := time.Parse(atLayout, t.At); err != nil {
+		return t, errors.Errorf("Require the time of day for template %s as HH:MM", name)
+	}
+	d, err := time.ParseDuration(keys[paramDuration])
+	if err != nil || d <= 0 {
+		return t, errors.Errorf("Require a positive duration for template %s", name)
+	}
+	t.Duration = d
+	if t.Tags != "" {
+		if _, err := argparse.GetTagNames(t.Tags); err != nil {
+			return t, err
+		}
+	}
+	if _, err := repeatDays(t.Repeat); err != nil {
+		return t, errors.Wrapf(err, "Invalid repetition for template %s", name)
+	}
+	return t, nil
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "template"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "<action>",
+			Description: "What to do: " + actionAdd + " or " + actionList,
+		},
+		argparse.Arg{
+			Name:        "[name]",
+			Description: "The name of the template to add",
+			Optional:    true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Option(paramTask, "<task>", "The task to log"),
+		argparse.Option(paramAt, "<HH:MM>", "When the entry starts"),
+		argparse.Option(paramDuration, "<duration>", "How long the entry lasts"),
+		argparse.Option(paramNote, "<text>", "Attach a note to the entry"),
+		argparse.Option(paramTags, "<tag,..>", "Tag the entry"),
+		argparse.Option(paramRepeat, "<days>", "Have the server log the entry on these days: "+
+			repeatDaily+", "+repeatWorkingDays+", or days of the week such as mon,thu"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Manage templates for recurring entries")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Add a template for an entry logged again and again, or list the templates"
+	footer := "Templates are logged on a given day with `tilo apply`. They are stored in the\n" +
+		"configuration file, in a section named after the template, e.g. [template.standup].\n" +
+		"Adding a template of the same name again changes the values given\n\n" +
+		"With :repeat, the server logs the entry on its own once its time is over, on\n" +
+		"the days given but not on holidays or days off, see `tilo off`. Such entries\n" +
+		"are logged at most once per day and noted as logged automatically\n\n" +
+		"Examples\n" +
+		"    tilo template add standup :task=meetings :duration=15m :at=09:30\n" +
+		"    tilo template add standup :repeat=working-days\n" +
+		"    tilo template list"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	conf := cl.Config()
+	switch cmd.Args[0] {
+	case actionAdd:
+		if len(cmd.Args) < 2 {
+			return errors.New("Require a name for the template")
+		} else if names, err := argparse.GetTaskNames(cmd.Args[1]); err != nil || len(names) != 1 {
+			return errors.Errorf("Invalid template name: %s", cmd.Args[1])
+		}
+		keys := make(map[string]string)
+		for _, key := range []string{paramTask, paramAt, paramDuration, paramNote, paramTags, paramRepeat} {
+			if value := cmd.Opts[key]; value != "" {
+				keys[key] = value
+			}
+		}
+		merged := make(map[string]string)
+		for key, value := range conf.Section(config.SectionTemplatePrefix + cmd.Args[1]) {
+			merged[key] = value
+		}
+		for key, value := range keys {
+			merged[key] = value
+		}
+		if _, err := parse(cmd.Args[1], merged); err != nil {
+			return err
+		}
+		if err := conf.SaveSection(config.SectionTemplatePrefix+cmd.Args[1], keys); err != nil {
+			return errors.Wrap(err, "Failed to save template")
+		}
+		cl.PrintMessage("Template saved: " + cmd.Args[1])
+	case actionList:
+		names := conf.SectionNames(config.SectionTemplatePrefix)
+		if len(names) == 0 {
+			cl.PrintMessage("No templates, add one with `tilo template add`")
+			return nil
+		}
+		var rows [][]string
+		for _, name := range names {
+			t, err := Find(conf, name)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, []string{t.Name, t.Task, t.At, t.Duration.String(), t.Repeat, t.Tags, t.Note})
+		}
+		resp := msg.Response{}
+		resp.AddTable([]string{"Template", "Task", "At", "Duration", "Repeat", "Tags", "Note"}, rows)
+		cl.PrintResponse(resp)
+		return cl.Error()
+	default:
+		return errors.Errorf("No such action: %s", cmd.Args[0])
+	}
+	return nil
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation: " + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
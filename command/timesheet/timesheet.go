@@ -0,0 +1,175 @@
+package timesheet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	cal *quantifier.Calendar
+}
+
+func (op operation) Command() string {
+	return "timesheet"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := append(query.PeriodParams(time.Now(), op.cal), query.MinParam())
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) Configure(conf *config.Opts) error {
+	return op.cal.Configure(conf)
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Show logged time as a timesheet grid")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Show the time logged in the given periods as a grid ready to be copied into a timesheet"
+	footer := "Each day of the period is a row, with a column for each booking code and the\n" +
+		"daily total, all in hours and minutes; the last row holds the totals per code\n\n" +
+		"Tasks are mapped to booking codes in the [codes] section of the configuration\n" +
+		"file, e.g. `backend = PRJ-1234`. Several tasks may share a code; tasks without\n" +
+		"a code get a column of their own, with a warning if any codes are configured\n\n" +
+		"Cells are rounded to the minute, totals are the sums of the rounded cells\n\n" +
+		"Examples\n" +
+		"    tilo timesheet :last-week                 # Last week, ready to be filled in\n" +
+		"    tilo timesheet :this-month :min=1m        # Leaving out accidental entries"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if len(cmd.Quantities) == 0 {
+		return errors.New("No period given")
+	} else if _, err := query.MinDuration(cmd); err != nil {
+		return err
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to create timesheet")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(srv.Config()); err != nil {
+		resp.SetError(errors.Wrap(err, "Invalid calendar configuration"))
+	} else if err := addTimesheets(srv, req.Cmd, cal, &resp); err != nil {
+		resp.SetError(errors.Wrap(err, "Failed to create timesheet"))
+	}
+	return srv.Answer(req, resp)
+}
+
+// Add a timesheet for each requested period to the response.
+func addTimesheets(srv *server.Server, cmd msg.Cmd, cal *quantifier.Calendar, resp *msg.Response) error {
+	min, err := query.MinDuration(cmd)
+	if err != nil {
+		return err
+	}
+	conf := srv.Config()
+	unmapped := make(map[string]bool)
+	for _, quant := range cmd.Quantities {
+		period, err := cal.Period(quant)
+		if err != nil {
+			return err
+		}
+		days, err := cal.Breakdown(period, quantifier.ByDay)
+		if err != nil {
+			return err
+		}
+
+		// Time per day and code, rounded to the minute
+		cells := make([]map[string]time.Duration, len(days))
+		known := make(map[string]bool)
+		for i, day := range days {
+			sum, err := srv.Backend.GetAllTasksBetween(day.Start, day.End, min)
+			if err != nil {
+				return err
+			}
+			cells[i] = make(map[string]time.Duration)
+			for _, s := range sum {
+				if s.Total <= 0 {
+					continue
+				}
+				code, ok := conf.BookingCode(s.Task)
+				if !ok {
+					unmapped[s.Task] = true
+				}
+				cells[i][code] += s.Total
+				known[code] = true
+			}
+			for code, d := range cells[i] {
+				cells[i][code] = d.Round(time.Minute)
+			}
+		}
+		var columns []string
+		for code := range known {
+			columns = append(columns, code)
+		}
+		sort.Strings(columns)
+
+		var rows [][]string
+		totals := make(map[string]time.Duration)
+		var total time.Duration
+		for i, day := range days {
+			row := []string{day.Start.Format("Mon 2006-01-02")}
+			var daily time.Duration
+			for _, code := range columns {
+				row = append(row, formatCell(cells[i][code]))
+				daily += cells[i][code]
+				totals[code] += cells[i][code]
+			}
+			total += daily
+			rows = append(rows, append(row, formatCell(daily)))
+		}
+		row := []string{"Total"}
+		for _, code := range columns {
+			row = append(row, formatCell(totals[code]))
+		}
+		rows = append(rows, append(row, formatCell(total)))
+
+		title := strings.Join(append([]string{"Timesheet", quant.Type}, quant.Elems...), " ")
+		header := append(append([]string{title}, columns...), "Total")
+		resp.AddTable(header, rows)
+	}
+	if conf.HasBookingCodes() {
+		resp.AddUnmappedTasks(sortedKeys(unmapped))
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Format a duration as hh:mm, marking empty cells with a dash.
+func formatCell(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func init() {
+	command.RegisterOperation(operation{quantifier.DefaultCalendar()})
+}
@@ -0,0 +1,113 @@
+package until
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramCancel = "cancel"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "until"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	args := []argparse.Arg{
+		argparse.Arg{
+			Name:        "[time]",
+			Description: "When to stop, as HH:MM today or a duration from now, e.g. 1h30m",
+			Optional:    true,
+		},
+	}
+	params := []argparse.Param{
+		argparse.Flag(paramCancel, "Remove the scheduled stop"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForArgsAndParams(args, params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Schedule the current task to stop")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Schedule the current task to be stopped and saved at a given time"
+	footer := "Scheduling again replaces a prior schedule; stopping the task removes it\n" +
+		"With parallel tasks, this applies to the most recently started one\n" +
+		"The scheduled time is shown by the `current` command\n\n" +
+		"Examples\n" +
+		"    tilo until 18:00     # Stop at 6pm\n" +
+		"    tilo until 45m       # Stop in 45 minutes\n" +
+		"    tilo until :cancel   # Keep running after all"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	if !cmd.Flags[paramCancel] {
+		if _, err := stopTime(cmd, time.Now()); err != nil {
+			return err
+		}
+	}
+	cl.SendReceivePrint(cmd)
+	return errors.Wrap(cl.Error(), "Failed to schedule stop")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	task := srv.CurrentTask()
+	if !task.IsRunning() {
+		resp.SetError(errors.New("No active task"))
+	} else if req.Cmd.Flags[paramCancel] {
+		if err := srv.CancelStop(task.Name); err != nil {
+			resp.SetError(err)
+		}
+	} else if at, err := stopTime(req.Cmd, time.Now()); err != nil {
+		resp.SetError(err)
+	} else if err := srv.ScheduleStop(task.Name, at); err != nil {
+		resp.SetError(err)
+	}
+	if !resp.Failed() {
+		resp.AddCurrentTask(srv.CurrentTask())
+	}
+	return srv.Answer(req, resp)
+}
+
+// The time to stop as given in the command, relative to now.
+func stopTime(cmd msg.Cmd, now time.Time) (time.Time, error) {
+	if len(cmd.Args) == 0 {
+		return now, errors.New("No time given")
+	}
+	arg := cmd.Args[0]
+	if d, err := time.ParseDuration(arg); err == nil {
+		if d <= 0 {
+			return now, errors.Errorf("Duration must be positive: %s", arg)
+		}
+		return now.Add(d).Truncate(time.Second), nil
+	}
+	clock, err := time.Parse("15:04", arg)
+	if err != nil {
+		return now, errors.Errorf("Not a time (HH:MM) or duration: %s", arg)
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !at.After(now) {
+		return now, errors.Errorf("%s has already passed", arg)
+	}
+	return at, nil
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
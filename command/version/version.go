@@ -0,0 +1,60 @@
+package version
+
+import (
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "version"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	return argparse.CommandParser(op.Command()).WithoutTask().WithoutParams()
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Show the client and server versions")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Show the release of this program and of the running server, if any"
+	footer := "No server is started to determine its version. All commands warn when client\n" +
+		"and server differ by more than a patch release, e.g. when a server started\n" +
+		"before an upgrade is still running. Use `tilo server restart` in that case"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	client := []string{"Client", msg.Release}
+	if !cl.ServerIsRunning() {
+		if cl.Failed() {
+			return errors.Wrap(cl.Error(), "Unable to determine the server version")
+		}
+		cl.PrintResponse(msg.Response{Status: msg.RespSuccess, Body: [][]string{client, {"Server", "not running"}}})
+		return cl.Error()
+	}
+	resp := cl.SendReceive(cmd)
+	resp.Body = append([][]string{client}, resp.Body...)
+	cl.PrintResponse(resp)
+	return errors.Wrap(cl.Error(), "Unable to determine the server version")
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.AddServerRelease()
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
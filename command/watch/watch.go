@@ -0,0 +1,185 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/client"
+	"github.com/fgahr/tilo/command"
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	paramInterval  = "interval"
+	paramAutoStart = "auto-start"
+	paramCommand   = "command"
+	paramOnce      = "once"
+)
+
+const defaultInterval = 30 * time.Second
+
+// A rule maps windows whose title or application matches a pattern to a task.
+type rule struct {
+	pattern *regexp.Regexp
+	task    string
+}
+
+type operation struct {
+	// No state required
+}
+
+func (op operation) Command() string {
+	return "watch"
+}
+
+func (op operation) Parser() *argparse.Parser {
+	params := []argparse.Param{
+		argparse.Option(paramInterval, "<duration>", "Time between samples, default 30s"),
+		argparse.Flag(paramAutoStart, "Start the matching task instead of suggesting it"),
+		argparse.Option(paramCommand, "<command>", "Shell command printing the focused window's application and title"),
+		argparse.Flag(paramOnce, "Print the focused window and matching task, then exit"),
+	}
+	return argparse.CommandParser(op.Command()).WithoutTask().
+		WithArgHandler(argparse.HandlerForParams(params))
+}
+
+func (op operation) DescribeShort() argparse.Description {
+	return op.Parser().Describe("Suggest tasks based on the focused window")
+}
+
+func (op operation) HelpHeaderAndFooter() (string, string) {
+	header := "Sample the focused window and, while no task is active, suggest or start a task for it"
+	footer := "Rules are defined in the [window_rules] section of the configuration file, each\n" +
+		"mapping a regular expression to a task. A rule applies if the pattern matches the\n" +
+		"window's title or application; if several apply, the alphabetically first pattern wins\n\n" +
+		"The focused window is determined via swaymsg on Sway, or xprop on X11. For other\n" +
+		"environments, give a command printing the application and title, separated by a tab\n\n" +
+		"Examples\n" +
+		"    [window_rules]\n" +
+		"    (?i)thesis.*\\.tex = thesis\n" +
+		"    ^Slack$ = communication\n\n" +
+		"    tilo watch :once                   # Check which rule applies to the focused window\n" +
+		"    tilo watch :auto-start :interval=1m"
+	return header, footer
+}
+
+func (op operation) ClientExec(cl *client.Client, cmd msg.Cmd) error {
+	cl.SetKind(msg.OriginAgent)
+	rules, err := windowRules(cl.Config())
+	if err != nil {
+		return err
+	}
+	interval := defaultInterval
+	if value, ok := cmd.Opts[paramInterval]; ok {
+		if interval, err = time.ParseDuration(value); err != nil || interval < time.Second {
+			return errors.Errorf("Invalid interval: %s", value)
+		}
+	}
+	sample := focusedWindow
+	if command := cmd.Opts[paramCommand]; command != "" {
+		sample = func() (window, error) { return commandWindow(command) }
+	}
+
+	if cmd.Flags[paramOnce] {
+		win, err := sample()
+		if err != nil {
+			return err
+		}
+		cl.PrintMessage(fmt.Sprintf("Application: %s\nTitle:       %s\nTask:        %s",
+			win.app, win.title, matchingTask(rules, win)))
+		return nil
+	}
+	if len(rules) == 0 {
+		return errors.New("No window rules configured, see `tilo watch --help`")
+	}
+	return watch(cl, rules, sample, interval, cmd.Flags[paramAutoStart])
+}
+
+// Sample the focused window until interrupted, acting on matching rules while
+// no task is active.
+func watch(cl *client.Client, rules []rule, sample func() (window, error), interval time.Duration, autoStart bool) error {
+	cl.StartSession()
+	// Act only once for each window focused, so that stopping a task is not
+	// immediately undone.
+	var handled window
+	for ; ; time.Sleep(interval) {
+		cl.Reset()
+		resp := cl.SendReceive(msg.Cmd{Op: "current"})
+		if cl.Failed() {
+			cl.PrintError(cl.Error())
+			continue
+		} else if !resp.Failed() {
+			// A task is active, nothing to suggest
+			continue
+		}
+		win, err := sample()
+		if err != nil {
+			cl.PrintError(err)
+			continue
+		}
+		task := matchingTask(rules, win)
+		if task == "" || win == handled {
+			continue
+		}
+		handled = win
+		if autoStart {
+			cl.Execute([]string{"start", task})
+		} else {
+			cl.PrintMessage(fmt.Sprintf("%s  Focused on %q, start with: tilo start %s",
+				time.Now().Format("15:04"), win.title, task))
+		}
+	}
+}
+
+// The rules from the configuration, in alphabetical order of their patterns.
+func windowRules(conf *config.Opts) ([]rule, error) {
+	section := conf.Section(config.SectionWindowRules)
+	var patterns []string
+	for pattern := range section {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var rules []rule
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid window rule: %s", pattern)
+		}
+		task := section[pattern]
+		if tasks, err := argparse.GetTaskNames(task); err != nil {
+			return nil, err
+		} else if len(tasks) != 1 || tasks[0] == argparse.AllTasks {
+			return nil, errors.Errorf("Window rule requires a single task, got %s", task)
+		}
+		rules = append(rules, rule{re, task})
+	}
+	return rules, nil
+}
+
+// The task for the first rule matching the window, empty if none does.
+func matchingTask(rules []rule, win window) string {
+	for _, r := range rules {
+		if r.pattern.MatchString(win.title) || (win.app != "" && r.pattern.MatchString(win.app)) {
+			return r.task
+		}
+	}
+	return ""
+}
+
+func (op operation) ServerExec(srv *server.Server, req *server.Request) error {
+	defer req.Close()
+	resp := msg.Response{}
+	resp.SetError(errors.New("Not a valid server operation:" + op.Command()))
+	return srv.Answer(req, resp)
+}
+
+func init() {
+	command.RegisterOperation(operation{})
+}
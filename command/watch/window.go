@@ -0,0 +1,118 @@
+package watch
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The focused window, as far as it can be determined.
+type window struct {
+	app   string
+	title string
+}
+
+// Determine the focused window using the tools of the running desktop.
+func focusedWindow() (window, error) {
+	if os.Getenv("SWAYSOCK") != "" {
+		return swayWindow()
+	} else if os.Getenv("DISPLAY") != "" {
+		return x11Window()
+	}
+	return window{}, errors.New("Unable to determine the focused window: no supported desktop, use :command")
+}
+
+// Run a user-defined command printing the application and title, separated
+// by a tab, or just the title.
+func commandWindow(command string) (window, error) {
+	out, err := exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		return window{}, errors.Wrapf(err, "Failed to run %s", command)
+	}
+	line := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if parts := strings.SplitN(line, "\t", 2); len(parts) == 2 {
+		return window{app: parts[0], title: parts[1]}, nil
+	}
+	return window{title: line}, nil
+}
+
+// A node in the tree reported by swaymsg.
+type swayNode struct {
+	Name     string     `json:"name"`
+	AppID    string     `json:"app_id"`
+	Focused  bool       `json:"focused"`
+	Props    swayProps  `json:"window_properties"`
+	Nodes    []swayNode `json:"nodes"`
+	Floating []swayNode `json:"floating_nodes"`
+}
+
+// Properties of X11 windows running under Xwayland.
+type swayProps struct {
+	Class string `json:"class"`
+}
+
+func swayWindow() (window, error) {
+	out, err := exec.Command("swaymsg", "-t", "get_tree").Output()
+	if err != nil {
+		return window{}, errors.Wrap(err, "Failed to query sway")
+	}
+	var root swayNode
+	if err := json.Unmarshal(out, &root); err != nil {
+		return window{}, errors.Wrap(err, "Unexpected output from swaymsg")
+	}
+	if node, ok := focusedNode(root); ok {
+		app := node.AppID
+		if app == "" {
+			app = node.Props.Class
+		}
+		return window{app: app, title: node.Name}, nil
+	}
+	return window{}, errors.New("No focused window")
+}
+
+func focusedNode(node swayNode) (swayNode, bool) {
+	if node.Focused {
+		return node, true
+	}
+	for _, children := range [][]swayNode{node.Nodes, node.Floating} {
+		for _, child := range children {
+			if found, ok := focusedNode(child); ok {
+				return found, true
+			}
+		}
+	}
+	return swayNode{}, false
+}
+
+var (
+	xActiveWindow = regexp.MustCompile(`window id # (0x[0-9a-f]+)`)
+	xClass        = regexp.MustCompile(`WM_CLASS\(STRING\) = "[^"]*", "([^"]*)"`)
+	xTitle        = regexp.MustCompile(`_NET_WM_NAME\(UTF8_STRING\) = "(.*)"`)
+)
+
+func x11Window() (window, error) {
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return window{}, errors.Wrap(err, "Failed to query X11")
+	}
+	match := xActiveWindow.FindSubmatch(out)
+	if match == nil || string(match[1]) == "0x0" {
+		return window{}, errors.New("No focused window")
+	}
+	out, err = exec.Command("xprop", "-id", string(match[1]), "WM_CLASS", "_NET_WM_NAME").Output()
+	if err != nil {
+		return window{}, errors.Wrap(err, "Failed to query X11")
+	}
+	var win window
+	if m := xClass.FindSubmatch(out); m != nil {
+		win.app = string(m[1])
+	}
+	if m := xTitle.FindSubmatch(out); m != nil {
+		win.title = strings.Replace(string(m[1]), `\"`, `"`, -1)
+	}
+	return win, nil
+}
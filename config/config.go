@@ -11,7 +11,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -22,6 +25,22 @@ const (
 	LOG_TRACE = "trace"
 )
 
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+const (
+	OVERLONG_STOP  = "stop"
+	OVERLONG_ABORT = "abort"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_CSV   = "csv"
+)
+
 func logLevel(description string) int {
 	switch description {
 	case LOG_OFF:
@@ -39,9 +58,63 @@ func logLevel(description string) int {
 	}
 }
 
+// IsLogLevel determines whether the description names a log level, e.g. debug.
+func IsLogLevel(description string) bool {
+	switch description {
+	case LOG_OFF, LOG_WARN, LOG_INFO, LOG_DEBUG, LOG_TRACE:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ways of handling tasks stopped before reaching discard_under.
+const (
+	DISCARD_ASK      = "ask"
+	DISCARD_SILENTLY = "silently"
+)
+
+// Where the value of an item comes from, see Source.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "environment"
+	SourceArgs    = "command line"
+)
+
+// Sections of the configuration file.
+const (
+	SectionPeriods  = "periods"
+	SectionHolidays = "holidays"
+	// Expected working time for specific days of the week
+	SectionWeekdayHours = "weekday_hours"
+	// Prefix for sections holding named import presets, e.g. [import.name]
+	SectionImportPrefix = "import."
+	// Prefix for sections holding named entry templates, e.g. [template.name]
+	SectionTemplatePrefix = "template."
+	// Patterns for window titles or applications, each mapped to a task
+	SectionWindowRules = "window_rules"
+	// Patterns for git branch names, each mapped to a task
+	SectionBranchRules = "branch_rules"
+	// Remote target, schedule and retention of backups
+	SectionBackup = "backup"
+	// Booking codes, each mapped from a task
+	SectionCodes = "codes"
+	// Site categories, each mapped from a domain
+	SectionSites = "sites"
+	// Target and schedule for pushing daily totals to a time-series database
+	SectionMetrics = "metrics"
+	// Broker and topics for announcing the current task over MQTT
+	SectionMQTT = "mqtt"
+	// Break required per day, each mapped from the time worked
+	SectionBreakRules = "break_rules"
+)
+
 const (
 	ENV_VAR_PREFIX = "__TILO_"
 	CLI_VAR_PREFIX = "--"
+	// Not a configuration parameter, passed on to the command instead.
+	CLI_HELP = "--help"
 )
 
 type taggedString struct {
@@ -50,14 +123,16 @@ type taggedString struct {
 }
 
 type rawConf struct {
-	values map[string]string
-	inUse  map[string]bool
+	values   map[string]string
+	inUse    map[string]bool
+	sections map[string]map[string]string
 }
 
 func makeRawConf() rawConf {
 	values := make(map[string]string)
 	inUse := make(map[string]bool)
-	return rawConf{values: values, inUse: inUse}
+	sections := make(map[string]map[string]string)
+	return rawConf{values: values, inUse: inUse, sections: sections}
 }
 
 // TODO: Add Description field for help messages?
@@ -92,6 +167,78 @@ type Opts struct {
 	Backend Item
 	// Determines the amount of additional log output.
 	LogLevel Item
+	// The format of server log lines, text or json.
+	LogFormat Item
+	// The first day of the fiscal year, as MM-DD.
+	FiscalYearStart Item
+	// The days of the week on which work is expected.
+	WorkingDays Item
+	// The working time expected on each working day.
+	ExpectedHours Item
+	// Whether several tasks may be active at the same time.
+	AllowParallel Item
+	// The directory holding backups.
+	BackupDir Item
+	// Stopped tasks which ran for less than this are not saved.
+	DiscardUnder Item
+	// Whether to ask before discarding a short task, or discard it silently.
+	DiscardShort Item
+	// The time of day (HH:MM) at which active tasks are saved and restarted.
+	Rollover Item
+	// The time of day (HH:MM) at which days start for queries and reports.
+	DayStart Item
+	// The address (host:port) on which to serve HTTP; empty if not at all.
+	HTTPListen Item
+	// Web origins allowed to access the HTTP endpoints from a browser, besides
+	// the server's own, separated by comma; * for all.
+	HTTPOrigins Item
+	// The token a browser extension presents to use the browser API; the
+	// API is disabled if empty.
+	BrowserToken Item
+	// The token editor extensions present to use the editor API; the API is
+	// disabled if empty.
+	EditorToken Item
+	// How long clients wait for a response, e.g. 30s; without limit if empty.
+	RequestTimeout Item
+	// How long clients wait for a server they start to accept connections.
+	StartTimeout Item
+	// How long a server started by a client may be idle before it shuts
+	// down, e.g. 4h; running until stopped if empty.
+	IdleShutdown Item
+	// The address (host:port) on which the server accepts clients over TCP,
+	// besides the socket; not at all if empty.
+	ListenAddr Item
+	// The address (host:port) of a server to connect to over TCP instead of
+	// the socket, e.g. on another machine.
+	ServerAddr Item
+	// The token clients present when connecting over TCP. Required to
+	// accept clients over TCP at all.
+	ServerToken Item
+	// How clients print results: table, json or csv.
+	Output Item
+	// Whether clients restart a server of an older release, handing over
+	// active tasks.
+	AutoUpgrade Item
+	// How long a task may run before the server stops it, e.g. 10h; without
+	// limit if empty.
+	MaxTaskDuration Item
+	// Whether tasks running too long are saved up to the limit (stop) or
+	// not at all (abort), until decided otherwise.
+	OverlongAction Item
+	// A command run by the server, via sh -c, when it stops a task for
+	// running too long.
+	IdleCommand Item
+	// The directory holding the default socket; the user's runtime directory
+	// or else the system's temporary one if empty.
+	TempDir Item
+	// Free-form sections of the configuration file, by name.
+	sections map[string]map[string]string
+	// Values set from the environment or command line, by name in the
+	// environment.
+	overrides map[string]string
+	// The source of each value not left at its default, by name in the
+	// environment.
+	sources map[string]string
 }
 
 type BackendConfig interface {
@@ -131,6 +278,10 @@ func GetConfig(args []string, env []string) (*Opts, []string, error) {
 	apply(conf.AcceptedItems(), fromFile, nameInFile)
 	apply(conf.AcceptedItems(), fromEnv, nameInEnv)
 	apply(conf.AcceptedItems(), fromArgs, nameInArgs)
+	conf.sections = fromFile.sections
+	if conf.Socket.Value == "" {
+		conf.Socket.Value = defaultSocket(conf.TempDir.Value)
+	}
 
 	// Build up the backend configuration.
 	if bc := backendConfigs[conf.Backend.Value]; bc == nil {
@@ -143,6 +294,23 @@ func GetConfig(args []string, env []string) (*Opts, []string, error) {
 
 	warnUnused(fromFile, fromEnv, fromArgs)
 
+	conf.overrides = make(map[string]string)
+	conf.sources = make(map[string]string)
+	items := append(conf.AcceptedItems(), backendConfigs[conf.Backend.Value].AcceptedItems()...)
+	for _, item := range items {
+		if fromEnv.inUse[nameInEnv(item)] || fromArgs.inUse[nameInArgs(item)] {
+			conf.overrides[nameInEnv(item)] = item.Value
+		}
+		switch {
+		case fromArgs.inUse[nameInArgs(item)]:
+			conf.sources[nameInEnv(item)] = SourceArgs
+		case fromEnv.inUse[nameInEnv(item)]:
+			conf.sources[nameInEnv(item)] = SourceEnv
+		case fromFile.inUse[nameInFile(item)]:
+			conf.sources[nameInEnv(item)] = SourceFile
+		}
+	}
+
 	return conf, unused, nil
 }
 
@@ -170,18 +338,84 @@ func warn(message ...interface{}) {
 	fmt.Fprintln(os.Stderr, message...)
 }
 
+// The default socket, in the given temporary directory if set, otherwise in
+// the user's runtime directory if there is one. It is private to the user
+// and keeps the path short, unlike some temporary directories. Otherwise in a
+// per-user directory in the system's temporary one.
+func defaultSocket(tempDir string) string {
+	if tempDir != "" {
+		return filepath.Join(tempDir, fmt.Sprintf("%s%d", "tilo", os.Getuid()), "server")
+	}
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		if info, err := os.Stat(runtime); err == nil && info.IsDir() {
+			return filepath.Join(runtime, "tilo", "server")
+		}
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s%d", "tilo", os.Getuid()), "server")
+}
+
 // Create a set of default parameters.
 func defaultConfig() *Opts {
-	socket := filepath.Join(os.TempDir(), fmt.Sprintf("%s%d", "tilo", os.Getuid()), "server")
 	// There's nothing we can do with an error here so we ignore it.
 	homeDir, _ := os.UserHomeDir()
 	confFile := filepath.Join(homeDir, ".config", "tilo", "config")
 	return &Opts{
 		ConfFile: Item{InFile: "", InArgs: "conf-file", InEnv: "CONF_FILE", Value: confFile},
-		Socket:   Item{InFile: "socket", InArgs: "socket", InEnv: "SOCKET", Value: socket},
+		// Depends on the temporary directory, determined once it is known
+		Socket:   Item{InFile: "socket", InArgs: "socket", InEnv: "SOCKET", Value: ""},
 		Protocol: Item{InFile: "protocol", InArgs: "protocol", InEnv: "PROTOCOL", Value: "unix"},
 		Backend:  Item{InFile: "backend", InArgs: "backend", InEnv: "BACKEND", Value: "sqlite3"},
 		LogLevel: Item{InFile: "log_level", InArgs: "log-level", InEnv: "LOG_LEVEL", Value: LOG_INFO},
+		LogFormat: Item{
+			InFile: "log_format", InArgs: "log-format", InEnv: "LOG_FORMAT", Value: LOG_FORMAT_TEXT},
+		FiscalYearStart: Item{
+			InFile: "fiscal_year_start", InArgs: "fiscal-year-start", InEnv: "FISCAL_YEAR_START", Value: "01-01"},
+		WorkingDays: Item{
+			InFile: "working_days", InArgs: "working-days", InEnv: "WORKING_DAYS", Value: "mon,tue,wed,thu,fri"},
+		ExpectedHours: Item{
+			InFile: "expected_hours", InArgs: "expected-hours", InEnv: "EXPECTED_HOURS", Value: "8h"},
+		AllowParallel: Item{
+			InFile: "allow_parallel", InArgs: "allow-parallel", InEnv: "ALLOW_PARALLEL", Value: "false"},
+		BackupDir: Item{
+			InFile: "backup_dir", InArgs: "backup-dir", InEnv: "BACKUP_DIR",
+			Value: filepath.Join(homeDir, ".config", "tilo", "backups")},
+		DiscardUnder: Item{
+			InFile: "discard_under", InArgs: "discard-under", InEnv: "DISCARD_UNDER", Value: "0s"},
+		DiscardShort: Item{
+			InFile: "discard_short", InArgs: "discard-short", InEnv: "DISCARD_SHORT", Value: DISCARD_ASK},
+		Rollover: Item{InFile: "rollover", InArgs: "rollover", InEnv: "ROLLOVER", Value: ""},
+		DayStart: Item{InFile: "day_start", InArgs: "day-start", InEnv: "DAY_START", Value: "00:00"},
+		HTTPListen: Item{
+			InFile: "http_listen", InArgs: "http-listen", InEnv: "HTTP_LISTEN", Value: ""},
+		HTTPOrigins: Item{
+			InFile: "http_origins", InArgs: "http-origins", InEnv: "HTTP_ORIGINS", Value: ""},
+		BrowserToken: Item{
+			InFile: "browser_token", InArgs: "browser-token", InEnv: "BROWSER_TOKEN", Value: ""},
+		EditorToken: Item{
+			InFile: "editor_token", InArgs: "editor-token", InEnv: "EDITOR_TOKEN", Value: ""},
+		RequestTimeout: Item{
+			InFile: "request_timeout", InArgs: "request-timeout", InEnv: "REQUEST_TIMEOUT", Value: ""},
+		StartTimeout: Item{
+			InFile: "start_timeout", InArgs: "start-timeout", InEnv: "START_TIMEOUT", Value: "5s"},
+		IdleShutdown: Item{
+			InFile: "idle_shutdown", InArgs: "idle-shutdown", InEnv: "IDLE_SHUTDOWN", Value: ""},
+		ListenAddr: Item{
+			InFile: "listen_addr", InArgs: "listen-addr", InEnv: "LISTEN_ADDR", Value: ""},
+		ServerAddr: Item{
+			InFile: "server_addr", InArgs: "server-addr", InEnv: "SERVER_ADDR", Value: ""},
+		ServerToken: Item{
+			InFile: "server_token", InArgs: "server-token", InEnv: "SERVER_TOKEN", Value: ""},
+		Output: Item{
+			InFile: "output", InArgs: "output", InEnv: "OUTPUT", Value: OUTPUT_TABLE},
+		AutoUpgrade: Item{
+			InFile: "auto_upgrade", InArgs: "auto-upgrade", InEnv: "AUTO_UPGRADE", Value: "false"},
+		MaxTaskDuration: Item{
+			InFile: "max_task_duration", InArgs: "max-task-duration", InEnv: "MAX_TASK_DURATION", Value: ""},
+		OverlongAction: Item{
+			InFile: "overlong_action", InArgs: "overlong-action", InEnv: "OVERLONG_ACTION", Value: OVERLONG_STOP},
+		IdleCommand: Item{
+			InFile: "idle_command", InArgs: "idle-command", InEnv: "IDLE_COMMAND", Value: ""},
+		TempDir: Item{InFile: "temp_dir", InArgs: "temp-dir", InEnv: "TEMP_DIR", Value: ""},
 	}
 }
 
@@ -192,7 +426,417 @@ func (c *Opts) AcceptedItems() []*Item {
 		&c.Protocol,
 		&c.Backend,
 		&c.LogLevel,
+		&c.LogFormat,
+		&c.FiscalYearStart,
+		&c.WorkingDays,
+		&c.ExpectedHours,
+		&c.AllowParallel,
+		&c.BackupDir,
+		&c.DiscardUnder,
+		&c.DiscardShort,
+		&c.Rollover,
+		&c.DayStart,
+		&c.HTTPListen,
+		&c.HTTPOrigins,
+		&c.BrowserToken,
+		&c.EditorToken,
+		&c.RequestTimeout,
+		&c.StartTimeout,
+		&c.IdleShutdown,
+		&c.ListenAddr,
+		&c.ServerAddr,
+		&c.ServerToken,
+		&c.Output,
+		&c.AutoUpgrade,
+		&c.MaxTaskDuration,
+		&c.OverlongAction,
+		&c.IdleCommand,
+		&c.TempDir,
+	}
+}
+
+// ParallelTasks determines whether several tasks may be active at once.
+func (c *Opts) ParallelTasks() bool {
+	allow, _ := strconv.ParseBool(c.AllowParallel.Value)
+	return allow
+}
+
+// UpgradeServer determines whether clients restart a server of an older
+// release.
+func (c *Opts) UpgradeServer() bool {
+	upgrade, _ := strconv.ParseBool(c.AutoUpgrade.Value)
+	return upgrade
+}
+
+// TaskLimit gives how long a task may run before the server stops it, 0 if
+// without limit.
+func (c *Opts) TaskLimit() time.Duration {
+	max, err := time.ParseDuration(c.MaxTaskDuration.Value)
+	if err != nil || max < 0 {
+		return 0
+	}
+	return max
+}
+
+// AbortOverlong determines whether tasks running too long are not saved
+// until decided otherwise.
+func (c *Opts) AbortOverlong() bool {
+	return c.OverlongAction.Value == OVERLONG_ABORT
+}
+
+// DiscardThreshold gives the duration below which stopped tasks are not
+// saved, 0 if all are saved.
+func (c *Opts) DiscardThreshold() time.Duration {
+	threshold, err := time.ParseDuration(c.DiscardUnder.Value)
+	if err != nil || threshold < 0 {
+		return 0
+	}
+	return threshold
+}
+
+// Timeout gives how long clients wait for a response, 0 if without limit.
+func (c *Opts) Timeout() time.Duration {
+	timeout, err := time.ParseDuration(c.RequestTimeout.Value)
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// ServerStartTimeout gives how long clients wait for a server they start.
+func (c *Opts) ServerStartTimeout() time.Duration {
+	timeout, err := time.ParseDuration(c.StartTimeout.Value)
+	if err != nil || timeout <= 0 {
+		return 5 * time.Second
+	}
+	return timeout
+}
+
+// IdleShutdownAfter gives how long a server started by a client may be idle
+// before it shuts down, 0 if it keeps running.
+func (c *Opts) IdleShutdownAfter() time.Duration {
+	after, err := time.ParseDuration(c.IdleShutdown.Value)
+	if err != nil || after < 0 {
+		return 0
+	}
+	return after
+}
+
+// RemoteServer determines whether clients connect to a server over TCP rather
+// than through the socket. Such a server is not started by clients.
+func (c *Opts) RemoteServer() bool {
+	return c.ServerAddr.Value != ""
+}
+
+// DiscardSilently determines whether short tasks are discarded without
+// asking.
+func (c *Opts) DiscardSilently() bool {
+	return c.DiscardShort.Value == DISCARD_SILENTLY
+}
+
+// Section gives the key-value pairs in the section of the configuration file
+// with the given name. The result is empty if the section does not exist.
+func (c *Opts) Section(name string) map[string]string {
+	if section, ok := c.sections[name]; ok {
+		return section
+	}
+	return make(map[string]string)
+}
+
+// SectionNames gives the names of the sections starting with the given
+// prefix, without it, in alphabetical order.
+func (c *Opts) SectionNames(prefix string) []string {
+	var names []string
+	for name := range c.sections {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, strings.TrimPrefix(name, prefix))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BookingCode gives the code a task is booked under in corporate reporting,
+// as mapped in the codes section. Without a code, the task's name is used.
+func (c *Opts) BookingCode(task string) (string, bool) {
+	if code := c.Section(SectionCodes)[task]; code != "" {
+		return code, true
+	}
+	return task, false
+}
+
+// HasBookingCodes determines whether any tasks are mapped to booking codes.
+func (c *Opts) HasBookingCodes() bool {
+	return len(c.Section(SectionCodes)) > 0
+}
+
+// SiteCategory gives the category of a site, as mapped in the sites section
+// from its domain or any domain above it, e.g. from github.com for
+// gist.github.com.
+func (c *Opts) SiteCategory(host string) (string, bool) {
+	sites := c.Section(SectionSites)
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for host != "" {
+		if category := sites[host]; category != "" {
+			return category, true
+		}
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return "", false
+}
+
+// OriginAllowed determines whether a browser page from the given web origin,
+// e.g. http://localhost:3000, may access the HTTP endpoints.
+func (c *Opts) OriginAllowed(origin string) bool {
+	for _, allowed := range strings.Split(c.HTTPOrigins.Value, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || (allowed != "" && allowed == origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveSection appends a section with the given name and key-value pairs to
+// the configuration file. Keys already present in a section of the same name
+// are overridden, since later lines take precedence.
+func (c *Opts) SaveSection(name string, values map[string]string) error {
+	var keys []string
+	for key, value := range values {
+		if strings.ContainsAny(key+value, "=#[]\n") || strings.TrimSpace(key) == "" {
+			return errors.Errorf("Cannot save to configuration file: %s = %s", key, value)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	content := fmt.Sprintf("\n[%s]\n", name)
+	for _, key := range keys {
+		content += fmt.Sprintf("%s = \"%s\"\n", key, values[key])
 	}
+
+	if err := os.MkdirAll(c.ConfigDir(), 0700); err != nil {
+		return errors.Wrap(err, "Unable to create configuration directory")
+	}
+	file, err := os.OpenFile(c.ConfFile.Value, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Unable to open configuration file")
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		return errors.Wrap(err, "Unable to write configuration file")
+	}
+
+	if c.sections == nil {
+		c.sections = make(map[string]map[string]string)
+	}
+	if c.sections[name] == nil {
+		c.sections[name] = make(map[string]string)
+	}
+	for key, value := range values {
+		c.sections[name][key] = value
+	}
+	return nil
+}
+
+// Source tells where the item's value comes from, one of the Source
+// constants.
+func (c *Opts) Source(item *Item) string {
+	if source, ok := c.sources[nameInEnv(item)]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// SaveValue sets an item in the configuration file, replacing any prior
+// value; an empty value removes it, restoring the default. A new value takes
+// effect at once unless the item is set from the environment or command line.
+func (c *Opts) SaveValue(key string, value string) error {
+	item := c.itemInFile(key)
+	if item == nil {
+		return errors.Errorf("No such setting: %s", key)
+	} else if strings.ContainsAny(value, "#\"\n") {
+		return errors.Errorf("Cannot save to configuration file: %s = %s", key, value)
+	} else if err := c.checkValue(item, value); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(c.ConfFile.Value)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Unable to read configuration file")
+	}
+
+	// A prior value is replaced where it was, a new one is added before the
+	// first section.
+	var lines []string
+	at, section := -1, -1
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			trimmed := strings.TrimSpace(strings.Split(line, "#")[0])
+			if section < 0 && strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+				section = len(lines)
+			}
+			if rawKey, _ := splitKeyValue(trimmed); section < 0 && strings.TrimSpace(rawKey) == key {
+				if at < 0 {
+					at = len(lines)
+				}
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	if at < 0 && section >= 0 {
+		for at = section; at > 0 && strings.TrimSpace(lines[at-1]) == ""; at-- {
+		}
+	} else if at < 0 {
+		at = len(lines)
+	}
+	if value != "" {
+		line := fmt.Sprintf("%s = \"%s\"", key, value)
+		lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+	}
+
+	if err := os.MkdirAll(c.ConfigDir(), 0700); err != nil {
+		return errors.Wrap(err, "Unable to create configuration directory")
+	}
+	err = ioutil.WriteFile(c.ConfFile.Value, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		return errors.Wrap(err, "Unable to write configuration file")
+	}
+	if _, overridden := c.overrides[nameInEnv(item)]; !overridden && value != "" {
+		if c.sources == nil {
+			c.sources = make(map[string]string)
+		}
+		item.Value = value
+		c.sources[nameInEnv(item)] = SourceFile
+	}
+	return nil
+}
+
+// Check a value for an item taking one of a few choices.
+func (c *Opts) checkValue(item *Item, value string) error {
+	var choices []string
+	switch item {
+	case &c.Backend:
+		choices = BackendNames()
+	case &c.LogLevel:
+		choices = []string{LOG_OFF, LOG_WARN, LOG_INFO, LOG_DEBUG, LOG_TRACE}
+	case &c.LogFormat:
+		choices = []string{LOG_FORMAT_TEXT, LOG_FORMAT_JSON}
+	case &c.Output:
+		choices = []string{OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_CSV}
+	case &c.OverlongAction:
+		choices = []string{OVERLONG_STOP, OVERLONG_ABORT}
+	case &c.DiscardShort:
+		choices = []string{DISCARD_ASK, DISCARD_SILENTLY}
+	default:
+		return nil
+	}
+	for _, choice := range choices {
+		if value == "" || value == choice {
+			return nil
+		}
+	}
+	return errors.Errorf("Invalid value for %s: %s, choose from %s", item.InFile, value, strings.Join(choices, ", "))
+}
+
+// The item with the given name in the configuration file, of any backend;
+// nil if there is none.
+func (c *Opts) itemInFile(key string) *Item {
+	items := c.AcceptedItems()
+	for _, name := range BackendNames() {
+		items = append(items, BackendItems(name)...)
+	}
+	for _, item := range items {
+		if item.InFile != "" && item.InFile == key {
+			return item
+		}
+	}
+	return nil
+}
+
+// WriteFile replaces the configuration file with one holding the given items,
+// e.g. as chosen in an interactive setup.
+func (c *Opts) WriteFile(items []*Item) error {
+	content := "# tilo configuration, see `tilo help` for what can be changed\n\n"
+	for _, item := range items {
+		if item.InFile == "" || strings.ContainsAny(item.Value, "#\"\n") {
+			return errors.Errorf("Cannot save to configuration file: %s = %s", item.InFile, item.Value)
+		}
+		content += fmt.Sprintf("%s = \"%s\"\n", item.InFile, item.Value)
+	}
+	if err := os.MkdirAll(c.ConfigDir(), 0700); err != nil {
+		return errors.Wrap(err, "Unable to create configuration directory")
+	}
+	err := ioutil.WriteFile(c.ConfFile.Value, []byte(content), 0600)
+	return errors.Wrap(err, "Unable to write configuration file")
+}
+
+// BackendNames gives the names of all registered backends, sorted.
+func BackendNames() []string {
+	var names []string
+	for name := range backendConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BackendItems gives the configuration items of the backend with the given
+// name, nil if there is no such backend.
+func BackendItems(name string) []*Item {
+	if bc := backendConfigs[name]; bc != nil {
+		return bc.AcceptedItems()
+	}
+	return nil
+}
+
+// Items which only take effect when the server starts, see Reload.
+func (c *Opts) fixedItems() []*Item {
+	return []*Item{&c.ConfFile, &c.Socket, &c.Protocol, &c.Backend, &c.HTTPListen, &c.ListenAddr}
+}
+
+// Reload re-reads the configuration as GetConfig does, taking over changes
+// which can take effect at once, including those of sections. Changes to the
+// socket, backend or listening addresses are left for the next server start.
+// Gives the names of changed items and sections, and of those left.
+func (c *Opts) Reload(args []string, env []string) ([]string, []string, error) {
+	fresh, _, err := GetConfig(args, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	fixed := make(map[*Item]bool)
+	for _, item := range c.fixedItems() {
+		fixed[item] = true
+	}
+
+	var applied, left []string
+	current, changed := c.AcceptedItems(), fresh.AcceptedItems()
+	for i, item := range current {
+		if item.Value == changed[i].Value {
+			continue
+		} else if fixed[item] {
+			left = append(left, nameInFile(item))
+			continue
+		}
+		item.Value = changed[i].Value
+		applied = append(applied, nameInFile(item))
+	}
+	for name, section := range fresh.sections {
+		if !reflect.DeepEqual(section, c.sections[name]) {
+			applied = append(applied, "["+name+"]")
+		}
+	}
+	for name := range c.sections {
+		if _, ok := fresh.sections[name]; !ok {
+			applied = append(applied, "["+name+"]")
+		}
+	}
+	c.sections = fresh.sections
+	sort.Strings(applied)
+	return applied, left, nil
 }
 
 func (c *Opts) ConfigDir() string {
@@ -203,6 +847,12 @@ func (c *Opts) SocketDir() string {
 	return filepath.Dir(c.Socket.Value)
 }
 
+// DefaultSocket determines whether the socket is the default one, in a
+// directory meant to be private to the user.
+func (c *Opts) DefaultSocket() bool {
+	return c.Socket.Value == defaultSocket(c.TempDir.Value)
+}
+
 func (c *Opts) ShouldLogAny() bool {
 	return c.logLevel() > logLevel(LOG_OFF)
 }
@@ -223,25 +873,34 @@ func (c *Opts) ShouldLogTrace() bool {
 	return c.logLevel() >= logLevel(LOG_TRACE)
 }
 
+// LogJSON determines whether the server logs one JSON object per line rather
+// than free text.
+func (c *Opts) LogJSON() bool {
+	return c.LogFormat.Value == LOG_FORMAT_JSON
+}
+
 func (c *Opts) logLevel() int {
 	return logLevel(c.LogLevel.Value)
 }
 
-// Emit the configuration in a format suitable as environment variables.
+// Emit the items set from the environment or command line, overriding the
+// configuration file, in a format suitable as environment variables.
 func (c *Opts) AsEnvKeyValue() []string {
-	v := reflect.ValueOf(*c)
-	result := make([]string, v.NumField())
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i)
-		tag := fieldInfo.Tag
-		name := tag.Get("env")
-		result[i] = fmt.Sprintf("%s%s=%v", ENV_VAR_PREFIX, name, v.Field(i))
-
+	var keys []string
+	for key := range c.overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var result []string
+	for _, key := range keys {
+		result = append(result, ENV_VAR_PREFIX+key+"="+c.overrides[key])
 	}
 	return result
 }
 
 // Take a list of environment-compatible key=value pairs and add tilo-options.
+// A process started with the result, e.g. a server, arrives at the same
+// configuration, and picks up later changes to the configuration file.
 func (c *Opts) MergeIntoEnv(env []string) []string {
 	var result []string
 	for _, keyValuePair := range env {
@@ -255,6 +914,7 @@ func (c *Opts) MergeIntoEnv(env []string) []string {
 }
 
 // Read configuration from a config file.
+// Keys following a line of the form [name] belong to the section of that name.
 func FromFile(configFile string) (rawConf, error) {
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
 		return rawConf{}, nil
@@ -263,6 +923,7 @@ func FromFile(configFile string) (rawConf, error) {
 	data, _ := ioutil.ReadFile(configFile)
 	asString := string(data)
 	lines := strings.Split(asString, "\n")
+	var section map[string]string
 	for i, fullLine := range lines {
 		lnum := i + 1
 		line := strings.Split(fullLine, "#")[0]
@@ -270,13 +931,28 @@ func FromFile(configFile string) (rawConf, error) {
 		if trimmed == "" {
 			continue
 		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if name == "" {
+				return result, errors.Errorf("Error in file %s, line %d: %s", configFile, lnum, fullLine)
+			}
+			if result.sections[name] == nil {
+				result.sections[name] = make(map[string]string)
+			}
+			section = result.sections[name]
+			continue
+		}
 
 		rawKey, rawValue := splitKeyValue(trimmed)
 		key := strings.TrimSpace(rawKey)
-		value := strings.TrimSpace(rawValue)
+		value := unquote(strings.TrimSpace(rawValue))
 		if key == "" || value == "" {
 			return result, errors.Errorf("Error in file %s, line %d: %s", configFile, lnum, fullLine)
 		}
+		if section != nil {
+			section[key] = value
+			continue
+		}
 		result.values[key] = value
 		result.inUse[key] = false
 	}
@@ -289,7 +965,9 @@ func FromCommandLineParams(args []string) (rawConf, []string, error) {
 	var unused []string
 	for i := 0; i < len(args); i++ {
 		param := args[i]
-		if strings.HasPrefix(param, CLI_VAR_PREFIX) {
+		if param == CLI_HELP {
+			unused = append(unused, param)
+		} else if strings.HasPrefix(param, CLI_VAR_PREFIX) {
 			var rawKey, value string
 			// Value in the same arg?
 			if strings.Contains(param, "=") {
@@ -335,11 +1013,20 @@ func FromEnvironment(env []string) rawConf {
 	return result
 }
 
+// Remove a pair of surrounding quotes, if present.
+func unquote(str string) string {
+	if len(str) >= 2 && (str[0] == '"' || str[0] == '\'') && str[len(str)-1] == str[0] {
+		return str[1 : len(str)-1]
+	}
+	return str
+}
+
 func splitKeyValue(str string) (string, string) {
 	if !strings.Contains(str, "=") {
 		return "", ""
 	}
 
-	pair := strings.Split(str, "=")
+	// Values may contain further signs, e.g. URLs with parameters
+	pair := strings.SplitN(str, "=", 2)
 	return pair[0], pair[1]
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -126,3 +127,241 @@ func TestParametersFromFile(t *testing.T) {
 	expect(t, "foo", backendConf.foo.Value, "fooValue")
 	expect(t, "bar", backendConf.bar.Value, "bar")
 }
+
+func TestFiscalYearStartFromFile(t *testing.T) {
+	backendName := "backendFiscalYearStartFromFile"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.WriteString("fiscal_year_start = \"04-01\"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName)}
+	conf, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "fiscal year start", conf.FiscalYearStart.Value, "04-01")
+}
+
+func TestHelpIsNotAParameter(t *testing.T) {
+	args := []string{"query", CLI_HELP}
+	raw, unused, err := FromCommandLineParams(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.values) != 0 {
+		t.Error("Help flag interpreted as configuration parameter:", raw.values)
+	}
+	if len(unused) != 2 || unused[1] != CLI_HELP {
+		t.Error("Help flag not passed on, instead:", unused)
+	}
+}
+
+func TestSectionsFromFile(t *testing.T) {
+	backendName := "backendSectionsFromFile"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	content := "log_level=debug\n[periods]\nsprint42 = 2024-05-06..2024-05-17\n\n[ other ]\nkey=value\n"
+	if _, err = file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName)}
+	conf, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "log level", conf.LogLevel.Value, "debug")
+	expect(t, "period", conf.Section("periods")["sprint42"], "2024-05-06..2024-05-17")
+	expect(t, "other", conf.Section("other")["key"], "value")
+	if len(conf.Section("missing")) != 0 {
+		t.Error("Missing section should be empty")
+	}
+}
+
+func TestSaveSection(t *testing.T) {
+	backendName := "backendSaveSection"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.WriteString("[import.bank]\ntask = Project\nlayout = 02.01.2006\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName)}
+	conf, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.SaveSection("import.bank", map[string]string{"layout": "2006-01-02 15:04"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.SaveSection("import.bank", map[string]string{"bad": "a=b"}); err == nil {
+		t.Error("Saved a value which cannot be read back")
+	}
+
+	reread, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Opts{conf, reread} {
+		expect(t, "task", c.Section("import.bank")["task"], "Project")
+		expect(t, "layout", c.Section("import.bank")["layout"], "2006-01-02 15:04")
+	}
+}
+
+func TestSiteCategory(t *testing.T) {
+	conf := &Opts{sections: map[string]map[string]string{
+		SectionSites: {"github.com": "code", "docs.github.com": "docs"},
+	}}
+	for host, category := range map[string]string{
+		"github.com":      "code",
+		"gist.github.com": "code",
+		"docs.github.com": "docs",
+		"GitHub.com.":     "code",
+		"example.com":     "",
+		"notgithub.com":   "",
+		"github.com.evil": "",
+	} {
+		got, _ := conf.SiteCategory(host)
+		expect(t, "category of "+host, got, category)
+	}
+}
+
+func TestReload(t *testing.T) {
+	backendName := "backendReload"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.WriteString("log_level=info\nsocket=/tmp/a\n[codes]\nfoo = F-1\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName)}
+	conf, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "log_level=debug\nsocket=/tmp/b\n[codes]\nfoo = F-2\n"
+	if err := ioutil.WriteFile(file.Name(), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	applied, left, err := conf.Reload(args, []string{envVal("LOG_LEVEL", "trace")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "applied", strings.Join(applied, ","), "[codes],log_level")
+	expect(t, "left", strings.Join(left, ","), "socket")
+	expect(t, "log level", conf.LogLevel.Value, "trace")
+	expect(t, "socket", conf.Socket.Value, "/tmp/a")
+	expect(t, "code", conf.Section(SectionCodes)["foo"], "F-2")
+}
+
+func TestOverridesPassedOn(t *testing.T) {
+	backendName := "backendOverrides"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.WriteString("log_level=debug\ndiscard_under=1m\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName), cliVal("foo", "baz")}
+	conf, _, err := GetConfig(args, []string{envVal("DISCARD_UNDER", "2m")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := conf.MergeIntoEnv([]string{"HOME=/home/tilo", envVal("LOG_LEVEL", "trace")})
+	expect(t, "environment", strings.Join(env, " "), "HOME=/home/tilo "+
+		envVal("BACKEND", backendName)+" "+envVal("CONF_FILE", file.Name())+" "+
+		envVal("DISCARD_UNDER", "2m")+" "+envVal("FOO", "baz"))
+
+	passed, _, err := GetConfig(nil, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "log level", passed.LogLevel.Value, "debug")
+	expect(t, "discard under", passed.DiscardUnder.Value, "2m")
+}
+
+func TestSaveValue(t *testing.T) {
+	backendName := "backendSaveValue"
+	RegisterBackend(newTestBackendConfig(backendName))
+	defer unsetBackendConfig(backendName)
+
+	file, err := ioutil.TempFile(os.TempDir(), "tilo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.WriteString("log_level=debug\noutput=csv\n\n[codes]\nfoo = F-1\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{cliVal("conf-file", file.Name()), cliVal("backend", backendName)}
+	conf, _, err := GetConfig(args, []string{envVal("OUTPUT", "json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "log level source", conf.Source(&conf.LogLevel), SourceFile)
+	expect(t, "output source", conf.Source(&conf.Output), SourceEnv)
+	expect(t, "backend source", conf.Source(&conf.Backend), SourceArgs)
+	expect(t, "day start source", conf.Source(&conf.DayStart), SourceDefault)
+
+	for _, kv := range [][2]string{{"log_level", "trace"}, {"day_start", "04:00"}, {"output", ""}, {"foo", "x"}} {
+		if err := conf.SaveValue(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conf.SaveValue("no_such_setting", "x"); err == nil {
+		t.Error("Saved an unknown setting")
+	}
+	expect(t, "log level", conf.LogLevel.Value, "trace")
+	expect(t, "output", conf.Output.Value, "json")
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	expect(t, "first line", lines[0], "log_level = \"trace\"")
+	reread, _, err := GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "log level", reread.LogLevel.Value, "trace")
+	expect(t, "day start", reread.DayStart.Value, "04:00")
+	expect(t, "output", reread.Output.Value, OUTPUT_TABLE)
+	expect(t, "code", reread.Section(SectionCodes)["foo"], "F-1")
+	expect(t, "file", strings.Join(lines, "|"), "log_level = \"trace\"|day_start = \"04:00\"|foo = \"x\"||[codes]|foo = F-1|")
+}
@@ -7,18 +7,61 @@ import (
 
 	"github.com/fgahr/tilo/client"
 	_ "github.com/fgahr/tilo/command/abort"
+	_ "github.com/fgahr/tilo/command/amend"
+	_ "github.com/fgahr/tilo/command/annotate"
+	_ "github.com/fgahr/tilo/command/apply"
+	_ "github.com/fgahr/tilo/command/backup"
+	_ "github.com/fgahr/tilo/command/batch"
+	_ "github.com/fgahr/tilo/command/breaker"
+	_ "github.com/fgahr/tilo/command/budget"
+	_ "github.com/fgahr/tilo/command/completion"
+	_ "github.com/fgahr/tilo/command/confcmd"
 	_ "github.com/fgahr/tilo/command/current"
+	_ "github.com/fgahr/tilo/command/delete"
+	_ "github.com/fgahr/tilo/command/doctor"
+	_ "github.com/fgahr/tilo/command/edit"
+	_ "github.com/fgahr/tilo/command/export"
+	_ "github.com/fgahr/tilo/command/githook"
 	_ "github.com/fgahr/tilo/command/help"
+	_ "github.com/fgahr/tilo/command/hook"
+	_ "github.com/fgahr/tilo/command/importer"
+	_ "github.com/fgahr/tilo/command/introspect"
+	_ "github.com/fgahr/tilo/command/last"
 	_ "github.com/fgahr/tilo/command/listen"
+	_ "github.com/fgahr/tilo/command/log"
+	_ "github.com/fgahr/tilo/command/mqtt"
+	_ "github.com/fgahr/tilo/command/note"
+	_ "github.com/fgahr/tilo/command/off"
+	_ "github.com/fgahr/tilo/command/org"
+	_ "github.com/fgahr/tilo/command/overlong"
+	_ "github.com/fgahr/tilo/command/pause"
 	_ "github.com/fgahr/tilo/command/ping"
+	_ "github.com/fgahr/tilo/command/push"
 	_ "github.com/fgahr/tilo/command/query"
 	_ "github.com/fgahr/tilo/command/recent"
+	_ "github.com/fgahr/tilo/command/report"
+	_ "github.com/fgahr/tilo/command/restore"
 	_ "github.com/fgahr/tilo/command/resume"
+	_ "github.com/fgahr/tilo/command/review"
+	_ "github.com/fgahr/tilo/command/setup"
+	_ "github.com/fgahr/tilo/command/shell"
+	_ "github.com/fgahr/tilo/command/show"
 	_ "github.com/fgahr/tilo/command/shutdown"
+	_ "github.com/fgahr/tilo/command/snooze"
 	_ "github.com/fgahr/tilo/command/srvcmd"
 	_ "github.com/fgahr/tilo/command/start"
 	_ "github.com/fgahr/tilo/command/stop"
+	_ "github.com/fgahr/tilo/command/switcher"
+	_ "github.com/fgahr/tilo/command/tag"
+	_ "github.com/fgahr/tilo/command/task"
+	_ "github.com/fgahr/tilo/command/tasks"
+	_ "github.com/fgahr/tilo/command/template"
+	_ "github.com/fgahr/tilo/command/timesheet"
+	_ "github.com/fgahr/tilo/command/until"
+	_ "github.com/fgahr/tilo/command/version"
+	_ "github.com/fgahr/tilo/command/watch"
 	"github.com/fgahr/tilo/config"
+	_ "github.com/fgahr/tilo/server/backend/postgres"
 	_ "github.com/fgahr/tilo/server/backend/sqlite3"
 )
 
@@ -2,6 +2,8 @@
 package msg
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,12 +14,80 @@ const (
 	// Status
 	RespError   = "error"
 	RespSuccess = "success"
+	// Error codes for requests rejected before execution
+	ErrUnknownOperation = "unknown_operation"
+	ErrInvalidRequest   = "invalid_request"
+	// Clients connecting over TCP without the right token
+	ErrUnauthorized = "unauthorized"
+	// Requests failing due to an internal error of the server
+	ErrInternal = "internal_error"
+	// Tasks are too short to be saved without asking
+	ErrShortTask = "short_task"
+	// Tasks are active and would be stopped without asking
+	ErrActiveTasks = "active_tasks"
 	// Type
 	RespStartTask   = "start"
 	RespStopTask    = "stop"
 	RespCurrentTask = "current"
 )
 
+// Protocol versions. Commands without a version stem from clients predating
+// versioning and are answered as in ProtocolLegacy.
+const (
+	ProtocolLegacy  = 1
+	ProtocolVersion = 2 // The version spoken by this program
+)
+
+// Release is the version of tilo, as MAJOR.MINOR.PATCH. Builds may set it via
+// -ldflags "-X github.com/fgahr/tilo/msg.Release=...".
+var Release = "0.9.0"
+
+// CompatibleReleases determines whether client and server releases differ by
+// at most a patch release. Releases not of the form MAJOR.MINOR.PATCH are
+// only compatible with themselves.
+func CompatibleReleases(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, okA := parseRelease(a)
+	rb, okB := parseRelease(b)
+	return okA && okB && ra[0] == rb[0] && ra[1] == rb[1]
+}
+
+// OlderRelease determines whether release a precedes release b. Releases not
+// of the form MAJOR.MINOR.PATCH precede none and are preceded by none.
+func OlderRelease(a string, b string) bool {
+	ra, okA := parseRelease(a)
+	rb, okB := parseRelease(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			return ra[i] < rb[i]
+		}
+	}
+	return false
+}
+
+// The numbers of a release of the form MAJOR.MINOR.PATCH, optionally
+// preceded by v.
+func parseRelease(release string) ([3]int, bool) {
+	var nums [3]int
+	parts := strings.Split(strings.TrimPrefix(release, "v"), ".")
+	if len(parts) != 3 {
+		return nums, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nums, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
 // TODO: Doc comments. This one is important.
 type Quantity struct {
 	Type  string
@@ -27,13 +97,31 @@ type Quantity struct {
 type QueryParam []string
 
 type Cmd struct {
-	Op          string            `json:"operation"`    // The operation to perform
-	Flags       map[string]bool   `json:"flags"`        // Possible flags
-	Opts        map[string]string `json:"options"`      // Possible options
-	TaskNames   []string          `json:"tasks"`        // The tasks for any related requests
-	Body        [][]string        `json:"body"`         // The body containing the command information
-	Quantities  []Quantity        `json:"quantifiers"`  // Quantifiers, e.g. for queries
-	QueryParams []QueryParam      `json:"query_params"` // The parameters for a query
+	Op          string            `json:"operation"`            // The operation to perform
+	Flags       map[string]bool   `json:"flags"`                // Possible flags
+	Opts        map[string]string `json:"options"`              // Possible options
+	TaskNames   []string          `json:"tasks"`                // The tasks for any related requests
+	Args        []string          `json:"args"`                 // Positional arguments
+	Body        [][]string        `json:"body"`                 // The body containing the command information
+	Quantities  []Quantity        `json:"quantifiers"`          // Quantifiers, e.g. for queries
+	QueryParams []QueryParam      `json:"query_params"`         // The parameters for a query
+	KeepAlive   bool              `json:"keep_alive"`           // Keep the connection open for further commands
+	Version     int               `json:"version,omitempty"`    // The protocol version spoken by the client
+	Origin      string            `json:"origin,omitempty"`     // The client issuing the command, see MakeOrigin
+	Timeout     int64             `json:"timeout_ms,omitempty"` // Milliseconds until the client gives up waiting, if limited
+}
+
+// Auth is sent by clients connecting over TCP before any command.
+type Auth struct {
+	Token string `json:"token"`
+}
+
+// Protocol gives the protocol version of the client issuing the command.
+func (c Cmd) Protocol() int {
+	if c.Version == 0 {
+		return ProtocolLegacy
+	}
+	return c.Version
 }
 
 // Type representing a named task with start and end times.
@@ -42,6 +130,199 @@ type Task struct {
 	Started  time.Time
 	Ended    time.Time
 	HasEnded bool
+	Split    []Allocation // Shares of other tasks if the time is split
+	StopAt   time.Time    // When the task is scheduled to stop, if at all
+	Note     string       // Any note attached to the task
+	Icon     string       // Shown before the name for recognition, if set
+	Tags     []string     // Tags to save along with the task
+	Origin   string       // The client which started the task, see MakeOrigin
+}
+
+// Kinds of clients, recorded along with the entries they create or modify.
+const (
+	OriginCLI    = "cli"    // A single command
+	OriginTUI    = "tui"    // An interactive session
+	OriginAgent  = "agent"  // Acting on its own, e.g. on window changes or for an editor
+	OriginImport = "import" // Entries logged with other tools
+	OriginServer = "server" // Logged by the server itself, e.g. from templates
+)
+
+// SourceTemplate marks entries logged from templates as imported, so that each
+// is logged at most once per day. The marks outlast the entries, so that
+// deleting one does not make the server log it again.
+const SourceTemplate = "template"
+
+// MakeOrigin identifies a kind of client running on a host, e.g. cli@laptop.
+func MakeOrigin(kind string, host string) string {
+	return kind + "@" + host
+}
+
+// MatchOrigin determines whether an origin matches the filter: a kind of
+// client, a host, or both as kind@host.
+func MatchOrigin(origin string, filter string) bool {
+	if origin == "" {
+		return false
+	} else if strings.Contains(filter, "@") {
+		return origin == filter
+	}
+	kind, host := origin, ""
+	if i := strings.Index(origin, "@"); i >= 0 {
+		kind, host = origin[:i], origin[i+1:]
+	}
+	return kind == filter || host == filter
+}
+
+// TagSummary describes how many entries carry a tag and the time they cover.
+type TagSummary struct {
+	Tag     string        `json:"tag"`
+	Entries int           `json:"entries"`
+	Total   time.Duration `json:"total"`
+}
+
+// TaskInfo holds metadata on a task.
+type TaskInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`     // A short icon or emoji
+	Archived    bool   `json:"archived,omitempty"` // Hidden unless asked for
+}
+
+// Whether there is no metadata apart from the name.
+func (i TaskInfo) IsEmpty() bool {
+	return i.Description == "" && i.Icon == "" && !i.Archived
+}
+
+// ProjectSeparator separates the project a task belongs to from the rest of
+// its name, as in client-a/backend.
+const ProjectSeparator = "/"
+
+// Project gives the project of the task with the given name, the part before
+// the first ProjectSeparator; empty if it belongs to none.
+func Project(task string) string {
+	if i := strings.Index(task, ProjectSeparator); i > 0 {
+		return task[:i]
+	}
+	return ""
+}
+
+// Label gives the task's name, prefixed with its icon if it has one.
+func (i TaskInfo) Label() string {
+	return withIcon(i.Icon, i.Name)
+}
+
+// Label gives the task's name, prefixed with its icon if it has one.
+func (t Task) Label() string {
+	return withIcon(t.Icon, t.Name)
+}
+
+func withIcon(icon string, name string) string {
+	if icon == "" {
+		return name
+	}
+	return icon + " " + name
+}
+
+// Allocation is the share of a task in time split across several tasks.
+type Allocation struct {
+	Task   string
+	Weight int
+}
+
+// ParseAllocation parses a task's share of split time, given as task:weight.
+func ParseAllocation(spec string) (Allocation, error) {
+	sep := strings.LastIndex(spec, ":")
+	if sep <= 0 {
+		return Allocation{}, errors.Errorf("Not of the form task:weight: %s", spec)
+	}
+	weight, err := strconv.Atoi(spec[sep+1:])
+	if err != nil || weight <= 0 {
+		return Allocation{}, errors.Errorf("Weight must be a positive integer: %s", spec)
+	}
+	return Allocation{Task: spec[:sep], Weight: weight}, nil
+}
+
+const (
+	OffVacation = "vacation"
+	OffSick     = "sick"
+)
+
+// DayOff marks a whole day, given as YYYY-MM-DD, as absence of some kind.
+type DayOff struct {
+	Date string `json:"date"`
+	Kind string `json:"kind"`
+}
+
+// Note is a piece of text attached to the day on which it was made.
+type Note struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// Breaks are logged on a task of their own and tagged as such. Entries on
+// other tasks count as breaks when tagged likewise.
+const (
+	BreakTask = "break"
+	BreakTag  = "break"
+)
+
+// IsBreak determines whether the entry is a break, see BreakTask.
+func (e Entry) IsBreak() bool {
+	if e.Task == BreakTask {
+		return true
+	}
+	for _, tag := range e.Tags {
+		if tag == BreakTag {
+			return true
+		}
+	}
+	return false
+}
+
+// Kinds of budgets.
+const (
+	BudgetMax = "max" // A limit not to be exceeded
+	BudgetMin = "min" // A target to be reached
+)
+
+// Periods budgets apply to, each starting anew with the next.
+const (
+	BudgetWeek  = "week"
+	BudgetMonth = "month"
+)
+
+// Budget is the time to be logged on a task, or on all tasks of a project,
+// per week or month: at most or at least.
+type Budget struct {
+	Task   string        `json:"task"`
+	Kind   string        `json:"kind"`
+	Period string        `json:"period"`
+	Limit  time.Duration `json:"limit"`
+}
+
+// String describes the budget, e.g. max 20h00m/week.
+func (b Budget) String() string {
+	return b.Kind + " " + formatHours(b.Limit) + "/" + b.Period
+}
+
+// States of a budget in its current period.
+const (
+	BudgetOK       = "ok"
+	BudgetAtRisk   = "at risk"
+	BudgetExceeded = "exceeded" // A maximum was passed
+	BudgetMet      = "met"      // A minimum was reached
+)
+
+// BudgetStatus is the time logged towards a budget in its current period.
+type BudgetStatus struct {
+	Budget
+	Logged time.Duration `json:"logged"`
+	State  string        `json:"state"`
+}
+
+// Remaining gives the time until the budget's limit is reached, negative
+// once past it.
+func (s BudgetStatus) Remaining() time.Duration {
+	return s.Limit - s.Logged
 }
 
 // Initiate a new task, started just now.
@@ -54,6 +335,18 @@ func FreshTask(name string) Task {
 	return Task{Name: name, Started: rightNow(), HasEnded: false}
 }
 
+// Initiate a task, started just now, whose time is split according to the
+// allocations. Its name combines those of the allocated tasks.
+func FreshSplitTask(split []Allocation) Task {
+	var names []string
+	for _, alloc := range split {
+		names = append(names, alloc.Task)
+	}
+	task := FreshTask(strings.Join(names, "+"))
+	task.Split = split
+	return task
+}
+
 func IdleTask() Task {
 	t := rightNow()
 	return Task{Name: "", Started: t, Ended: t, HasEnded: true}
@@ -71,6 +364,41 @@ func (t *Task) IsRunning() bool {
 	return !t.HasEnded
 }
 
+// Attach a note to the task, in addition to any prior one.
+func (t *Task) AddNote(note string) {
+	if note == "" {
+		return
+	} else if t.Note == "" {
+		t.Note = note
+	} else {
+		t.Note += "; " + note
+	}
+}
+
+// Allocate the time of a stopped split task to the tasks sharing it. The
+// resulting tasks follow each other without gaps, spanning the original.
+func (t *Task) Allocate() []Task {
+	if len(t.Split) == 0 {
+		return []Task{*t}
+	}
+	total := 0
+	for _, alloc := range t.Split {
+		total += alloc.Weight
+	}
+	elapsed := t.Ended.Sub(t.Started)
+	var parts []Task
+	start, cumulative := t.Started, 0
+	for _, alloc := range t.Split {
+		cumulative += alloc.Weight
+		share := elapsed * time.Duration(cumulative) / time.Duration(total)
+		end := t.Started.Add(share.Round(time.Second))
+		parts = append(parts, Task{Name: alloc.Task, Started: start, Ended: end, HasEnded: true,
+			Note: t.Note, Tags: t.Tags})
+		start = end
+	}
+	return parts
+}
+
 // The current local time, truncated to seconds.
 func rightNow() time.Time {
 	return time.Now().Truncate(time.Second)
@@ -78,18 +406,125 @@ func rightNow() time.Time {
 
 // Response represents a server's answer to a client's request.
 type Response struct {
+	Status   string     `json:"status"`
+	Error    string     `json:"error"`
+	Code     string     `json:"code,omitempty"` // Why the request was rejected, if it was
+	Body     [][]string `json:"body"`
+	Entries  []Entry    `json:"entries,omitempty"`  // Individual entries, if requested
+	Summary  []Summary  `json:"summary,omitempty"`  // Query results, for structured output
+	Tasks    []Task     `json:"tasks,omitempty"`    // Active or paused tasks, for structured output
+	Overlong []Overlong `json:"overlong,omitempty"` // Tasks stopped for running too long, awaiting a decision
+	Warnings []string   `json:"warnings,omitempty"` // Hints on possibly unwanted results
+	Server   string     `json:"server,omitempty"`   // The release of the answering server
+	// Whether the results are contained in the fields above, even if empty,
+	// rather than only in the body
+	Structured bool `json:"structured,omitempty"`
+}
+
+// The response as understood by clients speaking ProtocolLegacy.
+type legacyResponse struct {
 	Status string     `json:"status"`
 	Error  string     `json:"error"`
 	Body   [][]string `json:"body"`
 }
 
+// ForProtocol gives the response in the shape understood by clients speaking
+// the given protocol version. Fields unknown to them are left out.
+func (r Response) ForProtocol(version int) interface{} {
+	if version <= ProtocolLegacy {
+		return legacyResponse{Status: r.Status, Error: r.Error, Body: r.Body}
+	}
+	return r
+}
+
+// Entry is a single saved task, identified by an ID which remains stable for
+// as long as the entry exists.
+type Entry struct {
+	ID         int64     `json:"id"`
+	Task       string    `json:"task"`
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	SplitGroup int64     `json:"split_group,omitempty"` // Links entries sharing split time
+	Note       string    `json:"note,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Code       string    `json:"code,omitempty"`        // Booking code of the task, if requested
+	Origin     string    `json:"origin,omitempty"`      // The client which created the entry
+	Modified   string    `json:"modified_by,omitempty"` // The client which last modified the entry, if any
+}
+
+// ParseEntryIDs parses the IDs of entries given as arguments, requiring at
+// least one.
+func ParseEntryIDs(args []string) ([]int64, error) {
+	if len(args) == 0 {
+		return nil, errors.New("No entry ID given")
+	}
+	var ids []int64
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errors.Errorf("Not an entry ID: %s", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Overlong is a task the server stopped for running longer than allowed, see
+// the max_task_duration setting, awaiting a decision on what to keep of it.
+type Overlong struct {
+	Task  Task `json:"task"`  // The task, ending when it reached the limit
+	Saved bool `json:"saved"` // Whether it was saved as such
+}
+
+// MatchOrigin determines whether the entry was created or last modified by a
+// client matching the filter, see MatchOrigin.
+func (e Entry) MatchOrigin(filter string) bool {
+	return MatchOrigin(e.Origin, filter) || MatchOrigin(e.Modified, filter)
+}
+
+// Unreviewed determines whether the entry was created without anyone
+// logging it, i.e. imported or logged by the server, and not modified since.
+func (e Entry) Unreviewed() bool {
+	return e.Modified == "" && (MatchOrigin(e.Origin, OriginImport) || MatchOrigin(e.Origin, OriginServer))
+}
+
+// Edit records a change to an entry, kept as its history.
+type Edit struct {
+	Time   time.Time `json:"time"`
+	By     string    `json:"by,omitempty"`     // The client making the change, see MakeOrigin
+	Fields []string  `json:"fields,omitempty"` // The changed fields; none if only reviewed
+}
+
+// ChangedFields names the fields in which the entry differs from how it was
+// before, as recorded in an Edit. Times are compared in whole seconds, as
+// saved.
+func (e Entry) ChangedFields(before Entry) []string {
+	var fields []string
+	if e.Task != before.Task {
+		fields = append(fields, "task")
+	}
+	if e.Started.Unix() != before.Started.Unix() {
+		fields = append(fields, "started")
+	}
+	if e.Ended.Unix() != before.Ended.Unix() {
+		fields = append(fields, "ended")
+	}
+	if e.Note != before.Note {
+		fields = append(fields, "note")
+	}
+	return fields
+}
+
 // Summary represents all relevant information concerning a single request
 type Summary struct {
-	Task    string
-	Details Quantity
-	Total   time.Duration
-	Start   time.Time
-	End     time.Time
+	Task        string
+	Details     Quantity
+	Total       time.Duration
+	Start       time.Time
+	End         time.Time
+	WorkingDays int     // Working days in the period; zero if not determined
+	Percent     float64 // Share of all time logged in the period; zero if not determined
+	Description string  // The task's description, if any
 }
 
 func (r *Response) SetError(err error) {
@@ -103,6 +538,14 @@ func (r *Response) SetError(err error) {
 	r.Error = err.Error()
 }
 
+// Reject marks a request as not executed at all, for the given reason.
+func (r *Response) Reject(code string, err error) {
+	r.Status = RespError
+	r.Code = code
+	r.Error = err.Error()
+	r.Body = nil
+}
+
 func (r *Response) Failed() bool {
 	return r.Status == RespError
 }
@@ -137,6 +580,51 @@ func (r *Response) AddStartedTask(task Task) {
 	r.addTaskWithDescription("Now", task)
 }
 
+// Add several active tasks to the response, sharing a header line.
+func (r *Response) AddActiveTasks(tasks []Task) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	header := line("Currently", "Since")
+	for _, task := range tasks {
+		if !task.StopAt.IsZero() {
+			header = append(header, "Stops at")
+			break
+		}
+	}
+	r.addToBody(header)
+	for _, task := range tasks {
+		if !task.IsRunning() {
+			panic("Task not running but should be reported as active!")
+		}
+		row := line(task.Label(), formatTime(task.Started))
+		if !task.StopAt.IsZero() {
+			row = append(row, formatTime(task.StopAt))
+		}
+		r.addToBody(row)
+	}
+	r.Tasks = append(r.Tasks, tasks...)
+	r.Structured = true
+}
+
+// Add paused tasks to the response, along with the time they ran before the
+// pause and how long they have been paused.
+func (r *Response) AddPausedTasks(tasks []Task, now time.Time) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Paused", "Since", "Elapsed", "Paused for"))
+	for _, task := range tasks {
+		if !task.HasEnded {
+			panic("Task needs to end before being reported as paused!")
+		}
+		r.addToBody(line(task.Label(), formatTime(task.Ended),
+			formatHours(task.Ended.Sub(task.Started)), formatHours(now.Sub(task.Ended))))
+	}
+	r.Tasks = append(r.Tasks, tasks...)
+	r.Structured = true
+}
+
 func (r *Response) AddStoppedTask(task Task) {
 	if !task.HasEnded {
 		panic("Task needs to end before responding to stop!")
@@ -151,6 +639,27 @@ func (r *Response) AddAbortedTask(task Task) {
 	r.addTaskWithDescription("Aborted", task)
 }
 
+// AddDroppedPause tells that paused tasks are no longer resumed, e.g. on
+// shutdown. They were saved when paused.
+func (r *Response) AddDroppedPause(tasks []Task) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	var labels []string
+	for _, task := range tasks {
+		labels = append(labels, task.Label())
+	}
+	r.addToBody(line("No longer paused, saved up to the pause: " + strings.Join(labels, ", ")))
+}
+
+// A stopped task which was not saved for being too short.
+func (r *Response) AddDiscardedTask(task Task) {
+	if !task.HasEnded {
+		panic("Task needs to end before being discarded!")
+	}
+	r.addTaskWithDescription("Discarded", task)
+}
+
 func (r *Response) addTaskWithDescription(description string, task Task) {
 	if !r.statusIsSet() {
 		r.Status = RespSuccess
@@ -158,14 +667,91 @@ func (r *Response) addTaskWithDescription(description string, task Task) {
 	if task.HasEnded {
 		r.addToBody(
 			line(description, "Since", "Until"),
-			line(task.Name, formatTime(task.Started), formatTime(task.Ended)),
+			line(task.Label(), formatTime(task.Started), formatTime(task.Ended)),
+		)
+	} else if !task.StopAt.IsZero() {
+		r.addToBody(
+			line(description, "Since", "Stops at"),
+			line(task.Label(), formatTime(task.Started), formatTime(task.StopAt)),
 		)
 	} else {
 		r.addToBody(
 			line(description, "Since"),
-			line(task.Name, formatTime(task.Started)),
+			line(task.Label(), formatTime(task.Started)),
 		)
 	}
+	if task.Note != "" {
+		r.addToBody(line("Note", task.Note))
+	}
+	if len(task.Tags) > 0 {
+		r.addToBody(line("Tags", strings.Join(task.Tags, ", ")))
+	}
+}
+
+// Add what the server waits for before shutting down, if anything.
+func (r *Response) AddDeferredShutdown(active []Task, paused []Task, clients int) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if len(active) == 0 && len(paused) == 0 && clients == 0 {
+		r.addToBody(line("Server shutting down: " + formatTime(time.Now())))
+		return
+	}
+	var waiting []string
+	for _, task := range active {
+		waiting = append(waiting, task.Label())
+	}
+	for _, task := range paused {
+		waiting = append(waiting, task.Label()+" (paused)")
+	}
+	if clients == 1 {
+		waiting = append(waiting, "1 other client")
+	} else if clients > 1 {
+		waiting = append(waiting, strconv.Itoa(clients)+" other clients")
+	}
+	r.addToBody(line("Server shutting down once idle, waiting for: " + strings.Join(waiting, ", ")))
+}
+
+// AddReloadedConfig tells which items and sections of the configuration
+// changed on reload, and which of those only take effect on restart.
+func (r *Response) AddReloadedConfig(applied []string, left []string) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if len(applied) == 0 && len(left) == 0 {
+		r.addToBody(line("Configuration reloaded, nothing changed"))
+		return
+	}
+	if len(applied) > 0 {
+		r.addToBody(line("Configuration reloaded, changed: " + strings.Join(applied, ", ")))
+	}
+	if len(left) > 0 {
+		r.addToBody(line("Taking effect on restart: " + strings.Join(left, ", ")))
+	}
+}
+
+// AddLogLevel tells about a change of the server's log level.
+func (r *Response) AddLogLevel(level string, previous string) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Log level: " + level + " (was " + previous + ")"))
+}
+
+// AddHandoverMessage tells about a shutdown leaving the active tasks for the
+// next server to resume.
+func (r *Response) AddHandoverMessage(active []Task) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	var labels []string
+	for _, task := range active {
+		labels = append(labels, task.Label())
+	}
+	if len(labels) == 0 {
+		labels = append(labels, "none")
+	}
+	r.addToBody(line("Server shutting down, handing over active tasks: " + strings.Join(labels, ", ")))
 }
 
 func (r *Response) AddShutdownMessage() {
@@ -175,6 +761,63 @@ func (r *Response) AddShutdownMessage() {
 	r.addToBody(line("Server shutting down: " + formatTime(time.Now())))
 }
 
+// Add the given task names to the response, one per line, each followed by
+// its description if there is one. Icons are shown after the name so that
+// the name remains the first word.
+func (r *Response) AddTaskNames(names []string, infos map[string]TaskInfo) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	for _, name := range names {
+		info := infos[name]
+		switch {
+		case info.Icon != "":
+			r.addToBody(line(name, info.Icon, info.Description))
+		case info.Description != "":
+			r.addToBody(line(name, "", info.Description))
+		default:
+			r.addToBody(line(name))
+		}
+	}
+}
+
+// Add a task's metadata to the response.
+func (r *Response) AddTaskInfo(info TaskInfo) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	switch {
+	case info.IsEmpty():
+		r.addToBody(line(info.Name, "has no description or icon"))
+	case info.Archived:
+		r.addToBody(line(info.Label(), info.Description, "(archived)"))
+	default:
+		r.addToBody(line(info.Label(), info.Description))
+	}
+}
+
+// Add the given days off to the response, one per line.
+func (r *Response) AddDaysOff(days []DayOff, removed bool) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	for _, d := range days {
+		if removed {
+			r.addToBody(line(d.Date, "no longer marked as off"))
+		} else {
+			r.addToBody(line(d.Date, "marked as", d.Kind))
+		}
+	}
+}
+
+// Add a confirmation for a saved note to the response.
+func (r *Response) AddSavedNote(note Note) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Note saved", formatTime(note.Time)))
+}
+
 // Create a response containing the given query summaries.
 func (r *Response) AddQuerySummaries(sum []Summary) {
 	if !r.statusIsSet() {
@@ -184,11 +827,428 @@ func (r *Response) AddQuerySummaries(sum []Summary) {
 		header := []string{s.Task}
 		header = append(header, s.Details.Type)
 		header = append(header, s.Details.Elems...)
+		if s.Description != "" {
+			header = append(header, "("+s.Description+")")
+		}
 		r.addToBody(line(strings.Join(header, " ")))
 		r.addToBody(line("First logged", formatTime(s.Start)))
 		r.addToBody(line("Last logged", formatTime(s.End)))
 		r.addToBody(line("Total time", s.Total.String()))
+		if s.WorkingDays > 0 {
+			perDay := (s.Total / time.Duration(s.WorkingDays)).Truncate(time.Second)
+			r.addToBody(line("Per working day", perDay.String()))
+		}
+		if s.Percent > 0 {
+			r.addToBody(line("Share of total", fmt.Sprintf("%.1f%%", s.Percent)))
+		}
 	}
+	r.Summary = append(r.Summary, sum...)
+	r.Structured = true
+}
+
+// Add the total of several query results to the response, preceded by
+// subtotals for each period if requested, e.g. with a breakdown.
+func (r *Response) AddQueryTotals(sum []Summary, byPeriod bool) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	var total time.Duration
+	var periods []string
+	subtotals := make(map[string]time.Duration)
+	for _, s := range sum {
+		period := strings.Join(append([]string{s.Details.Type}, s.Details.Elems...), " ")
+		if _, ok := subtotals[period]; !ok {
+			periods = append(periods, period)
+		}
+		subtotals[period] += s.Total
+		total += s.Total
+	}
+	// Separated so as not to affect the alignment of the results
+	r.addToBody(line(""))
+	if byPeriod {
+		for _, period := range periods {
+			r.addToBody(line("Subtotal "+period, subtotals[period].String()))
+		}
+	}
+	r.addToBody(line("Total", total.String()))
+}
+
+// Add individual entries to the response, both as a table and in structured
+// form.
+func (r *Response) AddEntries(entries []Entry) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("ID", "Task", "Started", "Ended", "Duration", "Note"))
+	for _, e := range entries {
+		r.addToBody(line(strconv.FormatInt(e.ID, 10), e.Task, formatTime(e.Started),
+			formatTime(e.Ended), e.Ended.Sub(e.Started).String(), e.Note))
+	}
+	r.Entries = append(r.Entries, entries...)
+	r.Structured = true
+}
+
+// Add entries for further processing by the client, without listing them.
+func (r *Response) AddRawEntries(entries []Entry) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.Entries = append(r.Entries, entries...)
+}
+
+// Add everything known about a single entry to the response, including the
+// entries it shares split time with, if any, and its edits, oldest first.
+func (r *Response) AddEntryDetails(e Entry, linked []Entry, history []Edit) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(
+		line("ID", strconv.FormatInt(e.ID, 10)),
+		line("Task", e.Task),
+		line("Started", formatTime(e.Started)),
+		line("Ended", formatTime(e.Ended)),
+		line("Duration", e.Ended.Sub(e.Started).String()),
+	)
+	if e.Note != "" {
+		r.addToBody(line("Note", e.Note))
+	}
+	if len(e.Tags) > 0 {
+		r.addToBody(line("Tags", strings.Join(e.Tags, ", ")))
+	}
+	if e.Origin != "" {
+		r.addToBody(line("Created by", e.Origin))
+	}
+	if e.Modified != "" {
+		r.addToBody(line("Modified by", e.Modified))
+	}
+	for _, edit := range history {
+		changed := "reviewed"
+		if len(edit.Fields) > 0 {
+			changed = "changed " + strings.Join(edit.Fields, ", ")
+		}
+		by := edit.By
+		if by == "" {
+			by = "unknown"
+		}
+		r.addToBody(line("Edited", formatTime(edit.Time), "by "+by+", "+changed))
+	}
+	for _, other := range linked {
+		if other.ID != e.ID {
+			r.addToBody(line("Split with", strconv.FormatInt(other.ID, 10), other.Task,
+				other.Ended.Sub(other.Started).String()))
+		}
+	}
+	r.Entries = append(r.Entries, e)
+}
+
+// Add a summary of the last entry to the response, including how long ago it
+// ended.
+func (r *Response) AddLastEntry(e Entry) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	ago := time.Since(e.Ended).Truncate(time.Second)
+	r.addToBody(
+		line("Last task", e.Task),
+		line("ID", strconv.FormatInt(e.ID, 10)),
+		line("Started", formatTime(e.Started)),
+		line("Ended", formatTime(e.Ended), "("+ago.String()+" ago)"),
+		line("Duration", e.Ended.Sub(e.Started).String()),
+	)
+	if e.Note != "" {
+		r.addToBody(line("Note", e.Note))
+	}
+	if len(e.Tags) > 0 {
+		r.addToBody(line("Tags", strings.Join(e.Tags, ", ")))
+	}
+}
+
+// Add the changes made to an entry to the response, field by field.
+func (r *Response) AddAmendedEntry(before Entry, after Entry) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Amended", "ID "+strconv.FormatInt(after.ID, 10)))
+	fields := [][]string{
+		line("Task", before.Task, after.Task),
+		line("Started", formatTime(before.Started), formatTime(after.Started)),
+		line("Ended", formatTime(before.Ended), formatTime(after.Ended)),
+		line("Duration", before.Ended.Sub(before.Started).String(), after.Ended.Sub(after.Started).String()),
+		line("Note", before.Note, after.Note),
+	}
+	for _, f := range fields {
+		if f[1] == f[2] {
+			if f[2] != "" {
+				r.addToBody(line(f[0], f[2]))
+			}
+		} else {
+			r.addToBody(line(f[0], f[1], "->", f[2]))
+		}
+	}
+	r.Entries = append(r.Entries, after)
+}
+
+// Add an entry removed on request to the response.
+func (r *Response) AddDeletedEntry(e Entry) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(
+		line("Deleted", "ID "+strconv.FormatInt(e.ID, 10)),
+		line("Task", e.Task),
+		line("Started", formatTime(e.Started)),
+		line("Ended", formatTime(e.Ended)),
+		line("Duration", e.Ended.Sub(e.Started).String()),
+	)
+	if e.Note != "" {
+		r.addToBody(line("Note", e.Note))
+	}
+	r.Entries = append(r.Entries, e)
+}
+
+// Warn about entries overlapping with one just saved or changed.
+func (r *Response) AddOverlaps(entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, fmt.Sprintf("%d (%s)", e.ID, e.Task))
+	}
+	r.Warnings = append(r.Warnings, "Overlaps with entries: "+strings.Join(ids, ", "))
+}
+
+// Add tasks stopped for running too long to the response, listed if asked
+// for, otherwise only for the client to ask about them.
+func (r *Response) AddOverlong(overlong []Overlong, list bool) {
+	r.Overlong = append(r.Overlong, overlong...)
+	if !list {
+		return
+	}
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Stopped", "Since", "At limit", "Saved"))
+	for _, o := range overlong {
+		r.addToBody(line(o.Task.Name, formatTime(o.Task.Started), formatTime(o.Task.Ended),
+			strconv.FormatBool(o.Saved)))
+	}
+}
+
+// Add the release of the answering server to the response.
+func (r *Response) AddServerRelease() {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Server", Release))
+}
+
+// Add the end of a snooze period to the response, zero meaning none.
+func (r *Response) AddSnooze(until time.Time) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if until.IsZero() {
+		r.addToBody(line("Reminders are not snoozed"))
+	} else {
+		r.addToBody(line("Reminders snoozed until", formatTime(until)))
+	}
+}
+
+// Add a task's time in the current session, today, and this week to the
+// response.
+func (r *Response) AddRunningTotals(task string, session, today, week time.Duration) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line(fmt.Sprintf("%s: %s this session, %s today, %s this week",
+		task, formatHours(session), formatHours(today), formatHours(week))))
+}
+
+// Add tags along with the number of entries and time they cover.
+func (r *Response) AddTagSummaries(tags []TagSummary) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Tag", "Entries", "Total time"))
+	for _, t := range tags {
+		r.addToBody(line(t.Tag, strconv.Itoa(t.Entries), t.Total.String()))
+	}
+}
+
+// Add the result of renaming or merging a tag.
+func (r *Response) AddRenamedTag(from string, into string, entries int64) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Renamed", "Into", "Entries"), line(from, into, strconv.FormatInt(entries, 10)))
+}
+
+// Add the result of deleting a tag.
+func (r *Response) AddDeletedTag(tag string, entries int64) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Deleted", "Entries"), line(tag, strconv.FormatInt(entries, 10)))
+}
+
+// Add the result of renaming a task or merging it into another.
+func (r *Response) AddRenamedTask(from string, into string, entries int64) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Renamed", "Into", "Entries"), line(from, into, strconv.FormatInt(entries, 10)))
+}
+
+// Add a task removed along with its entries to the response.
+func (r *Response) AddPurgedTask(task string, entries int64) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Purged", "Entries"), line(task, strconv.FormatInt(entries, 10)))
+}
+
+// Add a budget which was just set to the response.
+func (r *Response) AddSavedBudget(b Budget) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Budget set for", b.Task, b.String()))
+}
+
+// Add the number of budgets removed for a task to the response.
+func (r *Response) AddRemovedBudgets(task string, removed int64) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Budgets removed for", task, strconv.FormatInt(removed, 10)))
+}
+
+// Add budgets along with the time logged towards them in their current
+// period.
+func (r *Response) AddBudgetStatus(statuses []BudgetStatus) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(line("Task", "Budget", "Logged", "Remaining", "State"))
+	for _, s := range statuses {
+		remaining := formatHours(s.Remaining())
+		if s.Remaining() < 0 {
+			remaining = formatHours(-s.Remaining()) + " over"
+		}
+		r.addToBody(line(s.Task, s.String(), formatHours(s.Logged), remaining, s.State))
+	}
+}
+
+// Warn about budgets exceeded or at risk of being missed.
+func (r *Response) AddBudgetWarnings(statuses []BudgetStatus) {
+	for _, s := range statuses {
+		var warning string
+		switch {
+		case s.State == BudgetExceeded:
+			warning = fmt.Sprintf("Budget exceeded for %s: %s logged this %s, at most %s",
+				s.Task, formatHours(s.Logged), s.Period, formatHours(s.Limit))
+		case s.State == BudgetAtRisk && s.Kind == BudgetMax:
+			warning = fmt.Sprintf("Budget at risk for %s: %s left this %s of at most %s",
+				s.Task, formatHours(s.Remaining()), s.Period, formatHours(s.Limit))
+		case s.State == BudgetAtRisk:
+			warning = fmt.Sprintf("Budget at risk for %s: %s to go this %s for at least %s",
+				s.Task, formatHours(s.Remaining()), s.Period, formatHours(s.Limit))
+		default:
+			continue
+		}
+		r.Warnings = append(r.Warnings, warning)
+	}
+}
+
+// Add groups of duplicate entries to the response, stating whether each
+// group was merged into a single entry.
+func (r *Response) AddDuplicates(groups [][]Entry, merged bool) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if len(groups) == 0 {
+		r.addToBody(line("No duplicates found"))
+		return
+	}
+	r.addToBody(line("Group", "ID", "Task", "Started", "Ended", "Note"))
+	for i, group := range groups {
+		for _, e := range group {
+			r.addToBody(line(strconv.Itoa(i+1), strconv.FormatInt(e.ID, 10), e.Task,
+				formatTime(e.Started), formatTime(e.Ended), e.Note))
+		}
+	}
+	if merged {
+		r.addToBody(line(strconv.Itoa(len(groups)) + " groups merged"))
+	} else {
+		r.addToBody(line(strconv.Itoa(len(groups)) + " groups found, nothing merged"))
+	}
+}
+
+// Add a summary of imported entries to the response, along with the numbers
+// of records skipped since they had been imported before or were covered by
+// other entries.
+func (r *Response) AddImportedEntries(tasks []Task, skipped int, covered int) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if len(tasks) == 0 {
+		r.addToBody(line("No entries imported"))
+	} else {
+		first, last := tasks[0].Started, tasks[0].Ended
+		for _, task := range tasks {
+			if task.Started.Before(first) {
+				first = task.Started
+			}
+			if task.Ended.After(last) {
+				last = task.Ended
+			}
+		}
+		r.addToBody(
+			line("Imported", "From", "Until"),
+			line(strconv.Itoa(len(tasks))+" entries", formatTime(first), formatTime(last)),
+		)
+	}
+	if skipped > 0 {
+		r.addToBody(line("Skipped " + strconv.Itoa(skipped) + " records imported before"))
+	}
+	if covered > 0 {
+		r.addToBody(line("Skipped " + strconv.Itoa(covered) + " records covered by other entries"))
+	}
+}
+
+// Add the number of entries restored from a backup to the response.
+func (r *Response) AddRestoredEntries(count int, merged bool) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	if merged {
+		r.addToBody(line("Restored", strconv.Itoa(count)+" entries, added to the existing ones"))
+	} else {
+		r.addToBody(line("Restored", strconv.Itoa(count)+" entries, replacing all existing ones"))
+	}
+}
+
+// Add a table, consisting of a header line and rows, to the response.
+func (r *Response) AddTable(header []string, rows [][]string) {
+	if !r.statusIsSet() {
+		r.Status = RespSuccess
+	}
+	r.addToBody(header)
+	r.addToBody(rows...)
+}
+
+// Warn about tasks not mapped to booking codes.
+func (r *Response) AddUnmappedTasks(tasks []string) {
+	if len(tasks) > 0 {
+		r.Warnings = append(r.Warnings, "No booking code for: "+strings.Join(tasks, ", "))
+	}
+}
+
+// Add an empty line, e.g. between tables, so that the lines following it are
+// aligned independently of those before.
+func (r *Response) AddSeparator() {
+	r.addToBody(line(""))
 }
 
 // The error encapsulated in the response, if any.
@@ -211,6 +1271,12 @@ func line(words ...string) []string {
 	return words
 }
 
+// Format a duration as hours and minutes, e.g. 1h02m.
+func formatHours(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
 // Format a time instance as a string.
 func formatTime(t time.Time) string {
 	return t.Format("2006-01-02 15:04:05")
@@ -0,0 +1,182 @@
+package msg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseAllocation(t *testing.T) {
+	if alloc, err := ParseAllocation("a:b:30"); err != nil {
+		t.Error(err)
+	} else if alloc.Task != "a:b" || alloc.Weight != 30 {
+		t.Errorf("Unexpected allocation: %v", alloc)
+	}
+	for _, invalid := range []string{"meeting", ":50", "meeting:", "meeting:0", "meeting:x"} {
+		if _, err := ParseAllocation(invalid); err == nil {
+			t.Errorf("Expected error for allocation %q", invalid)
+		}
+	}
+}
+
+func TestParseEntryIDs(t *testing.T) {
+	if ids, err := ParseEntryIDs([]string{"42", "7"}); err != nil {
+		t.Error(err)
+	} else if len(ids) != 2 || ids[0] != 42 || ids[1] != 7 {
+		t.Errorf("Unexpected IDs: %v", ids)
+	}
+	for _, invalid := range [][]string{nil, {"0"}, {"-1"}, {"42", "x"}} {
+		if _, err := ParseEntryIDs(invalid); err == nil {
+			t.Errorf("Expected error for IDs %q", invalid)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	start := time.Date(2019, time.May, 15, 13, 0, 0, 0, time.Local)
+	task := FreshSplitTask([]Allocation{{"meeting", 1}, {"admin", 1}, {"mail", 1}})
+	task.Started, task.Ended, task.HasEnded = start, start.Add(100*time.Second), true
+	if task.Name != "meeting+admin+mail" {
+		t.Errorf("Unexpected name for split task: %s", task.Name)
+	}
+
+	parts := task.Allocate()
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(parts))
+	}
+	var total time.Duration
+	for i, part := range parts {
+		if i > 0 && !part.Started.Equal(parts[i-1].Ended) {
+			t.Errorf("Gap between parts %d and %d", i-1, i)
+		}
+		if d := part.Ended.Sub(part.Started); d < 33*time.Second || d > 34*time.Second {
+			t.Errorf("Unexpected length of part %s: %v", part.Name, d)
+		}
+		total += part.Ended.Sub(part.Started)
+	}
+	if total != 100*time.Second || !parts[2].Ended.Equal(task.Ended) {
+		t.Errorf("Parts do not span the task: %v", parts)
+	}
+}
+
+func TestResponseForLegacyProtocol(t *testing.T) {
+	resp := Response{}
+	resp.Reject(ErrInvalidRequest, errors.New("bad"))
+	resp.Entries = []Entry{{ID: 1, Task: "foo"}}
+
+	legacy, err := json.Marshal(resp.ForProtocol(Cmd{}.Protocol()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"status":"error","error":"bad","body":null}`; string(legacy) != expected {
+		t.Errorf("Expected legacy response %s, got %s", expected, legacy)
+	}
+	current, err := json.Marshal(resp.ForProtocol(ProtocolVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Response
+	if err := json.Unmarshal(current, &decoded); err != nil {
+		t.Fatal(err)
+	} else if decoded.Code != ErrInvalidRequest || len(decoded.Entries) != 1 {
+		t.Errorf("Fields missing from current response: %s", current)
+	}
+}
+
+func TestCompatibleReleases(t *testing.T) {
+	cases := []struct {
+		a, b       string
+		compatible bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.10", true},
+		{"v1.2.3", "1.2.0", true},
+		{"1.2.3", "1.3.3", false},
+		{"1.2.3", "2.2.3", false},
+		{"dev", "1.2.3", false},
+		{"dev", "dev", true},
+	}
+	for _, c := range cases {
+		if CompatibleReleases(c.a, c.b) != c.compatible {
+			t.Errorf("Expected %s and %s compatible: %v", c.a, c.b, c.compatible)
+		}
+	}
+	if !OlderRelease("1.9.3", "1.10.0") || OlderRelease("1.10.0", "1.9.3") || OlderRelease("dev", "1.0.0") {
+		t.Error("Releases not ordered numerically")
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	origin := MakeOrigin(OriginAgent, "laptop")
+	for _, filter := range []string{"agent", "laptop", "agent@laptop"} {
+		if !MatchOrigin(origin, filter) {
+			t.Errorf("Expected %s to match %q", origin, filter)
+		}
+	}
+	for _, filter := range []string{"cli", "desktop", "cli@laptop", "agent@desktop", "agent@"} {
+		if MatchOrigin(origin, filter) {
+			t.Errorf("Expected %s not to match %q", origin, filter)
+		}
+	}
+	if MatchOrigin("", "") {
+		t.Error("Expected unknown origin not to match")
+	}
+}
+
+func TestBudgetWarnings(t *testing.T) {
+	max := Budget{Task: "client-a", Kind: BudgetMax, Period: BudgetWeek, Limit: 20 * time.Hour}
+	min := Budget{Task: "learning", Kind: BudgetMin, Period: BudgetMonth, Limit: 5 * time.Hour}
+	resp := Response{}
+	resp.AddBudgetWarnings([]BudgetStatus{
+		{Budget: max, Logged: 21*time.Hour + 5*time.Minute, State: BudgetExceeded},
+		{Budget: max, Logged: 19 * time.Hour, State: BudgetAtRisk},
+		{Budget: min, Logged: time.Hour, State: BudgetAtRisk},
+		{Budget: min, Logged: 6 * time.Hour, State: BudgetMet},
+	})
+	expected := []string{
+		"Budget exceeded for client-a: 21h05m logged this week, at most 20h00m",
+		"Budget at risk for client-a: 1h00m left this week of at most 20h00m",
+		"Budget at risk for learning: 4h00m to go this month for at least 5h00m",
+	}
+	if len(resp.Warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %v", len(expected), resp.Warnings)
+	}
+	for i, warning := range expected {
+		if resp.Warnings[i] != warning {
+			t.Errorf("Expected warning %q, got %q", warning, resp.Warnings[i])
+		}
+	}
+}
+
+func TestEntryIsBreak(t *testing.T) {
+	if !(Entry{Task: BreakTask}).IsBreak() {
+		t.Error("Expected an entry on the break task to be a break")
+	}
+	if !(Entry{Task: "lunch", Tags: []string{"food", BreakTag}}).IsBreak() {
+		t.Error("Expected an entry tagged as a break to be one")
+	}
+	if (Entry{Task: "coding", Tags: []string{"backend"}}).IsBreak() {
+		t.Error("Expected an entry neither on the break task nor tagged as a break not to be one")
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	before := Entry{Task: "a", Started: start, Ended: start.Add(time.Hour), Note: "note"}
+	if fields := before.ChangedFields(before); len(fields) != 0 {
+		t.Errorf("Expected no changes, got %v", fields)
+	}
+	// Fractions of seconds are not saved
+	after := before
+	after.Ended = after.Ended.Add(time.Millisecond)
+	if fields := after.ChangedFields(before); len(fields) != 0 {
+		t.Errorf("Expected no changes below a second, got %v", fields)
+	}
+	after = Entry{Task: "b", Started: start.Add(time.Minute), Ended: before.Ended, Note: ""}
+	fields := after.ChangedFields(before)
+	if len(fields) != 3 || fields[0] != "task" || fields[1] != "started" || fields[2] != "note" {
+		t.Errorf("Expected task, started and note to change, got %v", fields)
+	}
+}
@@ -0,0 +1,111 @@
+// Package project handles project files, marking a directory and everything
+// below it as belonging to a project.
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileName is the name of project files.
+const FileName = ".tilo"
+
+// Keys in project files. Any other key is taken as metadata.
+const (
+	keyTask = "task"
+	keyTags = "tags"
+)
+
+// File describes a project as defined in a project file.
+type File struct {
+	Path string            // The location of the file
+	Task string            // The project's task
+	Tags []string          // Tags for entries of the project
+	Meta map[string]string // Further information, e.g. the client
+}
+
+// AllTags gives the project's tags, followed by its metadata as key:value,
+// in order of keys.
+func (f *File) AllTags() []string {
+	tags := append([]string{}, f.Tags...)
+	var keys []string
+	for key := range f.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tags = append(tags, key+":"+f.Meta[key])
+	}
+	return tags
+}
+
+// Find the project file for the given directory, i.e. the one in the
+// directory itself or in the closest of its parents. Gives nil if there is
+// none.
+func Find(dir string) (*File, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return Read(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Read a project file. Lines are of the form key = value, anything following
+// a # is ignored.
+func Read(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read project file")
+	}
+	file := File{Path: path, Meta: make(map[string]string)}
+	for i, fullLine := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(strings.SplitN(fullLine, "#", 2)[0])
+		if line == "" {
+			continue
+		}
+		pair := strings.SplitN(line, "=", 2)
+		if len(pair) != 2 {
+			return nil, errors.Errorf("Error in file %s, line %d: %s", path, i+1, fullLine)
+		}
+		key, value := strings.TrimSpace(pair[0]), unquote(strings.TrimSpace(pair[1]))
+		switch key {
+		case keyTask:
+			file.Task = value
+		case keyTags:
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					file.Tags = append(file.Tags, tag)
+				}
+			}
+		default:
+			file.Meta[key] = value
+		}
+	}
+	if file.Task == "" {
+		return nil, errors.Errorf("No task in project file %s", path)
+	}
+	return &file, nil
+}
+
+// Remove a pair of surrounding quotes, if present.
+func unquote(str string) string {
+	if len(str) >= 2 && (str[0] == '"' || str[0] == '\'') && str[len(str)-1] == str[0] {
+		return str[1 : len(str)-1]
+	}
+	return str
+}
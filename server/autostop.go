@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule the active task with the given name to be stopped and saved at
+// the given time, replacing any prior schedule.
+func (s *Server) ScheduleStop(taskName string, at time.Time) error {
+	i := s.activeIndex(taskName)
+	if i < 0 {
+		return errors.Errorf("Task is not active: %s", taskName)
+	}
+	if !at.After(time.Now()) {
+		return errors.New("Cannot schedule a stop in the past")
+	}
+	s.cancelScheduledStop(taskName)
+	s.activeTasks[i].StopAt = at
+	s.stopTimers[taskName] = time.AfterFunc(time.Until(at), func() {
+		s.stopAsScheduled(taskName, at)
+	})
+	s.logInfo("Scheduled stop of task", taskName, "at", at)
+	return nil
+}
+
+// Remove the scheduled stop from the active task with the given name.
+func (s *Server) CancelStop(taskName string) error {
+	i := s.activeIndex(taskName)
+	if i < 0 {
+		return errors.Errorf("Task is not active: %s", taskName)
+	} else if s.activeTasks[i].StopAt.IsZero() {
+		return errors.Errorf("No stop scheduled for task %s", taskName)
+	}
+	s.cancelScheduledStop(taskName)
+	s.activeTasks[i].StopAt = time.Time{}
+	s.logInfo("Cancelled scheduled stop of task", taskName)
+	return nil
+}
+
+// Stop the timer for a scheduled stop, if any.
+func (s *Server) cancelScheduledStop(taskName string) {
+	if timer, ok := s.stopTimers[taskName]; ok {
+		timer.Stop()
+		delete(s.stopTimers, taskName)
+	}
+}
+
+// Stop and save a task when its scheduled time has come. Does nothing if
+// the schedule has changed in the meantime.
+func (s *Server) stopAsScheduled(taskName string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.activeIndex(taskName)
+	if i < 0 || !s.activeTasks[i].StopAt.Equal(at) {
+		return
+	}
+	task, _ := s.StopTask(taskName)
+	s.logInfo("Stopped task as scheduled:", task)
+	if _, err := s.SaveOrDiscard(task); err != nil {
+		s.logError(errors.Wrap(err, "Failed to save task stopped as scheduled"))
+	}
+	s.shutdownIfIdle()
+}
@@ -2,6 +2,7 @@
 package backend
 
 import (
+	"context"
 	"time"
 
 	"github.com/fgahr/tilo/config"
@@ -14,13 +15,100 @@ type Backend interface {
 	Name() string
 	Init() error
 	Close() error
+	// WithContext gives a backend sharing the same storage, whose queries are
+	// cancelled along with the context. Changes are carried out regardless,
+	// so that no task is lost when a client gives up waiting.
+	WithContext(ctx context.Context) Backend
 	Save(task msg.Task) error
+	// SaveEntry saves a completed task as Save does, giving the new entry's ID
+	SaveEntry(task msg.Task) (int64, error)
+	// SaveImported saves an imported entry unless one with the same
+	// fingerprint was imported from the same source before; gives whether it
+	// was saved
+	SaveImported(task msg.Task, source string, fingerprint string) (bool, error)
+	// SaveSplit saves the parts of a span split across tasks, linked together
+	SaveSplit(parts []msg.Task) error
 	Config() config.BackendConfig
 	// RecentTasks gives a summary of the latest activity, limited to the `maxNumber` most recent tasks
 	RecentTasks(maxNumber int) ([]msg.Summary, error)
+	// TaskNames gives the names of all tasks with logged activity
+	TaskNames() ([]string, error)
+	// SaveTaskInfo saves metadata for a task, replacing prior metadata
+	SaveTaskInfo(info msg.TaskInfo) error
+	// TaskInfo gives the metadata of all tasks having any, by name
+	TaskInfo() (map[string]msg.TaskInfo, error)
+	// SaveDayOff marks a day as off, replacing any prior mark for that day
+	SaveDayOff(day msg.DayOff) error
+	// RemoveDayOff removes any mark for the given day (YYYY-MM-DD)
+	RemoveDayOff(date string) error
+	// DaysOff gives all days marked as off between start and end
+	DaysOff(start time.Time, end time.Time) ([]msg.DayOff, error)
+	// SaveBudget saves a budget, replacing any prior one of the same kind and
+	// period for the task
+	SaveBudget(b msg.Budget) error
+	// Budgets gives all budgets, ordered by task
+	Budgets() ([]msg.Budget, error)
+	// RemoveBudgets removes the budgets of a task, only those of the given
+	// kind and period unless empty; gives the number removed
+	RemoveBudgets(task string, kind string, period string) (int64, error)
+	// SaveNote saves a note for the day it was made
+	SaveNote(note msg.Note) error
+	// Notes gives all notes made between start and end, oldest first
+	Notes(start time.Time, end time.Time) ([]msg.Note, error)
+	// TagSummaries gives all tags along with the entries they cover
+	TagSummaries() ([]msg.TagSummary, error)
+	// RenameTag renames a tag on all entries, merging into an existing tag
+	// only if requested; gives the number of affected entries
+	RenameTag(from string, into string, merge bool) (int64, error)
+	// TagTotals sums up the time per tag between start and end, counting
+	// each entry once under its combined tags if exclusive
+	TagTotals(start time.Time, end time.Time, exclusive bool, min time.Duration) ([]msg.TagSummary, error)
+	// DeleteTag removes a tag from all entries; gives the number affected
+	DeleteTag(tag string) (int64, error)
+	// MergeEntries updates an entry's times, note and tags, and removes the
+	// entries merged into it
+	MergeEntries(into msg.Entry, merged []int64) error
+	// UpdateEntry changes an entry's task, times and note, recording which of
+	// them changed in its history
+	UpdateEntry(e msg.Entry) error
+	// EntryHistory gives the changes made to an entry, oldest first
+	EntryHistory(id int64) ([]msg.Edit, error)
+	// DeleteEntry removes an entry along with its tags and fingerprints,
+	// except those of entries logged from templates, see msg.SourceTemplate
+	DeleteEntry(id int64) error
+	// DiscardEntry removes an entry along with its tags, keeping its
+	// fingerprints so that a discarded import is not imported again
+	DiscardEntry(id int64) error
+	// RenameTask moves all entries of a task to another, along with its
+	// metadata and budgets, merging into an existing task only if requested;
+	// gives the number of affected entries
+	RenameTask(from string, into string, merge bool) (int64, error)
+	// PurgeTask removes all entries of a task along with their tags, as well
+	// as the task's metadata and budgets; gives the number of removed entries
+	PurgeTask(name string) (int64, error)
+	// Queries for entries between start and end leave out those shorter than
+	// min, as they are usually accidental.
 	// TODO: Split into several meaningful methods?
-	GetTaskBetween(task string, start time.Time, end time.Time) ([]msg.Summary, error)
-	GetAllTasksBetween(start time.Time, end time.Time) ([]msg.Summary, error)
+	GetTaskBetween(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Summary, error)
+	GetAllTasksBetween(start time.Time, end time.Time, min time.Duration) ([]msg.Summary, error)
+	// Entries gives the individual entries for a task between start and end,
+	// oldest first
+	Entries(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Entry, error)
+	// EntriesOverlapping gives the entries for a task reaching into the span
+	// between start and end, oldest first, as counted by GetTaskBetween
+	EntriesOverlapping(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Entry, error)
+	// EntriesAfter gives all entries with an ID greater than the given one,
+	// in order of their IDs
+	EntriesAfter(id int64) ([]msg.Entry, error)
+	// RestoreEntries saves entries from a backup. They replace all existing
+	// entries, keeping their IDs, or are added to them with new IDs
+	RestoreEntries(entries []msg.Entry, replace bool) error
+	// LastEntry gives the most recently ended entry; its ID is 0 if there is none
+	LastEntry() (msg.Entry, error)
+	// Entry gives the entry with the given ID
+	Entry(id int64) (msg.Entry, error)
+	// SplitEntries gives all entries in the given split group
+	SplitEntries(group int64) ([]msg.Entry, error)
 }
 
 var backends = make(map[string]Backend)
@@ -34,8 +122,8 @@ func RegisterBackend(b Backend) {
 	config.RegisterBackend(b.Config())
 }
 
-// From determines and sets up a backend based on configuration options.
+// From determines the backend to use based on configuration options, nil if
+// there is no such backend.
 func From(conf *config.Opts) Backend {
-	// TODO: Adjust to conf
-	return backends["sqlite3"]
+	return backends[conf.Backend.Value]
 }
@@ -0,0 +1,527 @@
+// Package backendtest checks the behaviour shared by all backends, so that
+// they do not drift apart. Each backend runs it from its own tests.
+package backendtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fgahr/tilo/command/query"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server/backend"
+)
+
+// Opener gives an initialized backend without any data, closed once the test
+// is done.
+type Opener func(t *testing.T) backend.Backend
+
+// Run checks the backend given by open, opening a fresh one for each case.
+func Run(t *testing.T, open Opener) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, b backend.Backend)
+	}{
+		{"IDsNotReused", testIDsNotReused},
+		{"DeleteEntry", testDeleteEntry},
+		{"Fingerprints", testFingerprints},
+		{"TemplateMarks", testTemplateMarks},
+		{"DiscardEntry", testDiscardEntry},
+		{"EntryHistory", testEntryHistory},
+		{"MergeEntries", testMergeEntries},
+		{"RestoreReplace", testRestoreReplace},
+		{"RestoreAdd", testRestoreAdd},
+		{"RenameTask", testRenameTask},
+		{"PurgeTask", testPurgeTask},
+		{"Budgets", testBudgets},
+		{"EntriesOverlapping", testEntriesOverlapping},
+		{"EntriesAtEdges", testEntriesAtEdges},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, open(t))
+		})
+	}
+}
+
+// A point in time the given number of hours after a fixed start.
+func at(hours int) time.Time {
+	return time.Date(2024, 3, 4, 8, 0, 0, 0, time.Local).Add(time.Duration(hours) * time.Hour)
+}
+
+func task(name string, from int, to int, tags ...string) msg.Task {
+	return msg.Task{Name: name, Started: at(from), Ended: at(to), HasEnded: true, Tags: tags}
+}
+
+// Save the task, failing the test on error.
+func save(t *testing.T, b backend.Backend, tsk msg.Task) int64 {
+	id, err := b.SaveEntry(tsk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Save the imported task, failing the test on error; gives whether it was
+// saved.
+func saveImported(t *testing.T, b backend.Backend, tsk msg.Task, source string, fingerprint string) bool {
+	saved, err := b.SaveImported(tsk, source, fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+// The IDs of all entries, in order.
+func ids(t *testing.T, b backend.Backend) []int64 {
+	entries, err := b.EntriesAfter(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// The IDs of the entries of a task, at any time.
+func taskIDs(t *testing.T, b backend.Backend, name string) []int64 {
+	entries, err := b.Entries(name, at(-1000), at(1000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func testIDsNotReused(t *testing.T, b backend.Backend) {
+	save(t, b, task("a", 0, 1))
+	last := save(t, b, task("a", 1, 2))
+	if err := b.DeleteEntry(last); err != nil {
+		t.Fatal(err)
+	}
+	if id := save(t, b, task("a", 2, 3)); id <= last {
+		t.Errorf("Expected an ID greater than %d for a new entry, got %d", last, id)
+	}
+}
+
+func testDeleteEntry(t *testing.T, b backend.Backend) {
+	keep := save(t, b, task("a", 0, 1, "x"))
+	id := save(t, b, task("a", 1, 2, "x", "y"))
+	if err := b.DeleteEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Entry(id); err == nil {
+		t.Error("Expected an error for a deleted entry")
+	}
+	if err := b.DeleteEntry(id); err == nil {
+		t.Error("Expected an error deleting an entry twice")
+	}
+	if got := ids(t, b); !reflect.DeepEqual(got, []int64{keep}) {
+		t.Errorf("Expected entries %v to be left, got %v", []int64{keep}, got)
+	}
+	tags, err := b.TagSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Tag != "x" || tags[0].Entries != 1 {
+		t.Errorf("Expected only tag x on one entry to be left, got %v", tags)
+	}
+}
+
+func testFingerprints(t *testing.T, b backend.Backend) {
+	if !saveImported(t, b, task("a", 0, 1), "csv", "1") {
+		t.Error("Expected a new record to be saved")
+	}
+	if saveImported(t, b, task("a", 0, 1), "csv", "1") {
+		t.Error("Expected a known record not to be saved again")
+	}
+	if !saveImported(t, b, task("a", 0, 1), "other", "1") {
+		t.Error("Expected a record from another source to be saved")
+	}
+	if got := len(ids(t, b)); got != 2 {
+		t.Errorf("Expected 2 entries, got %d", got)
+	}
+
+	// Deleted imports may be imported again
+	for _, id := range ids(t, b) {
+		if err := b.DeleteEntry(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !saveImported(t, b, task("a", 0, 1), "csv", "1") {
+		t.Error("Expected a record to be saved again after deleting its entry")
+	}
+}
+
+func testTemplateMarks(t *testing.T, b backend.Backend) {
+	if !saveImported(t, b, task("standup", 0, 1), msg.SourceTemplate, "standup@2024-03-04") {
+		t.Fatal("Expected the template entry to be saved")
+	}
+	id := ids(t, b)[0]
+	if err := b.DeleteEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if saveImported(t, b, task("standup", 0, 1), msg.SourceTemplate, "standup@2024-03-04") {
+		t.Error("Expected a deleted template entry not to be logged again")
+	}
+
+	if !saveImported(t, b, task("standup", 24, 25), msg.SourceTemplate, "standup@2024-03-05") {
+		t.Fatal("Expected the template entry to be saved")
+	}
+	if _, err := b.PurgeTask("standup"); err != nil {
+		t.Fatal(err)
+	}
+	if saveImported(t, b, task("standup", 24, 25), msg.SourceTemplate, "standup@2024-03-05") {
+		t.Error("Expected a purged template entry not to be logged again")
+	}
+}
+
+func testDiscardEntry(t *testing.T, b backend.Backend) {
+	saveImported(t, b, task("a", 0, 1, "x"), "csv", "1")
+	id := ids(t, b)[0]
+	if err := b.DiscardEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Entry(id); err == nil {
+		t.Error("Expected an error for a discarded entry")
+	}
+	if tags, err := b.TagSummaries(); err != nil || len(tags) != 0 {
+		t.Errorf("Expected the discarded entry's tags to be removed, got %v, %v", tags, err)
+	}
+	if saveImported(t, b, task("a", 0, 1), "csv", "1") {
+		t.Error("Expected a discarded record not to be imported again")
+	}
+	if err := b.DiscardEntry(id); err == nil {
+		t.Error("Expected an error discarding an entry twice")
+	}
+}
+
+func testEntryHistory(t *testing.T, b backend.Backend) {
+	id := save(t, b, task("a", 0, 1))
+	if history, err := b.EntryHistory(id); err != nil || len(history) != 0 {
+		t.Errorf("Expected no history for a new entry, got %v, %v", history, err)
+	}
+	e, err := b.Entry(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Task, e.Ended, e.Modified = "b", at(2), "cli@laptop"
+	if err := b.UpdateEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	e.Modified = "tui@desktop"
+	if err := b.UpdateEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	history, err := b.EntryHistory(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 edits, got %v", history)
+	}
+	if history[0].By != "cli@laptop" || !reflect.DeepEqual(history[0].Fields, []string{"task", "ended"}) {
+		t.Errorf("Expected the first edit to change task and end, got %v", history[0])
+	}
+	if history[1].By != "tui@desktop" || len(history[1].Fields) != 0 {
+		t.Errorf("Expected the second edit to change nothing, got %v", history[1])
+	}
+	if err := b.UpdateEntry(msg.Entry{ID: id + 1, Task: "a", Started: at(0), Ended: at(1)}); err == nil {
+		t.Error("Expected an error updating a missing entry")
+	}
+
+	if err := b.DeleteEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := b.EntryHistory(id); err != nil || len(history) != 0 {
+		t.Errorf("Expected the history to be deleted along with the entry, got %v, %v", history, err)
+	}
+}
+
+func testMergeEntries(t *testing.T, b backend.Backend) {
+	saveImported(t, b, task("a", 0, 1, "x"), "csv", "1")
+	saveImported(t, b, task("a", 1, 2, "y"), "csv", "2")
+	other := save(t, b, task("b", 2, 3))
+	all := ids(t, b)
+	into, merged := all[0], all[1]
+
+	e := msg.Entry{ID: into, Task: "a", Started: at(0), Ended: at(2), Note: "merged", Tags: []string{"x", "y"}}
+	if err := b.MergeEntries(e, []int64{merged}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, b); !reflect.DeepEqual(got, []int64{into, other}) {
+		t.Errorf("Expected entries %v to be left, got %v", []int64{into, other}, got)
+	}
+	got, err := b.Entry(into)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Ended.Equal(at(2)) || got.Note != "merged" || !reflect.DeepEqual(got.Tags, []string{"x", "y"}) {
+		t.Errorf("Expected the merged entry, got %v", got)
+	}
+	// Both records stay known, so that merged duplicates are not imported again
+	for _, fingerprint := range []string{"1", "2"} {
+		if saveImported(t, b, task("a", 0, 1), "csv", fingerprint) {
+			t.Errorf("Expected record %s not to be imported again after merging", fingerprint)
+		}
+	}
+}
+
+func testRestoreReplace(t *testing.T, b backend.Backend) {
+	saveImported(t, b, task("a", 0, 1, "x"), "csv", "1")
+	var last int64
+	for i := 1; i < 10; i++ {
+		last = save(t, b, task("a", i, i+1))
+	}
+	restored := []msg.Entry{
+		{ID: 2, Task: "b", Started: at(0), Ended: at(1), Tags: []string{"y"}},
+		{ID: 4, Task: "b", Started: at(1), Ended: at(2), Note: "note"},
+	}
+	if err := b.RestoreEntries(restored, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, b); !reflect.DeepEqual(got, []int64{2, 4}) {
+		t.Errorf("Expected the restored entries %v, got %v", []int64{2, 4}, got)
+	}
+	if e, err := b.Entry(2); err != nil || e.Task != "b" || !reflect.DeepEqual(e.Tags, []string{"y"}) {
+		t.Errorf("Expected entry 2 as restored, got %v, %v", e, err)
+	}
+	tags, err := b.TagSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Tag != "y" {
+		t.Errorf("Expected only the restored tags, got %v", tags)
+	}
+	// Fingerprints referred to the replaced entries
+	if !saveImported(t, b, task("a", 0, 1), "csv", "1") {
+		t.Error("Expected fingerprints to be dropped when replacing entries")
+	}
+	if id := save(t, b, task("c", 0, 1)); id <= last {
+		t.Errorf("Expected an ID greater than %d after restoring, got %d", last, id)
+	}
+}
+
+func testRestoreAdd(t *testing.T, b backend.Backend) {
+	first := save(t, b, task("a", 0, 1))
+	restored := []msg.Entry{
+		{ID: first, Task: "b", Started: at(0), Ended: at(1)},
+		{ID: first + 1, Task: "b", Started: at(1), Ended: at(2), Tags: []string{"y"}},
+	}
+	if err := b.RestoreEntries(restored, false); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := b.Entry(first); err != nil || e.Task != "a" {
+		t.Errorf("Expected existing entry %d to be kept, got %v, %v", first, e, err)
+	}
+	added := taskIDs(t, b, "b")
+	if len(added) != 2 || added[0] <= first {
+		t.Fatalf("Expected 2 entries added with new IDs, got %v", added)
+	}
+	if e, err := b.Entry(added[1]); err != nil || !reflect.DeepEqual(e.Tags, []string{"y"}) {
+		t.Errorf("Expected the added entry's tags, got %v, %v", e, err)
+	}
+}
+
+func testRenameTask(t *testing.T, b backend.Backend) {
+	save(t, b, task("a", 0, 1))
+	save(t, b, task("a", 1, 2))
+	save(t, b, task("b", 2, 3))
+	if err := b.SaveTaskInfo(msg.TaskInfo{Name: "a", Description: "Task a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveBudget(msg.Budget{Task: "a", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.RenameTask("a", "b", false); err == nil {
+		t.Error("Expected an error renaming into an existing task without merging")
+	}
+	if _, err := b.RenameTask("missing", "c", false); err == nil {
+		t.Error("Expected an error renaming a task without entries")
+	}
+	n, err := b.RenameTask("a", "c", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(taskIDs(t, b, "c")) != 2 || len(taskIDs(t, b, "a")) != 0 {
+		t.Errorf("Expected 2 entries to be moved, got %d", n)
+	}
+	infos, err := b.TaskInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := infos["a"]; ok || infos["c"].Description != "Task a" {
+		t.Errorf("Expected the metadata to be moved, got %v", infos)
+	}
+	budgets, err := b.Budgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 1 || budgets[0].Task != "c" {
+		t.Errorf("Expected the budget to be moved, got %v", budgets)
+	}
+
+	// The budget of the task merged into is kept
+	if err := b.SaveBudget(msg.Budget{Task: "b", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: 2 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.RenameTask("c", "b", true); err != nil || n != 2 {
+		t.Fatalf("Expected 2 entries to be merged, got %d, %v", n, err)
+	}
+	if got := len(taskIDs(t, b, "b")); got != 3 {
+		t.Errorf("Expected 3 entries after merging, got %d", got)
+	}
+	budgets, err = b.Budgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 1 || budgets[0].Task != "b" || budgets[0].Limit != 2*time.Hour {
+		t.Errorf("Expected only the budget merged into, got %v", budgets)
+	}
+}
+
+func testPurgeTask(t *testing.T, b backend.Backend) {
+	save(t, b, task("a", 0, 1, "x"))
+	saveImported(t, b, task("a", 1, 2), "csv", "1")
+	keep := save(t, b, task("b", 2, 3, "x"))
+	if err := b.SaveTaskInfo(msg.TaskInfo{Name: "a", Description: "Task a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveBudget(msg.Budget{Task: "a", Kind: msg.BudgetMin, Period: msg.BudgetMonth, Limit: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := b.PurgeTask("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 entries to be purged, got %d", n)
+	}
+	if got := ids(t, b); !reflect.DeepEqual(got, []int64{keep}) {
+		t.Errorf("Expected entries %v to be left, got %v", []int64{keep}, got)
+	}
+	tags, err := b.TagSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Entries != 1 {
+		t.Errorf("Expected the purged entries' tags to be removed, got %v", tags)
+	}
+	infos, err := b.TaskInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets, err := b.Budgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 || len(budgets) != 0 {
+		t.Errorf("Expected metadata and budgets to be removed, got %v, %v", infos, budgets)
+	}
+	if !saveImported(t, b, task("a", 1, 2), "csv", "1") {
+		t.Error("Expected a purged record to be imported again")
+	}
+}
+
+func testBudgets(t *testing.T, b backend.Backend) {
+	for _, budget := range []msg.Budget{
+		{Task: "b", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: time.Hour},
+		{Task: "a", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: time.Hour},
+		{Task: "a", Kind: msg.BudgetMin, Period: msg.BudgetWeek, Limit: time.Hour},
+		// Replaces the first one
+		{Task: "b", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: 3 * time.Hour},
+	} {
+		if err := b.SaveBudget(budget); err != nil {
+			t.Fatal(err)
+		}
+	}
+	budgets, err := b.Budgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []msg.Budget{
+		{Task: "a", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: time.Hour},
+		{Task: "a", Kind: msg.BudgetMin, Period: msg.BudgetWeek, Limit: time.Hour},
+		{Task: "b", Kind: msg.BudgetMax, Period: msg.BudgetWeek, Limit: 3 * time.Hour},
+	}
+	if !reflect.DeepEqual(budgets, expected) {
+		t.Errorf("Expected budgets %v, got %v", expected, budgets)
+	}
+
+	if n, err := b.RemoveBudgets("a", msg.BudgetMin, msg.BudgetWeek); err != nil || n != 1 {
+		t.Errorf("Expected 1 budget to be removed, got %d, %v", n, err)
+	}
+	if n, err := b.RemoveBudgets("b", "", ""); err != nil || n != 1 {
+		t.Errorf("Expected 1 budget to be removed, got %d, %v", n, err)
+	}
+	budgets, err = b.Budgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(budgets, expected[:1]) {
+		t.Errorf("Expected budgets %v, got %v", expected[:1], budgets)
+	}
+}
+
+func testEntriesOverlapping(t *testing.T, b backend.Backend) {
+	// Reaching days past either edge of the span
+	long := save(t, b, task("a", -72, 72))
+	inside := save(t, b, task("a", 1, 2))
+	save(t, b, task("a", 10, 11))
+	save(t, b, task("b", 1, 2))
+
+	entries, err := b.EntriesOverlapping("a", at(0), at(10), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, e := range entries {
+		got = append(got, e.ID)
+	}
+	if !reflect.DeepEqual(got, []int64{long, inside}) {
+		t.Errorf("Expected entries %v, got %v", []int64{long, inside}, got)
+	}
+	all, err := b.EntriesOverlapping(query.TskAllTasks, at(0), at(10), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected 3 entries for all tasks, got %d", len(all))
+	}
+	// Shorter ones are left out
+	if short, err := b.EntriesOverlapping("a", at(0), at(10), 2*time.Hour); err != nil || len(short) != 1 {
+		t.Errorf("Expected only the long entry, got %v, %v", short, err)
+	}
+
+	// Counted as the totals count them
+	sum, err := b.GetTaskBetween("a", at(0), at(10), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum) != 1 || sum[0].Total != 11*time.Hour {
+		t.Errorf("Expected a total of 11h, got %v", sum)
+	}
+}
+
+func testEntriesAtEdges(t *testing.T, b backend.Backend) {
+	// E.g. split at midnight by a rollover
+	save(t, b, task("a", -1, 0))
+	last := save(t, b, task("a", 9, 10))
+	save(t, b, task("a", 10, 11))
+
+	entries, err := b.EntriesOverlapping("a", at(0), at(10), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != last {
+		t.Errorf("Expected only the entry ending at the end of the span, got %v", entries)
+	}
+}
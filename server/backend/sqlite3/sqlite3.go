@@ -2,13 +2,20 @@
 //
 // Each record has two timestamps, "started" and "ended". They are saved as
 // Unix time stamps because some arithmetic is performed on them which is
-// cumbersome when storing timestamps as strings.
+// cumbersome when storing timestamps as strings. Records resulting from a
+// span split across several tasks share a common "split_group". Records are
+// identified by an explicit "id" so that IDs remain stable, e.g. on VACUUM,
+// and are not reused after deleting an entry.
 package sqlite3
 
 import (
+	"context"
 	"database/sql"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/fgahr/tilo/command/query"
@@ -21,6 +28,20 @@ import (
 
 const (
 	backendName = "sqlite3"
+	// Columns selected for msg.Entry values, see entriesFromQuery.
+	entryColumns = "id, name, started, ended, ifnull(split_group, 0), ifnull(note, ''), " +
+		"ifnull(origin, ''), ifnull(modified_by, ''), " +
+		"(SELECT ifnull(group_concat(tag.name, ','), '') FROM tag WHERE tag.entry = task.id)"
+	// Definition of the task table. IDs of deleted entries are never reused.
+	taskTable = `(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	started INTEGER NOT NULL,
+	ended INTEGER NOT NULL,
+	split_group INTEGER,
+	note TEXT,
+	origin TEXT,
+	modified_by TEXT)`
 )
 
 func init() {
@@ -56,6 +77,7 @@ func (c *sqliteConf) AcceptedItems() []*config.Item {
 type SQLite struct {
 	conf sqliteConf
 	db   *sql.DB
+	ctx  context.Context // For queries, see WithContext
 }
 
 func (s *SQLite) Config() config.BackendConfig {
@@ -66,6 +88,20 @@ func (s *SQLite) Name() string {
 	return backendName
 }
 
+// WithContext gives a backend sharing the database connection, whose queries
+// are cancelled along with the context. Changes are always carried out.
+func (s *SQLite) WithContext(ctx context.Context) backend.Backend {
+	return &SQLite{conf: s.conf, db: s.db, ctx: ctx}
+}
+
+// The context of queries, see WithContext.
+func (s *SQLite) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
 func (s *SQLite) Init() error {
 	if s == nil {
 		return errors.New("No backend present")
@@ -76,17 +112,112 @@ func (s *SQLite) Init() error {
 	}
 	s.db = db
 	// Setup schema
-	_, err = s.db.Exec(`
-CREATE TABLE IF NOT EXISTS task (
-	name TEXT NOT NULL,
-	started INTEGER NOT NULL,
-	ended INTEGER NOT NULL);`)
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS task " + taskTable + ";")
 	if err != nil {
 		return errors.Wrap(err, "Unable to setup database")
 	}
+	if err = s.addColumnIfMissing("task", "split_group", "INTEGER"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addColumnIfMissing("task", "note", "TEXT"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addColumnIfMissing("task", "origin", "TEXT"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addColumnIfMissing("task", "modified_by", "TEXT"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addTaskIDs(); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
 
 	_, err = s.db.Exec(
 		"CREATE INDEX IF NOT EXISTS task_name ON task (name);")
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	// Days off are calendar days rather than points in time, hence stored
+	// as YYYY-MM-DD which also sorts correctly.
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS day_off (
+	date TEXT PRIMARY KEY,
+	kind TEXT NOT NULL);`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS task_info (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL,
+	icon TEXT NOT NULL DEFAULT '',
+	archived INTEGER NOT NULL DEFAULT 0);`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addColumnIfMissing("task_info", "icon", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	if err = s.addColumnIfMissing("task_info", "archived", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	// Foreign keys are not enforced, so tags, edits and fingerprints are
+	// deleted along with their entries explicitly, see deleteEntry
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS tag (
+	entry INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	PRIMARY KEY (entry, name));`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS note (
+	created INTEGER NOT NULL,
+	text TEXT NOT NULL);`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	// Limits are stored in seconds
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS budget (
+	task TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	period TEXT NOT NULL,
+	seconds INTEGER NOT NULL,
+	PRIMARY KEY (task, kind, period));`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	// Identifies imported records, so that they are imported only once
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS fingerprint (
+	source TEXT NOT NULL,
+	value TEXT NOT NULL,
+	entry INTEGER NOT NULL,
+	PRIMARY KEY (source, value));`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+
+	// The history of changes to entries, see UpdateEntry. The changed fields
+	// are comma-separated.
+	_, err = s.db.Exec(`
+CREATE TABLE IF NOT EXISTS edit (
+	entry INTEGER NOT NULL,
+	changed INTEGER NOT NULL,
+	modified_by TEXT,
+	fields TEXT NOT NULL);`)
+	if err != nil {
+		return errors.Wrap(err, "Unable to setup database")
+	}
+	_, err = s.db.Exec("CREATE INDEX IF NOT EXISTS edit_entry ON edit (entry);")
 	return errors.Wrap(err, "Unable to setup database")
 }
 
@@ -98,16 +229,222 @@ func (s *SQLite) Close() error {
 }
 
 func (s *SQLite) Save(task msg.Task) error {
+	_, err := s.SaveEntry(task)
+	return err
+}
+
+func (s *SQLite) SaveEntry(task msg.Task) (int64, error) {
 	if s == nil {
-		return errors.New("No backend present")
+		return 0, errors.New("No backend present")
 	}
 	if task.IsRunning() {
 		panic("Cannot save an active task.")
 	}
-	_, err := s.db.Exec(
-		"INSERT INTO task (name, started, ended) VALUES (?, ?, ?);",
-		task.Name, task.Started.Unix(), task.Ended.Unix())
-	return errors.Wrapf(err, "Error while saving %v", task)
+	tx, err := s.db.Begin()
+	var id int64
+	if err == nil {
+		if id, err = insertTask(tx, task, nil); err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+	return id, errors.Wrapf(err, "Error while saving %v", task)
+}
+
+func (s *SQLite) SaveImported(task msg.Task, source string, fingerprint string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, errors.Wrapf(err, "Error while saving %v", task)
+	}
+	saved, err := insertImported(tx, task, source, fingerprint)
+	if err != nil {
+		tx.Rollback()
+		return false, errors.Wrapf(err, "Error while saving %v", task)
+	}
+	return saved, errors.Wrapf(tx.Commit(), "Error while saving %v", task)
+}
+
+func insertImported(tx *sql.Tx, task msg.Task, source string, fingerprint string) (bool, error) {
+	var known int
+	err := tx.QueryRow("SELECT count(*) FROM fingerprint WHERE source = ? AND value = ?;",
+		source, fingerprint).Scan(&known)
+	if err != nil || known > 0 {
+		return false, err
+	}
+	id, err := insertTask(tx, task, nil)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("INSERT INTO fingerprint (source, value, entry) VALUES (?, ?, ?);", source, fingerprint, id)
+	return err == nil, err
+}
+
+// Insert a task along with its tags, giving its ID. The split group may be
+// nil.
+func insertTask(tx *sql.Tx, task msg.Task, group interface{}) (int64, error) {
+	res, err := tx.Exec(
+		"INSERT INTO task (name, started, ended, split_group, note, origin) VALUES (?, ?, ?, ?, nullif(?, ''), nullif(?, ''));",
+		task.Name, task.Started.Unix(), task.Ended.Unix(), group, task.Note, task.Origin)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range task.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tag (entry, name) VALUES (?, ?);", id, tag); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// Save the parts of a split span in a single transaction, linked by a new
+// split group.
+func (s *SQLite) SaveSplit(parts []msg.Task) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error while saving split task")
+	}
+	var group int64
+	err = tx.QueryRow("SELECT ifnull(max(split_group), 0) + 1 FROM task;").Scan(&group)
+	for _, part := range parts {
+		if err != nil {
+			break
+		}
+		_, err = insertTask(tx, part, group)
+	}
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "Error while saving split task %v", parts)
+	}
+	return errors.Wrap(tx.Commit(), "Error while saving split task")
+}
+
+func (s *SQLite) RestoreEntries(entries []msg.Entry, replace bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error while restoring entries")
+	}
+	if err = restoreEntries(tx, entries, replace); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error while restoring entries")
+	}
+	return errors.Wrap(tx.Commit(), "Error while restoring entries")
+}
+
+func restoreEntries(tx *sql.Tx, entries []msg.Entry, replace bool) error {
+	// Added entries keep their split groups apart from existing ones
+	groups := make(map[int64]int64)
+	var nextGroup int64
+	if replace {
+		for _, stmt := range []string{"DELETE FROM tag;", "DELETE FROM edit;", "DELETE FROM fingerprint;", "DELETE FROM task;"} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	} else if err := tx.QueryRow("SELECT ifnull(max(split_group), 0) + 1 FROM task;").Scan(&nextGroup); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var id, group interface{}
+		if replace {
+			id = e.ID
+			if e.SplitGroup != 0 {
+				group = e.SplitGroup
+			}
+		} else if e.SplitGroup != 0 {
+			if _, ok := groups[e.SplitGroup]; !ok {
+				groups[e.SplitGroup] = nextGroup
+				nextGroup++
+			}
+			group = groups[e.SplitGroup]
+		}
+		res, err := tx.Exec(
+			"INSERT INTO task (id, name, started, ended, split_group, note, origin, modified_by) "+
+				"VALUES (?, ?, ?, ?, ?, nullif(?, ''), nullif(?, ''), nullif(?, ''));",
+			id, e.Task, e.Started.Unix(), e.Ended.Unix(), group, e.Note, e.Origin, e.Modified)
+		if err != nil {
+			return err
+		}
+		entryID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, tag := range e.Tags {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO tag (entry, name) VALUES (?, ?);", entryID, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Databases created by earlier versions may lack columns added since.
+func (s *SQLite) addColumnIfMissing(table string, column string, def string) error {
+	if exists, err := s.hasColumn(table, column); err != nil || exists {
+		return err
+	}
+	_, err := s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + def + ";")
+	return err
+}
+
+// Whether the table has a column with the given name.
+func (s *SQLite) hasColumn(table string, column string) (bool, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT name FROM pragma_table_info(?);", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// Databases created by earlier versions rely on implicit row IDs which may
+// change, or on IDs which are reused once the newest entry is deleted. The
+// table is rebuilt with IDs that are never reused, keeping the existing ones.
+func (s *SQLite) addTaskIDs() error {
+	hasID, err := s.hasColumn("task", "id")
+	if err != nil {
+		return err
+	}
+	var def string
+	err = s.db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'task';").Scan(&def)
+	if err != nil || (hasID && strings.Contains(strings.ToUpper(def), "AUTOINCREMENT")) {
+		return err
+	}
+	idColumn := "rowid"
+	if hasID {
+		idColumn = "id"
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE task_with_id " + taskTable + ";",
+		`INSERT INTO task_with_id (id, name, started, ended, split_group, note, origin, modified_by)
+SELECT ` + idColumn + `, name, started, ended, split_group, note, origin, modified_by FROM task;`,
+		"DROP TABLE task;",
+		"ALTER TABLE task_with_id RENAME TO task;",
+		"CREATE INDEX IF NOT EXISTS task_name ON task (name);",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func allTasksFromQuery(rows *sql.Rows) ([]msg.Summary, error) {
@@ -132,7 +469,7 @@ func allTasksFromQuery(rows *sql.Rows) ([]msg.Summary, error) {
 }
 
 func (s *SQLite) RecentTasks(maxNumber int) ([]msg.Summary, error) {
-	rows, err := s.db.Query(`
+	rows, err := s.db.QueryContext(s.context(), `
 SELECT name, ended - started, started, ended FROM task
 ORDER BY ended DESC
 LIMIT ?;
@@ -144,20 +481,83 @@ LIMIT ?;
 	return allTasksFromQuery(rows)
 }
 
+func (s *SQLite) TaskNames() ([]string, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT DISTINCT name FROM task ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Save task metadata. Rows without any metadata are removed.
+func (s *SQLite) SaveTaskInfo(info msg.TaskInfo) error {
+	var err error
+	if info.IsEmpty() {
+		_, err = s.db.Exec("DELETE FROM task_info WHERE name = ?;", info.Name)
+	} else {
+		_, err = s.db.Exec(
+			"INSERT OR REPLACE INTO task_info (name, description, icon, archived) VALUES (?, ?, ?, ?);",
+			info.Name, info.Description, info.Icon, info.Archived)
+	}
+	return errors.Wrapf(err, "Error while saving information on task %s", info.Name)
+}
+
+func (s *SQLite) TaskInfo() (map[string]msg.TaskInfo, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT name, description, icon, archived FROM task_info;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	infos := make(map[string]msg.TaskInfo)
+	for rows.Next() {
+		var info msg.TaskInfo
+		if err := rows.Scan(&info.Name, &info.Description, &info.Icon, &info.Archived); err != nil {
+			return infos, err
+		}
+		infos[info.Name] = info
+	}
+	return infos, rows.Err()
+}
+
+// Totals between start and end only count the part of each entry within
+// them, so that an entry spanning midnight counts towards both days. The
+// overlap takes end and start as parameters, in this order, as does the
+// condition selecting the entries concerned.
+const (
+	overlap  = "min(task.ended, ?) - max(task.started, ?)"
+	overlaps = "task.started < ? AND task.ended > ?"
+)
+
+// The minimum duration of entries in whole seconds, as stored. Entries of
+// any duration count if there is no minimum.
+func minSeconds(min time.Duration) int64 {
+	return int64(math.Ceil(min.Seconds()))
+}
+
 // Query the total time spent on a task between start and end.
-func (s *SQLite) GetTaskBetween(task string, start time.Time, end time.Time) ([]msg.Summary, error) {
+func (s *SQLite) GetTaskBetween(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Summary, error) {
 	if task == query.TskAllTasks {
-		return s.GetAllTasksBetween(start, end)
+		return s.GetAllTasksBetween(start, end, min)
 	}
 	// NOTE: total() is a non-standard function present in SQLite which is
 	// superior to sum() in terms of NULL-handling
-	rows, err := s.db.Query(`
-SELECT total(ended - started), min(started), max(ended) FROM task
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT total(`+overlap+`), min(max(started, ?)), max(min(ended, ?)) FROM task
 WHERE name = ?
-  AND started >= ?
-  AND ended < ?
+  AND `+overlaps+`
+  AND ended - started >= ?
 GROUP BY name;`,
-		task, start.Unix(), end.Unix())
+		end.Unix(), start.Unix(), start.Unix(), end.Unix(),
+		task, end.Unix(), start.Unix(), minSeconds(min))
 	if err != nil {
 		return nil, err
 	}
@@ -180,16 +580,580 @@ GROUP BY name;`,
 }
 
 // Query the total time spent on all tasks between start and end.
-func (s *SQLite) GetAllTasksBetween(start, end time.Time) ([]msg.Summary, error) {
-	rows, err := s.db.Query(`
-SELECT name, total(ended-started), min(started), max(ended) FROM task
-WHERE started >= ?
-  AND ended < ?
+func (s *SQLite) GetAllTasksBetween(start, end time.Time, min time.Duration) ([]msg.Summary, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT name, total(`+overlap+`), min(max(started, ?)), max(min(ended, ?)) FROM task
+WHERE `+overlaps+`
+  AND ended - started >= ?
 GROUP BY name;`,
-		start.Unix(), end.Unix())
+		end.Unix(), start.Unix(), start.Unix(), end.Unix(),
+		end.Unix(), start.Unix(), minSeconds(min))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	return allTasksFromQuery(rows)
 }
+
+func (s *SQLite) SaveDayOff(day msg.DayOff) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO day_off (date, kind) VALUES (?, ?);",
+		day.Date, day.Kind)
+	return errors.Wrapf(err, "Error while saving day off %s", day.Date)
+}
+
+func (s *SQLite) RemoveDayOff(date string) error {
+	_, err := s.db.Exec("DELETE FROM day_off WHERE date = ?;", date)
+	return errors.Wrapf(err, "Error while removing day off %s", date)
+}
+
+// Query all days off from the day containing start up to, excluding, end.
+func (s *SQLite) DaysOff(start time.Time, end time.Time) ([]msg.DayOff, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT date, kind FROM day_off
+WHERE date >= ?
+  AND date < ?
+ORDER BY date;`,
+		start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var days []msg.DayOff
+	for rows.Next() {
+		var day msg.DayOff
+		if err := rows.Scan(&day.Date, &day.Kind); err != nil {
+			return days, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+func (s *SQLite) SaveBudget(b msg.Budget) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO budget (task, kind, period, seconds) VALUES (?, ?, ?, ?);",
+		b.Task, b.Kind, b.Period, int64(b.Limit.Seconds()))
+	return errors.Wrapf(err, "Error while saving budget for %s", b.Task)
+}
+
+func (s *SQLite) Budgets() ([]msg.Budget, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT task, kind, period, seconds FROM budget
+ORDER BY task, period, kind;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var budgets []msg.Budget
+	for rows.Next() {
+		var b msg.Budget
+		var seconds int64
+		if err := rows.Scan(&b.Task, &b.Kind, &b.Period, &seconds); err != nil {
+			return budgets, err
+		}
+		b.Limit = time.Duration(seconds) * time.Second
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+func (s *SQLite) RemoveBudgets(task string, kind string, period string) (int64, error) {
+	res, err := s.db.Exec(`
+DELETE FROM budget
+WHERE task = ?
+  AND (kind = ? OR ? = '')
+  AND (period = ? OR ? = '');`,
+		task, kind, kind, period, period)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error while removing budgets for %s", task)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) SaveNote(note msg.Note) error {
+	_, err := s.db.Exec(
+		"INSERT INTO note (created, text) VALUES (?, ?);",
+		note.Time.Unix(), note.Text)
+	return errors.Wrap(err, "Error while saving note")
+}
+
+func (s *SQLite) Notes(start time.Time, end time.Time) ([]msg.Note, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT created, text FROM note
+WHERE created >= ?
+  AND created < ?
+ORDER BY created;`,
+		start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notes []msg.Note
+	for rows.Next() {
+		var created int64
+		var text string
+		if err := rows.Scan(&created, &text); err != nil {
+			return notes, err
+		}
+		notes = append(notes, msg.Note{Time: time.Unix(created, 0), Text: text})
+	}
+	return notes, rows.Err()
+}
+
+// Query the individual entries for a task between start and end.
+func (s *SQLite) Entries(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+WHERE (name = ? OR ? = ?)
+  AND started >= ?
+  AND ended < ?
+  AND ended - started >= ?
+ORDER BY started, id;`,
+		task, task, query.TskAllTasks, start.Unix(), end.Unix(), minSeconds(min))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return entriesFromQuery(rows)
+}
+
+// Query the entries for a task reaching into the span between start and end.
+func (s *SQLite) EntriesOverlapping(task string, start time.Time, end time.Time, min time.Duration) ([]msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+WHERE (name = ? OR ? = ?)
+  AND `+overlaps+`
+  AND ended - started >= ?
+ORDER BY started, id;`,
+		task, task, query.TskAllTasks, end.Unix(), start.Unix(), minSeconds(min))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return entriesFromQuery(rows)
+}
+
+func (s *SQLite) Entry(id int64) (msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+WHERE id = ?;`, id)
+	if err != nil {
+		return msg.Entry{}, err
+	}
+	defer rows.Close()
+	entries, err := entriesFromQuery(rows)
+	if err != nil {
+		return msg.Entry{}, err
+	} else if len(entries) == 0 {
+		return msg.Entry{}, errors.Errorf("No entry with ID %d", id)
+	}
+	return entries[0], nil
+}
+
+func (s *SQLite) EntriesAfter(id int64) ([]msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+WHERE id > ?
+ORDER BY id;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return entriesFromQuery(rows)
+}
+
+func (s *SQLite) LastEntry() (msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+ORDER BY ended DESC, id DESC
+LIMIT 1;`)
+	if err != nil {
+		return msg.Entry{}, err
+	}
+	defer rows.Close()
+	entries, err := entriesFromQuery(rows)
+	if err != nil || len(entries) == 0 {
+		return msg.Entry{}, err
+	}
+	return entries[0], nil
+}
+
+func (s *SQLite) SplitEntries(group int64) ([]msg.Entry, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT `+entryColumns+` FROM task
+WHERE split_group = ?
+ORDER BY started, id;`, group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return entriesFromQuery(rows)
+}
+
+// Entries from a query selecting the entry columns.
+func entriesFromQuery(rows *sql.Rows) ([]msg.Entry, error) {
+	var entries []msg.Entry
+	for rows.Next() {
+		var e msg.Entry
+		var started, ended int64
+		var tags string
+		if err := rows.Scan(&e.ID, &e.Task, &started, &ended, &e.SplitGroup, &e.Note, &e.Origin, &e.Modified, &tags); err != nil {
+			return entries, err
+		}
+		if tags != "" {
+			e.Tags = strings.Split(tags, ",")
+			sort.Strings(e.Tags)
+		}
+		e.Started, e.Ended = time.Unix(started, 0), time.Unix(ended, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Summarize all tags with the number of entries and total time they cover.
+func (s *SQLite) TagSummaries() ([]msg.TagSummary, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT tag.name, count(*), total(task.ended - task.started) FROM tag
+JOIN task ON task.id = tag.entry
+GROUP BY tag.name
+ORDER BY tag.name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return tagSummariesFromQuery(rows)
+}
+
+// Sum up the time per tag for entries between start and end. Untagged
+// entries are summarized under the empty tag. In exclusive mode, each entry
+// is counted once, under the combination of all its tags, joined by '+'.
+func (s *SQLite) TagTotals(start time.Time, end time.Time, exclusive bool, min time.Duration) ([]msg.TagSummary, error) {
+	tags := "tag"
+	if exclusive {
+		tags = `(
+SELECT entry, group_concat(name, '+') AS name
+FROM (SELECT entry, name FROM tag ORDER BY entry, name)
+GROUP BY entry)`
+	}
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT ifnull(tags.name, ''), count(*), total(`+overlap+`) FROM task
+LEFT JOIN `+tags+` AS tags ON tags.entry = task.id
+WHERE `+overlaps+`
+  AND task.ended - task.started >= ?
+GROUP BY 1
+ORDER BY 1;`,
+		end.Unix(), start.Unix(), end.Unix(), start.Unix(), minSeconds(min))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return tagSummariesFromQuery(rows)
+}
+
+func tagSummariesFromQuery(rows *sql.Rows) ([]msg.TagSummary, error) {
+	var summaries []msg.TagSummary
+	for rows.Next() {
+		var sum msg.TagSummary
+		var seconds float64
+		if err := rows.Scan(&sum.Tag, &sum.Entries, &seconds); err != nil {
+			return summaries, err
+		}
+		sum.Total = time.Duration(seconds) * time.Second
+		summaries = append(summaries, sum)
+	}
+	return summaries, rows.Err()
+}
+
+// Move all entries tagged as `from` to `into`. Unless merging, the target
+// must not be in use. Gives the number of affected entries.
+func (s *SQLite) RenameTag(from string, into string, merge bool) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	affected, err := renameTag(tx, from, into, merge)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return affected, tx.Commit()
+}
+
+func renameTag(tx *sql.Tx, from string, into string, merge bool) (int64, error) {
+	var n, existing int64
+	if err := tx.QueryRow("SELECT count(*) FROM tag WHERE name = ?;", from).Scan(&n); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, errors.Errorf("No such tag: %s", from)
+	}
+	if err := tx.QueryRow("SELECT count(*) FROM tag WHERE name = ?;", into).Scan(&existing); err != nil {
+		return 0, err
+	} else if existing > 0 && !merge {
+		return 0, errors.Errorf("Tag %s already exists, merge instead", into)
+	}
+	// Entries carrying both tags keep a single one.
+	if _, err := tx.Exec(`
+UPDATE tag SET name = ?
+WHERE name = ?
+  AND entry NOT IN (SELECT entry FROM tag WHERE name = ?);`, into, from, into); err != nil {
+		return 0, err
+	}
+	_, err := tx.Exec("DELETE FROM tag WHERE name = ?;", from)
+	return n, err
+}
+
+// Remove the tag from all entries. Gives the number of affected entries.
+func (s *SQLite) DeleteTag(tag string) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM tag WHERE name = ?;", tag)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = errors.Errorf("No such tag: %s", tag)
+	}
+	return n, err
+}
+
+// Update the entry, recording the change in its history.
+func (s *SQLite) UpdateEntry(e msg.Entry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error while updating entry")
+	}
+	if err = updateEntry(tx, e); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "Error while updating entry")
+}
+
+func updateEntry(tx *sql.Tx, e msg.Entry) error {
+	var before msg.Entry
+	var started, ended int64
+	err := tx.QueryRow("SELECT name, started, ended, ifnull(note, '') FROM task WHERE id = ?;", e.ID).
+		Scan(&before.Task, &started, &ended, &before.Note)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("No entry with ID %d", e.ID)
+	} else if err != nil {
+		return errors.Wrap(err, "Error while updating entry")
+	}
+	before.Started, before.Ended = time.Unix(started, 0), time.Unix(ended, 0)
+	_, err = tx.Exec(
+		"UPDATE task SET name = ?, started = ?, ended = ?, note = nullif(?, ''), modified_by = nullif(?, '') WHERE id = ?;",
+		e.Task, e.Started.Unix(), e.Ended.Unix(), e.Note, e.Modified, e.ID)
+	if err != nil {
+		return errors.Wrap(err, "Error while updating entry")
+	}
+	_, err = tx.Exec("INSERT INTO edit (entry, changed, modified_by, fields) VALUES (?, ?, nullif(?, ''), ?);",
+		e.ID, time.Now().Unix(), e.Modified, strings.Join(e.ChangedFields(before), ","))
+	return errors.Wrap(err, "Error while updating entry")
+}
+
+func (s *SQLite) EntryHistory(id int64) ([]msg.Edit, error) {
+	rows, err := s.db.QueryContext(s.context(), `
+SELECT changed, ifnull(modified_by, ''), fields FROM edit
+WHERE entry = ?
+ORDER BY changed, rowid;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []msg.Edit
+	for rows.Next() {
+		var changed int64
+		var fields string
+		var edit msg.Edit
+		if err := rows.Scan(&changed, &edit.By, &fields); err != nil {
+			return history, err
+		}
+		edit.Time = time.Unix(changed, 0)
+		if fields != "" {
+			edit.Fields = strings.Split(fields, ",")
+		}
+		history = append(history, edit)
+	}
+	return history, rows.Err()
+}
+
+func (s *SQLite) MergeEntries(into msg.Entry, merged []int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error while merging entries")
+	}
+	if err = mergeEntries(tx, into, merged); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error while merging entries")
+	}
+	return errors.Wrap(tx.Commit(), "Error while merging entries")
+}
+
+func mergeEntries(tx *sql.Tx, into msg.Entry, merged []int64) error {
+	_, err := tx.Exec("UPDATE task SET started = ?, ended = ?, note = nullif(?, ''), modified_by = nullif(?, '') WHERE id = ?;",
+		into.Started.Unix(), into.Ended.Unix(), into.Note, into.Modified, into.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tag WHERE entry = ?;", into.ID); err != nil {
+		return err
+	}
+	for _, id := range merged {
+		// Imported records stay known, so that they are not imported again
+		if _, err := tx.Exec("UPDATE fingerprint SET entry = ? WHERE entry = ?;", into.ID, id); err != nil {
+			return err
+		}
+		for _, table := range []string{"tag", "edit"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE entry = ?;", id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM task WHERE id = ?;", id); err != nil {
+			return err
+		}
+	}
+	for _, tag := range into.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tag (entry, name) VALUES (?, ?);", into.ID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteEntry(id int64) error {
+	return s.removeEntry(id, false)
+}
+
+func (s *SQLite) DiscardEntry(id int64) error {
+	return s.removeEntry(id, true)
+}
+
+func (s *SQLite) removeEntry(id int64, discard bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error while deleting entry")
+	}
+	if err = deleteEntry(tx, id, discard); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "Error while deleting entry")
+}
+
+// Remove an entry along with everything referring to it. Fingerprints are
+// kept for discarded entries, so that they are not imported again.
+func deleteEntry(tx *sql.Tx, id int64, discard bool) error {
+	for _, table := range []string{"tag", "edit"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE entry = ?;", id); err != nil {
+			return errors.Wrap(err, "Error while deleting entry")
+		}
+	}
+	// Entries logged from templates keep their mark, see msg.SourceTemplate
+	if !discard {
+		_, err := tx.Exec("DELETE FROM fingerprint WHERE entry = ? AND source <> ?;", id, msg.SourceTemplate)
+		if err != nil {
+			return errors.Wrap(err, "Error while deleting entry")
+		}
+	}
+	res, err := tx.Exec("DELETE FROM task WHERE id = ?;", id)
+	if err != nil {
+		return errors.Wrap(err, "Error while deleting entry")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.Errorf("No entry with ID %d", id)
+	}
+	return nil
+}
+
+// Move all entries of the task `from` to `into`, along with its metadata
+// and budgets unless the target has its own. Unless merging, the target must
+// not have any entries. Gives the number of affected entries.
+func (s *SQLite) RenameTask(from string, into string, merge bool) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	affected, err := renameTask(tx, from, into, merge)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return affected, tx.Commit()
+}
+
+func renameTask(tx *sql.Tx, from string, into string, merge bool) (int64, error) {
+	var n, existing int64
+	if err := tx.QueryRow("SELECT count(*) FROM task WHERE name = ?;", from).Scan(&n); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, errors.Errorf("No such task: %s", from)
+	}
+	if err := tx.QueryRow("SELECT count(*) FROM task WHERE name = ?;", into).Scan(&existing); err != nil {
+		return 0, err
+	} else if existing > 0 && !merge {
+		return 0, errors.Errorf("Task %s already exists, merge instead", into)
+	}
+	if _, err := tx.Exec("UPDATE task SET name = ? WHERE name = ?;", into, from); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+UPDATE task_info SET name = ?
+WHERE name = ?
+  AND NOT EXISTS (SELECT 1 FROM task_info WHERE name = ?);`, into, from, into); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM task_info WHERE name = ?;", from); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+UPDATE budget SET task = ?
+WHERE task = ?
+  AND NOT EXISTS (SELECT 1 FROM budget b WHERE b.task = ? AND b.kind = budget.kind AND b.period = budget.period);`,
+		into, from, into); err != nil {
+		return 0, err
+	}
+	_, err := tx.Exec("DELETE FROM budget WHERE task = ?;", from)
+	return n, err
+}
+
+func (s *SQLite) PurgeTask(name string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error while purging task")
+	}
+	entries, err := purgeTask(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "Error while purging task")
+	}
+	return entries, errors.Wrap(tx.Commit(), "Error while purging task")
+}
+
+func purgeTask(tx *sql.Tx, name string) (int64, error) {
+	for _, table := range []string{"tag", "edit"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE entry IN (SELECT id FROM task WHERE name = ?);", name)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// Entries logged from templates keep their mark, see msg.SourceTemplate
+	_, err := tx.Exec("DELETE FROM fingerprint WHERE entry IN (SELECT id FROM task WHERE name = ?) AND source <> ?;",
+		name, msg.SourceTemplate)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("DELETE FROM task WHERE name = ?;", name)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	for _, stmt := range []string{"DELETE FROM task_info WHERE name = ?;", "DELETE FROM budget WHERE task = ?;"} {
+		if _, err := tx.Exec(stmt, name); err != nil {
+			return 0, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,21 @@
+package sqlite3
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fgahr/tilo/server/backend"
+	"github.com/fgahr/tilo/server/backend/backendtest"
+)
+
+func TestBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		s := &SQLite{conf: defaultConf()}
+		s.conf.dbFile.Value = filepath.Join(t.TempDir(), "tilo.db")
+		if err := s.Init(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
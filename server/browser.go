@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+const browserAPIPath = "/api/browser/v1/"
+
+// The state shown by browser extensions: that of editors, along with the
+// tags of the current task and the category of the site, if given one.
+type browserStatus struct {
+	editorStatus
+	Tags     []string `json:"tags,omitempty"`
+	Category string   `json:"category,omitempty"`
+}
+
+// The body of a start request. The URL is that of the active tab, if any.
+type browserStart struct {
+	Task string `json:"task"`
+	URL  string `json:"url"`
+}
+
+// The body of a visit request, made when the active tab changes.
+type browserVisit struct {
+	URL string `json:"url"`
+}
+
+// Answer the requests made by browser extensions, which need to present the
+// configured token and may only connect from the same machine.
+func serveBrowserAPI(s *Server, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		// Preflight, made by the browser before sending the token
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if status, err := authorizeLocal(r, "Browser", s.conf.BrowserToken); err != "" {
+		writeEditorError(w, status, editorError{Error: err})
+		return
+	}
+
+	var category string
+	action := r.URL.Path[len(browserAPIPath):]
+	switch {
+	case action == "status" && r.Method == http.MethodGet:
+	case action == "start" && r.Method == http.MethodPost:
+		var body browserStart
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid request body: " + err.Error()})
+			return
+		} else if names, err := argparse.GetTaskNames(body.Task); err != nil || len(names) != 1 {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid task name: " + body.Task})
+			return
+		}
+		if !editorExecute(s, w, msg.Cmd{Op: "start", TaskNames: []string{body.Task}}) {
+			return
+		}
+		category = s.siteCategory(body.URL)
+	case action == "stop" && r.Method == http.MethodPost:
+		if !editorExecute(s, w, msg.Cmd{Op: "stop"}) {
+			return
+		}
+	case action == "visit" && r.Method == http.MethodPost:
+		var body browserVisit
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid request body: " + err.Error()})
+			return
+		}
+		category = s.siteCategory(body.URL)
+	case action == "status" || action == "start" || action == "stop" || action == "visit":
+		writeEditorError(w, http.StatusMethodNotAllowed, editorError{Error: "Method not allowed: " + r.Method})
+		return
+	default:
+		writeEditorError(w, http.StatusNotFound, editorError{Error: "No such action: " + action})
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if category != "" {
+		if err := s.tagCurrent(category); err != nil {
+			writeEditorError(w, http.StatusInternalServerError, editorError{Error: err.Error()})
+			return
+		}
+	}
+	status, err := s.editorStatus(time.Now())
+	if err != nil {
+		writeEditorError(w, http.StatusInternalServerError, editorError{Error: err.Error()})
+		return
+	}
+	current := s.CurrentTask()
+	result := browserStatus{editorStatus: status, Category: category}
+	if current.IsRunning() {
+		result.Tags = current.Tags
+	}
+	writeJSON(w, result)
+}
+
+// The category of the site at the URL, empty if it has none.
+func (s *Server) siteCategory(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	category, _ := s.conf.SiteCategory(u.Hostname())
+	return category
+}
+
+// Add a tag to the current task, if any. Requires the server to be locked.
+func (s *Server) tagCurrent(tag string) error {
+	current := s.CurrentTask()
+	if !current.IsRunning() {
+		return nil
+	}
+	if names, err := argparse.GetTagNames(tag); err != nil || len(names) != 1 {
+		return errors.Errorf("Invalid site category: %s", tag)
+	}
+	for _, t := range current.Tags {
+		if t == tag {
+			return nil
+		}
+	}
+	return s.SetTags(current.Name, append(append([]string{}, current.Tags...), tag))
+}
+
+func init() {
+	RegisterEndpoint(browserAPIPath, serveBrowserAPI)
+}
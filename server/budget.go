@@ -0,0 +1,138 @@
+package server
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// From which share of a maximum on it is at risk of being exceeded.
+const maxRiskShare = 0.9
+
+// Whether a budget for the given task or project covers the task.
+func covers(budgetTask string, taskName string) bool {
+	return taskName == budgetTask || msg.Project(taskName) == budgetTask
+}
+
+// BudgetStatus gives the budgets covering any of the given tasks, all if none
+// are given, along with the time logged towards them in their current period,
+// including the active tasks. Requires the server to be locked.
+func (s *Server) BudgetStatus(taskNames []string, now time.Time) ([]msg.BudgetStatus, error) {
+	budgets, err := s.Backend.Budgets()
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(s.conf); err != nil {
+		return nil, errors.Wrap(err, "Invalid calendar configuration")
+	}
+	var statuses []msg.BudgetStatus
+	for _, b := range budgets {
+		if len(taskNames) > 0 && !coversAny(b.Task, taskNames) {
+			continue
+		}
+		span := cal.Week(now)
+		if b.Period == msg.BudgetMonth {
+			span = cal.Month(now)
+		}
+		daysOff, err := s.Backend.DaysOff(span.Start, span.End)
+		if err != nil {
+			return nil, err
+		}
+		cal.AddDaysOff(daysOff)
+		logged, err := s.loggedTowards(b.Task, span, now)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, evaluate(b, logged, cal, span, now))
+	}
+	return statuses, nil
+}
+
+func coversAny(budgetTask string, taskNames []string) bool {
+	for _, name := range taskNames {
+		if covers(budgetTask, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The time logged within the span on the task or the tasks of the project,
+// including the time of active tasks up to now.
+func (s *Server) loggedTowards(budgetTask string, span quantifier.Span, now time.Time) (time.Duration, error) {
+	sum, err := s.Backend.GetAllTasksBetween(span.Start, span.End, 0)
+	if err != nil {
+		return 0, err
+	}
+	var logged time.Duration
+	for _, t := range sum {
+		if covers(budgetTask, t.Task) {
+			logged += t.Total
+		}
+	}
+	for _, task := range s.ActiveTasks() {
+		// Split tasks share the time so far
+		task.Ended = now
+		for _, part := range task.Allocate() {
+			if !covers(budgetTask, part.Name) {
+				continue
+			}
+			from := part.Started
+			if from.Before(span.Start) {
+				from = span.Start
+			}
+			if part.Ended.After(from) {
+				logged += part.Ended.Sub(from)
+			}
+		}
+	}
+	return logged, nil
+}
+
+// The state of a budget with the given time logged in its current span. A
+// maximum is at risk once most of it is used up, a minimum while less of it
+// is logged than the share of working days passed before today.
+func evaluate(b msg.Budget, logged time.Duration, cal *quantifier.Calendar, span quantifier.Span, now time.Time) msg.BudgetStatus {
+	status := msg.BudgetStatus{Budget: b, Logged: logged, State: msg.BudgetOK}
+	switch b.Kind {
+	case msg.BudgetMax:
+		if logged > b.Limit {
+			status.State = msg.BudgetExceeded
+		} else if float64(logged) >= maxRiskShare*float64(b.Limit) {
+			status.State = msg.BudgetAtRisk
+		}
+	case msg.BudgetMin:
+		passed := cal.WorkingDays(quantifier.Span{Start: span.Start, End: cal.Day(now).Start})
+		total := cal.WorkingDays(span)
+		if logged >= b.Limit {
+			status.State = msg.BudgetMet
+		} else if total > 0 && logged*time.Duration(total) < b.Limit*time.Duration(passed) {
+			status.State = msg.BudgetAtRisk
+		}
+	}
+	return status
+}
+
+// WarnAboutBudgets warns about budgets exceeded or at risk among those
+// covering the tasks just stopped, including the tasks sharing the time of
+// split ones. Requires the server to be locked.
+func (s *Server) WarnAboutBudgets(resp *msg.Response, stopped []msg.Task) error {
+	var names []string
+	for _, task := range stopped {
+		for _, part := range task.Allocate() {
+			names = append(names, part.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	statuses, err := s.BudgetStatus(names, time.Now())
+	if err != nil {
+		return err
+	}
+	resp.AddBudgetWarnings(statuses)
+	return nil
+}
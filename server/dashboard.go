@@ -0,0 +1,239 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/fgahr/tilo/argparse/quantifier"
+	"github.com/fgahr/tilo/msg"
+)
+
+// The state shown on the dashboard.
+type dashboard struct {
+	Active []dashboardTask  `json:"active"`
+	Today  []dashboardTotal `json:"today"` // Per task, largest first
+	Week   []dashboardTotal `json:"week"`  // Per day
+}
+
+type dashboardTask struct {
+	Task  string    `json:"task"`
+	Icon  string    `json:"icon,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+type dashboardTotal struct {
+	Name    string `json:"name"`
+	Seconds int64  `json:"seconds"`
+}
+
+// Serve the dashboard page.
+func serveDashboardPage(s *Server, w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardPage)
+}
+
+// Serve the state shown on the dashboard.
+func serveDashboardState(s *Server, w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	state, err := s.dashboardState(time.Now())
+	s.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, state)
+}
+
+// Determine the active tasks along with today's totals per task and this
+// week's totals per day, the active tasks included.
+func (s *Server) dashboardState(now time.Time) (dashboard, error) {
+	state := dashboard{Active: []dashboardTask{}, Today: []dashboardTotal{}, Week: []dashboardTotal{}}
+	cal := quantifier.DefaultCalendar()
+	if err := cal.Configure(s.conf); err != nil {
+		return state, err
+	}
+	var running []msg.Task
+	for _, task := range s.activeTasks {
+		if !task.IsRunning() {
+			continue
+		}
+		state.Active = append(state.Active, dashboardTask{Task: task.Name, Icon: task.Icon, Since: task.Started})
+		task.Ended, task.HasEnded = now, true
+		running = append(running, task.Allocate()...)
+	}
+
+	today := cal.Day(now)
+	sum, err := s.Backend.GetAllTasksBetween(today.Start, today.End, 0)
+	if err != nil {
+		return state, err
+	}
+	perTask := make(map[string]time.Duration)
+	for _, sm := range sum {
+		perTask[sm.Task] += sm.Total
+	}
+	for _, part := range running {
+		perTask[part.Name] += overlap(part, today)
+	}
+	for task, total := range perTask {
+		if total > 0 {
+			state.Today = append(state.Today, dashboardTotal{Name: task, Seconds: int64(total.Seconds())})
+		}
+	}
+	sort.Slice(state.Today, func(i, j int) bool {
+		return state.Today[i].Seconds > state.Today[j].Seconds
+	})
+
+	days, err := cal.Breakdown(cal.Week(now), quantifier.ByDay)
+	if err != nil {
+		return state, err
+	}
+	for _, day := range days {
+		sum, err := s.Backend.GetAllTasksBetween(day.Start, day.End, 0)
+		if err != nil {
+			return state, err
+		}
+		var total time.Duration
+		for _, sm := range sum {
+			total += sm.Total
+		}
+		for _, part := range running {
+			total += overlap(part, day)
+		}
+		state.Week = append(state.Week, dashboardTotal{Name: day.Start.Format("Mon"), Seconds: int64(total.Seconds())})
+	}
+	return state, nil
+}
+
+// The time a stopped task spent within the span.
+func overlap(task msg.Task, span quantifier.Span) time.Duration {
+	from, until := task.Started, task.Ended
+	if from.Before(span.Start) {
+		from = span.Start
+	}
+	if until.After(span.End) {
+		until = span.End
+	}
+	if until.Before(from) {
+		return 0
+	}
+	return until.Sub(from)
+}
+
+func init() {
+	RegisterEndpoint("/", serveDashboardPage)
+	RegisterEndpoint("/api/dashboard", serveDashboardState)
+}
+
+// A single page, updating itself as notifications arrive.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>tilo</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.1em; margin-top: 2em; color: #555; }
+#active .since { color: #777; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 0.2em 0.4em; }
+td.hours { text-align: right; width: 6em; font-variant-numeric: tabular-nums; }
+.bar { background: #4a90d9; height: 1.2em; min-width: 1px; }
+#status { position: fixed; top: 0.5em; right: 0.5em; font-size: 0.8em; color: #999; }
+</style>
+</head>
+<body>
+<div id="status">connecting</div>
+<h1 id="active">&hellip;</h1>
+<h2>Today</h2>
+<table id="today"></table>
+<h2>This week</h2>
+<table id="week"></table>
+<script>
+let state = {active: [], today: [], week: []};
+let fetched = Date.now();
+
+function hours(seconds) {
+  const m = Math.round(seconds / 60);
+  return Math.floor(m / 60) + "h" + String(m % 60).padStart(2, "0") + "m";
+}
+
+function cell(text, cls) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (cls) td.className = cls;
+  return td;
+}
+
+function render() {
+  const running = (Date.now() - fetched) / 1000 * state.active.length;
+  const active = document.getElementById("active");
+  active.textContent = "";
+  if (state.active.length === 0) {
+    active.textContent = "Idle";
+  }
+  for (const t of state.active) {
+    const since = new Date(t.since);
+    active.append((t.icon ? t.icon + " " : "") + t.task + " ");
+    const span = document.createElement("span");
+    span.className = "since";
+    span.textContent = hours((Date.now() - since) / 1000) + " since " + since.toLocaleTimeString();
+    active.append(span, document.createElement("br"));
+  }
+
+  const today = document.getElementById("today");
+  today.textContent = "";
+  let total = running;
+  for (const t of state.today) {
+    total += t.seconds;
+    const tr = document.createElement("tr");
+    tr.append(cell(t.name), cell(hours(t.seconds), "hours"));
+    today.append(tr);
+  }
+  const tr = document.createElement("tr");
+  tr.append(cell("Total"), cell(hours(total), "hours"));
+  today.append(tr);
+
+  const week = document.getElementById("week");
+  week.textContent = "";
+  const max = Math.max(3600, ...state.week.map(d => d.seconds));
+  for (const d of state.week) {
+    const row = document.createElement("tr");
+    const bar = document.createElement("div");
+    bar.className = "bar";
+    bar.style.width = (100 * d.seconds / max) + "%";
+    const barCell = cell("");
+    barCell.style.width = "100%";
+    barCell.append(bar);
+    row.append(cell(d.name), barCell, cell(hours(d.seconds), "hours"));
+    week.append(row);
+  }
+}
+
+async function refresh() {
+  const resp = await fetch("/api/dashboard");
+  if (resp.ok) {
+    state = await resp.json();
+    fetched = Date.now();
+    render();
+  }
+}
+
+const events = new EventSource("/events");
+events.addEventListener("status", refresh);
+events.onopen = () => { document.getElementById("status").textContent = "live"; };
+events.onerror = () => { document.getElementById("status").textContent = "disconnected"; };
+setInterval(refresh, 60000);
+setInterval(render, 1000);
+refresh();
+</script>
+</body>
+</html>
+`
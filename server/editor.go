@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
+	"github.com/fgahr/tilo/msg"
+)
+
+// The version of the editor API. Fields may be added without notice, any
+// other change increments the version, which is part of the path.
+const editorAPIVersion = 1
+
+const editorAPIPath = "/api/editor/v1/"
+
+// The state shown by editors, e.g. in a status bar.
+type editorStatus struct {
+	APIVersion       int       `json:"api_version"`
+	Task             string    `json:"task"` // Empty if idle
+	Icon             string    `json:"icon,omitempty"`
+	Since            time.Time `json:"since"` // When the task started or, if idle, the last one stopped
+	TodaySeconds     int64     `json:"today_seconds"`
+	TaskTodaySeconds int64     `json:"task_today_seconds"` // For the current task
+}
+
+// The body of a switch request.
+type editorSwitch struct {
+	Task string `json:"task"`
+}
+
+// The body of a stop request, both fields optional. Short tasks are
+// discarded or kept as configured, see discard_short, unless one is set.
+type editorStop struct {
+	Keep    bool `json:"keep"`
+	Discard bool `json:"discard"`
+}
+
+type editorError struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// Answer the requests made by editor extensions, which need to present the
+// configured token and may only connect from the same machine.
+func serveEditorAPI(s *Server, w http.ResponseWriter, r *http.Request) {
+	if status, err := authorizeLocal(r, "Editor", s.conf.EditorToken); err != "" {
+		writeEditorError(w, status, editorError{Error: err})
+		return
+	}
+	action := r.URL.Path[len(editorAPIPath):]
+	switch {
+	case action == "status" && r.Method == http.MethodGet:
+	case action == "switch" && r.Method == http.MethodPost:
+		var body editorSwitch
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid request body: " + err.Error()})
+			return
+		} else if names, err := argparse.GetTaskNames(body.Task); err != nil || len(names) != 1 {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid task name: " + body.Task})
+			return
+		}
+		if !editorExecute(s, w, msg.Cmd{Op: "start", TaskNames: []string{body.Task}}) {
+			return
+		}
+	case action == "stop" && r.Method == http.MethodPost:
+		var body editorStop
+		// An empty body is fine
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && r.ContentLength > 0 {
+			writeEditorError(w, http.StatusBadRequest, editorError{Error: "Invalid request body: " + err.Error()})
+			return
+		}
+		cmd := msg.Cmd{Op: "stop", Flags: map[string]bool{"keep": body.Keep, "discard": body.Discard}}
+		if !editorExecute(s, w, cmd) {
+			return
+		}
+	case action == "status" || action == "switch" || action == "stop":
+		writeEditorError(w, http.StatusMethodNotAllowed, editorError{Error: "Method not allowed: " + r.Method})
+		return
+	default:
+		writeEditorError(w, http.StatusNotFound, editorError{Error: "No such action: " + action})
+		return
+	}
+
+	s.Lock()
+	status, err := s.editorStatus(time.Now())
+	s.Unlock()
+	if err != nil {
+		writeEditorError(w, http.StatusInternalServerError, editorError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, status)
+}
+
+// Execute a command on behalf of an editor, answering with an error if it
+// fails. Gives whether it succeeded.
+func editorExecute(s *Server, w http.ResponseWriter, cmd msg.Cmd) bool {
+	resp, err := s.Execute(cmd)
+	if err != nil {
+		writeEditorError(w, http.StatusInternalServerError, editorError{Error: err.Error()})
+		return false
+	} else if resp.Failed() {
+		// E.g. a short task, for the editor to ask whether to keep it
+		writeEditorError(w, http.StatusConflict, editorError{Error: resp.Error, Code: resp.Code})
+		return false
+	}
+	return true
+}
+
+func writeEditorError(w http.ResponseWriter, status int, e editorError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// Determine the current task and today's totals. Requires the server to be
+// locked.
+func (s *Server) editorStatus(now time.Time) (editorStatus, error) {
+	status := editorStatus{APIVersion: editorAPIVersion}
+	current := s.CurrentTask()
+	if current.IsRunning() {
+		status.Task, status.Icon, status.Since = current.Name, current.Icon, current.Started
+	} else {
+		status.Since = current.Ended
+	}
+	state, err := s.dashboardState(now)
+	if err != nil {
+		return status, err
+	}
+	for _, t := range state.Today {
+		status.TodaySeconds += t.Seconds
+		if t.Name == status.Task {
+			status.TaskTodaySeconds = t.Seconds
+		}
+	}
+	return status, nil
+}
+
+func init() {
+	RegisterEndpoint(editorAPIPath, serveEditorAPI)
+}
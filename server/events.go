@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WebSocket opcodes, see RFC 6455.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// Appended to the client's key to prove the handshake was understood.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// A WebSocket connection on which notifications are sent. Messages from the
+// client are only read to answer pings and close requests.
+type wsConn struct {
+	conn net.Conn
+	buf  *bufio.ReadWriter
+	mu   sync.Mutex // Serializes writes
+}
+
+// Stream notifications as server-sent events until the client disconnects or
+// the server shuts down.
+func serveEvents(s *Server, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sub := s.lockedSubscribe()
+	defer s.lockedUnsubscribe(sub)
+
+	// Keep the connection from being closed by proxies while idle
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ntf, open := <-sub.ch:
+			if !open {
+				sub.closed = true
+				return
+			}
+			data, err := json.Marshal(ntf)
+			if err != nil {
+				s.logError(err)
+				return
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Stream notifications over a WebSocket, as text messages holding the same
+// JSON objects listeners receive.
+func serveWebSocket(s *Server, w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "Expected a WebSocket handshake", http.StatusBadRequest)
+		return
+	} else if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		s.logError(errors.Wrap(err, "WebSocket handshake failed"))
+		return
+	}
+	defer conn.Close()
+
+	hash := sha1.Sum([]byte(key + wsGUID))
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		s.logError(errors.Wrap(err, "WebSocket handshake failed"))
+		return
+	}
+
+	ws := &wsConn{conn: conn, buf: buf}
+	sub := s.lockedSubscribe()
+	defer s.lockedUnsubscribe(sub)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := ws.readUntilClosed(); err != nil && err != io.EOF {
+			s.logDebug("WebSocket connection lost:", err)
+		}
+	}()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ntf, open := <-sub.ch:
+			if !open {
+				sub.closed = true
+				ws.write(wsClose, nil)
+				return
+			}
+			data, err := json.Marshal(ntf)
+			if err != nil {
+				s.logError(err)
+				return
+			}
+			if err := ws.write(wsText, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := ws.write(wsPing, nil); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Read frames sent by the client, answering pings, until it closes the
+// connection.
+func (ws *wsConn) readUntilClosed() error {
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(ws.buf, head[:]); err != nil {
+			return err
+		}
+		opcode := head[0] & 0x0f
+		masked := head[1]&0x80 != 0
+		length := uint64(head[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(ws.buf, ext[:]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(ws.buf, ext[:]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		// Messages from clients are not expected to carry anything of size
+		if length > 1<<16 {
+			return errors.New("WebSocket frame too large")
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(ws.buf, mask[:]); err != nil {
+				return err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.buf, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case wsClose:
+			ws.write(wsClose, payload)
+			return nil
+		case wsPing:
+			if err := ws.write(wsPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Write a single, unmasked frame.
+func (ws *wsConn) write(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n < 1<<16:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 127)
+		head = append(head, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+	if _, err := ws.buf.Write(head); err != nil {
+		return err
+	}
+	if _, err := ws.buf.Write(payload); err != nil {
+		return err
+	}
+	return ws.buf.Flush()
+}
+
+// Whether a comma-separated header contains the value, ignoring case.
+func headerContains(h http.Header, name string, value string) bool {
+	for _, field := range h.Values(name) {
+		for _, v := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterEndpoint("/events", serveEvents)
+	RegisterEndpoint("/ws", serveWebSocket)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// Written on shutdown for a restart, read and removed by the next server.
+const handoverFile = "handover.json"
+
+// The state passed on to the next server in a restart.
+type handover struct {
+	ActiveTasks []msg.Task
+	LastTask    msg.Task
+	Paused      []msg.Task
+	Overlong    []msg.Overlong
+}
+
+func (s *Server) handoverPath() string {
+	return filepath.Join(s.conf.ConfigDir(), handoverFile)
+}
+
+// HandOver makes the server shut down without stopping active tasks. They
+// are resumed by the next server to start, e.g. after an upgrade.
+func (s *Server) HandOver() {
+	s.handingOver = true
+	s.InitiateShutdown()
+}
+
+// Persist the state for the next server. Requires the server to be locked.
+func (s *Server) saveHandover() error {
+	state := handover{ActiveTasks: s.activeTasks, LastTask: s.lastTask, Paused: s.paused, Overlong: s.overlong}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(s.handoverPath(), data, 0600), "Unable to hand over active tasks")
+}
+
+// Resume the state handed over by the previous server, if any, restoring
+// the schedules of active tasks. Those due in the meantime stop right away.
+func (s *Server) resumeHandover() error {
+	data, err := ioutil.ReadFile(s.handoverPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "Unable to resume handed over tasks")
+	}
+	// Resumed at most once, even if broken
+	defer os.Remove(s.handoverPath())
+	var state handover
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "Unable to resume handed over tasks")
+	}
+
+	s.activeTasks = state.ActiveTasks
+	s.paused = state.Paused
+	s.overlong = state.Overlong
+	if state.LastTask.Name != "" {
+		s.lastTask = state.LastTask
+	}
+	for _, task := range s.activeTasks {
+		s.logInfo("Resuming handed over task:", task)
+		if task.StopAt.IsZero() {
+			continue
+		}
+		name, at := task.Name, task.StopAt
+		s.stopTimers[name] = time.AfterFunc(time.Until(at), func() {
+			s.stopAsScheduled(name, at)
+		})
+	}
+	return nil
+}
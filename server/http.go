@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+var endpoints = make(map[string]Endpoint)
+
+// How often to show idle event streams that the connection is still alive.
+const keepAliveInterval = 30 * time.Second
+
+// Endpoint answers HTTP requests. Unlike operations, endpoints are not
+// serialized with other requests and need to lock the server themselves
+// before accessing its state, see Server.Lock.
+type Endpoint func(s *Server, w http.ResponseWriter, r *http.Request)
+
+// RegisterEndpoint makes the server answer HTTP requests matching the pattern,
+// as understood by http.ServeMux, when serving HTTP.
+// This function is called indirectly from other packages' init() functions.
+func RegisterEndpoint(pattern string, endpoint Endpoint) {
+	if endpoints[pattern] != nil {
+		panic("Double registration of HTTP endpoint " + pattern)
+	}
+	endpoints[pattern] = endpoint
+}
+
+// Lock holds back requests until Unlock is called, so that the server's
+// state can be accessed safely from an endpoint.
+func (s *Server) Lock() {
+	s.mu.Lock()
+}
+
+// Unlock lets requests continue after Lock.
+func (s *Server) Unlock() {
+	s.mu.Unlock()
+}
+
+// Serve HTTP on the configured address, if any.
+func (s *Server) startHTTP() error {
+	addr := s.conf.HTTPListen.Value
+	if addr == "" {
+		return nil
+	}
+	lst, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Unable to serve HTTP")
+	}
+	mux := http.NewServeMux()
+	for pattern, endpoint := range endpoints {
+		endpoint := endpoint
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if !s.checkHost(r) {
+				http.Error(w, "Host not allowed", http.StatusForbidden)
+				return
+			} else if !s.checkOrigin(w, r) {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			endpoint(s, w, r)
+		})
+	}
+	s.httpServer = &http.Server{Handler: mux}
+	go func() {
+		if err := s.httpServer.Serve(lst); err != http.ErrServerClosed {
+			s.logError(errors.Wrap(err, "Stopped serving HTTP"))
+		}
+	}()
+	s.logInfo("Serving HTTP on", lst.Addr())
+	return nil
+}
+
+// Stop serving HTTP, ending the event streams of subscribers after telling
+// them about the shutdown.
+func (s *Server) stopHTTP() {
+	s.publish(shutdownNotification())
+	for _, ch := range s.subscribers {
+		close(ch)
+	}
+	s.subscribers = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
+	}
+}
+
+// Check whether a request may be answered, given the web origin of the page
+// making it, if made from a browser. Requests from the server's own pages are
+// always allowed, others only from configured origins. Browsers are allowed
+// to read the response for these.
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || strings.TrimPrefix(strings.TrimPrefix(origin, "http://"), "https://") == r.Host {
+		return true
+	} else if !s.conf.OriginAllowed(origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	return true
+}
+
+// Check that a request to an API comes from this machine and carries the
+// token set for it, the API being disabled without one. Gives the status and
+// error to answer with otherwise.
+func authorizeLocal(r *http.Request, api string, token config.Item) (int, string) {
+	if token.Value == "" {
+		return http.StatusForbidden, api + " API disabled, no " + token.InFile + " configured"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		return http.StatusForbidden, api + " API only available on this machine"
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token.Value)) != 1 {
+		return http.StatusUnauthorized, "Invalid token"
+	}
+	return 0, ""
+}
+
+// Check whether a request is addressed to this server by a name it is known
+// by: an IP address, localhost, the host name of the machine or the one it
+// listens on. Pages from elsewhere resolving their own name to the server's
+// address, i.e. DNS rebinding, are thus kept out.
+func (s *Server) checkHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if net.ParseIP(host) != nil || host == "localhost" {
+		return true
+	}
+	var known []string
+	if h, _, err := net.SplitHostPort(s.conf.HTTPListen.Value); err == nil {
+		known = append(known, h)
+	}
+	if h, err := os.Hostname(); err == nil {
+		known = append(known, h, h+".local")
+	}
+	for _, k := range known {
+		if strings.EqualFold(host, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe to the notifications sent to listeners, starting with the current
+// state. The channel is closed on shutdown. Requires the server to be locked.
+func (s *Server) Subscribe() <-chan Notification {
+	// Buffered so that slow subscribers do not hold back the server
+	ch := make(chan Notification, 8)
+	ch <- s.CurrentNotification()
+	s.subscribers = append(s.subscribers, ch)
+	s.scheduleIdleShutdown()
+	return ch
+}
+
+// Unsubscribe from notifications. Requires the server to be locked.
+func (s *Server) Unsubscribe(sub <-chan Notification) {
+	for i, ch := range s.subscribers {
+		if ch == sub {
+			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+			close(ch)
+			s.scheduleIdleShutdown()
+			return
+		}
+	}
+}
+
+// An active subscription to notifications, for use outside of requests.
+type subscription struct {
+	ch     <-chan Notification
+	closed bool // Whether the channel has been closed by the server
+}
+
+// Subscribe while holding back requests in the meantime.
+func (s *Server) lockedSubscribe() *subscription {
+	s.Lock()
+	defer s.Unlock()
+	return &subscription{ch: s.Subscribe()}
+}
+
+// Unsubscribe unless the server has already ended the subscription, e.g.
+// in shutdown, while holding back requests in the meantime.
+func (s *Server) lockedUnsubscribe(sub *subscription) {
+	if sub.closed {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.Unsubscribe(sub.ch)
+}
+
+// Send a notification to all subscribers and services. Those not keeping up
+// miss out.
+func (s *Server) publish(ntf Notification) {
+	subs := make([]chan Notification, 0, len(s.subscribers)+len(s.serviceSubs))
+	for _, ch := range append(append(subs, s.subscribers...), s.serviceSubs...) {
+		select {
+		case ch <- ntf:
+		default:
+			s.logDebug("Subscriber is not keeping up, skipping notification")
+		}
+	}
+}
+
+// Execute a command as if sent by a client, giving the response. Unless set,
+// the command's origin is that of an agent on this host. Must not be called
+// while the server is locked.
+func (s *Server) Execute(cmd msg.Cmd) (msg.Response, error) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	cmd.Version = msg.ProtocolVersion
+	if cmd.Origin == "" {
+		host, _ := os.Hostname()
+		cmd.Origin = msg.MakeOrigin(msg.OriginAgent, host)
+	}
+	go func() {
+		if err := s.Dispatch(&Request{Conn: remote, Cmd: cmd}); err != nil {
+			s.logError(err)
+		}
+		remote.Close()
+	}()
+	var resp msg.Response
+	err := json.NewDecoder(local).Decode(&resp)
+	return resp, errors.Wrapf(err, "No response to %s", cmd.Op)
+}
+
+// Answer an HTTP request with an object in JSON format.
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
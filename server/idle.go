@@ -0,0 +1,53 @@
+package server
+
+import (
+	"os"
+	"time"
+)
+
+// Set in the environment of servers started by clients, see
+// StartInBackground. Only those shut down on their own after idle_shutdown.
+const spawnedEnv = "TILO_SPAWNED"
+
+// Whether the server is unused: no task is active or paused and no client
+// connected, including listeners, and no task stopped for running too long
+// awaits a decision. Requires the server to be locked.
+func (s *Server) idle() bool {
+	return len(s.activeTasks) == 0 && len(s.paused) == 0 && s.connections == 0 && len(s.listeners) == 0 &&
+		len(s.subscribers) == 0 && len(s.overlong) == 0
+}
+
+// Shut down once idle for the configured time, if the server was started by
+// a client; clients start it again when needed. Stops waiting as soon as
+// the server is used again. Requires the server to be locked.
+func (s *Server) scheduleIdleShutdown() {
+	after := s.conf.IdleShutdownAfter()
+	if !s.spawned || after <= 0 || !s.idle() || s.shuttingDown() {
+		if s.idleTimer != nil {
+			s.idleTimer.Stop()
+			s.idleTimer = nil
+		}
+		return
+	} else if s.idleTimer != nil {
+		// Idle since the timer was started
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(after, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.idleTimer != timer || !s.idle() || s.shuttingDown() {
+			return
+		}
+		s.idleTimer = nil
+		s.logInfo("Shutting down after being idle for", after)
+		s.InitiateShutdown()
+	})
+	s.idleTimer = timer
+	s.logDebug("Shutting down if idle until", time.Now().Add(after))
+}
+
+// Whether the server process was started by a client.
+func startedByClient() bool {
+	return os.Getenv(spawnedEnv) != ""
+}
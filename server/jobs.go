@@ -0,0 +1,106 @@
+package server
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/pkg/errors"
+)
+
+var jobs = make(map[string]Job)
+
+// Schedules with special names, see NextScheduled.
+const (
+	ScheduleHourly  = "hourly"
+	ScheduleNightly = "nightly"
+	// When nightly jobs run
+	nightlyAt = "03:00"
+)
+
+// Job is work done by the server in the background, at times of its own
+// choosing, e.g. nightly.
+type Job interface {
+	// Next gives the time of the next run following the given time. The zero
+	// time means the job is not to run, e.g. because it is not configured.
+	Next(conf *config.Opts, after time.Time) time.Time
+	// Run the job. The server must be locked to access its state in the
+	// meantime, as briefly as possible: requests are held back while it is,
+	// so that slow work such as uploads is best done without the lock.
+	Run(s *Server) error
+}
+
+// RegisterJob makes a job run by every server.
+// This function is called indirectly from other packages' init() functions.
+func RegisterJob(name string, job Job) {
+	if jobs[name] != nil {
+		panic("Double registration of job with name " + name)
+	}
+	jobs[name] = job
+}
+
+// NextScheduled gives the time of the next run following the given time,
+// according to a schedule: hourly, nightly or a time of day as HH:MM. The zero
+// time if there is no schedule.
+func NextScheduled(schedule string, after time.Time) (time.Time, error) {
+	switch schedule {
+	case "":
+		return time.Time{}, nil
+	case ScheduleHourly:
+		return after.Truncate(time.Hour).Add(time.Hour), nil
+	case ScheduleNightly:
+		schedule = nightlyAt
+	}
+	at, err := time.Parse("15:04", schedule)
+	if err != nil {
+		return time.Time{}, errors.Errorf("Invalid schedule: %s", schedule)
+	}
+	next := time.Date(after.Year(), after.Month(), after.Day(), at.Hour(), at.Minute(), 0, 0, after.Location())
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// Run all jobs, each one in the background until shutdown.
+func (s *Server) startJobs() {
+	for name, job := range jobs {
+		go s.runJob(name, job)
+	}
+}
+
+// Run a job whenever it is due, until the server shuts down. The next run is
+// determined anew when the configuration is reloaded.
+func (s *Server) runJob(name string, job Job) {
+	for {
+		s.mu.Lock()
+		next := job.Next(s.conf, time.Now())
+		reloaded := s.reloaded
+		s.mu.Unlock()
+		// Never due without a next run
+		var due <-chan time.Time
+		stop := func() {}
+		if next.IsZero() {
+			s.logDebug("No further runs scheduled for job", name)
+		} else {
+			s.logDebug("Next run of job", name, "at", next)
+			timer := time.NewTimer(time.Until(next))
+			due, stop = timer.C, func() { timer.Stop() }
+		}
+		select {
+		case <-due:
+		case <-reloaded:
+			stop()
+			continue
+		case <-s.shutdownChan:
+			stop()
+			return
+		}
+		if !s.shuttingDown() {
+			if err := job.Run(s); err != nil {
+				s.logError(errors.Wrapf(err, "Job %s failed", name))
+			} else {
+				s.logInfo("Completed job", name)
+			}
+		}
+	}
+}
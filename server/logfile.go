@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fgahr/tilo/config"
+)
+
+// The number of logs of earlier background servers kept, as server.log.1
+// and so on, the most recent first.
+const keptLogs = 3
+
+// Logged last by a server shutting down cleanly, see shutdown.
+const shutdownComplete = "Shutdown complete."
+
+// BackgroundLog gives the file receiving the output of a server started in
+// the background. Logs of earlier servers are kept next to it, see keptLogs.
+func BackgroundLog(conf *config.Opts) string {
+	return filepath.Join(conf.ConfigDir(), "server.log")
+}
+
+// Make room for the log of a new background server, keeping those of the
+// latest ones.
+func rotateLogs(conf *config.Opts) error {
+	current := BackgroundLog(conf)
+	numbered := func(n int) string {
+		return fmt.Sprintf("%s.%d", current, n)
+	}
+	if err := os.Remove(numbered(keptLogs)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := keptLogs - 1; n > 0; n-- {
+		if err := os.Rename(numbered(n), numbered(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(current, numbered(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// LastLogLines gives up to n lines from the end of the background log.
+func LastLogLines(conf *config.Opts, n int) []string {
+	data, err := ioutil.ReadFile(BackgroundLog(conf))
+	if err != nil || len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// FailedStart gives the last lines logged by the most recent background
+// server unless it shut down cleanly, e.g. because it failed to start or
+// crashed; nothing if it is still running. Only available if logging.
+func FailedStart(conf *config.Opts, n int) []string {
+	if running, _ := IsRunning(conf); running {
+		return nil
+	}
+	lines := LastLogLines(conf, n)
+	if len(lines) == 0 || strings.Contains(lines[len(lines)-1], shutdownComplete) {
+		return nil
+	}
+	return lines
+}
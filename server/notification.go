@@ -7,21 +7,44 @@ import (
 	"time"
 )
 
+// What a notification is sent in response to.
+const (
+	EventStatus   = "status"   // Sent on connecting and on other changes, e.g. of the icon
+	EventStart    = "start"    // A task was started
+	EventStop     = "stop"     // Tasks were stopped
+	EventPause    = "pause"    // Tasks were paused, see Server.Pause
+	EventTick     = "tick"     // Sent at intervals while a task is active, if requested
+	EventShutdown = "shutdown" // The server is shutting down
+)
+
 // The notification to send to listeners.
 type Notification struct {
-	Task  string    `json:"task"`  // The name of the task; empty if idle
-	Since time.Time `json:"since"` // Time of the last status change, formatted
+	Event        string     `json:"event,omitempty"`         // What the notification is sent in response to
+	Task         string     `json:"task"`                    // The name of the task; empty if idle
+	Icon         string     `json:"icon,omitempty"`          // The task's icon, if it has one
+	Since        time.Time  `json:"since"`                   // Time of the last status change, formatted
+	Elapsed      int64      `json:"elapsed"`                 // Seconds since the task started; 0 if idle
+	Paused       []string   `json:"paused,omitempty"`        // The paused tasks, if any
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"` // Until when reminders are snoozed, if at all
+}
+
+// The notification as understood by listeners speaking msg.ProtocolLegacy.
+type legacyNotification struct {
+	Task  string    `json:"task"`
+	Since time.Time `json:"since"`
 }
 
 // An entity awaiting notifications about task changes.
 type NotificationListener struct {
-	conn net.Conn // The connection to notify
+	conn    net.Conn      // The connection to notify
+	version int           // The protocol version spoken by the listener
+	tick    time.Duration // How often to notify while a task is active; never if 0
 }
 
 // A notification informing listeners about server shutdown.
 func shutdownNotification() Notification {
 	// --shutdown is not a valid task name and hence can be used as a signal.
-	return Notification{"--shutdown", time.Now().Truncate(time.Second)}
+	return Notification{Event: EventShutdown, Task: "--shutdown", Since: time.Now().Truncate(time.Second)}
 }
 
 // A notification about a task, presumed to be the currently set one.
@@ -29,7 +52,7 @@ func shutdownNotification() Notification {
 // idle state.
 func TaskNotification(t msg.Task) Notification {
 	if t.IsRunning() {
-		return Notification{Task: t.Name, Since: t.Started}
+		return Notification{Task: t.Name, Icon: t.Icon, Since: t.Started}
 	} else {
 		return Notification{Task: "", Since: t.Ended}
 	}
@@ -45,5 +68,9 @@ func (lst *NotificationListener) disconnect() error {
 
 // Notify this listener.
 func (lst *NotificationListener) Notify(ntf Notification) error {
-	return errors.Wrap(writeJsonLine(ntf, lst.conn), "Failed to send notification")
+	var shaped interface{} = ntf
+	if lst.version <= msg.ProtocolLegacy {
+		shaped = legacyNotification{Task: ntf.Task, Since: ntf.Since}
+	}
+	return errors.Wrap(writeJsonLine(shaped, lst.conn), "Failed to send notification")
 }
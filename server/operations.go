@@ -5,13 +5,24 @@ package server
 // with explanations.
 
 import (
+	"strings"
+	"time"
+
+	"github.com/fgahr/tilo/argparse"
 	"github.com/fgahr/tilo/msg"
 	"github.com/pkg/errors"
 )
 
 // Log a request at the appropriate debug level.
 func (s *Server) logCommand(cmd msg.Cmd) {
-	s.logFmtInfo("Processing command: %v\n", cmd)
+	fields := logFields{"op": cmd.Op}
+	if len(cmd.TaskNames) > 0 {
+		fields["task"] = strings.Join(cmd.TaskNames, ",")
+	}
+	if cmd.Origin != "" {
+		fields["client"] = cmd.Origin
+	}
+	s.logInfoFields(fields, "Processing command: %v\n", cmd)
 }
 
 // Log a response at the appropriate debug level.
@@ -19,9 +30,14 @@ func (s *Server) logResponse(resp msg.Response) {
 	s.logFmtDebug("Returning response: %v\n", resp)
 }
 
-// Answer the request with the provided response.
+// Answer the request with the provided response, unless the client has hung
+// up or given up waiting.
 func (s *Server) Answer(req *Request, resp msg.Response) error {
-	return errors.Wrap(writeJsonLine(resp, req.Conn), "Failed to send response")
+	if err := req.Context().Err(); err != nil {
+		return errors.Wrap(err, "Not answering "+req.Cmd.Op)
+	}
+	resp.Server = msg.Release
+	return errors.Wrap(writeJsonLine(resp.ForProtocol(req.Cmd.Protocol()), req.Conn), "Failed to send response")
 }
 
 // Save a task to the backend database.
@@ -29,44 +45,295 @@ func (s *Server) SaveTask(task msg.Task) error {
 	if task.IsRunning() {
 		return errors.New("Cannot save an active task")
 	}
-	s.logFmtInfo("Saving task: %v\n", task)
-	if err := s.Backend.Save(task); err != nil {
-		s.logFmtInfo("%v\n", err)
+	s.logInfoFields(logFields{
+		"op": "save", "task": task.Name, "duration": task.Ended.Sub(task.Started).Seconds(), "client": task.Origin,
+	}, "Saving task: %v\n", task)
+	var err error
+	if len(task.Split) > 0 {
+		err = s.Backend.SaveSplit(task.Allocate())
+	} else {
+		err = s.Backend.Save(task)
+	}
+	if err != nil {
+		s.logError(err)
 		return err
 	}
 	return nil
 }
 
-// Change the server's current task.
+// TooShort determines whether a stopped task ran for less than the
+// configured discard_under and should not be saved.
+func (s *Server) TooShort(task msg.Task) bool {
+	threshold := s.conf.DiscardThreshold()
+	return threshold > 0 && task.Ended.Sub(task.Started) < threshold
+}
+
+// SaveOrDiscard saves a stopped task unless it is too short and configured
+// to be discarded silently. Returns whether the task was saved.
+func (s *Server) SaveOrDiscard(task msg.Task) (bool, error) {
+	if s.TooShort(task) && s.conf.DiscardSilently() {
+		s.logFmtInfo("Discarding short task: %v\n", task)
+		return false, nil
+	}
+	return true, s.SaveTask(task)
+}
+
+// Overlapping gives the saved entries, other than the given one, whose time
+// overlaps with it. Only entries starting within a day of it are considered.
+func (s *Server) Overlapping(e msg.Entry) ([]msg.Entry, error) {
+	near, err := s.Backend.Entries(argparse.AllTasks, e.Started.Add(-24*time.Hour), e.Ended.Add(24*time.Hour), 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to check for overlapping entries")
+	}
+	var overlapping []msg.Entry
+	for _, other := range near {
+		if other.ID != e.ID && other.Started.Before(e.Ended) && other.Ended.After(e.Started) {
+			overlapping = append(overlapping, other)
+		}
+	}
+	return overlapping, nil
+}
+
+// ParallelTasks determines whether several tasks may be active at once.
+func (s *Server) ParallelTasks() bool {
+	return s.conf.ParallelTasks()
+}
+
+// CurrentTask gives the most recently started active task. If no task is
+// active, the most recently stopped one is returned instead.
+func (s *Server) CurrentTask() msg.Task {
+	if n := len(s.activeTasks); n > 0 {
+		return s.activeTasks[n-1]
+	}
+	return s.lastTask
+}
+
+// ActiveTasks gives all active tasks, most recently started last.
+func (s *Server) ActiveTasks() []msg.Task {
+	return append([]msg.Task(nil), s.activeTasks...)
+}
+
+// IsActive determines whether a task with the given name is active.
+func (s *Server) IsActive(taskName string) bool {
+	return s.activeIndex(taskName) >= 0
+}
+
+// InUse determines whether the server holds on to a task with the given
+// name, possibly as part of a split: as active, paused, or stopped for
+// running too long and awaiting a decision. Such tasks are saved under their
+// name later on.
+func (s *Server) InUse(taskName string) bool {
+	held := append(s.ActiveTasks(), s.paused...)
+	for _, o := range s.overlong {
+		held = append(held, o.Task)
+	}
+	for _, task := range held {
+		if task.Name == taskName {
+			return true
+		}
+		for _, alloc := range task.Split {
+			if alloc.Task == taskName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The index of the active task with the given name, -1 if there is none.
+func (s *Server) activeIndex(taskName string) int {
+	for i, task := range s.activeTasks {
+		if task.Name == taskName {
+			return i
+		}
+	}
+	return -1
+}
+
+// Start a task. Unless parallel tasks are allowed, it replaces any active
+// task. Starting a task which is already active has no effect.
 func (s *Server) SetActiveTask(taskName string) {
-	if s.CurrentTask.IsRunning() {
-		s.logWarn("Task was not stopped before being superseded:", s.CurrentTask)
-		s.CurrentTask.Stop()
+	s.activate(msg.FreshTask(taskName))
+}
+
+// Start a task whose time is split between several tasks, see SetActiveTask.
+func (s *Server) SetActiveSplitTask(split []msg.Allocation) {
+	s.activate(msg.FreshSplitTask(split))
+}
+
+func (s *Server) activate(fresh msg.Task) {
+	if s.IsActive(fresh.Name) {
+		s.logWarn("Task is already active:", fresh.Name)
+		return
+	}
+	fresh.Origin = s.origin
+	// Starting anything ends a pause
+	s.paused = nil
+	if infos, err := s.Backend.TaskInfo(); err != nil {
+		s.logWarn("Unable to determine task icon:", err)
+	} else {
+		fresh.Icon = infos[fresh.Name].Icon
+	}
+	if !s.ParallelTasks() {
+		for _, task := range s.activeTasks {
+			s.logWarn("Task was not stopped before being superseded:", task)
+			s.cancelScheduledStop(task.Name)
+		}
+		s.activeTasks = nil
 	}
-	s.CurrentTask = msg.FreshTask(taskName)
-	s.notifyListeners()
+	s.activeTasks = append(s.activeTasks, fresh)
+	s.notifyListeners(EventStart)
 }
 
-// Stop the current task and return it. Returns true if the task was actually
-// halted and false if it had been stopped before this function was called.
-func (s *Server) StopCurrentTask() (msg.Task, bool) {
-	if s.CurrentTask.IsRunning() {
-		s.CurrentTask.Stop()
-		s.notifyListeners()
-		return s.CurrentTask, true
+// Switch stops the most recently started task, or all active tasks unless
+// parallel tasks are allowed, and starts the given task at the very moment
+// they end. Returns the stopped tasks, which are left to be saved.
+func (s *Server) Switch(taskName string) []msg.Task {
+	var stopped []msg.Task
+	if !s.ParallelTasks() {
+		stopped = s.StopAllTasks()
+	} else if n := len(s.activeTasks); n > 0 {
+		task, _ := s.StopTask(s.activeTasks[n-1].Name)
+		stopped = []msg.Task{task}
+	}
+	fresh := msg.FreshTask(taskName)
+	if len(stopped) > 0 {
+		fresh.Started = stopped[len(stopped)-1].Ended
+	}
+	s.activate(fresh)
+	return stopped
+}
+
+// Set the icon shown for the active task with the given name, if any.
+func (s *Server) SetIcon(taskName string, icon string) {
+	if i := s.activeIndex(taskName); i >= 0 {
+		s.activeTasks[i].Icon = icon
+		s.notifyListeners(EventStatus)
+	}
+}
+
+// Attach a note to the active task with the given name.
+func (s *Server) AddNote(taskName string, note string) error {
+	i := s.activeIndex(taskName)
+	if i < 0 {
+		return errors.Errorf("Task is not active: %s", taskName)
+	}
+	s.activeTasks[i].AddNote(note)
+	return nil
+}
+
+// Tag the active task with the given name.
+func (s *Server) SetTags(taskName string, tags []string) error {
+	i := s.activeIndex(taskName)
+	if i < 0 {
+		return errors.Errorf("Task is not active: %s", taskName)
+	}
+	s.activeTasks[i].Tags = tags
+	return nil
+}
+
+// Stop the active task with the given name and return it. Returns true if
+// the task was actually halted and false if it was not active.
+func (s *Server) StopTask(taskName string) (msg.Task, bool) {
+	for i, task := range s.activeTasks {
+		if task.Name == taskName {
+			s.cancelScheduledStop(taskName)
+			task.Stop()
+			s.activeTasks = append(s.activeTasks[:i], s.activeTasks[i+1:]...)
+			s.lastTask = task
+			s.notifyListeners(EventStop)
+			return task, true
+		}
+	}
+	return msg.Task{}, false
+}
+
+// ForgetTask discards everything the server holds concerning the task with
+// the given name: if active, it is stopped without being saved.
+func (s *Server) ForgetTask(taskName string) {
+	s.StopTask(taskName)
+	if s.lastTask.Name == taskName {
+		s.lastTask = msg.IdleTask()
 	}
-	return s.CurrentTask, false
 }
 
-// Register the listener with the server. If it cannot be notified immediately,
-// an error is returned.
-func (s *Server) RegisterListener(req *Request) (NotificationListener, error) {
-	lst := NotificationListener{req.Conn}
-	// FIXME: Make thread-safe
+// Stop the active tasks with the given names, or all active tasks if no
+// names are given. Returns those actually stopped.
+func (s *Server) StopTasks(taskNames []string) []msg.Task {
+	if len(taskNames) == 0 {
+		return s.StopAllTasks()
+	}
+	var stopped []msg.Task
+	for _, name := range taskNames {
+		if task, ok := s.StopTask(name); ok {
+			stopped = append(stopped, task)
+		}
+	}
+	return stopped
+}
+
+// Stop all active tasks and return them, in the order they were started.
+func (s *Server) StopAllTasks() []msg.Task {
+	stopped := s.stopAll()
+	if len(stopped) > 0 {
+		s.notifyListeners(EventStop)
+	}
+	return stopped
+}
+
+// Stop all active tasks without notifying listeners.
+func (s *Server) stopAll() []msg.Task {
+	stopped := s.activeTasks
+	if len(stopped) == 0 {
+		return nil
+	}
+	for i := range stopped {
+		s.cancelScheduledStop(stopped[i].Name)
+		stopped[i].Stop()
+	}
+	s.activeTasks = nil
+	s.lastTask = stopped[len(stopped)-1]
+	return stopped
+}
+
+// Register the listener with the server, to be notified at the given interval
+// while a task is active, besides changes; not at intervals if 0. If it cannot
+// be notified immediately, an error is returned.
+func (s *Server) RegisterListener(req *Request, tick time.Duration) (NotificationListener, error) {
+	lst := NotificationListener{conn: req.Conn, version: req.Cmd.Protocol(), tick: tick}
+	// The connection now belongs to the listener.
+	req.detached = true
 	s.listeners = append(s.listeners, lst)
+	if tick > 0 {
+		go s.tickListener(lst)
+	}
 	return lst, nil
 }
 
+// ShutdownWhenIdle makes the server shut down once no task is active or
+// paused and no client is connected, listeners aside. Gives the number of clients connected
+// besides the one making the request.
+func (s *Server) ShutdownWhenIdle() int {
+	s.whenIdle = true
+	if s.connections > 0 {
+		return s.connections - 1
+	}
+	return 0
+}
+
+// Shut down if requested once idle, and idle now. Otherwise, keep track of
+// how long the server has been idle, see scheduleIdleShutdown. Requires the
+// server to be locked.
+func (s *Server) shutdownIfIdle() {
+	if s.whenIdle && len(s.activeTasks) == 0 && len(s.paused) == 0 && s.connections == 0 && !s.shuttingDown() {
+		s.whenIdle = false
+		s.logInfo("Shutting down now that the server is idle")
+		s.InitiateShutdown()
+		return
+	}
+	s.scheduleIdleShutdown()
+}
+
 // Initiate the server to shut down, accepting no further connections.
 func (s *Server) InitiateShutdown() {
 	close(s.shutdownChan)
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"github.com/fgahr/tilo/msg"
+)
+
+// Pause stops all active tasks, remembering them to be resumed, see Unpause.
+// Returns the stopped tasks, which are left to be saved. Requires the server
+// to be locked.
+func (s *Server) Pause() []msg.Task {
+	stopped := s.stopAll()
+	if len(stopped) > 0 {
+		s.paused = append([]msg.Task(nil), stopped...)
+		s.logInfo("Paused", len(stopped), "task(s)")
+		s.notifyListeners(EventPause)
+	}
+	return stopped
+}
+
+// Paused gives the tasks stopped by the last pause, unless they have been
+// resumed or another task has been started since.
+func (s *Server) Paused() []msg.Task {
+	return append([]msg.Task(nil), s.paused...)
+}
+
+// DropPaused forgets about the paused tasks, which are saved already, so that
+// they are no longer resumed. Returns the dropped tasks. Requires the server
+// to be locked.
+func (s *Server) DropPaused() []msg.Task {
+	paused := s.paused
+	s.paused = nil
+	return paused
+}
+
+// Unpause starts the paused tasks afresh, with their split and tags. Returns
+// the started tasks. Requires the server to be locked.
+func (s *Server) Unpause() []msg.Task {
+	paused := s.paused
+	s.paused = nil
+	var resumed []msg.Task
+	for _, task := range paused {
+		fresh := msg.FreshTask(task.Name)
+		fresh.Split = task.Split
+		fresh.Tags = task.Tags
+		s.activate(fresh)
+		resumed = append(resumed, s.activeTasks[len(s.activeTasks)-1])
+	}
+	return resumed
+}
+
+// Break pauses all active tasks and starts the break task in their place,
+// leaving them to be resumed once the break is over. Returns the paused tasks,
+// which are left to be saved. Requires the server to be locked.
+func (s *Server) Break() []msg.Task {
+	stopped := s.stopAll()
+	fresh := msg.FreshTask(msg.BreakTask)
+	fresh.Tags = []string{msg.BreakTag}
+	s.activate(fresh)
+	// Kept only now, as starting a task ends the pause
+	if len(stopped) > 0 {
+		s.paused = append([]msg.Task(nil), stopped...)
+		s.logInfo("Paused", len(stopped), "task(s) for a break")
+		s.notifyListeners(EventPause)
+	}
+	return stopped
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/fgahr/tilo/server/backend"
+)
+
+// A backend implementing only what the tests use.
+type testBackend struct {
+	backend.Backend
+}
+
+func (b testBackend) TaskInfo() (map[string]msg.TaskInfo, error) {
+	return nil, nil
+}
+
+// The configuration of testBackend, without any items.
+type testBackendConf struct{}
+
+func (c testBackendConf) BackendName() string {
+	return "test"
+}
+
+func (c testBackendConf) AcceptedItems() []*config.Item {
+	return nil
+}
+
+func init() {
+	config.RegisterBackend(testBackendConf{})
+}
+
+// A server as started by a client, without connections, configured with
+// the given arguments.
+func testServer(t *testing.T, args ...string) *Server {
+	args = append([]string{"--conf-file=" + filepath.Join(t.TempDir(), "tilo.conf"), "--log-level=off", "--backend=test"}, args...)
+	conf, _, err := config.GetConfig(args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{conf: conf, Backend: testBackend{}, shutdownChan: make(chan struct{}), spawned: true}
+}
+
+// Wait for the server to shut down, giving whether it did within the time.
+func awaitShutdown(s *Server, within time.Duration) bool {
+	select {
+	case <-s.shutdownChan:
+		return true
+	case <-time.After(within):
+		return false
+	}
+}
+
+func TestIdleShutdownWaitsForPausedTasks(t *testing.T) {
+	s := testServer(t, "--idle-shutdown=10ms")
+	s.mu.Lock()
+	s.activate(msg.FreshTask("a"))
+	if paused := s.Pause(); len(paused) != 1 {
+		t.Fatalf("Expected one task to be paused, got %v", paused)
+	}
+	if s.idle() {
+		t.Error("Expected the server not to be idle while tasks are paused")
+	}
+	s.shutdownIfIdle()
+	s.mu.Unlock()
+	if awaitShutdown(s, 100*time.Millisecond) {
+		t.Fatal("Expected no shutdown while tasks are paused")
+	}
+
+	s.mu.Lock()
+	resumed := s.Unpause()
+	if len(resumed) != 1 || resumed[0].Name != "a" || !s.IsActive("a") {
+		t.Errorf("Expected task a to be resumed, got %v", resumed)
+	}
+	s.StopAllTasks()
+	s.shutdownIfIdle()
+	s.mu.Unlock()
+	if !awaitShutdown(s, time.Second) {
+		t.Error("Expected shutdown once idle")
+	}
+}
+
+func TestShutdownWhenIdleWaitsForPausedTasks(t *testing.T) {
+	s := testServer(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activate(msg.FreshTask("a"))
+	s.Pause()
+	s.ShutdownWhenIdle()
+	s.shutdownIfIdle()
+	if s.shuttingDown() {
+		t.Fatal("Expected no shutdown while tasks are paused")
+	}
+
+	s.Unpause()
+	s.StopAllTasks()
+	s.shutdownIfIdle()
+	if !s.shuttingDown() {
+		t.Error("Expected shutdown once idle")
+	}
+}
+
+func TestDropPaused(t *testing.T) {
+	s := testServer(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activate(msg.FreshTask("a"))
+	s.Pause()
+	if dropped := s.DropPaused(); len(dropped) != 1 || dropped[0].Name != "a" {
+		t.Errorf("Expected task a to be dropped, got %v", dropped)
+	}
+	if !s.idle() {
+		t.Error("Expected the server to be idle once the pause is dropped")
+	}
+	if resumed := s.Unpause(); len(resumed) != 0 {
+		t.Errorf("Expected nothing to be resumed, got %v", resumed)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"os"
+	"strings"
+)
+
+// ReloadConfig re-reads the configuration file, see config.Opts.Reload, and
+// reschedules jobs accordingly. Gives the names of changed items and sections,
+// and of those only taking effect on restart. Requires the server to be
+// locked.
+func (s *Server) ReloadConfig() ([]string, []string, error) {
+	applied, left, err := s.conf.Reload(os.Args[1:], os.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+	close(s.reloaded)
+	s.reloaded = make(chan struct{})
+	if len(applied) > 0 {
+		s.logInfo("Reloaded configuration, changed:", strings.Join(applied, ", "))
+	} else {
+		s.logInfo("Reloaded configuration, nothing changed")
+	}
+	if len(left) > 0 {
+		s.logWarn("Changes take effect on restart:", strings.Join(left, ", "))
+	}
+	return applied, left, nil
+}
+
+// Reload the configuration on behalf of a signal.
+func (s *Server) reloadOnSignal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, _, err := s.ReloadConfig(); err != nil {
+		s.logError(err)
+	}
+}
+
+// SetLogLevel changes the log level until the configuration is reloaded.
+// Gives the previous level. Requires the server to be locked.
+func (s *Server) SetLogLevel(level string) string {
+	previous := s.conf.LogLevel.Value
+	s.conf.LogLevel.Value = level
+	s.logInfo("Log level changed from", previous, "to", level)
+	return previous
+}
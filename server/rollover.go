@@ -0,0 +1,78 @@
+package server
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/pkg/errors"
+)
+
+// Splits active tasks at the configured time of day, so that sessions
+// running overnight are saved as one entry per day.
+type rollover struct {
+	// No state required
+}
+
+// The configured time of rollover on the day of the given time. False if
+// rollover is not configured.
+func rolloverOn(conf *config.Opts, day time.Time) (time.Time, bool, error) {
+	if conf.Rollover.Value == "" {
+		return time.Time{}, false, nil
+	}
+	clock, err := time.Parse("15:04", conf.Rollover.Value)
+	if err != nil {
+		return time.Time{}, false, errors.Errorf("Invalid rollover time: %s", conf.Rollover.Value)
+	}
+	at := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+	return at, true, nil
+}
+
+func (r rollover) Next(conf *config.Opts, after time.Time) time.Time {
+	at, ok, err := rolloverOn(conf, after)
+	if err != nil {
+		// Reported when running the job
+		return after.Add(24 * time.Hour)
+	} else if !ok {
+		return time.Time{}
+	}
+	if !at.After(after) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at
+}
+
+func (r rollover) Run(s *Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	at, ok, err := rolloverOn(s.conf, now)
+	if err != nil || !ok {
+		return err
+	}
+	if at.After(now) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return s.rollOver(at)
+}
+
+// Save the part of each active task before the given time, restarting the
+// task at that time. The tasks keep running without interruption.
+func (s *Server) rollOver(at time.Time) error {
+	for i, task := range s.activeTasks {
+		if !task.Started.Before(at) {
+			continue
+		}
+		task.Ended, task.HasEnded = at, true
+		if err := s.SaveTask(task); err != nil {
+			return errors.Wrapf(err, "Failed to save task %s at rollover", task.Name)
+		}
+		s.activeTasks[i].Started = at
+		s.logInfo("Rolled over task", task.Name, "at", at)
+	}
+	s.notifyListeners(EventStatus)
+	return nil
+}
+
+func init() {
+	RegisterJob("rollover", rollover{})
+}
@@ -2,14 +2,21 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fgahr/tilo/config"
 	"github.com/fgahr/tilo/msg"
@@ -21,11 +28,28 @@ import (
 var operations = make(map[string]Operation)
 
 type Request struct {
-	Conn net.Conn
-	Cmd  msg.Cmd
+	Conn      net.Conn
+	Cmd       msg.Cmd
+	ctx       context.Context // Done when the client hangs up or gives up waiting
+	keepAlive bool            // Whether the connection is reused for further requests
+	detached  bool            // Whether the connection has been handed over, e.g. to a listener
 }
 
+// Context gives the context of the request, which is done once the client
+// hangs up or its timeout expires. Long operations should stop then.
+func (req *Request) Context() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+	return req.ctx
+}
+
+// Close the connection underlying the request unless it is kept alive for
+// further requests.
 func (req *Request) Close() error {
+	if req.keepAlive {
+		return nil
+	}
 	return req.Conn.Close()
 }
 
@@ -34,6 +58,12 @@ type Operation interface {
 	ServerExec(srv *Server, req *Request) error
 }
 
+// Validator is implemented by operations checking commands before their
+// execution, so that they can rely on the command being well-formed.
+type Validator interface {
+	Validate(cmd msg.Cmd) error
+}
+
 func RegisterOperation(name string, operation Operation) {
 	operations[name] = operation
 }
@@ -41,12 +71,30 @@ func RegisterOperation(name string, operation Operation) {
 // A tilo Server. When the configuration is provided, the remaining fields
 // are filled by the .init() method.
 type Server struct {
+	mu             sync.Mutex             // Serializes request processing
 	shutdownChan   chan struct{}          // Used to communicate shutdown requests
 	conf           *config.Opts           // Configuration parameters for this instance
 	Backend        backend.Backend        // The database backend
 	socketListener net.Listener           // Listener on the client request socket
-	CurrentTask    msg.Task               // The currently active task, if any
+	tcpListener    net.Listener           // Listener for clients over TCP, if configured
+	activeTasks    []msg.Task             // The active tasks, most recently started last
+	lastTask       msg.Task               // The most recently stopped task
+	paused         []msg.Task             // Tasks stopped by a pause, see Pause
+	overlong       []msg.Overlong         // Tasks stopped for running too long, see ResolveOverlong
+	stopTimers     map[string]*time.Timer // Timers for scheduled stops by task name
+	snoozedUntil   time.Time              // Until when reminders are snoozed
 	listeners      []NotificationListener // Listeners for task change notifications
+	subscribers    []chan Notification    // In-process listeners, e.g. HTTP event streams
+	serviceSubs    []chan Notification    // Notifications for services, see RegisterService
+	services       sync.WaitGroup         // Services running in the background
+	httpServer     *http.Server           // Serves HTTP endpoints, if configured
+	origin         string                 // The client issuing the request in process, if any
+	connections    int                    // Clients connected for requests, listeners aside
+	whenIdle       bool                   // Whether to shut down once idle, see ShutdownWhenIdle
+	handingOver    bool                   // Whether active tasks are left to the next server, see HandOver
+	reloaded       chan struct{}          // Closed and replaced when the configuration is reloaded
+	spawned        bool                   // Whether started by a client, see scheduleIdleShutdown
+	idleTimer      *time.Timer            // Shuts down the server once idle for long, if running
 }
 
 // Start server operation.
@@ -59,21 +107,48 @@ func Run(conf *config.Opts) error {
 
 	// Ensure clean shutdown if at all possible.
 	defer s.enforceCleanup()
+	defer s.waitForServices()
 	defer close(s.shutdownChan)
 
+	s.startJobs()
+	s.startServices()
 	s.main()
 	return nil
 }
 
-// Check whether the server is running.
+// Check whether the server is running, i.e. accepting connections. A socket
+// left behind by a server which did not shut down cleanly does not count.
+// For a remote server, see config.Opts.RemoteServer, whether it is reachable.
 func IsRunning(conf *config.Opts) (bool, error) {
-	_, err := os.Stat(conf.Socket.Value)
-	if os.IsNotExist(err) {
+	if conf.RemoteServer() {
+		return isListening("tcp", conf.ServerAddr.Value)
+	}
+	return runningLocally(conf)
+}
+
+// Check whether a server is accepting connections on the local socket.
+func runningLocally(conf *config.Opts) (bool, error) {
+	if err := checkSocketPath(conf); err != nil {
+		return false, err
+	}
+	return isListening(conf.Protocol.Value, conf.Socket.Value)
+}
+
+// Check whether connections are accepted at the address.
+func isListening(network string, addr string) (bool, error) {
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err == nil {
+		conn.Close()
+		return true, nil
+	} else if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
 		return false, nil
-	} else if err != nil {
-		return false, errors.Wrap(err, "Could not determine server status")
 	}
-	return true, nil
+	return false, errors.Wrap(err, "Could not determine server status")
+}
+
+// Config gives the configuration the server operates with.
+func (s *Server) Config() *config.Opts {
+	return s.conf
 }
 
 // Check whether the server is currently in shutdown.
@@ -93,13 +168,14 @@ func ensureDirExists(dir string) error {
 
 // Start the server, initiating required connections.
 func (s *Server) init() error {
-	if running, err := IsRunning(s.conf); err != nil {
+	if running, err := runningLocally(s.conf); err != nil {
 		return err
 	} else if running {
 		return errors.New("Cannot start server: Already running.")
 	}
 
 	s.shutdownChan = make(chan struct{})
+	s.reloaded = make(chan struct{})
 
 	// Create directories if necessary
 	if err := ensureDirExists(s.conf.ConfigDir()); err != nil {
@@ -108,18 +184,37 @@ func (s *Server) init() error {
 
 	if err := ensureDirExists(s.conf.SocketDir()); err != nil {
 		return err
+	} else if err := s.checkSocketDir(); err != nil {
+		return err
 	}
 
 	// Establish database connection.
 	backend := backend.From(s.conf)
-	if err := backend.Init(); err != nil {
-		s.socketListener.Close()
+	if backend == nil {
+		return errors.Errorf("No such backend: %s", s.conf.Backend.Value)
+	} else if err := backend.Init(); err != nil {
 		backend.Close()
 		return err
 	} else {
 		s.Backend = backend
 	}
 
+	// Remove the socket of a server which did not shut down cleanly, e.g.
+	// after a crash, which would prevent listening. Another server may have
+	// started in the meantime, its socket is left alone.
+	if _, err := os.Stat(s.conf.Socket.Value); err == nil && s.conf.Protocol.Value == "unix" {
+		if conn, err := net.DialTimeout("unix", s.conf.Socket.Value, time.Second); err == nil {
+			conn.Close()
+			return errors.New("Cannot start server: Already running.")
+		} else if !errors.Is(err, syscall.ECONNREFUSED) {
+			return errors.Wrap(err, "Unable to determine whether the socket is stale")
+		}
+		s.logWarn("Removing stale socket", s.conf.Socket.Value)
+		if err := os.Remove(s.conf.Socket.Value); err != nil {
+			return errors.Wrap(err, "Unable to remove stale socket")
+		}
+	}
+
 	// Open request socket.
 	if requestListener, err := net.Listen(s.conf.Protocol.Value, s.conf.Socket.Value); err != nil {
 		return err
@@ -127,7 +222,20 @@ func (s *Server) init() error {
 		s.socketListener = requestListener
 	}
 
-	s.CurrentTask = msg.IdleTask()
+	s.lastTask = msg.IdleTask()
+	s.stopTimers = make(map[string]*time.Timer)
+	s.spawned = startedByClient()
+	if err := s.resumeHandover(); err != nil {
+		s.logError(err)
+	}
+
+	// Not essential, hence no reason to refuse starting up
+	if err := s.startHTTP(); err != nil {
+		s.logError(err)
+	}
+	if err := s.startTCP(); err != nil {
+		s.logError(err)
+	}
 
 	return nil
 }
@@ -147,19 +255,29 @@ func (s *Server) main() {
 	srvChan := make(chan net.Conn)
 	defer close(srvChan)
 
-	// Enable cleanup on receiving SIGTERM.
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Enable cleanup on receiving SIGTERM, reloading on SIGHUP.
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	// Enable connection processing.
 	go s.waitForConnection(s.socketListener, srvChan)
+	if s.tcpListener != nil {
+		go s.waitForConnection(s.tcpListener, srvChan)
+	}
 
 	s.logDebug("Starting server main loop.")
+	s.mu.Lock()
+	s.scheduleIdleShutdown()
+	s.mu.Unlock()
 MainLoop:
 	for {
 		select {
 		case conn := <-srvChan:
-			s.serveConnection(conn)
+			go s.serveConnection(conn)
 		case sig := <-sigChan:
 			s.logDebug("Received signal: ", sig)
+			if sig == syscall.SIGHUP {
+				go s.reloadOnSignal()
+				continue
+			}
 			break MainLoop
 		case <-s.shutdownChan:
 			break MainLoop
@@ -182,32 +300,128 @@ func (s *Server) waitForConnection(lst net.Listener, srvChan chan<- net.Conn) {
 	}
 }
 
-// Serve a notification listener connection, keeping it open.
+// Serve a client connection. Requests are processed one after another for as
+// long as the client asks for the connection to be kept alive.
 func (s *Server) serveConnection(conn net.Conn) {
-	dec := json.NewDecoder(conn)
-	cmd := msg.Cmd{}
-	if err := dec.Decode(&cmd); err != nil {
-		s.logError(errors.Wrap(err, "Failed to decode command"))
+	// Read in the background, to notice the client hanging up while its
+	// request is processed.
+	in, out := io.Pipe()
+	defer in.Close()
+	hangup := make(chan struct{})
+	go func() {
+		_, err := io.Copy(out, conn)
+		out.CloseWithError(err)
+		close(hangup)
+	}()
+
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.connections--
+		s.shutdownIfIdle()
+	}()
+
+	dec := json.NewDecoder(in)
+	if isTCP(conn) && !s.authenticate(dec, conn) {
+		conn.Close()
+		return
+	}
+	for {
+		cmd := msg.Cmd{}
+		if err := dec.Decode(&cmd); err != nil {
+			if err != io.EOF {
+				s.logError(errors.Wrap(err, "Failed to decode command"))
+			}
+			conn.Close()
+			return
+		}
+		ctx, cancel := requestContext(cmd, hangup)
+		req := &Request{Conn: conn, Cmd: cmd, ctx: ctx, keepAlive: cmd.KeepAlive}
+		if err := s.Dispatch(req); err != nil {
+			s.logError(errors.Wrap(err, "Unable to execute command"))
+		}
+		cancel()
+		if !req.keepAlive || req.detached {
+			return
+		}
 	}
-	if err := s.Dispatch(&Request{conn, cmd}); err != nil {
-		s.logError(errors.Wrap(err, "Unable to execute command"))
+}
+
+// The context of a request, done when the client hangs up or the timeout
+// given with the command expires.
+func requestContext(cmd msg.Cmd, hangup <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if cmd.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cmd.Timeout)*time.Millisecond)
 	}
+	go func() {
+		select {
+		case <-hangup:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
-func (s *Server) Dispatch(req *Request) error {
+func (s *Server) Dispatch(req *Request) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A bug triggered by one request must not take down the server, and
+	// with it the running tasks.
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("Panic while executing %s: %v\n%s", req.Cmd.Op, r, debug.Stack())
+			resp := msg.Response{}
+			resp.Reject(msg.ErrInternal, errors.Errorf("Internal error while executing %s", req.Cmd.Op))
+			// Fails if the operation has answered already, which is fine
+			s.Answer(req, resp)
+			req.keepAlive = false
+			req.Close()
+		}
+	}()
 	s.logCommand(req.Cmd)
+	s.origin = req.Cmd.Origin
+	// Queries are given up along with the request
+	base := s.Backend
+	s.Backend = base.WithContext(req.Context())
+	defer func() { s.origin, s.Backend = "", base }()
 	command := req.Cmd.Op
 	op := operations[command]
 	if op == nil {
-		return errors.New("No such operation: " + command)
+		err := errors.New("No such operation: " + command)
+		return s.reject(req, msg.ErrUnknownOperation, err)
+	}
+	if v, ok := op.(Validator); ok {
+		if err := v.Validate(req.Cmd); err != nil {
+			err = errors.Wrapf(err, "Invalid request for %s", command)
+			return s.reject(req, msg.ErrInvalidRequest, err)
+		}
 	}
 	op.ServerExec(s, req)
+	s.shutdownIfIdle()
 	return nil
 }
 
-// Send a notification to all registered listeners.
-func (s *Server) notifyListeners() {
-	ntf := TaskNotification(s.CurrentTask)
+// Answer a request which is not executed, giving the reason.
+func (s *Server) reject(req *Request, code string, err error) error {
+	resp := msg.Response{}
+	resp.Reject(code, err)
+	if answerErr := s.Answer(req, resp); answerErr != nil {
+		s.logError(answerErr)
+	}
+	req.Close()
+	return err
+}
+
+// Send a notification about the current state to all registered listeners,
+// in response to the given event.
+func (s *Server) notifyListeners(event string) {
+	ntf := s.CurrentNotification()
+	ntf.Event = event
 	s.logDebug("Notifying listeners:", ntf)
 	if len(s.listeners) > 0 {
 		remainingListeners := make([]NotificationListener, 0)
@@ -221,6 +435,7 @@ func (s *Server) notifyListeners() {
 		}
 		s.listeners = remainingListeners
 	}
+	s.publish(ntf)
 }
 
 // Notify all connected listeners of shutdown and disconnect them.
@@ -232,21 +447,84 @@ func (s *Server) disconnectAllListeners() {
 			s.logWarn("Error closing listener connection:", err)
 		}
 	}
+	s.listeners = nil
+}
+
+// Notify the listener at its interval while a task is active, until it is
+// disconnected.
+func (s *Server) tickListener(lst NotificationListener) {
+	ticker := time.NewTicker(lst.tick)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.tick(lst) {
+			return
+		}
+	}
+}
+
+// Notify the listener of the elapsed time if a task is active. Gives whether
+// it is still registered.
+func (s *Server) tick(lst NotificationListener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, registered := range s.listeners {
+		if registered.conn != lst.conn {
+			continue
+		}
+		if len(s.activeTasks) == 0 {
+			return true
+		}
+		ntf := s.CurrentNotification()
+		ntf.Event = EventTick
+		if err := lst.Notify(ntf); err != nil {
+			s.logInfo("Could not notify listener, disconnecting:", err)
+			lst.disconnect()
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			return false
+		}
+		return true
+	}
+	return false
 }
 
 // Initiate shutdown, closing open connections.
 func (s *Server) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	var err error
 	s.logInfo("Shutting down server..")
-	// When the shutdown is initiated by a message, the task is stopped prior.
+	// When the shutdown is initiated by a message, tasks are stopped prior.
 	// If shutdown is in response to a signal, there is nothing else to do here.
-	s.StopCurrentTask()
+	// In a restart, they are left for the next server to resume.
+	if s.handingOver {
+		s.logInfo("Handing over active tasks..")
+		if err := s.saveHandover(); err != nil {
+			s.logError(err)
+		}
+		for name := range s.stopTimers {
+			s.cancelScheduledStop(name)
+		}
+	} else {
+		s.StopAllTasks()
+	}
 
 	if len(s.listeners) > 0 {
 		s.logInfo("Disconnecting listeners")
 		s.disconnectAllListeners()
 	}
 
+	if s.httpServer != nil {
+		s.logInfo("Stopping HTTP listener..")
+		s.stopHTTP()
+	}
+
+	if s.tcpListener != nil {
+		s.logInfo("Stopping TCP listener..")
+		if err := s.tcpListener.Close(); err != nil {
+			s.logError(err)
+		}
+	}
+
 	s.logInfo("Closing socket..")
 	err = s.socketListener.Close()
 	if err != nil {
@@ -255,47 +533,59 @@ func (s *Server) shutdown() {
 		s.logInfo("OK")
 	}
 
-	// FIXME: Directory should probably not be removed unless in /tmp
-	s.logInfo("Removing temporary directory..")
-	err = os.RemoveAll(s.conf.SocketDir())
-	if err != nil {
-		s.logError(err)
-	} else {
-		s.logInfo("OK")
+	// The socket itself is removed on closing. A configured directory is
+	// left alone, as is the default one if it holds anything else.
+	if s.conf.DefaultSocket() {
+		s.logInfo("Removing socket directory..")
+		err = os.Remove(s.conf.SocketDir())
+		if err != nil && !os.IsNotExist(err) {
+			s.logInfo("Keeping socket directory:", err)
+		} else {
+			s.logInfo("OK")
+		}
 	}
 
-	s.logInfo("Shutdown complete.")
+	s.logInfo(shutdownComplete)
 }
 
 // TODO: Move to client package?
-// Start a server in a background process.
-func StartInBackground(conf *config.Opts) (int, error) {
-	sysProcAttr := syscall.SysProcAttr{}
+// Start a server in a background process, detached from the terminal. Its
+// output goes to the background log, see BackgroundLog.
+func StartInBackground(conf *config.Opts) (*os.Process, error) {
+	sysProcAttr := syscall.SysProcAttr{Setsid: true}
 	// Prepare high-level process attributes
 	confDir := filepath.Dir(conf.ConfFile.Value)
 	if err := ensureDirExists(confDir); err != nil {
-		return 0, errors.Wrap(err, "Unable to start server in background")
+		return nil, errors.Wrap(err, "Unable to start server in background")
 	}
+	if err := rotateLogs(conf); err != nil {
+		return nil, errors.Wrap(err, "Unable to rotate server logs")
+	}
+	logFile, err := os.OpenFile(BackgroundLog(conf), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create server log")
+	}
+	// The server keeps its own descriptor
+	defer logFile.Close()
 	procAttr := os.ProcAttr{
 		Dir:   confDir,
-		Env:   conf.MergeIntoEnv(os.Environ()),
-		Files: []*os.File{nil, nil, nil}, // stdin, stdout, stderr
+		Env:   append(conf.MergeIntoEnv(os.Environ()), spawnedEnv+"=1"),
+		Files: []*os.File{nil, logFile, logFile}, // stdin, stdout, stderr
 		Sys:   &sysProcAttr,
 	}
 
-	// No need to keep track of the spawned process
 	executable, err := os.Executable()
 	if err != nil {
-		return 0, errors.Wrap(err, "Unable to determine server executable")
+		return nil, errors.Wrap(err, "Unable to determine server executable")
 	}
 	// NOTE: Due to dependency resolution issues, there is no direct way to tie
 	// the arguments to the corresponding operation and its arguments. It could
 	// be done indirectly.
 	proc, err := os.StartProcess(executable, []string{executable, "server", "run"}, &procAttr)
 	if err != nil {
-		return 0, errors.Wrap(err, "Unable to start server process")
+		return nil, errors.Wrap(err, "Unable to start server process")
 	}
-	return proc.Pid, nil
+	return proc, nil
 }
 
 // Serialize obj to JSON, add a linebreak, and send it to the writer.
@@ -310,47 +600,78 @@ func writeJsonLine(obj interface{}, w io.Writer) error {
 	return err
 }
 
+// Fields of a structured log record, see config.Opts.LogJSON.
+type logFields map[string]interface{}
+
+// Shared by all records, so that concurrent ones do not interleave.
+var jsonLog = log.New(os.Stderr, "", 0)
+
+// Write a log line: the text as is, or a JSON object holding it along with the
+// level and fields.
+func (s *Server) writeLog(level string, fields logFields, text string) {
+	if !s.conf.LogJSON() {
+		log.Print(text)
+		return
+	}
+	record := logFields{"time": time.Now().Format(time.RFC3339Nano), "level": level, "msg": strings.TrimSpace(text)}
+	for key, value := range fields {
+		record[key] = value
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(logFields{"level": level, "msg": strings.TrimSpace(text)})
+	}
+	jsonLog.Println(string(data))
+}
+
 func (s *Server) logError(err error) {
 	if err == nil {
 		return
 	}
 	if s.conf.ShouldLogAny() {
-		log.Println(err)
+		s.writeLog("error", logFields{"error": err.Error()}, err.Error())
 	}
 }
 
 func (s *Server) logWarn(msg ...interface{}) {
 	if s.conf.ShouldLogWarnings() {
-		log.Println(msg...)
+		s.writeLog("warn", nil, fmt.Sprintln(msg...))
 	}
 }
 
 func (s *Server) logFmtWarn(format string, v ...interface{}) {
 	if s.conf.ShouldLogWarnings() {
-		log.Printf(format, v...)
+		s.writeLog("warn", nil, fmt.Sprintf(format, v...))
 	}
 }
 
 func (s *Server) logInfo(msg ...interface{}) {
 	if s.conf.ShouldLogInfo() {
-		log.Println(msg...)
+		s.writeLog("info", nil, fmt.Sprintln(msg...))
 	}
 }
 
 func (s *Server) logFmtInfo(format string, v ...interface{}) {
 	if s.conf.ShouldLogInfo() {
-		log.Printf(format, v...)
+		s.writeLog("info", nil, fmt.Sprintf(format, v...))
+	}
+}
+
+// Log at info level along with fields for structured logs.
+func (s *Server) logInfoFields(fields logFields, format string, v ...interface{}) {
+	if s.conf.ShouldLogInfo() {
+		s.writeLog("info", fields, fmt.Sprintf(format, v...))
 	}
 }
 
 func (s *Server) logDebug(msg ...interface{}) {
 	if s.conf.ShouldLogDebug() {
-		log.Println(msg...)
+		s.writeLog("debug", nil, fmt.Sprintln(msg...))
 	}
 }
 
 func (s *Server) logFmtDebug(format string, v ...interface{}) {
 	if s.conf.ShouldLogDebug() {
-		log.Printf(format, v...)
+		s.writeLog("debug", nil, fmt.Sprintf(format, v...))
 	}
 }
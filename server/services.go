@@ -0,0 +1,123 @@
+package server
+
+import (
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/pkg/errors"
+)
+
+var services = make(map[string]Service)
+
+// Service is work done by the server for as long as it runs, in response to
+// notifications, e.g. relaying them to other systems. Unlike subscribers,
+// services do not keep an idle server from shutting down.
+type Service interface {
+	// Enabled tells whether the service is to run, e.g. because it is
+	// configured.
+	Enabled(conf *config.Opts) bool
+	// Serve the notifications, starting with the current state, until the
+	// channel is closed on shutdown or when the configuration is reloaded.
+	// The server must be locked to access its state in the meantime.
+	Serve(s *Server, ntfs <-chan Notification) error
+}
+
+// RegisterService makes a service run by every server.
+// This function is called indirectly from other packages' init() functions.
+func RegisterService(name string, service Service) {
+	if services[name] != nil {
+		panic("Double registration of service with name " + name)
+	}
+	services[name] = service
+}
+
+const (
+	// How long until a failed service is started again
+	serviceRetryDelay = time.Minute
+	// How long services are given to finish on shutdown
+	serviceStopTimeout = 5 * time.Second
+)
+
+// Run all services, each one in the background until shutdown.
+func (s *Server) startServices() {
+	for name, service := range services {
+		s.services.Add(1)
+		go s.runService(name, service)
+	}
+}
+
+// Wait for services to finish after shutdown has been initiated, though not
+// for long.
+func (s *Server) waitForServices() {
+	done := make(chan struct{})
+	go func() {
+		s.services.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(serviceStopTimeout):
+		s.logWarn("Services did not finish in time")
+	}
+}
+
+// Run a service while it is enabled, until the server shuts down. It is
+// started anew when the configuration is reloaded, or a while after failing.
+func (s *Server) runService(name string, service Service) {
+	defer s.services.Done()
+	for {
+		s.mu.Lock()
+		reloaded := s.reloaded
+		var ntfs chan Notification
+		if service.Enabled(s.conf) && !s.shuttingDown() {
+			// Buffered so that a slow service does not hold back the server
+			ntfs = make(chan Notification, 8)
+			ntfs <- s.CurrentNotification()
+			s.serviceSubs = append(s.serviceSubs, ntfs)
+		}
+		s.mu.Unlock()
+
+		var retry <-chan time.Time
+		if ntfs == nil {
+			s.logDebug("Service", name, "is not enabled")
+		} else {
+			s.logInfo("Starting service", name)
+			done := make(chan error, 1)
+			go func() { done <- service.Serve(s, ntfs) }()
+			var err error
+			select {
+			case err = <-done:
+				s.endServiceSub(ntfs)
+				retry = time.After(serviceRetryDelay)
+			case <-reloaded:
+				s.endServiceSub(ntfs)
+				err = <-done
+			case <-s.shutdownChan:
+				s.endServiceSub(ntfs)
+				err = <-done
+			}
+			if err != nil {
+				s.logError(errors.Wrapf(err, "Service %s failed", name))
+			}
+		}
+		select {
+		case <-retry:
+		case <-reloaded:
+		case <-s.shutdownChan:
+			return
+		}
+	}
+}
+
+// Stop sending notifications to a service, closing its channel.
+func (s *Server) endServiceSub(ntfs chan Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ch := range s.serviceSubs {
+		if ch == ntfs {
+			s.serviceSubs = append(s.serviceSubs[:i], s.serviceSubs[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
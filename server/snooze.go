@@ -0,0 +1,48 @@
+package server
+
+import (
+	"time"
+)
+
+// Snooze reminders until the given time. Reminders are not issued by the
+// server itself; listeners are informed so that they can hold back theirs.
+func (s *Server) Snooze(until time.Time) {
+	s.snoozedUntil = until
+	s.logInfo("Reminders snoozed until", until)
+	s.notifyListeners(EventStatus)
+}
+
+// Unsnooze ends a snooze period early.
+func (s *Server) Unsnooze() {
+	s.snoozedUntil = time.Time{}
+	s.logInfo("Reminders no longer snoozed")
+	s.notifyListeners(EventStatus)
+}
+
+// SnoozedUntil gives the end of the current snooze period. It is the zero
+// time if reminders are not snoozed.
+func (s *Server) SnoozedUntil() time.Time {
+	if s.snoozedUntil.After(time.Now()) {
+		return s.snoozedUntil
+	}
+	return time.Time{}
+}
+
+// CurrentNotification describes the server's state for listeners: the
+// current task and how long it has been running, paused tasks and, if
+// applicable, the end of the snooze period.
+func (s *Server) CurrentNotification() Notification {
+	current := s.CurrentTask()
+	ntf := TaskNotification(current)
+	ntf.Event = EventStatus
+	if current.IsRunning() {
+		ntf.Elapsed = int64(time.Since(current.Started).Seconds())
+	}
+	for _, task := range s.paused {
+		ntf.Paused = append(ntf.Paused, task.Name)
+	}
+	if until := s.SnoozedUntil(); !until.IsZero() {
+		ntf.SnoozedUntil = &until
+	}
+	return ntf
+}
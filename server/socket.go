@@ -0,0 +1,66 @@
+package server
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/pkg/errors"
+)
+
+// The longest path of a unix socket, given by the size of sun_path less the
+// terminating NUL.
+func maxSocketPath() int {
+	switch runtime.GOOS {
+	case "linux":
+		return 107
+	default:
+		// BSDs and macOS
+		return 103
+	}
+}
+
+// Check that the configured socket can be used, as far as possible before
+// listening or connecting.
+func checkSocketPath(conf *config.Opts) error {
+	if conf.Protocol.Value != "unix" {
+		return nil
+	}
+	if n := len(conf.Socket.Value); n > maxSocketPath() {
+		return errors.Errorf("Socket path too long, %d characters, at most %d allowed: %s\n"+
+			"Choose a shorter one with the socket option", n, maxSocketPath(), conf.Socket.Value)
+	}
+	return nil
+}
+
+// Check that the directory holding the socket belongs to the current user and
+// is not accessible to others, so that no other user can intercept requests.
+// Shared temporary directories may hold a directory of the same name created
+// by someone else. Only the default directory is required to be private, a
+// configured one may be shared on purpose, e.g. /tmp.
+func (s *Server) checkSocketDir() error {
+	if s.conf.Protocol.Value != "unix" {
+		return nil
+	}
+	dir := s.conf.SocketDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.Wrap(err, "Unable to access socket directory")
+	} else if !info.IsDir() {
+		return errors.Errorf("Not a directory: %s", dir)
+	}
+	var problem string
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		problem = "belongs to another user"
+	} else if info.Mode().Perm()&0022 != 0 {
+		problem = "is writable by other users"
+	} else {
+		return nil
+	}
+	if !s.conf.DefaultSocket() {
+		s.logFmtWarn("Socket directory %s %s, other users may be able to intercept requests", dir, problem)
+		return nil
+	}
+	return errors.Errorf("Socket directory %s %s, choose another socket", dir, problem)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// Connect opens a connection for a client: over TCP to the configured server
+// address if there is one, presenting the token, otherwise to the socket.
+func Connect(conf *config.Opts) (net.Conn, error) {
+	if !conf.RemoteServer() {
+		return net.Dial(conf.Protocol.Value, conf.Socket.Value)
+	}
+	conn, err := net.Dial("tcp", conf.ServerAddr.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(msg.Auth{Token: conf.ServerToken.Value}); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "Unable to send token")
+	}
+	return conn, nil
+}
+
+// Accept clients over TCP on the configured address, if any. Refused without
+// a token, which would leave the server open to anyone on the network.
+func (s *Server) startTCP() error {
+	addr := s.conf.ListenAddr.Value
+	if addr == "" {
+		return nil
+	} else if s.conf.ServerToken.Value == "" {
+		return errors.New("Not listening on " + addr + ": no server_token configured")
+	}
+	lst, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Unable to listen for clients over TCP")
+	}
+	s.tcpListener = lst
+	s.logInfo("Accepting clients on", lst.Addr())
+	return nil
+}
+
+// Whether a client is connected over TCP, as opposed to the socket.
+func isTCP(conn net.Conn) bool {
+	_, ok := conn.LocalAddr().(*net.TCPAddr)
+	return ok
+}
+
+// Check the token sent by a client connected over TCP before any command,
+// answering with an error if it does not match. Gives whether it does.
+func (s *Server) authenticate(dec *json.Decoder, conn net.Conn) bool {
+	var auth msg.Auth
+	if err := dec.Decode(&auth); err != nil {
+		// Hanging up at once is how clients check whether the server is up
+		return false
+	}
+	s.mu.Lock()
+	token := s.conf.ServerToken.Value
+	s.mu.Unlock()
+	if token != "" && subtle.ConstantTimeCompare([]byte(auth.Token), []byte(token)) == 1 {
+		return true
+	}
+	s.logWarn("Rejecting client with invalid token:", conn.RemoteAddr())
+	resp := msg.Response{}
+	resp.Reject(msg.ErrUnauthorized, errors.New("Invalid token"))
+	if err := writeJsonLine(resp.ForProtocol(msg.ProtocolVersion), conn); err != nil {
+		s.logError(errors.Wrap(err, "Failed to send response"))
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fgahr/tilo/msg"
+)
+
+// Present the token as a client would, giving whether the server accepted it
+// and its response, if it sent one.
+func presentToken(t *testing.T, s *Server, token string) (bool, msg.Response) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	accepted := make(chan bool, 1)
+	go func() {
+		accepted <- s.authenticate(json.NewDecoder(conn), conn)
+		conn.Close()
+	}()
+	if err := json.NewEncoder(client).Encode(msg.Auth{Token: token}); err != nil {
+		t.Fatal(err)
+	}
+	var resp msg.Response
+	// Nothing is sent on success, the connection is closed by then
+	json.NewDecoder(client).Decode(&resp)
+	return <-accepted, resp
+}
+
+// Capture the server's log output while running f.
+func captureLog(f func()) string {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	f()
+	return buf.String()
+}
+
+func TestAuthenticateAcceptsToken(t *testing.T) {
+	s := testServer(t, "--server-token=secret")
+	if accepted, resp := presentToken(t, s, "secret"); !accepted || resp.Failed() {
+		t.Errorf("Expected the token to be accepted, got %v", resp)
+	}
+}
+
+func TestAuthenticateRejectsWrongToken(t *testing.T) {
+	s := testServer(t, "--server-token=secret")
+	for _, token := range []string{"wrong", "secre", "secret2", ""} {
+		accepted, resp := presentToken(t, s, token)
+		if accepted {
+			t.Errorf("Expected token %q to be rejected", token)
+		} else if resp.Code != msg.ErrUnauthorized {
+			t.Errorf("Expected token %q to be answered with %s, got %v", token, msg.ErrUnauthorized, resp)
+		}
+	}
+}
+
+func TestAuthenticateRejectsEmptyTokenWithoutServerToken(t *testing.T) {
+	s := testServer(t)
+	if accepted, resp := presentToken(t, s, ""); accepted || resp.Code != msg.ErrUnauthorized {
+		t.Errorf("Expected an empty token to be rejected, got %v", resp)
+	}
+}
+
+func TestAuthenticateHangUp(t *testing.T) {
+	s := testServer(t, "--server-token=secret", "--log-level=warn")
+	client, conn := net.Pipe()
+	client.Close()
+	var accepted bool
+	logged := captureLog(func() {
+		accepted = s.authenticate(json.NewDecoder(conn), conn)
+	})
+	if accepted {
+		t.Error("Expected a client hanging up not to be accepted")
+	}
+	if strings.TrimSpace(logged) != "" {
+		t.Errorf("Expected no warning for a client hanging up, got %q", logged)
+	}
+}
+
+func TestStartTCPRequiresToken(t *testing.T) {
+	s := testServer(t, "--listen-addr=127.0.0.1:0")
+	if err := s.startTCP(); err == nil {
+		s.tcpListener.Close()
+		t.Fatal("Expected an error listening without a token")
+	}
+	if s.tcpListener != nil {
+		t.Error("Expected no listener without a token")
+	}
+
+	s = testServer(t, "--listen-addr=127.0.0.1:0", "--server-token=secret")
+	if err := s.startTCP(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.tcpListener.Close()
+	if !isTCP(mustDial(t, s.tcpListener.Addr())) {
+		t.Error("Expected a connection over TCP")
+	}
+}
+
+// Connect to the address, closing the connection once the test is done.
+func mustDial(t *testing.T, addr net.Addr) net.Conn {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
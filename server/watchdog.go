@@ -0,0 +1,175 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/fgahr/tilo/config"
+	"github.com/fgahr/tilo/msg"
+	"github.com/pkg/errors"
+)
+
+// Decisions on what to keep of a task stopped for running too long.
+const (
+	OverlongKeep    = "keep"    // Up to the limit
+	OverlongTrim    = "trim"    // Up to an earlier time
+	OverlongDiscard = "discard" // Nothing
+)
+
+// How often the watchdog looks for tasks running too long.
+const watchdogInterval = time.Minute
+
+// Stops tasks running longer than max_task_duration, e.g. when forgotten
+// overnight.
+type watchdog struct {
+	// No state required
+}
+
+func (w watchdog) Next(conf *config.Opts, after time.Time) time.Time {
+	if conf.TaskLimit() == 0 {
+		return time.Time{}
+	}
+	return after.Add(watchdogInterval)
+}
+
+func (w watchdog) Run(s *Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopOverlong(time.Now())
+	return nil
+}
+
+// Stop the active tasks which have reached the limit as of now, as if
+// stopped at the limit. Unless configured to abort them, they are saved as
+// such. Either way, they are remembered until a client decides what to keep,
+// see ResolveOverlong.
+func (s *Server) stopOverlong(now time.Time) {
+	limit := s.conf.TaskLimit()
+	if limit == 0 {
+		return
+	}
+	var overlong []msg.Task
+	for _, task := range s.activeTasks {
+		if now.Sub(task.Started) >= limit {
+			overlong = append(overlong, task)
+		}
+	}
+	for _, task := range overlong {
+		stopped, _ := s.StopTask(task.Name)
+		stopped.Ended = stopped.Started.Add(limit)
+		o := msg.Overlong{Task: stopped}
+		if !s.conf.AbortOverlong() {
+			if err := s.SaveTask(stopped); err != nil {
+				s.logError(errors.Wrap(err, "Failed to save task stopped for running too long"))
+			} else {
+				o.Saved = true
+			}
+		}
+		s.overlong = append(s.overlong, o)
+		s.logWarn("Stopped task running longer than", limit, "saved:", o.Saved, stopped)
+		s.runIdleCommand(o)
+	}
+	if len(overlong) > 0 {
+		s.shutdownIfIdle()
+	}
+}
+
+// Run the configured command, if any, for a task stopped for running too long.
+func (s *Server) runIdleCommand(o msg.Overlong) {
+	command := s.conf.IdleCommand.Value
+	if command == "" {
+		return
+	}
+	action := config.OVERLONG_STOP
+	if !o.Saved {
+		action = config.OVERLONG_ABORT
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"TILO_TASK="+o.Task.Name,
+		"TILO_ACTION="+action,
+		"TILO_SINCE="+o.Task.Started.Format(time.RFC3339))
+	if err := cmd.Start(); err != nil {
+		s.logError(errors.Wrap(err, "Failed to run idle_command"))
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			s.logWarn("idle_command failed:", err)
+		}
+	}()
+}
+
+// Overlong gives the tasks stopped for running too long which await a
+// decision on what to keep.
+func (s *Server) Overlong() []msg.Overlong {
+	return append([]msg.Overlong(nil), s.overlong...)
+}
+
+// ResolveOverlong decides what to keep of a task stopped for running too
+// long: all of it up to the limit, the part up to the given end, or nothing.
+// Requires the server to be locked.
+func (s *Server) ResolveOverlong(taskName string, decision string, end time.Time) error {
+	i := -1
+	for j, o := range s.overlong {
+		if o.Task.Name == taskName {
+			i = j
+		}
+	}
+	if i < 0 {
+		return errors.Errorf("Task was not stopped for running too long: %s", taskName)
+	}
+	o := s.overlong[i]
+	switch decision {
+	case OverlongKeep:
+		end = o.Task.Ended
+	case OverlongTrim:
+		if !end.After(o.Task.Started) || !end.Before(o.Task.Ended) {
+			return errors.Errorf("Not between the start of the task and the limit: %s", end.Format(time.RFC3339))
+		}
+	case OverlongDiscard:
+	default:
+		return errors.Errorf("Cannot %s a task, only %s, %s or %s it", decision,
+			OverlongKeep, OverlongTrim, OverlongDiscard)
+	}
+
+	if o.Saved && decision != OverlongKeep {
+		if err := s.deleteSaved(o.Task); err != nil {
+			return err
+		}
+	}
+	if decision == OverlongTrim || (decision == OverlongKeep && !o.Saved) {
+		task := o.Task
+		task.Ended = end
+		if err := s.SaveTask(task); err != nil {
+			return err
+		}
+	}
+	s.overlong = append(s.overlong[:i], s.overlong[i+1:]...)
+	s.logInfo("Resolved task stopped for running too long:", taskName, decision)
+	return nil
+}
+
+// Delete the entries saved for a task, found by their tasks and times.
+func (s *Server) deleteSaved(task msg.Task) error {
+	for _, part := range task.Allocate() {
+		entries, err := s.Backend.Entries(part.Name, part.Started.Add(-time.Second), part.Ended.Add(time.Second), 0)
+		if err != nil {
+			return errors.Wrap(err, "Failed to find saved entries")
+		}
+		for _, e := range entries {
+			if e.Started.Unix() == part.Started.Unix() && e.Ended.Unix() == part.Ended.Unix() {
+				if err := s.Backend.DeleteEntry(e.ID); err != nil {
+					return errors.Wrap(err, "Failed to delete saved entry")
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterJob("watchdog", watchdog{})
+}